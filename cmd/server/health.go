@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// healthCheck is one dependency reported by name in the /health response
+type healthCheck struct {
+	name  string
+	check func() bool
+}
+
+// diskFreeFunc returns the bytes available on the volume holding path
+type diskFreeFunc func(path string) (uint64, error)
+
+// defaultHealthChecks checks the database and Slack, that the work directory's volume
+// has room for new worktrees, and that the claude binary can be found
+func (s *Server) defaultHealthChecks() []healthCheck {
+	checks := []healthCheck{
+		{name: "database", check: s.checkDatabase},
+		{name: "slack", check: s.checkSlackConnection},
+		{name: "disk", check: diskSpaceCheck(s.config.Session.WorkDir, uint64(s.config.Session.MinFreeDiskMB)<<20, freeDiskSpace)},
+	}
+	// Without the startup check the binary is expected to be missing, as in development
+	if !s.config.Session.SkipBinaryCheck {
+		checks = append(checks, healthCheck{name: "claude", check: binaryCheck(s.config.Session.ClaudeCodePath, exec.LookPath)})
+	}
+	return checks
+}
+
+// livenessHandler serves /livez, the liveness probe. It reports only that the process is
+// up and serving, without checking any dependency, so an outage of the database or Slack
+// doesn't get the pod restarted when a restart wouldn't fix it.
+func (s *Server) livenessHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alive":     true,
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// healthCheckHandler serves /readyz, the readiness probe, and /health. It runs every
+// health check and returns 503 if any fails, so traffic is held back until the
+// dependencies are reachable again.
+func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]bool, len(s.healthChecks))
+	healthy := true
+	for _, c := range s.healthChecks {
+		ok := c.check()
+		checks[c.name] = ok
+		if !ok {
+			healthy = false
+		}
+	}
+
+	status := http.StatusOK
+	if !healthy {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"healthy":   healthy,
+		"checks":    checks,
+		"frozen":    s.sessionMgr.IsFrozen(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+func (s *Server) checkDatabase() bool {
+	return s.db.Ping() == nil
+}
+
+func (s *Server) checkSlackConnection() bool {
+	_, err := s.slackClient.AuthTest()
+	return err == nil
+}
+
+// diskSpaceCheck fails when the volume holding dir has less than minFree bytes
+// available. The directory itself may not exist until the first session starts, so
+// the nearest existing parent is measured instead.
+func diskSpaceCheck(dir string, minFree uint64, diskFree diskFreeFunc) func() bool {
+	return func() bool {
+		if minFree == 0 {
+			return true
+		}
+		path, err := existingParent(dir)
+		if err != nil {
+			return false
+		}
+		free, err := diskFree(path)
+		return err == nil && free >= minFree
+	}
+}
+
+// binaryCheck fails when name can't be resolved to an executable
+func binaryCheck(name string, lookPath func(string) (string, error)) func() bool {
+	return func() bool {
+		_, err := lookPath(name)
+		return err == nil
+	}
+}
+
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
+
+// existingParent returns dir, or its nearest ancestor that exists
+func existingParent(dir string) (string, error) {
+	path, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", os.ErrNotExist
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/internal/session"
+)
+
+func TestDiskSpaceCheck(t *testing.T) {
+	workDir := t.TempDir()
+	const minFree = 100 << 20
+
+	tests := []struct {
+		name     string
+		dir      string
+		minFree  uint64
+		diskFree diskFreeFunc
+		want     bool
+	}{
+		{name: "enough space", dir: workDir, minFree: minFree, diskFree: fakeDiskFree(200<<20, nil), want: true},
+		{name: "below threshold", dir: workDir, minFree: minFree, diskFree: fakeDiskFree(50<<20, nil), want: false},
+		{name: "usage error", dir: workDir, minFree: minFree, diskFree: fakeDiskFree(0, errors.New("statfs failed")), want: false},
+		{name: "disabled", dir: workDir, minFree: 0, diskFree: fakeDiskFree(0, nil), want: true},
+		{name: "work dir not created yet", dir: filepath.Join(workDir, "sessions"), minFree: minFree, diskFree: fakeDiskFree(200<<20, nil), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diskSpaceCheck(tt.dir, tt.minFree, tt.diskFree)(); got != tt.want {
+				t.Errorf("diskSpaceCheck() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("measures the nearest existing directory", func(t *testing.T) {
+		var measured string
+		check := diskSpaceCheck(filepath.Join(workDir, "sessions", "worktrees"), minFree, func(path string) (uint64, error) {
+			measured = path
+			return 200 << 20, nil
+		})
+		check()
+		if measured != workDir {
+			t.Errorf("measured %q, want %q", measured, workDir)
+		}
+	})
+}
+
+func TestBinaryCheck(t *testing.T) {
+	found := func(name string) (string, error) { return "/usr/local/bin/" + name, nil }
+	missing := func(name string) (string, error) { return "", errors.New("executable file not found in $PATH") }
+
+	if !binaryCheck("claude", found)() {
+		t.Error("binaryCheck() = false for a resolvable binary")
+	}
+	if binaryCheck("claude", missing)() {
+		t.Error("binaryCheck() = true for a missing binary")
+	}
+}
+
+func TestHealthCheckHandler(t *testing.T) {
+	passing := func() bool { return true }
+
+	tests := []struct {
+		name       string
+		checks     []healthCheck
+		wantStatus int
+		wantChecks map[string]bool
+	}{
+		{
+			name: "healthy",
+			checks: []healthCheck{
+				{name: "database", check: passing},
+				{name: "disk", check: diskSpaceCheck(t.TempDir(), 1<<30, fakeDiskFree(2<<30, nil))},
+				{name: "claude", check: passing},
+			},
+			wantStatus: http.StatusOK,
+			wantChecks: map[string]bool{"database": true, "disk": true, "claude": true},
+		},
+		{
+			name: "disk full",
+			checks: []healthCheck{
+				{name: "database", check: passing},
+				{name: "disk", check: diskSpaceCheck(t.TempDir(), 1<<30, fakeDiskFree(10<<20, nil))},
+				{name: "claude", check: passing},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]bool{"database": true, "disk": false, "claude": true},
+		},
+		{
+			name: "claude missing",
+			checks: []healthCheck{
+				{name: "database", check: passing},
+				{name: "claude", check: binaryCheck("claude", func(string) (string, error) { return "", errors.New("not found") })},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantChecks: map[string]bool{"database": true, "claude": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.healthChecks = tt.checks
+
+			rec := httptest.NewRecorder()
+			s.healthCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var body struct {
+				Healthy bool            `json:"healthy"`
+				Checks  map[string]bool `json:"checks"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if body.Healthy != (tt.wantStatus == http.StatusOK) {
+				t.Errorf("healthy = %v, want %v", body.Healthy, tt.wantStatus == http.StatusOK)
+			}
+			for name, want := range tt.wantChecks {
+				if got, ok := body.Checks[name]; !ok || got != want {
+					t.Errorf("checks[%q] = %v (present %v), want %v", name, got, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLivenessHandler(t *testing.T) {
+	s := newTestServer(t)
+	s.healthChecks = []healthCheck{
+		{name: "database", check: func() bool { return false }},
+		{name: "slack", check: func() bool { return false }},
+	}
+
+	// Readiness reflects the failing database
+	rec := httptest.NewRecorder()
+	s.healthCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	// Liveness doesn't
+	rec = httptest.NewRecorder()
+	s.livenessHandler(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/livez status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func fakeDiskFree(free uint64, err error) diskFreeFunc {
+	return func(string) (uint64, error) { return free, err }
+}
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Session.WorkDir = t.TempDir()
+	return &Server{config: cfg, sessionMgr: session.NewManager(nil, cfg)}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -16,9 +17,15 @@ import (
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 
+	"github.com/pbdeuchler/claude-bot/internal/api"
 	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
 	"github.com/pbdeuchler/claude-bot/internal/db"
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/internal/metrics"
+	"github.com/pbdeuchler/claude-bot/internal/oauth"
 	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/internal/share"
 	slackHandler "github.com/pbdeuchler/claude-bot/internal/slack"
 )
 
@@ -28,30 +35,71 @@ type Server struct {
 	sessionMgr   *session.Manager
 	slackClient  *slack.Client
 	eventHandler *slackHandler.EventHandler
+	shareSigner  *share.Signer        // nil when the read-only API is disabled
+	githubOAuth  *oauth.GitHubHandler // nil when GitHub OAuth isn't configured
+	healthChecks []healthCheck
 	server       *http.Server
 }
 
 func main() {
-	log.Println("Starting Claude Bot service...")
+	rotateKey := flag.Bool("rotate-key", false, "re-encrypt stored credentials from ENCRYPTION_KEY to NEW_ENCRYPTION_KEY, then exit")
+	flag.Parse()
 
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if *rotateKey {
+		if err := rotateEncryptionKey(cfg); err != nil {
+			log.Fatalf("Failed to rotate encryption key: %v", err)
+		}
+		return
+	}
+	if err := cfg.CheckBinaries(); err != nil {
+		log.Fatalf("Failed to find required binaries: %v", err)
+	}
+
+	logging.InitGlobalLogger(cfg.Monitoring.LogLevel, cfg.Monitoring.LogFormat)
+	logging.Info("Starting Claude Bot service")
+
+	// Initialize credential encryption
+	encryptor, err := crypto.NewEncryptor(cfg.Database.EncryptionKey)
+	if err != nil {
+		log.Fatalf("Failed to initialize encryption: %v", err)
+	}
 
 	// Initialize database
-	database, err := db.NewDB(cfg.Database.Path)
+	database, err := db.Open(cfg.Database.Driver, cfg.DatabaseDSN(), encryptor)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer database.Close()
+	database.SetMaxConnections(cfg.Database.MaxConnections)
 
 	// Initialize session manager
 	sessionMgr := session.NewManager(database, cfg)
 
+	// Sessions detached by the last shutdown carry on where they left off
+	if _, err := sessionMgr.ResumeDetachedSessions(context.Background()); err != nil {
+		log.Fatalf("Failed to resume detached sessions: %v", err)
+	}
+
+	// Initialize metrics, starting from the sessions left active by the last run
+	appMetrics := metrics.NewMetrics()
+	activeSessions, err := database.GetAllActiveSessions(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to count active sessions: %v", err)
+	}
+	appMetrics.SetActiveSessions(len(activeSessions))
+	sessionMgr.SetMetrics(appMetrics)
+
 	// Initialize Slack client
-	slackClient := slack.New(cfg.Slack.BotToken)
+	var slackOptions []slack.Option
+	if cfg.Slack.Mode == config.SlackModeSocket {
+		slackOptions = append(slackOptions, slack.OptionAppLevelToken(cfg.Slack.AppToken))
+	}
+	slackClient := slack.New(cfg.Slack.BotToken, slackOptions...)
 
 	// Get bot user ID
 	authResp, err := slackClient.AuthTest()
@@ -60,8 +108,48 @@ func main() {
 	}
 	botUserID := authResp.UserID
 
+	// Cross-post budget alerts to a dedicated channel when configured
+	if cfg.Budget.AlertChannelID != "" {
+		alertChannelID := cfg.Budget.AlertChannelID
+		sessionMgr.SetAlertCallback(func(message string) {
+			if _, _, err := slackClient.PostMessage(alertChannelID, slack.MsgOptionText(message, false)); err != nil {
+				logging.Error("Failed to post budget alert", "channel_id", alertChannelID, "error", err)
+			}
+		})
+	}
+
+	sessionMgr.SetThreadCallback(func(channelID, threadTS, message string) {
+		if _, _, err := slackClient.PostMessage(channelID, slack.MsgOptionText(message, false), slack.MsgOptionTS(threadTS)); err != nil {
+			logging.Error("Failed to post to thread", "channel_id", channelID, "thread_ts", threadTS, "error", err)
+		}
+	})
+
 	// Initialize event handler
 	eventHandler := slackHandler.NewEventHandler(slackClient, sessionMgr, botUserID, cfg.Slack.SigningSecret)
+	eventHandler.SetAdminUserIDs(cfg.Slack.AdminUserIDs)
+	eventHandler.SetMaxMessagesPerTurn(cfg.Slack.MaxMessagesPerTurn)
+	eventHandler.SetCostNotifications(cfg.Slack.NotifyCost)
+	eventHandler.SetMetrics(appMetrics)
+
+	// Share links are signed with a key derived from the encryption key
+	var shareSigner *share.Signer
+	if cfg.API.ReadOnlyEnabled {
+		shareSigner = share.NewSigner(cfg.Database.EncryptionKey)
+		eventHandler.SetShareLinks(shareSigner, cfg.API.PublicURL, time.Duration(cfg.API.ShareLinkTTL)*time.Second)
+	}
+
+	// Users can connect their GitHub accounts rather than paste tokens into Slack
+	var githubOAuth *oauth.GitHubHandler
+	if cfg.GitHub.OAuthClientID != "" {
+		stateSigner := oauth.NewStateSigner(cfg.Database.EncryptionKey)
+		githubOAuth = oauth.NewGitHubHandler(oauth.GitHubConfig{
+			ClientID:     cfg.GitHub.OAuthClientID,
+			ClientSecret: cfg.GitHub.OAuthClientSecret,
+			OAuthURL:     cfg.GitHub.OAuthURL,
+			PublicURL:    cfg.API.PublicURL,
+		}, stateSigner, sessionMgr)
+		eventHandler.SetGitHubConnect(stateSigner, cfg.API.PublicURL)
+	}
 
 	// Create server
 	server := &Server{
@@ -70,26 +158,102 @@ func main() {
 		sessionMgr:   sessionMgr,
 		slackClient:  slackClient,
 		eventHandler: eventHandler,
+		shareSigner:  shareSigner,
+		githubOAuth:  githubOAuth,
+	}
+	server.healthChecks = server.defaultHealthChecks()
+
+	// Remove worktrees left behind by sessions that ended while the server was down
+	if cfg.Session.CleanupOrphans {
+		if _, err := sessionMgr.ReconcileWorktrees(context.Background()); err != nil {
+			logging.Error("Failed to clean up orphaned worktrees", "error", err)
+		}
 	}
 
 	// Start idle session monitor
 	go sessionMgr.StartIdleSessionMonitor(context.Background())
 
+	// Start stale mirror repo cleanup
+	go sessionMgr.StartMirrorSweeper(context.Background())
+
 	// Start server
 	if err := server.Start(); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
 
+// rotateEncryptionKey re-encrypts the stored credentials from the configured key to
+// NEW_ENCRYPTION_KEY. Credentials that don't decrypt with the configured key are listed
+// and make it fail, though the others are still rotated.
+func rotateEncryptionKey(cfg *config.Config) error {
+	newKey := os.Getenv("NEW_ENCRYPTION_KEY")
+	if err := crypto.ValidateKey(newKey); err != nil {
+		return fmt.Errorf("invalid NEW_ENCRYPTION_KEY: %w", err)
+	}
+
+	encryptor, err := crypto.NewEncryptor(cfg.Database.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	database, err := db.Open(cfg.Database.Driver, cfg.DatabaseDSN(), encryptor)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	result, err := database.RotateCredentials(context.Background(), cfg.Database.EncryptionKey, newKey)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rotated %d credentials\n", result.Rotated)
+	for _, failure := range result.Failed {
+		fmt.Printf("Could not decrypt the %s credential of user %d: %v\n", failure.CredentialType, failure.UserID, failure.Err)
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d credentials could not be decrypted with ENCRYPTION_KEY and were left unchanged", len(result.Failed))
+	}
+	fmt.Println("Set ENCRYPTION_KEY to the new key before restarting the service")
+	return nil
+}
+
 func (s *Server) Start() error {
 	// Create HTTP router
 	mux := http.NewServeMux()
 
-	// Health check endpoint
+	// Liveness and readiness probes; /health is kept for existing monitors
+	mux.HandleFunc("/livez", s.livenessHandler)
+	mux.HandleFunc("/readyz", s.healthCheckHandler)
 	mux.HandleFunc("/health", s.healthCheckHandler)
 
-	// Slack events endpoint
-	mux.HandleFunc("/slack/events", s.slackEventsHandler)
+	// Slack events endpoint, or a Socket Mode connection in its place
+	socketCtx, stopSocketMode := context.WithCancel(context.Background())
+	defer stopSocketMode()
+	if s.config.Slack.Mode == config.SlackModeSocket {
+		runner := slackHandler.NewSocketModeRunner(s.slackClient, s.eventHandler, s.config.Slack.UseEnterpriseID)
+		go func() {
+			if err := runner.Run(socketCtx); err != nil && socketCtx.Err() == nil {
+				log.Fatalf("Socket Mode connection failed: %v", err)
+			}
+		}()
+	} else {
+		mux.HandleFunc("/slack/events", s.slackEventsHandler)
+	}
+
+	// Read-only session views for share links (if enabled)
+	if s.shareSigner != nil {
+		share.NewHandler(s.shareSigner, s.sessionMgr).Register(mux)
+	}
+
+	// Session API for scripts (if enabled)
+	if s.config.API.Enabled {
+		api.NewHandler(s.config.API.Token, s.sessionMgr).Register(mux)
+	}
+
+	// GitHub OAuth flow for connecting accounts (if configured)
+	if s.githubOAuth != nil {
+		s.githubOAuth.Register(mux)
+	}
 
 	// Metrics endpoint (if enabled)
 	if s.config.Monitoring.MetricsEnabled {
@@ -106,7 +270,7 @@ func (s *Server) Start() error {
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Server starting on port %d", s.config.Server.Port)
+		logging.Info("Server starting", "port", s.config.Server.Port)
 		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
@@ -117,76 +281,65 @@ func (s *Server) Start() error {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("Shutting down server...")
+	logging.Info("Shutting down server")
+	stopSocketMode()
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// End all active sessions
-	if err := s.sessionMgr.EndAllActiveSessions(ctx); err != nil {
-		log.Printf("Error ending sessions during shutdown: %v", err)
+	// End all active sessions, or detach them to be resumed by the next start
+	if s.config.Server.ShutdownMode == config.ShutdownModeDetach {
+		if err := s.sessionMgr.DetachAllActiveSessions(ctx); err != nil {
+			logging.Error("Failed to detach sessions during shutdown", "error", err)
+		}
+	} else if err := s.sessionMgr.EndAllActiveSessions(ctx); err != nil {
+		logging.Error("Failed to end sessions during shutdown", "error", err)
 	}
 
 	// Shutdown HTTP server
 	return s.server.Shutdown(ctx)
 }
 
-func (s *Server) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	checks := map[string]bool{
-		"database": s.checkDatabase(),
-		"slack":    s.checkSlackConnection(),
-	}
-
-	healthy := true
-	for _, ok := range checks {
-		if !ok {
-			healthy = false
-			break
-		}
-	}
-
-	status := http.StatusOK
-	if !healthy {
-		status = http.StatusServiceUnavailable
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"healthy": healthy,
-		"checks":  checks,
-		"timestamp": time.Now().Unix(),
-	})
-}
-
-func (s *Server) checkDatabase() bool {
-	return s.db.Ping() == nil
-}
-
-func (s *Server) checkSlackConnection() bool {
-	_, err := s.slackClient.AuthTest()
-	return err == nil
-}
-
 func (s *Server) slackEventsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
+	// Every log line and error message for this event carries its request ID
+	requestID := logging.NewRequestID()
+	ctx := logging.WithRequestID(context.Background(), requestID)
+	w.Header().Set("X-Request-ID", requestID)
+
+	// A retry means Slack didn't see the first delivery acknowledged in time, though it
+	// is still being handled; handling it again would repeat the command
+	if retryNum := r.Header.Get("X-Slack-Retry-Num"); retryNum != "" {
+		logging.InfoCtx(ctx, "Ignoring Slack retry", "retry", retryNum, "reason", r.Header.Get("X-Slack-Retry-Reason"))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
 	// Read body
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		log.Printf("Failed to read request body: %v", err)
+		logging.WarnCtx(ctx, "Failed to read request body", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	// Only Slack knows the signing secret, so an unsigned request could claim to be
+	// from any user, including an admin
+	if err := s.eventHandler.VerifyRequest(r.Header, body); err != nil {
+		logging.WarnCtx(ctx, "Rejecting Slack event", "error", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
 	// Parse event
 	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
 	if err != nil {
-		log.Printf("Failed to parse Slack event: %v", err)
+		logging.WarnCtx(ctx, "Failed to parse Slack event", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -195,7 +348,7 @@ func (s *Server) slackEventsHandler(w http.ResponseWriter, r *http.Request) {
 	if event.Type == slackevents.URLVerification {
 		var challenge *slackevents.ChallengeResponse
 		if err := json.Unmarshal(body, &challenge); err != nil {
-			log.Printf("Failed to unmarshal challenge: %v", err)
+			logging.WarnCtx(ctx, "Failed to unmarshal challenge", "error", err)
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -205,21 +358,8 @@ func (s *Server) slackEventsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle callback events
-	if event.Type == slackevents.CallbackEvent {
-		ctx := context.Background()
-		
-		switch evData := event.InnerEvent.Data.(type) {
-		case *slackevents.AppMentionEvent:
-			if err := s.eventHandler.HandleAppMention(ctx, evData); err != nil {
-				log.Printf("Failed to handle app mention: %v", err)
-			}
-		case *slackevents.MessageEvent:
-			if err := s.eventHandler.HandleMessage(ctx, evData); err != nil {
-				log.Printf("Failed to handle message: %v", err)
-			}
-		default:
-			log.Printf("Unhandled event type: %T", evData)
-		}
+	if err := s.eventHandler.HandleEventsAPIEvent(ctx, event, s.config.Slack.UseEnterpriseID); err != nil {
+		logging.ErrorCtx(ctx, "Failed to handle Slack event", "error", err)
 	}
 
 	w.WriteHeader(http.StatusOK)
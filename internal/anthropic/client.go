@@ -0,0 +1,68 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the base URL of the Anthropic API
+const DefaultAPIURL = "https://api.anthropic.com"
+
+// apiVersion is the Anthropic API version requests are made against
+const apiVersion = "2023-06-01"
+
+// ErrInvalidKey is returned when the Anthropic API rejects an API key
+var ErrInvalidKey = errors.New("Anthropic API key is invalid")
+
+// Client calls the Anthropic API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates an Anthropic API client. An empty baseURL uses DefaultAPIURL and a
+// nil httpClient a client with a 30 second timeout.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// VerifyKey checks that the API key is accepted by listing a single model, which
+// costs nothing
+func (c *Client) VerifyKey(ctx context.Context, apiKey string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/v1/models?limit=1", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("x-api-key", apiKey)
+	req.Header.Set("anthropic-version", apiVersion)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call Anthropic API: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrInvalidKey
+	default:
+		return fmt.Errorf("Anthropic API returned %d", resp.StatusCode)
+	}
+}
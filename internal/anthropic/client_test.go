@@ -0,0 +1,67 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantErr    error
+		wantSubstr string
+	}{
+		{name: "accepted", status: http.StatusOK},
+		{name: "rejected", status: http.StatusUnauthorized, wantErr: ErrInvalidKey},
+		{name: "forbidden", status: http.StatusForbidden, wantErr: ErrInvalidKey},
+		{name: "overloaded", status: 529, wantSubstr: "returned 529"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotKey, gotVersion string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.Method + " " + r.URL.Path
+				gotKey = r.Header.Get("x-api-key")
+				gotVersion = r.Header.Get("anthropic-version")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			err := NewClient(server.URL, server.Client()).VerifyKey(context.Background(), "sk-ant-test")
+			if gotPath != "GET /v1/models" || gotKey != "sk-ant-test" || gotVersion == "" {
+				t.Errorf("request = %q with key %q and version %q, want GET /v1/models with the key", gotPath, gotKey, gotVersion)
+			}
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyKey() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantSubstr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantSubstr) {
+					t.Errorf("VerifyKey() error = %v, want it to contain %q", err, tt.wantSubstr)
+				}
+			default:
+				if err != nil {
+					t.Errorf("VerifyKey() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyKeyNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	err := NewClient(server.URL, nil).VerifyKey(context.Background(), "sk-ant-test")
+	if err == nil || errors.Is(err, ErrInvalidKey) {
+		t.Errorf("VerifyKey() error = %v, want a network error", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Package api serves a JSON API for listing and controlling sessions from scripts, under
+// /api/v1/. Every request must carry the configured token as a bearer token.
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/internal/repo"
+	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// SessionController looks up, stops and follows the output of sessions
+type SessionController interface {
+	GetAllActiveSessions(ctx context.Context) ([]*models.Session, error)
+	GetSessionByID(ctx context.Context, id int64) (*models.Session, error)
+	EndSession(ctx context.Context, sessionID, commitMsg string) error
+	SubscribeOutput(sessionID int64) (<-chan session.OutputLine, func())
+}
+
+// SessionView is a session as the API returns it. It leaves out the work tree path and
+// the Claude session ID.
+type SessionView struct {
+	ID             int64      `json:"id"`
+	Feature        string     `json:"feature"`
+	RepoURL        string     `json:"repo_url"`
+	Model          string     `json:"model"`
+	Status         string     `json:"status"`
+	RunningCost    float64    `json:"running_cost"`
+	SlackChannelID string     `json:"slack_channel_id"`
+	SlackThreadTS  string     `json:"slack_thread_ts"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EndedAt        *time.Time `json:"ended_at"`
+}
+
+// errorBody is the body of every error response; Code is a models.ErrCode* value
+type errorBody struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// Handler serves the session API
+type Handler struct {
+	token    string
+	sessions SessionController
+}
+
+// NewHandler creates a handler accepting requests that carry token
+func NewHandler(token string, sessions SessionController) *Handler {
+	return &Handler{token: token, sessions: sessions}
+}
+
+// Register adds the API's routes to mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("GET /api/v1/sessions", h.authorized(h.listSessions))
+	mux.Handle("GET /api/v1/sessions/{id}", h.authorized(h.getSession))
+	mux.Handle("POST /api/v1/sessions/{id}/stop", h.authorized(h.stopSession))
+	mux.Handle("GET /api/v1/sessions/{id}/stream", h.authorizedStream(h.streamSession))
+}
+
+// authorized rejects requests without the API token
+func (h *Handler) authorized(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !h.validToken(token) {
+			writeJSON(w, http.StatusUnauthorized, errorBody{Code: models.ErrCodeUnauthorized, Error: "missing or invalid API token"})
+			return
+		}
+		next(w, r)
+	})
+}
+
+// authorizedStream is authorized for the stream route, which also accepts the token as
+// the access_token query parameter since browsers can't set headers on a WebSocket
+func (h *Handler) authorizedStream(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			if !h.validToken(token) {
+				writeJSON(w, http.StatusUnauthorized, errorBody{Code: models.ErrCodeUnauthorized, Error: "missing or invalid API token"})
+				return
+			}
+			next(w, r)
+			return
+		}
+		h.authorized(next).ServeHTTP(w, r)
+	})
+}
+
+func (h *Handler) validToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func (h *Handler) listSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := h.sessions.GetAllActiveSessions(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	views := make([]SessionView, 0, len(sessions))
+	for _, session := range sessions {
+		views = append(views, newSessionView(session))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"sessions": views})
+}
+
+func (h *Handler) getSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.lookupSession(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, newSessionView(session))
+}
+
+// stopSession ends a session as the stop command does, committing and pushing its
+// changes. The optional JSON body's "message" is the commit message.
+func (h *Handler) stopSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.lookupSession(w, r)
+	if !ok {
+		return
+	}
+	if session.Status != models.SessionStatusActive {
+		writeJSON(w, http.StatusConflict, errorBody{Code: models.ErrCodeSessionNotFound, Error: "session is not active"})
+		return
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody{Code: models.ErrCodeInvalidCommand, Error: "invalid JSON body"})
+			return
+		}
+	}
+
+	ctx := logging.WithSessionID(r.Context(), session.SessionID)
+	logging.InfoCtx(ctx, "Stopping session from the API", "branch", session.BranchName)
+	if err := h.sessions.EndSession(context.WithoutCancel(ctx), session.SessionID, body.Message); err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	// Return the session as it is now it has ended
+	stopped, err := h.sessions.GetSessionByID(r.Context(), session.ID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newSessionView(stopped))
+}
+
+// lookupSession finds the session named by the request's path, writing the error
+// response if there isn't one
+func (h *Handler) lookupSession(w http.ResponseWriter, r *http.Request) (*models.Session, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Code: models.ErrCodeInvalidCommand, Error: "session ID must be a number"})
+		return nil, false
+	}
+
+	session, err := h.sessions.GetSessionByID(r.Context(), id)
+	if err != nil {
+		writeError(w, r, err)
+		return nil, false
+	}
+	return session, true
+}
+
+func newSessionView(session *models.Session) SessionView {
+	return SessionView{
+		ID:             session.ID,
+		Feature:        session.BranchName,
+		RepoURL:        session.RepoURL,
+		Model:          session.ModelName,
+		Status:         session.Status,
+		RunningCost:    session.RunningCost,
+		SlackChannelID: session.SlackChannelID,
+		SlackThreadTS:  session.SlackThreadTS,
+		CreatedAt:      session.CreatedAt,
+		EndedAt:        session.EndedAt,
+	}
+}
+
+// writeError writes the response for err, with a status derived from its CBError code.
+// Errors without a code are internal; their details are only logged.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var cbErr *models.CBError
+	if !errors.As(err, &cbErr) {
+		logging.ErrorCtx(r.Context(), "API request failed", "path", r.URL.Path, "error", err)
+		writeJSON(w, http.StatusInternalServerError, errorBody{Code: "INTERNAL", Error: "internal error"})
+		return
+	}
+
+	status := http.StatusInternalServerError
+	switch cbErr.Code {
+	case models.ErrCodeSessionNotFound:
+		status = http.StatusNotFound
+	case models.ErrCodeInvalidCommand:
+		status = http.StatusBadRequest
+	case models.ErrCodeUnauthorized:
+		status = http.StatusForbidden
+	case models.ErrCodeSessionExists:
+		status = http.StatusConflict
+	case models.ErrCodeRateLimited, models.ErrCodeQuotaExceeded:
+		status = http.StatusTooManyRequests
+	case models.ErrCodeSpendFrozen, models.ErrCodeClaudeUnavailable:
+		status = http.StatusServiceUnavailable
+	case models.ErrCodeRepoAccess:
+		// The session is still active, to be stopped again once the branch is merged
+		if errors.Is(err, repo.ErrPushRejected) {
+			status = http.StatusConflict
+		}
+	}
+	if status == http.StatusInternalServerError {
+		logging.ErrorCtx(r.Context(), "API request failed", "path", r.URL.Path, "error", err)
+	}
+	writeJSON(w, status, errorBody{Code: cbErr.Code, Error: cbErr.Message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.Error("Failed to write API response", "error", err)
+	}
+}
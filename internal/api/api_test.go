@@ -0,0 +1,237 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+const testToken = "test-api-token-that-is-32-chars-long"
+
+// fakeSessions holds sessions by database ID
+type fakeSessions struct {
+	sessions map[int64]*models.Session
+	stopped  map[string]string // commit messages of stopped sessions, by Claude session ID
+	output   *session.OutputBroker
+}
+
+func (f *fakeSessions) GetAllActiveSessions(ctx context.Context) ([]*models.Session, error) {
+	var active []*models.Session
+	for _, session := range f.sessions {
+		if session.Status == models.SessionStatusActive {
+			active = append(active, session)
+		}
+	}
+	return active, nil
+}
+
+func (f *fakeSessions) GetSessionByID(ctx context.Context, id int64) (*models.Session, error) {
+	session, ok := f.sessions[id]
+	if !ok {
+		return nil, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", nil)
+	}
+	return session, nil
+}
+
+func (f *fakeSessions) EndSession(ctx context.Context, sessionID, commitMsg string) error {
+	for _, session := range f.sessions {
+		if session.SessionID == sessionID {
+			session.Status = models.SessionStatusEnded
+			f.stopped[sessionID] = commitMsg
+			return nil
+		}
+	}
+	return models.NewCBError(models.ErrCodeSessionNotFound, "session not found", nil)
+}
+
+func (f *fakeSessions) SubscribeOutput(sessionID int64) (<-chan session.OutputLine, func()) {
+	return f.output.Subscribe(sessionID)
+}
+
+func newTestAPI(t *testing.T) (http.Handler, *fakeSessions) {
+	t.Helper()
+
+	sessions := &fakeSessions{
+		sessions: map[int64]*models.Session{
+			1: {ID: 1, SessionID: "claude-active", BranchName: "active-feature", WorkTreePath: "/work/active",
+				Status: models.SessionStatusActive, CreatedAt: time.Now()},
+			2: {ID: 2, SessionID: "claude-ended", BranchName: "ended-feature", WorkTreePath: "/work/ended",
+				Status: models.SessionStatusEnded, CreatedAt: time.Now()},
+		},
+		stopped: make(map[string]string),
+		output:  session.NewOutputBroker(),
+	}
+	mux := http.NewServeMux()
+	NewHandler(testToken, sessions).Register(mux)
+	return mux, sessions
+}
+
+func TestAPIRequiresToken(t *testing.T) {
+	handler, sessions := newTestAPI(t)
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{name: "no token", header: ""},
+		{name: "wrong token", header: "Bearer not-the-token"},
+		{name: "not a bearer token", header: testToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, req := range []*http.Request{
+				httptest.NewRequest(http.MethodGet, "/api/v1/sessions", nil),
+				httptest.NewRequest(http.MethodPost, "/api/v1/sessions/1/stop", nil),
+				httptest.NewRequest(http.MethodGet, "/api/v1/sessions/1/stream", nil),
+				httptest.NewRequest(http.MethodGet, "/api/v1/sessions/1/stream?access_token=not-the-token", nil),
+			} {
+				if tt.header != "" {
+					req.Header.Set("Authorization", tt.header)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusUnauthorized {
+					t.Errorf("%s %s status = %d, want %d", req.Method, req.URL.Path, rec.Code, http.StatusUnauthorized)
+				}
+				var body errorBody
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != models.ErrCodeUnauthorized {
+					t.Errorf("body = %s, want an %s error", rec.Body.String(), models.ErrCodeUnauthorized)
+				}
+			}
+		})
+	}
+
+	if len(sessions.stopped) != 0 {
+		t.Errorf("stopped sessions %v without a token", sessions.stopped)
+	}
+}
+
+func TestAPISessions(t *testing.T) {
+	handler, sessions := newTestAPI(t)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodGet, "/api/v1/sessions", "")
+	var list struct {
+		Sessions []SessionView `json:"sessions"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("list = %d %s, want the sessions", rec.Code, rec.Body.String())
+	}
+	if len(list.Sessions) != 1 || list.Sessions[0].Feature != "active-feature" {
+		t.Errorf("listed sessions = %+v, want only the active one", list.Sessions)
+	}
+	if strings.Contains(rec.Body.String(), "/work/active") || strings.Contains(rec.Body.String(), "claude-active") {
+		t.Errorf("list exposes internal details: %s", rec.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "get", method: http.MethodGet, path: "/api/v1/sessions/2", wantStatus: http.StatusOK},
+		{name: "get missing", method: http.MethodGet, path: "/api/v1/sessions/99", wantStatus: http.StatusNotFound, wantCode: models.ErrCodeSessionNotFound},
+		{name: "get bad ID", method: http.MethodGet, path: "/api/v1/sessions/abc", wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidCommand},
+		{name: "stop ended", method: http.MethodPost, path: "/api/v1/sessions/2/stop", wantStatus: http.StatusConflict, wantCode: models.ErrCodeSessionNotFound},
+		{name: "stop bad body", method: http.MethodPost, path: "/api/v1/sessions/1/stop", body: "{", wantStatus: http.StatusBadRequest, wantCode: models.ErrCodeInvalidCommand},
+		{name: "stop", method: http.MethodPost, path: "/api/v1/sessions/1/stop", body: `{"message":"Finish up"}`, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.path, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantCode != "" {
+				var body errorBody
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode {
+					t.Errorf("body = %s, want code %s", rec.Body.String(), tt.wantCode)
+				}
+			}
+		})
+	}
+
+	if got, ok := sessions.stopped["claude-active"]; !ok || got != "Finish up" {
+		t.Errorf("stopped = %v, want the active session stopped with its message", sessions.stopped)
+	}
+	if sessions.sessions[1].Status != models.SessionStatusEnded {
+		t.Errorf("session status = %s, want ended", sessions.sessions[1].Status)
+	}
+}
+
+func TestAPIStream(t *testing.T) {
+	handler, sessions := newTestAPI(t)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	streamURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/sessions/"
+
+	header := http.Header{"Authorization": {"Bearer " + testToken}}
+	if _, resp, err := websocket.DefaultDialer.Dial(streamURL+"2/stream", header); err == nil || resp.StatusCode != http.StatusConflict {
+		t.Errorf("streaming an ended session: err %v, want status %d", err, http.StatusConflict)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(streamURL+"1/stream", header)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	// A browser client passes the token in the URL instead
+	queryConn, _, err := websocket.DefaultDialer.Dial(streamURL+"1/stream?access_token="+testToken, nil)
+	if err != nil {
+		t.Fatalf("Dial() with access_token error = %v", err)
+	}
+	defer queryConn.Close()
+
+	// Output of other sessions isn't streamed
+	sessions.output.Publish(2, "other session")
+	sessions.output.Publish(1, "> Add a login page")
+	sessions.output.Publish(1, "Created login.html")
+	sessions.output.Close(1)
+
+	for _, c := range []*websocket.Conn{conn, queryConn} {
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var frames []StreamFrame
+		for {
+			var frame StreamFrame
+			if err := c.ReadJSON(&frame); err != nil {
+				break
+			}
+			frames = append(frames, frame)
+		}
+
+		want := []StreamFrame{
+			{Type: "output", Line: "> Add a login page"},
+			{Type: "output", Line: "Created login.html"},
+			{Type: "end"},
+		}
+		if len(frames) != len(want) {
+			t.Fatalf("frames = %+v, want %+v", frames, want)
+		}
+		for i := range want {
+			if frames[i].Type != want[i].Type || frames[i].Line != want[i].Line || frames[i].Time.IsZero() {
+				t.Errorf("frame %d = %+v, want %+v", i, frames[i], want[i])
+			}
+		}
+	}
+}
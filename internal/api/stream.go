@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+const (
+	// streamWriteTimeout bounds each write to a stream client
+	streamWriteTimeout = 10 * time.Second
+	// streamPingInterval is how often idle stream connections are pinged
+	streamPingInterval = 30 * time.Second
+)
+
+// upgrader accepts WebSocket connections from any origin: they're authenticated by the
+// API token rather than cookies, so another site can't ride on a user's browser
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// StreamFrame is a message sent to stream clients. Type is "output" for a line of the
+// session's output, or "end" when the session has ended and the stream is closing.
+type StreamFrame struct {
+	Type string    `json:"type"`
+	Line string    `json:"line,omitempty"`
+	Time time.Time `json:"ts"`
+}
+
+// streamSession upgrades to a WebSocket sending the session's output as it happens, as
+// it's sent to its Slack thread
+func (h *Handler) streamSession(w http.ResponseWriter, r *http.Request) {
+	session, ok := h.lookupSession(w, r)
+	if !ok {
+		return
+	}
+	if session.Status != models.SessionStatusActive {
+		writeJSON(w, http.StatusConflict, errorBody{Code: models.ErrCodeSessionNotFound, Error: "session is not active"})
+		return
+	}
+
+	// Subscribe before upgrading so no output is missed once the client is connected
+	lines, unsubscribe := h.sessions.SubscribeOutput(session.ID)
+	defer unsubscribe()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written the error response
+		logging.WarnCtx(r.Context(), "Failed to upgrade session stream", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx := logging.WithSessionID(r.Context(), session.SessionID)
+	logging.InfoCtx(ctx, "Streaming session output", "branch", session.BranchName, "remote", r.RemoteAddr)
+
+	// Clients only listen, but reading is how a close from the client is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				h.writeFrame(conn, StreamFrame{Type: "end", Time: time.Now()})
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session ended"),
+					time.Now().Add(streamWriteTimeout))
+				return
+			}
+			if err := h.writeFrame(conn, StreamFrame{Type: "output", Line: line.Text, Time: line.Time}); err != nil {
+				logging.DebugCtx(ctx, "Session stream client went away", "error", err)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
+func (h *Handler) writeFrame(conn *websocket.Conn, frame StreamFrame) error {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return conn.WriteJSON(frame)
+}
@@ -2,42 +2,163 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 
 	"github.com/caarlos0/env/v10"
+	"gopkg.in/yaml.v3"
+
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
+	"github.com/pbdeuchler/claude-bot/internal/db"
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+)
+
+// Slack connection modes
+const (
+	// SlackModeEvents receives events over HTTP at /slack/events
+	SlackModeEvents = "events"
+	// SlackModeSocket receives events over a Socket Mode WebSocket, so no public endpoint is needed
+	SlackModeSocket = "socket"
+)
+
+// Shutdown modes
+const (
+	// ShutdownModeEnd ends every active session on shutdown, removing their work trees
+	ShutdownModeEnd = "end"
+	// ShutdownModeDetach pushes active sessions' work but keeps them to resume on the next start
+	ShutdownModeDetach = "detach"
 )
 
 type Config struct {
 	Server struct {
-		Port         int `env:"PORT" envDefault:"8080"`
-		ReadTimeout  int `env:"READ_TIMEOUT" envDefault:"30"`
-		WriteTimeout int `env:"WRITE_TIMEOUT" envDefault:"30"`
+		Port         int    `env:"PORT" envDefault:"8080"`
+		ReadTimeout  int    `env:"READ_TIMEOUT" envDefault:"30"`
+		WriteTimeout int    `env:"WRITE_TIMEOUT" envDefault:"30"`
+		ShutdownMode string `env:"SHUTDOWN_MODE" envDefault:"end"`
 	}
 
 	Database struct {
+		Driver         string `env:"DB_DRIVER" envDefault:"sqlite"`
 		Path           string `env:"DB_PATH" envDefault:"./cb.db"`
+		DSN            string `env:"DB_DSN"`
 		MaxConnections int    `env:"DB_MAX_CONN" envDefault:"10"`
+		EncryptionKey  string `env:"ENCRYPTION_KEY,required"`
 	}
 
 	Slack struct {
-		SigningSecret string `env:"SLACK_SIGNING_SECRET,required"`
-		BotToken      string `env:"SLACK_BOT_TOKEN,required"`
+		SigningSecret   string   `env:"SLACK_SIGNING_SECRET,required"`
+		BotToken        string   `env:"SLACK_BOT_TOKEN,required"`
+		UseEnterpriseID bool     `env:"USE_ENTERPRISE_ID" envDefault:"false"`
+		AdminUserIDs    []string `env:"ADMIN_SLACK_USER_IDS" envSeparator:","`
+		Mode            string   `env:"SLACK_MODE" envDefault:"events"`
+		AppToken        string   `env:"SLACK_APP_TOKEN"`
+
+		// MaxMessagesPerTurn caps the messages one Claude turn posts; 0 for no cap
+		MaxMessagesPerTurn int `env:"MAX_MESSAGES_PER_TURN" envDefault:"20"`
+
+		// NotifyCost keeps each session's running cost in a pinned message in its thread
+		NotifyCost bool `env:"NOTIFY_COST" envDefault:"false"`
 	}
 
 	Session struct {
 		WorkDir        string `env:"WORK_DIR" envDefault:"./sessions"`
 		MaxPerUser     int    `env:"MAX_SESSIONS_PER_USER" envDefault:"5"`
 		IdleTimeout    int    `env:"SESSION_IDLE_TIMEOUT" envDefault:"3600"`
+		IdleWarning    int    `env:"SESSION_IDLE_WARNING" envDefault:"600"`
+		IdleCheck      int    `env:"IDLE_CHECK_INTERVAL" envDefault:"300"`
+		IdleWorkers    int    `env:"IDLE_CLEANUP_WORKERS" envDefault:"4"`
+		MaxLifetime    int    `env:"MAX_SESSION_LIFETIME" envDefault:"0"`
 		ClaudeCodePath string `env:"CLAUDE_CODE_PATH" envDefault:"claude"`
+		CommandTimeout int    `env:"CLAUDE_COMMAND_TIMEOUT" envDefault:"1800"`
+		CreateLimit    int    `env:"SESSION_CREATE_LIMIT" envDefault:"0"`
+		CreateWindow   int    `env:"SESSION_CREATE_WINDOW" envDefault:"3600"`
+		MirrorTTL      int    `env:"MIRROR_TTL" envDefault:"0"`
+		MirrorSweep    int    `env:"MIRROR_SWEEP_INTERVAL" envDefault:"3600"`
+		CleanupOrphans bool   `env:"CLEANUP_ORPHANS_ON_START" envDefault:"false"`
+		MinFreeDiskMB  int    `env:"MIN_FREE_DISK_MB" envDefault:"1024"`
+		LogDir         string `env:"SESSION_LOG_DIR" envDefault:"./logs/sessions"`
+
+		// LogMessages records the messages sent to and from Claude for the history command.
+		// Off by default since it stores conversation content in the database.
+		LogMessages bool `env:"LOG_MESSAGES" envDefault:"false"`
+
+		// ProtectedBranches can't be used as feature names, so Claude never commits to them directly
+		ProtectedBranches []string `env:"PROTECTED_BRANCHES" envSeparator:"," envDefault:"main,master,develop"`
+
+		// SkipBinaryCheck starts the service without checking that claude and git are installed
+		SkipBinaryCheck bool `env:"SKIP_BINARY_CHECK" envDefault:"false"`
+	}
+
+	// Git configures access to remote repositories: limits on concurrent clones, fetches
+	// and pushes to stay under remote rate limits, and SSH authentication
+	Git struct {
+		HostConcurrency int `env:"GIT_HOST_CONCURRENCY" envDefault:"4"`
+		RepoConcurrency int `env:"GIT_REPO_CONCURRENCY" envDefault:"1"`
+
+		// SSHPrivateKeyPath is the key used to clone SSH repository URLs; without one
+		// only HTTPS URLs can be used
+		SSHPrivateKeyPath string `env:"SSH_PRIVATE_KEY_PATH"`
+	}
+
+	GitHub struct {
+		APIURL string `env:"GITHUB_API_URL" envDefault:"https://api.github.com"`
+
+		// OAuthClientID and OAuthClientSecret identify the GitHub OAuth app users connect
+		// their accounts through instead of pasting tokens; unset to disable connecting
+		OAuthClientID     string `env:"GITHUB_OAUTH_CLIENT_ID"`
+		OAuthClientSecret string `env:"GITHUB_OAUTH_CLIENT_SECRET"`
+		OAuthURL          string `env:"GITHUB_OAUTH_URL" envDefault:"https://github.com"`
+	}
+
+	Anthropic struct {
+		APIURL string `env:"ANTHROPIC_API_URL" envDefault:"https://api.anthropic.com"`
+	}
+
+	Credentials struct {
+		// VerifyOnSet checks credentials with Anthropic or GitHub before storing them
+		VerifyOnSet bool `env:"VERIFY_CREDENTIALS_ON_SET" envDefault:"false"`
+	}
+
+	Budget struct {
+		WarnThresholdUSD float64 `env:"COST_WARNING_THRESHOLD_USD" envDefault:"0"`
+		AlertChannelID   string  `env:"BUDGET_ALERT_CHANNEL_ID"`
+
+		// MaxSessionCostUSD stops any session whose cost reaches it; 0 for no limit.
+		// A session started with a lower --budget is stopped at that instead.
+		MaxSessionCostUSD float64 `env:"MAX_SESSION_COST_USD" envDefault:"0"`
+
+		// Frozen starts the service with all new Claude spend blocked (see the freeze command)
+		Frozen bool `env:"SPEND_FROZEN" envDefault:"false"`
+	}
+
+	// API serves read-only session views over HTTP for share links and, when enabled,
+	// the session API for scripts
+	API struct {
+		ReadOnlyEnabled bool   `env:"READONLY_API_ENABLED" envDefault:"false"`
+		PublicURL       string `env:"PUBLIC_URL"`
+		ShareLinkTTL    int    `env:"SHARE_LINK_TTL" envDefault:"86400"`
+
+		// Enabled serves the session API under /api/v1/, for requests bearing Token
+		Enabled bool   `env:"API_ENABLED" envDefault:"false"`
+		Token   string `env:"API_TOKEN"`
 	}
 
 	Monitoring struct {
 		MetricsEnabled bool   `env:"METRICS_ENABLED" envDefault:"true"`
 		MetricsPort    int    `env:"METRICS_PORT" envDefault:"9090"`
 		LogLevel       string `env:"LOG_LEVEL" envDefault:"info"`
+		LogFormat      string `env:"LOG_FORMAT" envDefault:"text"`
 	}
 }
 
+// Load reads the configuration from environment variables, on top of the file named
+// by CONFIG_FILE if it's set
 func Load() (*Config, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return LoadFromFile(path)
+	}
+
 	var cfg Config
 
 	if err := env.Parse(&cfg); err != nil {
@@ -51,11 +172,134 @@ func Load() (*Config, error) {
 	return &cfg, nil
 }
 
+// LoadFromFile reads the configuration from a YAML file mapping environment variable
+// names to values, such as "SLACK_MODE: socket". Lists may be YAML sequences. Environment
+// variables override the file, which overrides the defaults.
+func LoadFromFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	environment, err := parseConfigFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	for _, kv := range os.Environ() {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			environment[key] = value
+		}
+	}
+
+	var cfg Config
+
+	if err := env.ParseWithOptions(&cfg, env.Options{Environment: environment}); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// parseConfigFile converts a config file's values to the strings their environment
+// variables would hold
+func parseConfigFile(data []byte) (map[string]string, error) {
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+
+	environment := make(map[string]string, len(values))
+	for key, value := range values {
+		switch value := value.(type) {
+		case nil:
+			environment[key] = ""
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			environment[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: nested values aren't supported; use environment variable names as keys", key)
+		default:
+			environment[key] = fmt.Sprint(value)
+		}
+	}
+	return environment, nil
+}
+
+// CheckBinaries checks that the Claude Code binary and git can be run, so a missing
+// one fails startup rather than every session's setup
+func (c *Config) CheckBinaries() error {
+	if c.Session.SkipBinaryCheck {
+		return nil
+	}
+
+	if _, err := exec.LookPath(c.Session.ClaudeCodePath); err != nil {
+		return fmt.Errorf("claude binary %q not found; set CLAUDE_CODE_PATH: %w", c.Session.ClaudeCodePath, err)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("git not found on PATH: %w", err)
+	}
+	return nil
+}
+
+// DatabaseDSN returns the data source for the configured driver: DB_DSN for Postgres and
+// DB_PATH for SQLite
+func (c *Config) DatabaseDSN() string {
+	if c.Database.Driver == db.DriverPostgres {
+		return c.Database.DSN
+	}
+	return c.Database.Path
+}
+
 func (c *Config) validate() error {
 	if c.Server.Port <= 0 || c.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", c.Server.Port)
 	}
 
+	switch c.Server.ShutdownMode {
+	case "", ShutdownModeEnd, ShutdownModeDetach:
+	default:
+		return fmt.Errorf("invalid shutdown mode %q: must be %s or %s", c.Server.ShutdownMode, ShutdownModeEnd, ShutdownModeDetach)
+	}
+
+	switch c.Database.Driver {
+	case "", db.DriverSQLite:
+	case db.DriverPostgres:
+		if c.Database.DSN == "" {
+			return fmt.Errorf("DB_DSN is required when DB_DRIVER is postgres")
+		}
+	default:
+		return fmt.Errorf("invalid database driver %q: must be %s or %s", c.Database.Driver, db.DriverSQLite, db.DriverPostgres)
+	}
+
+	// Stored credentials are always encrypted, so the key is always needed
+	if c.Database.EncryptionKey == "" {
+		return fmt.Errorf("missing encryption key: set ENCRYPTION_KEY to a random value of at least 32 bytes")
+	}
+	if err := crypto.ValidateKey(c.Database.EncryptionKey); err != nil {
+		return fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	switch c.Slack.Mode {
+	case "", SlackModeEvents:
+	case SlackModeSocket:
+		if c.Slack.AppToken == "" {
+			return fmt.Errorf("SLACK_APP_TOKEN is required when SLACK_MODE is socket")
+		}
+	default:
+		return fmt.Errorf("invalid Slack mode %q: must be %s or %s", c.Slack.Mode, SlackModeEvents, SlackModeSocket)
+	}
+
+	if c.Slack.MaxMessagesPerTurn < 0 {
+		return fmt.Errorf("max messages per turn cannot be negative")
+	}
+
 	if c.Session.MaxPerUser <= 0 {
 		return fmt.Errorf("max sessions per user must be positive")
 	}
@@ -64,6 +308,85 @@ func (c *Config) validate() error {
 		return fmt.Errorf("session idle timeout must be positive")
 	}
 
+	if c.Session.IdleWarning < 0 || c.Session.IdleWarning >= c.Session.IdleTimeout {
+		return fmt.Errorf("session idle warning must be between 0 and the idle timeout")
+	}
+
+	if c.Session.IdleCheck <= 0 {
+		return fmt.Errorf("idle check interval must be positive")
+	}
+
+	if c.Session.IdleWorkers <= 0 {
+		return fmt.Errorf("idle cleanup workers must be positive")
+	}
+
+	if c.Session.CommandTimeout < 0 {
+		return fmt.Errorf("claude command timeout cannot be negative")
+	}
+
+	if c.Session.MaxLifetime < 0 {
+		return fmt.Errorf("max session lifetime cannot be negative")
+	}
+
+	if c.Session.CreateLimit < 0 {
+		return fmt.Errorf("session create limit cannot be negative")
+	}
+
+	if c.Session.CreateLimit > 0 && c.Session.CreateWindow <= 0 {
+		return fmt.Errorf("session create window must be positive")
+	}
+
+	if c.Session.MinFreeDiskMB < 0 {
+		return fmt.Errorf("minimum free disk space cannot be negative")
+	}
+
+	if c.Session.MirrorTTL < 0 {
+		return fmt.Errorf("mirror TTL cannot be negative")
+	}
+
+	if c.Session.MirrorTTL > 0 && c.Session.MirrorSweep <= 0 {
+		return fmt.Errorf("mirror sweep interval must be positive")
+	}
+
+	if c.Git.HostConcurrency < 0 || c.Git.RepoConcurrency < 0 {
+		return fmt.Errorf("git concurrency limits cannot be negative")
+	}
+
+	if c.API.ReadOnlyEnabled {
+		if c.API.PublicURL == "" {
+			return fmt.Errorf("PUBLIC_URL is required when READONLY_API_ENABLED is set")
+		}
+		if c.API.ShareLinkTTL <= 0 {
+			return fmt.Errorf("share link TTL must be positive")
+		}
+	}
+
+	if c.API.Enabled && len(c.API.Token) < 32 {
+		return fmt.Errorf("API_TOKEN of at least 32 characters is required when API_ENABLED is set")
+	}
+
+	if c.GitHub.OAuthClientID != "" {
+		if c.GitHub.OAuthClientSecret == "" {
+			return fmt.Errorf("GITHUB_OAUTH_CLIENT_SECRET is required when GITHUB_OAUTH_CLIENT_ID is set")
+		}
+		if c.API.PublicURL == "" {
+			return fmt.Errorf("PUBLIC_URL is required when GITHUB_OAUTH_CLIENT_ID is set")
+		}
+	}
+
+	if c.Budget.WarnThresholdUSD < 0 {
+		return fmt.Errorf("cost warning threshold cannot be negative")
+	}
+	if c.Budget.MaxSessionCostUSD < 0 {
+		return fmt.Errorf("maximum session cost cannot be negative")
+	}
+
+	switch c.Monitoring.LogFormat {
+	case "", logging.FormatText, logging.FormatJSON:
+	default:
+		return fmt.Errorf("invalid log format %q: must be %s or %s", c.Monitoring.LogFormat, logging.FormatText, logging.FormatJSON)
+	}
+
 	return nil
 }
 
@@ -6,10 +6,15 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 )
 
+// ErrNotCiphertext is returned by DecryptCredential for values that can't have been
+// produced by EncryptCredential, as opposed to ciphertext that fails to decrypt
+var ErrNotCiphertext = errors.New("value is not ciphertext")
+
 // Encryptor handles credential encryption and decryption
 type Encryptor struct {
 	key []byte
@@ -67,7 +72,7 @@ func (e *Encryptor) DecryptCredential(ciphertext string) (string, error) {
 	// Decode base64
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode base64: %w", err)
+		return "", fmt.Errorf("%w: failed to decode base64: %v", ErrNotCiphertext, err)
 	}
 
 	block, err := aes.NewCipher(e.key)
@@ -82,7 +87,7 @@ func (e *Encryptor) DecryptCredential(ciphertext string) (string, error) {
 
 	nonceSize := gcm.NonceSize()
 	if len(data) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+		return "", fmt.Errorf("%w: ciphertext too short", ErrNotCiphertext)
 	}
 
 	// Extract nonce and ciphertext
@@ -1,6 +1,7 @@
 package crypto
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -136,9 +137,10 @@ func TestDecryptInvalidInput(t *testing.T) {
 	}
 
 	tests := []struct {
-		name       string
-		ciphertext string
-		wantErr    bool
+		name          string
+		ciphertext    string
+		wantErr       bool
+		notCiphertext bool // the error is ErrNotCiphertext
 	}{
 		{
 			name:       "empty ciphertext",
@@ -147,13 +149,15 @@ func TestDecryptInvalidInput(t *testing.T) {
 		},
 		{
 			name:       "invalid base64",
-			ciphertext: "not-base64!",
-			wantErr:    true,
+			ciphertext:    "not-base64!",
+			wantErr:       true,
+			notCiphertext: true,
 		},
 		{
 			name:       "too short ciphertext",
-			ciphertext: "YWJjZA==", // "abcd" in base64, too short for nonce
-			wantErr:    true,
+			ciphertext:    "YWJjZA==", // "abcd" in base64, too short for nonce
+			wantErr:       true,
+			notCiphertext: true,
 		},
 		{
 			name:       "corrupted ciphertext",
@@ -168,6 +172,9 @@ func TestDecryptInvalidInput(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Errorf("DecryptCredential() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if errors.Is(err, ErrNotCiphertext) != tt.notCiphertext {
+				t.Errorf("DecryptCredential() error = %v, want ErrNotCiphertext %v", err, tt.notCiphertext)
+			}
 		})
 	}
 }
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{
+			name:    "sqlite unchanged",
+			dialect: sqliteDialect,
+			query:   "SELECT id FROM sessions WHERE slack_workspace_id = ? AND branch_name = ?",
+			want:    "SELECT id FROM sessions WHERE slack_workspace_id = ? AND branch_name = ?",
+		},
+		{
+			name:    "postgres numbered",
+			dialect: postgresDialect,
+			query:   "SELECT id FROM sessions WHERE slack_workspace_id = ? AND branch_name = ?",
+			want:    "SELECT id FROM sessions WHERE slack_workspace_id = $1 AND branch_name = $2",
+		},
+		{
+			name:    "postgres quoted question marks",
+			dialect: postgresDialect,
+			query:   `UPDATE sessions SET status = ? WHERE branch_name <> 'why?' AND "odd?" = ?`,
+			want:    `UPDATE sessions SET status = $1 WHERE branch_name <> 'why?' AND "odd?" = $2`,
+		},
+		{
+			name:    "postgres no placeholders",
+			dialect: postgresDialect,
+			query:   "SELECT COUNT(*) FROM users",
+			want:    "SELECT COUNT(*) FROM users",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("rebind() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	encryptor, err := crypto.NewEncryptor("test-encryption-key-that-is-32-bytes-long")
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	if _, err := Open("mysql", "cb", encryptor); err == nil || !strings.Contains(err.Error(), "unknown database driver") {
+		t.Errorf("Open(mysql) error = %v, want an unknown driver error", err)
+	}
+}
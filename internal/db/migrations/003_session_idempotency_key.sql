@@ -0,0 +1,4 @@
+-- Client-supplied idempotency key for session creation (NULL when not supplied)
+ALTER TABLE sessions ADD COLUMN idempotency_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_idempotency_key ON sessions(idempotency_key);
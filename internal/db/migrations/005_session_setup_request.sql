@@ -0,0 +1,2 @@
+-- Original creation parameters (JSON CreateSessionRequest) so a failed or ended session can be set up again
+ALTER TABLE sessions ADD COLUMN setup_request TEXT;
@@ -0,0 +1,32 @@
+-- Allow the viewer role for users who join a session without being able to drive it.
+-- SQLite can't alter CHECK constraints in place, so the table is rebuilt.
+PRAGMA foreign_keys = OFF;
+
+BEGIN;
+
+CREATE TABLE session_users_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    role TEXT NOT NULL CHECK(role IN ('owner', 'collaborator', 'viewer')),
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(session_id, user_id),
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO session_users_new (id, session_id, user_id, role, joined_at)
+SELECT id, session_id, user_id, role, joined_at
+FROM session_users;
+
+DROP TABLE session_users;
+
+ALTER TABLE session_users_new RENAME TO session_users;
+
+CREATE INDEX IF NOT EXISTS idx_session_users_session ON session_users(session_id);
+CREATE INDEX IF NOT EXISTS idx_session_users_user ON session_users(user_id);
+CREATE INDEX IF NOT EXISTS idx_session_users_role ON session_users(role);
+
+COMMIT;
+
+PRAGMA foreign_keys = ON;
@@ -0,0 +1,7 @@
+-- Per-user preferences. Users without a row get the defaults.
+CREATE TABLE IF NOT EXISTS user_prefs (
+    user_id INTEGER PRIMARY KEY,
+    notify TEXT NOT NULL DEFAULT 'on' CHECK (notify IN ('on', 'off', 'mentions')),
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- Cost budget in USD at which a session is stopped, 0 for none
+ALTER TABLE sessions ADD COLUMN max_cost REAL NOT NULL DEFAULT 0;
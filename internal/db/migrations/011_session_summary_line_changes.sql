@@ -0,0 +1,4 @@
+-- Lines added and removed on a stopped session's branch, and the commit it was pushed at
+ALTER TABLE session_summaries ADD COLUMN insertions INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE session_summaries ADD COLUMN deletions INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE session_summaries ADD COLUMN commit_sha TEXT NOT NULL DEFAULT '';
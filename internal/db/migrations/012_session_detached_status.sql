@@ -0,0 +1,55 @@
+-- Allow the detached status, for sessions stopped by a shutdown in detach mode and
+-- resumed on the next start. SQLite can't alter constraints in place, so the table is
+-- rebuilt.
+PRAGMA foreign_keys = OFF;
+
+BEGIN;
+
+CREATE TABLE sessions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT DEFAULT '',
+    slack_workspace_id TEXT NOT NULL,
+    slack_channel_id TEXT NOT NULL,
+    slack_thread_ts TEXT NOT NULL,
+    repo_url TEXT NOT NULL,
+    branch_name TEXT NOT NULL,
+    work_tree_path TEXT NOT NULL,
+    model_name TEXT NOT NULL DEFAULT 'sonnet',
+    running_cost REAL NOT NULL DEFAULT 0.0,
+    status TEXT NOT NULL CHECK(status IN ('starting', 'active', 'ending', 'ended', 'error', 'detached')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMP,
+    idempotency_key TEXT,
+    setup_request TEXT,
+    turns INTEGER NOT NULL DEFAULT 0,
+    max_cost REAL NOT NULL DEFAULT 0,
+    UNIQUE(slack_workspace_id, slack_channel_id, slack_thread_ts)
+);
+
+INSERT INTO sessions_new (
+    id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
+    repo_url, branch_name, work_tree_path, model_name, running_cost, status,
+    created_at, updated_at, ended_at, idempotency_key, setup_request, turns, max_cost
+)
+SELECT
+    id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
+    repo_url, branch_name, work_tree_path, model_name, running_cost, status,
+    created_at, updated_at, ended_at, idempotency_key, setup_request, turns, max_cost
+FROM sessions;
+
+DROP TABLE sessions;
+
+ALTER TABLE sessions_new RENAME TO sessions;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_active ON sessions(status) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_sessions_channel ON sessions(slack_workspace_id, slack_channel_id, slack_thread_ts);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_idempotency_key ON sessions(idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_sessions_branch_name ON sessions(slack_workspace_id, branch_name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_live_branch_name
+    ON sessions(slack_workspace_id, repo_url, branch_name)
+    WHERE status NOT IN ('ended', 'error');
+
+COMMIT;
+
+PRAGMA foreign_keys = ON;
@@ -0,0 +1,144 @@
+-- Postgres schema, equivalent to the SQLite schema after migrations 001 to 011.
+-- Later migrations are added to both directories under the same version.
+
+-- Users table
+CREATE TABLE IF NOT EXISTS users (
+    id BIGSERIAL PRIMARY KEY,
+    slack_workspace_id TEXT NOT NULL,
+    slack_user_id TEXT NOT NULL,
+    slack_user_name TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(slack_workspace_id, slack_user_id)
+);
+
+-- Credentials table
+CREATE TABLE IF NOT EXISTS credentials (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_type TEXT NOT NULL CHECK(credential_type IN ('anthropic', 'github')),
+    credential_value TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, credential_type)
+);
+
+-- Sessions table (no direct user relationship - uses session_users junction table)
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGSERIAL PRIMARY KEY,
+    session_id TEXT DEFAULT '',
+    slack_workspace_id TEXT NOT NULL,
+    slack_channel_id TEXT NOT NULL,
+    slack_thread_ts TEXT NOT NULL,
+    repo_url TEXT NOT NULL,
+    branch_name TEXT NOT NULL,
+    work_tree_path TEXT NOT NULL,
+    model_name TEXT NOT NULL DEFAULT 'sonnet',
+    running_cost DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    status TEXT NOT NULL CHECK(status IN ('starting', 'active', 'ending', 'ended', 'error')),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMPTZ,
+    idempotency_key TEXT,
+    setup_request TEXT,
+    turns INTEGER NOT NULL DEFAULT 0,
+    max_cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    UNIQUE(slack_workspace_id, slack_channel_id, slack_thread_ts)
+);
+
+-- System prompts table
+CREATE TABLE IF NOT EXISTS system_prompts (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL,
+    is_public BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- User system prompts junction table (many-to-many)
+CREATE TABLE IF NOT EXISTS user_system_prompts (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    system_prompt_id BIGINT NOT NULL REFERENCES system_prompts(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, system_prompt_id)
+);
+
+-- Session users junction table (many-to-many)
+CREATE TABLE IF NOT EXISTS session_users (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK(role IN ('owner', 'collaborator', 'viewer')),
+    joined_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(session_id, user_id)
+);
+
+-- Session messages table for audit trail
+CREATE TABLE IF NOT EXISTS session_messages (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    slack_message_ts TEXT NOT NULL,
+    direction TEXT NOT NULL CHECK(direction IN ('user_to_claude', 'claude_to_user')),
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- MCP server registry
+CREATE TABLE IF NOT EXISTS mcp_servers (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    config TEXT NOT NULL,
+    created_by BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Summary of a session recorded when it is stopped
+CREATE TABLE IF NOT EXISTS session_summaries (
+    id BIGSERIAL PRIMARY KEY,
+    session_id BIGINT NOT NULL UNIQUE REFERENCES sessions(id) ON DELETE CASCADE,
+    feature TEXT NOT NULL,
+    branch TEXT NOT NULL,
+    repo_url TEXT NOT NULL,
+    commits INTEGER NOT NULL DEFAULT 0,
+    files_changed INTEGER NOT NULL DEFAULT 0,
+    total_cost DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    turns INTEGER NOT NULL DEFAULT 0,
+    duration_seconds INTEGER NOT NULL DEFAULT 0,
+    pr_url TEXT NOT NULL DEFAULT '',
+    insertions INTEGER NOT NULL DEFAULT 0,
+    deletions INTEGER NOT NULL DEFAULT 0,
+    commit_sha TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-user preferences. Users without a row get the defaults.
+CREATE TABLE IF NOT EXISTS user_prefs (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    notify TEXT NOT NULL DEFAULT 'on' CHECK (notify IN ('on', 'off', 'mentions')),
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes
+CREATE INDEX IF NOT EXISTS idx_users_slack ON users(slack_workspace_id, slack_user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_active ON sessions(status) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_sessions_channel ON sessions(slack_workspace_id, slack_channel_id, slack_thread_ts);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_idempotency_key ON sessions(idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_sessions_branch_name ON sessions(slack_workspace_id, branch_name);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_live_branch_name
+    ON sessions(slack_workspace_id, repo_url, branch_name)
+    WHERE status NOT IN ('ended', 'error');
+CREATE INDEX IF NOT EXISTS idx_session_messages_session ON session_messages(session_id);
+CREATE INDEX IF NOT EXISTS idx_session_messages_ts ON session_messages(slack_message_ts);
+CREATE INDEX IF NOT EXISTS idx_system_prompts_created_by ON system_prompts(created_by);
+CREATE INDEX IF NOT EXISTS idx_system_prompts_public ON system_prompts(is_public) WHERE is_public = TRUE;
+CREATE INDEX IF NOT EXISTS idx_system_prompts_name ON system_prompts(name);
+CREATE INDEX IF NOT EXISTS idx_user_system_prompts_user ON user_system_prompts(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_system_prompts_prompt ON user_system_prompts(system_prompt_id);
+CREATE INDEX IF NOT EXISTS idx_session_users_session ON session_users(session_id);
+CREATE INDEX IF NOT EXISTS idx_session_users_user ON session_users(user_id);
+CREATE INDEX IF NOT EXISTS idx_session_users_role ON session_users(role);
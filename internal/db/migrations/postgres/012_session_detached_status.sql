@@ -0,0 +1,5 @@
+-- Allow the detached status, for sessions stopped by a shutdown in detach mode and
+-- resumed on the next start
+ALTER TABLE sessions DROP CONSTRAINT IF EXISTS sessions_status_check;
+ALTER TABLE sessions ADD CONSTRAINT sessions_status_check
+    CHECK(status IN ('starting', 'active', 'ending', 'ended', 'error', 'detached'));
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openMigrationTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	sqlDB, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	return &DB{conn: &conn{DB: sqlDB, dialect: sqliteDialect}}
+}
+
+func migrationFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return fsys
+}
+
+func TestApplyMigrations(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	first := migrationFS(map[string]string{
+		"001_widgets.sql": "CREATE TABLE widgets (id INTEGER PRIMARY KEY);",
+	})
+	if err := db.applyMigrations(first); err != nil {
+		t.Fatalf("applyMigrations() error = %v", err)
+	}
+
+	t.Run("unchanged migrations are skipped", func(t *testing.T) {
+		// Re-running the CREATE TABLE would fail if the migration weren't skipped
+		if err := db.applyMigrations(first); err != nil {
+			t.Fatalf("applyMigrations() error = %v", err)
+		}
+	})
+
+	t.Run("new migrations are applied", func(t *testing.T) {
+		next := migrationFS(map[string]string{
+			"001_widgets.sql": "CREATE TABLE widgets (id INTEGER PRIMARY KEY);",
+			"002_gadgets.sql": "CREATE TABLE gadgets (id INTEGER PRIMARY KEY);",
+		})
+		if err := db.applyMigrations(next); err != nil {
+			t.Fatalf("applyMigrations() error = %v", err)
+		}
+		if _, err := db.conn.Exec("INSERT INTO gadgets (id) VALUES (1)"); err != nil {
+			t.Errorf("new migration wasn't applied: %v", err)
+		}
+
+		checksum, applied, err := db.appliedMigrationChecksum("002_gadgets")
+		if err != nil {
+			t.Fatalf("appliedMigrationChecksum() error = %v", err)
+		}
+		if !applied || checksum != migrationChecksum(next["002_gadgets.sql"].Data) {
+			t.Errorf("appliedMigrationChecksum() = %q, %v, want the file's checksum", checksum, applied)
+		}
+	})
+
+	t.Run("changed migrations are an error", func(t *testing.T) {
+		changed := migrationFS(map[string]string{
+			"001_widgets.sql": "CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT);",
+			"002_gadgets.sql": "CREATE TABLE gadgets (id INTEGER PRIMARY KEY);",
+		})
+		err := db.applyMigrations(changed)
+		if err == nil || !strings.Contains(err.Error(), "migration 001_widgets has changed since it was applied") {
+			t.Errorf("applyMigrations() error = %v, want the changed migration reported", err)
+		}
+	})
+}
+
+func TestApplyMigrationsBackfillsChecksums(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	// A database migrated before checksums were recorded
+	_, err := db.conn.Exec(`
+		CREATE TABLE schema_migrations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			migration_name TEXT UNIQUE NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE widgets (id INTEGER PRIMARY KEY);
+		INSERT INTO schema_migrations (migration_name) VALUES ('001_widgets');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to set up legacy schema: %v", err)
+	}
+
+	fsys := migrationFS(map[string]string{
+		"001_widgets.sql": "CREATE TABLE widgets (id INTEGER PRIMARY KEY);",
+	})
+	if err := db.applyMigrations(fsys); err != nil {
+		t.Fatalf("applyMigrations() error = %v", err)
+	}
+
+	checksum, applied, err := db.appliedMigrationChecksum("001_widgets")
+	if err != nil {
+		t.Fatalf("appliedMigrationChecksum() error = %v", err)
+	}
+	if !applied || checksum != migrationChecksum(fsys["001_widgets.sql"].Data) {
+		t.Errorf("appliedMigrationChecksum() = %q, %v, want the backfilled checksum", checksum, applied)
+	}
+}
+
+func TestApplyMigrationsDuplicateVersion(t *testing.T) {
+	db := openMigrationTestDB(t)
+
+	fsys := migrationFS(map[string]string{
+		"001_widgets.sql": "CREATE TABLE widgets (id INTEGER PRIMARY KEY);",
+		"001_gadgets.sql": "CREATE TABLE gadgets (id INTEGER PRIMARY KEY);",
+	})
+	err := db.applyMigrations(fsys)
+	if err == nil || !strings.Contains(err.Error(), "have the same version 001") {
+		t.Errorf("applyMigrations() error = %v, want a duplicate version error", err)
+	}
+}
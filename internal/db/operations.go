@@ -3,8 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
+	"github.com/pbdeuchler/claude-bot/internal/logging"
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
@@ -45,9 +50,28 @@ func (db *DB) GetUserBySlackID(ctx context.Context, workspaceID, userID string)
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			// User not found, return nil
-			// TODO: consider a better return scheme here
-			return nil, nil
+			return nil, models.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (db *DB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	query := `
+		SELECT id, slack_workspace_id, slack_user_id, slack_user_name, created_at, updated_at
+		FROM users 
+		WHERE id = ?
+	`
+
+	var user models.User
+	err := db.conn.QueryRowContext(ctx, query, id).Scan(
+		&user.ID, &user.SlackWorkspaceID, &user.SlackUserID, &user.SlackUserName, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.NewCBError(models.ErrCodeUnauthorized, "user not found", err)
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -58,6 +82,11 @@ func (db *DB) GetUserBySlackID(ctx context.Context, workspaceID, userID string)
 // Credential operations
 
 func (db *DB) StoreCredential(ctx context.Context, userID int64, credType, value string) error {
+	encrypted, err := db.encryptor.EncryptCredential(value)
+	if err != nil {
+		return models.NewCBError(models.ErrCodeEncryptionError, "failed to encrypt credential", err)
+	}
+
 	// First try to update existing credential
 	updateQuery := `
 		UPDATE credentials 
@@ -65,7 +94,7 @@ func (db *DB) StoreCredential(ctx context.Context, userID int64, credType, value
 		WHERE user_id = ? AND credential_type = ?
 	`
 
-	result, err := db.conn.ExecContext(ctx, updateQuery, value, userID, credType)
+	result, err := db.conn.ExecContext(ctx, updateQuery, encrypted, userID, credType)
 	if err != nil {
 		return fmt.Errorf("failed to update credential: %w", err)
 	}
@@ -82,7 +111,7 @@ func (db *DB) StoreCredential(ctx context.Context, userID int64, credType, value
 			VALUES (?, ?, ?)
 		`
 
-		_, err = db.conn.ExecContext(ctx, insertQuery, userID, credType, value)
+		_, err = db.conn.ExecContext(ctx, insertQuery, userID, credType, encrypted)
 		if err != nil {
 			return fmt.Errorf("failed to insert credential: %w", err)
 		}
@@ -107,41 +136,229 @@ func (db *DB) GetCredential(ctx context.Context, userID int64, credType string)
 		return "", fmt.Errorf("failed to get credential: %w", err)
 	}
 
-	return value, nil
+	decrypted, err := db.encryptor.DecryptCredential(value)
+	if err != nil {
+		if !errors.Is(err, crypto.ErrNotCiphertext) {
+			// Ciphertext that won't decrypt means the wrong encryption key or a corrupted
+			// row; it must be left as is so the credential isn't lost
+			return "", models.NewCBError(models.ErrCodeEncryptionError, "failed to decrypt credential", err)
+		}
+
+		// Rows stored before encryption was introduced are plaintext; encrypt them in place
+		logging.WarnCtx(logging.WithUserID(ctx, userID), "Credential is not encrypted, treating as plaintext", "type", credType)
+		if err := db.StoreCredential(ctx, userID, credType, value); err != nil {
+			logging.ErrorCtx(logging.WithUserID(ctx, userID), "Failed to encrypt plaintext credential", "type", credType, "error", err)
+		}
+		return value, nil
+	}
+
+	return decrypted, nil
+}
+
+// DeleteCredential removes a user's credential, returning an ErrCodeNoCredentials
+// error if they had none of that type
+func (db *DB) DeleteCredential(ctx context.Context, userID int64, credType string) error {
+	query := `DELETE FROM credentials WHERE user_id = ? AND credential_type = ?`
+
+	result, err := db.conn.ExecContext(ctx, query, userID, credType)
+	if err != nil {
+		return fmt.Errorf("failed to delete credential: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return models.NewCBError(models.ErrCodeNoCredentials, "credential not found", nil)
+	}
+
+	return nil
 }
 
-func (db *DB) HasRequiredCredentials(ctx context.Context, userID int64) (bool, error) {
+// MoveWorkspace re-keys the users and sessions stored under the workspace key fromID to
+// toID, in one transaction, for when USE_ENTERPRISE_ID keys a team's records on its
+// organization instead. Credentials and other per-user records follow their users. A
+// user or session that would clash with one already under toID (the same Slack user,
+// thread, or live branch) is left under fromID. It returns how many users and sessions
+// were moved.
+func (db *DB) MoveWorkspace(ctx context.Context, fromID, toID string) (users, sessions int64, err error) {
+	usersQuery := `
+		UPDATE users
+		SET slack_workspace_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE slack_workspace_id = ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM users other
+			WHERE other.slack_workspace_id = ? AND other.slack_user_id = users.slack_user_id
+		  )
+	`
+	sessionsQuery := `
+		UPDATE sessions
+		SET slack_workspace_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE slack_workspace_id = ?
+		  AND NOT EXISTS (
+			SELECT 1 FROM sessions other
+			WHERE other.slack_workspace_id = ?
+			  AND ((other.slack_channel_id = sessions.slack_channel_id AND other.slack_thread_ts = sessions.slack_thread_ts)
+			    OR (other.repo_url = sessions.repo_url AND other.branch_name = sessions.branch_name
+			        AND other.status NOT IN ('ended', 'error') AND sessions.status NOT IN ('ended', 'error')))
+		  )
+	`
+
+	err = db.WithTx(ctx, func(tx *Tx) error {
+		result, err := tx.ExecContext(ctx, usersQuery, toID, fromID, toID)
+		if err != nil {
+			return fmt.Errorf("failed to move users: %w", err)
+		}
+		if users, err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		result, err = tx.ExecContext(ctx, sessionsQuery, toID, fromID, toID)
+		if err != nil {
+			return fmt.Errorf("failed to move sessions: %w", err)
+		}
+		if sessions, err = result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return users, sessions, nil
+}
+
+// CredentialRotationFailure is a stored credential that couldn't be decrypted with the
+// old key, so RotateCredentials left it as it was
+type CredentialRotationFailure struct {
+	UserID         int64
+	CredentialType string
+	Err            error
+}
+
+// CredentialRotation reports the result of RotateCredentials
+type CredentialRotation struct {
+	Rotated int
+	Failed  []CredentialRotationFailure
+}
+
+// RotateCredentials re-encrypts every stored credential from oldKey to newKey in one
+// transaction, after which the database uses newKey. Plaintext rows from before
+// encryption are encrypted with newKey. Rows that don't decrypt with oldKey are
+// reported in the result's Failed and left unchanged, since they were encrypted with
+// some other key; the rest are still rotated.
+func (db *DB) RotateCredentials(ctx context.Context, oldKey, newKey string) (*CredentialRotation, error) {
+	oldEncryptor, err := crypto.NewEncryptor(oldKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid old key: %w", err)
+	}
+	newEncryptor, err := crypto.NewEncryptor(newKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new key: %w", err)
+	}
+
+	type storedCredential struct {
+		id       int64
+		userID   int64
+		credType string
+		value    string
+	}
+
+	result := &CredentialRotation{}
+	err = db.WithTx(ctx, func(tx *Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT id, user_id, credential_type, credential_value FROM credentials ORDER BY id`)
+		if err != nil {
+			return fmt.Errorf("failed to list credentials: %w", err)
+		}
+		var stored []storedCredential
+		for rows.Next() {
+			var c storedCredential
+			if err := rows.Scan(&c.id, &c.userID, &c.credType, &c.value); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan credential: %w", err)
+			}
+			stored = append(stored, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to list credentials: %w", err)
+		}
+
+		for _, c := range stored {
+			plaintext, err := oldEncryptor.DecryptCredential(c.value)
+			if errors.Is(err, crypto.ErrNotCiphertext) {
+				plaintext, err = c.value, nil
+			}
+			if err != nil {
+				result.Failed = append(result.Failed, CredentialRotationFailure{UserID: c.userID, CredentialType: c.credType, Err: err})
+				continue
+			}
+
+			encrypted, err := newEncryptor.EncryptCredential(plaintext)
+			if err != nil {
+				return models.NewCBError(models.ErrCodeEncryptionError, "failed to encrypt credential", err)
+			}
+			_, err = tx.ExecContext(ctx,
+				`UPDATE credentials SET credential_value = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+				encrypted, c.id)
+			if err != nil {
+				return fmt.Errorf("failed to update credential: %w", err)
+			}
+			result.Rotated++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db.encryptor = newEncryptor
+	return result, nil
+}
+
+func (db *DB) HasCredential(ctx context.Context, userID int64, credType string) (bool, error) {
 	query := `
 		SELECT COUNT(*) 
 		FROM credentials 
-		WHERE user_id = ? AND credential_type IN ('anthropic', 'github')
+		WHERE user_id = ? AND credential_type = ?
 	`
 
 	var count int
-	err := db.conn.QueryRowContext(ctx, query, userID).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query, userID, credType).Scan(&count)
 	if err != nil {
-		return false, fmt.Errorf("failed to check credentials: %w", err)
+		return false, fmt.Errorf("failed to check credential: %w", err)
 	}
 
-	return count >= 2, nil
+	return count > 0, nil
 }
 
 // Session operations
 
-func (db *DB) CreateSession(ctx context.Context, session *models.Session) error {
-	query := `
-		INSERT INTO sessions (
-			session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
-			repo_url, branch_name, work_tree_path, model_name, running_cost, status
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		RETURNING id
-	`
-
-	err := db.conn.QueryRowContext(ctx, query,
+const insertSessionQuery = `
+	INSERT INTO sessions (
+		session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
+		repo_url, branch_name, work_tree_path, model_name, running_cost, status,
+		idempotency_key, max_cost
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+`
+
+// insertSessionArgs returns the values for insertSessionQuery
+func insertSessionArgs(session *models.Session) []interface{} {
+	// Store NULL rather than '' so sessions without a key don't collide on the unique index
+	idempotencyKey := sql.NullString{String: session.IdempotencyKey, Valid: session.IdempotencyKey != ""}
+
+	return []interface{}{
 		session.SessionID, session.SlackWorkspaceID, session.SlackChannelID,
 		session.SlackThreadTS, session.RepoURL, session.BranchName, session.WorkTreePath,
-		session.ModelName, session.RunningCost, session.Status,
-	).Scan(&session.ID)
+		session.ModelName, session.RunningCost, session.Status, idempotencyKey, session.MaxCost,
+	}
+}
+
+func (db *DB) CreateSession(ctx context.Context, session *models.Session) error {
+	err := db.conn.QueryRowContext(ctx, insertSessionQuery, insertSessionArgs(session)...).Scan(&session.ID)
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
 	}
@@ -149,6 +366,44 @@ func (db *DB) CreateSession(ctx context.Context, session *models.Session) error
 	return nil
 }
 
+// CreateSessionWithOwner stores a new session and its owner in one transaction. The
+// feature name is claimed by the insert itself: if a live session of the repository in
+// the workspace already uses it, the unique index rejects the insert and an
+// ErrCodeSessionExists error is returned, so concurrent creates can't both succeed.
+func (db *DB) CreateSessionWithOwner(ctx context.Context, session *models.Session, ownerID int64) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		err := tx.QueryRowContext(ctx, insertSessionQuery, insertSessionArgs(session)...).Scan(&session.ID)
+		if isBranchNameConflict(err) {
+			return models.NewCBError(models.ErrCodeSessionExists,
+				fmt.Sprintf("session with feature name '%s' already exists", session.BranchName), err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO session_users (session_id, user_id, role) VALUES (?, ?, ?)`,
+			session.ID, ownerID, models.SessionRoleOwner)
+		if err != nil {
+			return fmt.Errorf("failed to add owner to session: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// isBranchNameConflict reports whether err is a violation of the unique index on live
+// sessions' branch names. It matches SQLite's and Postgres's messages rather than the
+// drivers' error types, which aren't in every build.
+func isBranchNameConflict(err error) bool {
+	if err == nil {
+		return false
+	}
+	message := err.Error()
+	return (strings.Contains(message, "UNIQUE constraint failed") && strings.Contains(message, "sessions.branch_name")) ||
+		(strings.Contains(message, "duplicate key") && strings.Contains(message, "idx_sessions_live_branch_name"))
+}
+
 func (db *DB) GetSession(ctx context.Context, sessionID string) (*models.Session, error) {
 	query := `
 		SELECT id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
@@ -175,6 +430,137 @@ func (db *DB) GetSession(ctx context.Context, sessionID string) (*models.Session
 	return &session, nil
 }
 
+// GetSessionByID retrieves a session by its database ID
+func (db *DB) GetSessionByID(ctx context.Context, id int64) (*models.Session, error) {
+	query := `
+		SELECT id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
+			   repo_url, branch_name, work_tree_path, model_name, running_cost, status,
+			   created_at, updated_at, ended_at
+		FROM sessions
+		WHERE id = ?
+	`
+
+	var session models.Session
+	err := db.conn.QueryRowContext(ctx, query, id).Scan(
+		&session.ID, &session.SessionID, &session.SlackWorkspaceID,
+		&session.SlackChannelID, &session.SlackThreadTS, &session.RepoURL, &session.BranchName,
+		&session.WorkTreePath, &session.ModelName, &session.RunningCost, &session.Status,
+		&session.CreatedAt, &session.UpdatedAt, &session.EndedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", err)
+		}
+		return nil, fmt.Errorf("failed to get session by ID: %w", err)
+	}
+
+	return &session, nil
+}
+
+// GetSessionByIdempotencyKey retrieves the session created with an idempotency key,
+// returning an ErrCodeSessionNotFound error if there is none
+func (db *DB) GetSessionByIdempotencyKey(ctx context.Context, idempotencyKey string) (*models.Session, error) {
+	query := `
+		SELECT id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
+			   repo_url, branch_name, work_tree_path, model_name, running_cost, status,
+			   created_at, updated_at, ended_at, idempotency_key
+		FROM sessions 
+		WHERE idempotency_key = ?
+	`
+
+	var session models.Session
+	err := db.conn.QueryRowContext(ctx, query, idempotencyKey).Scan(
+		&session.ID, &session.SessionID, &session.SlackWorkspaceID,
+		&session.SlackChannelID, &session.SlackThreadTS, &session.RepoURL, &session.BranchName,
+		&session.WorkTreePath, &session.ModelName, &session.RunningCost, &session.Status,
+		&session.CreatedAt, &session.UpdatedAt, &session.EndedAt, &session.IdempotencyKey,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.NewCBError(models.ErrCodeSessionNotFound, "no session for idempotency key", err)
+		}
+		return nil, fmt.Errorf("failed to get session by idempotency key: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (db *DB) GetLatestSessionForChannel(ctx context.Context, workspaceID, channelID, threadTS string) (*models.Session, error) {
+	query := `
+		SELECT id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
+			   repo_url, branch_name, work_tree_path, model_name, running_cost, status,
+			   created_at, updated_at, ended_at
+		FROM sessions 
+		WHERE slack_workspace_id = ? AND slack_channel_id = ? AND slack_thread_ts = ?
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	var session models.Session
+	err := db.conn.QueryRowContext(ctx, query, workspaceID, channelID, threadTS).Scan(
+		&session.ID, &session.SessionID, &session.SlackWorkspaceID,
+		&session.SlackChannelID, &session.SlackThreadTS, &session.RepoURL, &session.BranchName,
+		&session.WorkTreePath, &session.ModelName, &session.RunningCost, &session.Status,
+		&session.CreatedAt, &session.UpdatedAt, &session.EndedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil // No session in this channel/thread, not an error
+		}
+		return nil, fmt.Errorf("failed to get session for channel: %w", err)
+	}
+
+	return &session, nil
+}
+
+func (db *DB) SaveSessionSetupRequest(ctx context.Context, sessionDBID int64, setupRequest string) error {
+	query := `
+		UPDATE sessions 
+		SET setup_request = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.conn.ExecContext(ctx, query, setupRequest, sessionDBID)
+	if err != nil {
+		return fmt.Errorf("failed to save session setup request: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) GetSessionSetupRequest(ctx context.Context, sessionDBID int64) (string, error) {
+	query := `
+		SELECT COALESCE(setup_request, '')
+		FROM sessions 
+		WHERE id = ?
+	`
+
+	var setupRequest string
+	err := db.conn.QueryRowContext(ctx, query, sessionDBID).Scan(&setupRequest)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", models.NewCBError(models.ErrCodeSessionNotFound, "session not found", err)
+		}
+		return "", fmt.Errorf("failed to get session setup request: %w", err)
+	}
+
+	return setupRequest, nil
+}
+
+// GetSessionMaxCost returns a session's own cost budget in USD, 0 if it has none
+func (db *DB) GetSessionMaxCost(ctx context.Context, sessionDBID int64) (float64, error) {
+	var maxCost float64
+	err := db.conn.QueryRowContext(ctx, `SELECT max_cost FROM sessions WHERE id = ?`, sessionDBID).Scan(&maxCost)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", err)
+		}
+		return 0, fmt.Errorf("failed to get session budget: %w", err)
+	}
+
+	return maxCost, nil
+}
+
 func (db *DB) GetActiveSessionForChannel(ctx context.Context, workspaceID, channelID, threadTS string) (*models.Session, error) {
 	query := `
 		SELECT id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
@@ -195,7 +581,7 @@ func (db *DB) GetActiveSessionForChannel(ctx context.Context, workspaceID, chann
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, nil // No active session found, not an error
+			return nil, models.ErrNoActiveSession
 		}
 		return nil, fmt.Errorf("failed to get active session: %w", err)
 	}
@@ -203,7 +589,9 @@ func (db *DB) GetActiveSessionForChannel(ctx context.Context, workspaceID, chann
 	return &session, nil
 }
 
-func (db *DB) GetActiveSessionsByUser(ctx context.Context, userID int64) ([]*models.Session, error) {
+// GetActiveSessionsByUser returns a page of the active sessions the user is a member of,
+// newest first. A limit of 0 or less returns every session from offset on.
+func (db *DB) GetActiveSessionsByUser(ctx context.Context, userID int64, limit, offset int) ([]*models.Session, error) {
 	query := `
 		SELECT DISTINCT s.id, s.session_id, s.slack_workspace_id, s.slack_channel_id, s.slack_thread_ts,
 			   s.repo_url, s.branch_name, s.work_tree_path, s.model_name, s.running_cost, s.status,
@@ -211,10 +599,15 @@ func (db *DB) GetActiveSessionsByUser(ctx context.Context, userID int64) ([]*mod
 		FROM sessions s
 		INNER JOIN session_users su ON s.id = su.session_id
 		WHERE su.user_id = ? AND s.status = 'active'
-		ORDER BY s.created_at DESC
+		ORDER BY s.created_at DESC, s.id DESC
+		LIMIT ? OFFSET ?
 	`
 
-	rows, err := db.conn.QueryContext(ctx, query, userID)
+	var limitArg interface{} = limit
+	if limit <= 0 {
+		limitArg = db.conn.dialect.noLimit()
+	}
+	rows, err := db.conn.QueryContext(ctx, query, userID, limitArg, offset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get active sessions: %w", err)
 	}
@@ -238,6 +631,96 @@ func (db *DB) GetActiveSessionsByUser(ctx context.Context, userID int64) ([]*mod
 	return sessions, nil
 }
 
+// GetSessionCountByUser counts the active sessions the user is a member of, matching
+// GetActiveSessionsByUser
+func (db *DB) GetSessionCountByUser(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT s.id)
+		FROM sessions s
+		INNER JOIN session_users su ON s.id = su.session_id
+		WHERE su.user_id = ? AND s.status = 'active'
+	`
+
+	var count int
+	err := db.conn.QueryRowContext(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
+	return count, nil
+}
+
+func (db *DB) CountActiveSessionsByUser(ctx context.Context, userID int64) (int, error) {
+	query := `
+		SELECT COUNT(DISTINCT s.id)
+		FROM sessions s
+		INNER JOIN session_users su ON s.id = su.session_id
+		WHERE su.user_id = ? AND su.role = 'owner' AND s.status IN ('starting', 'active')
+	`
+
+	var count int
+	err := db.conn.QueryRowContext(ctx, query, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count active sessions: %w", err)
+	}
+
+	return count, nil
+}
+
+func (db *DB) GetUserTotalCost(ctx context.Context, userID int64) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(s.running_cost), 0)
+		FROM sessions s
+		INNER JOIN session_users su ON s.id = su.session_id
+		WHERE su.user_id = ? AND su.role = 'owner'
+	`
+
+	var total float64
+	err := db.conn.QueryRowContext(ctx, query, userID).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user total cost: %w", err)
+	}
+
+	return total, nil
+}
+
+// SumCostByUser returns the running cost of the sessions a user owns that were created
+// at or after since. A zero since counts every session.
+func (db *DB) SumCostByUser(ctx context.Context, userID int64, since time.Time) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(s.running_cost), 0)
+		FROM sessions s
+		INNER JOIN session_users su ON s.id = su.session_id
+		WHERE su.user_id = ? AND su.role = 'owner' AND s.created_at >= ?
+	`
+
+	var total float64
+	err := db.conn.QueryRowContext(ctx, query, userID, since.UTC()).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum user cost: %w", err)
+	}
+
+	return total, nil
+}
+
+// SumCostByWorkspace returns the running cost of a workspace's sessions that were
+// created at or after since. A zero since counts every session.
+func (db *DB) SumCostByWorkspace(ctx context.Context, workspaceID string, since time.Time) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(running_cost), 0)
+		FROM sessions
+		WHERE slack_workspace_id = ? AND created_at >= ?
+	`
+
+	var total float64
+	err := db.conn.QueryRowContext(ctx, query, workspaceID, since.UTC()).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum workspace cost: %w", err)
+	}
+
+	return total, nil
+}
+
 func (db *DB) UpdateSessionStatus(ctx context.Context, sessionID, status string) error {
 	query := `
 		UPDATE sessions 
@@ -262,6 +745,22 @@ func (db *DB) UpdateSessionStatus(ctx context.Context, sessionID, status string)
 	return nil
 }
 
+// ResumeDetachedSessions marks every detached session active again, returning how many
+// were
+func (db *DB) ResumeDetachedSessions(ctx context.Context) (int64, error) {
+	query := `
+		UPDATE sessions
+		SET status = 'active', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'detached'
+	`
+
+	result, err := db.conn.ExecContext(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to resume detached sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 func (db *DB) UpdateSessionCost(ctx context.Context, sessionID string, cost float64) error {
 	query := `
 		UPDATE sessions 
@@ -325,16 +824,17 @@ func (db *DB) UpdateSessionByID(ctx context.Context, sessionDBID int64, sessionI
 	return nil
 }
 
-func (db *DB) UpdateSessionStatusByID(ctx context.Context, sessionDBID int64, status string) error {
+// UpdateSessionWorkTreePath records where a session's work tree was created
+func (db *DB) UpdateSessionWorkTreePath(ctx context.Context, sessionDBID int64, workTreePath string) error {
 	query := `
-		UPDATE sessions 
-		SET status = ?, updated_at = CURRENT_TIMESTAMP, ended_at = CASE WHEN ? = 'ended' THEN CURRENT_TIMESTAMP ELSE ended_at END
+		UPDATE sessions
+		SET work_tree_path = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
 
-	result, err := db.conn.ExecContext(ctx, query, status, status, sessionDBID)
+	result, err := db.conn.ExecContext(ctx, query, workTreePath, sessionDBID)
 	if err != nil {
-		return fmt.Errorf("failed to update session status: %w", err)
+		return fmt.Errorf("failed to update session work tree path: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -349,16 +849,17 @@ func (db *DB) UpdateSessionStatusByID(ctx context.Context, sessionDBID int64, st
 	return nil
 }
 
-func (db *DB) UpdateSessionCostByID(ctx context.Context, sessionDBID int64, cost float64) error {
+func (db *DB) UpdateSessionStatusByID(ctx context.Context, sessionDBID int64, status string) error {
 	query := `
 		UPDATE sessions 
-		SET running_cost = ?, updated_at = CURRENT_TIMESTAMP
+		SET status = ?, updated_at = CURRENT_TIMESTAMP,
+			ended_at = CASE WHEN ? = 'ended' THEN CURRENT_TIMESTAMP WHEN ? = 'starting' THEN NULL ELSE ended_at END
 		WHERE id = ?
 	`
 
-	result, err := db.conn.ExecContext(ctx, query, cost, sessionDBID)
+	result, err := db.conn.ExecContext(ctx, query, status, status, status, sessionDBID)
 	if err != nil {
-		return fmt.Errorf("failed to update session cost: %w", err)
+		return fmt.Errorf("failed to update session status: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -373,6 +874,57 @@ func (db *DB) UpdateSessionCostByID(ctx context.Context, sessionDBID int64, cost
 	return nil
 }
 
+func (db *DB) AddSessionTurns(ctx context.Context, sessionDBID int64, turns int) error {
+	query := `
+		UPDATE sessions 
+		SET turns = turns + ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`
+
+	_, err := db.conn.ExecContext(ctx, query, turns, sessionDBID)
+	if err != nil {
+		return fmt.Errorf("failed to update session turns: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) GetSessionTurns(ctx context.Context, sessionDBID int64) (int, error) {
+	var turns int
+	err := db.conn.QueryRowContext(ctx, `SELECT turns FROM sessions WHERE id = ?`, sessionDBID).Scan(&turns)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", err)
+		}
+		return 0, fmt.Errorf("failed to get session turns: %w", err)
+	}
+
+	return turns, nil
+}
+
+// AddSessionCostByID adds cost to a session's running cost and returns the new total.
+// The addition happens in the database, so costs recorded concurrently, e.g. by two
+// turns each holding their own copy of the session, all count towards the total.
+func (db *DB) AddSessionCostByID(ctx context.Context, sessionDBID int64, cost float64) (float64, error) {
+	query := `
+		UPDATE sessions
+		SET running_cost = running_cost + ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		RETURNING running_cost
+	`
+
+	var total float64
+	err := db.conn.QueryRowContext(ctx, query, cost, sessionDBID).Scan(&total)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", err)
+		}
+		return 0, fmt.Errorf("failed to update session cost: %w", err)
+	}
+
+	return total, nil
+}
+
 func (db *DB) GetAllActiveSessions(ctx context.Context) ([]*models.Session, error) {
 	query := `
 		SELECT id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
@@ -407,6 +959,61 @@ func (db *DB) GetAllActiveSessions(ctx context.Context) ([]*models.Session, erro
 	return sessions, nil
 }
 
+func (db *DB) GetLiveSessionRepoURLs(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT DISTINCT repo_url
+		FROM sessions 
+		WHERE status IN ('starting', 'active', 'ending', 'detached')
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live session repo URLs: %w", err)
+	}
+	defer rows.Close()
+
+	var repoURLs []string
+	for rows.Next() {
+		var repoURL string
+		if err := rows.Scan(&repoURL); err != nil {
+			return nil, fmt.Errorf("failed to scan repo URL: %w", err)
+		}
+		repoURLs = append(repoURLs, repoURL)
+	}
+
+	return repoURLs, nil
+}
+
+// GetLiveSessionWorkTreePaths returns the worktree paths of sessions that are starting,
+// active, ending or detached
+func (db *DB) GetLiveSessionWorkTreePaths(ctx context.Context) ([]string, error) {
+	query := `
+		SELECT work_tree_path
+		FROM sessions
+		WHERE status IN ('starting', 'active', 'ending', 'detached') AND work_tree_path != ''
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get live session worktree paths: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("failed to scan worktree path: %w", err)
+		}
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get live session worktree paths: %w", err)
+	}
+
+	return paths, nil
+}
+
 // Session message operations
 
 func (db *DB) CreateSessionMessage(ctx context.Context, sessionID int64, messageTS, direction, content string) error {
@@ -428,7 +1035,7 @@ func (db *DB) GetSessionMessages(ctx context.Context, sessionID int64, limit int
 		SELECT id, session_id, slack_message_ts, direction, content, created_at
 		FROM session_messages 
 		WHERE session_id = ?
-		ORDER BY created_at DESC
+		ORDER BY created_at DESC, id DESC
 		LIMIT ?
 	`
 
@@ -548,6 +1155,25 @@ func (db *DB) GetSystemPromptByName(ctx context.Context, userID int64, name stri
 	return &prompt, nil
 }
 
+func (db *DB) SystemPromptNameExists(ctx context.Context, userID int64, name string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM system_prompts sp
+			LEFT JOIN user_system_prompts usp ON sp.id = usp.system_prompt_id
+			WHERE (sp.created_by = ? OR usp.user_id = ? OR sp.is_public = TRUE) AND sp.name = ?
+		)
+	`
+
+	var exists bool
+	err := db.conn.QueryRowContext(ctx, query, userID, userID, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check system prompt name: %w", err)
+	}
+
+	return exists, nil
+}
+
 func (db *DB) UpdateSystemPrompt(ctx context.Context, req *models.UpdateSystemPromptRequest) (*models.SystemPrompt, error) {
 	query := `
 		UPDATE system_prompts 
@@ -630,12 +1256,44 @@ func (db *DB) RemoveUserFromSession(ctx context.Context, sessionID int64, userID
 	return nil
 }
 
+// TransferSessionOwnership removes the current owner from a session and makes another
+// member the owner, atomically so the session is never left without an owner
+func (db *DB) TransferSessionOwnership(ctx context.Context, sessionID, fromUserID, toUserID int64) error {
+	return db.WithTx(ctx, func(tx *Tx) error {
+		result, err := tx.ExecContext(ctx,
+			`DELETE FROM session_users WHERE session_id = ? AND user_id = ? AND role = 'owner'`,
+			sessionID, fromUserID)
+		if err != nil {
+			return fmt.Errorf("failed to remove session owner: %w", err)
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		} else if rows == 0 {
+			return models.NewCBError(models.ErrCodeUnauthorized, "user is not the session owner", nil)
+		}
+
+		result, err = tx.ExecContext(ctx,
+			`UPDATE session_users SET role = 'owner' WHERE session_id = ? AND user_id = ?`,
+			sessionID, toUserID)
+		if err != nil {
+			return fmt.Errorf("failed to promote session member: %w", err)
+		}
+		if rows, err := result.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		} else if rows == 0 {
+			return models.NewCBError(models.ErrCodeSessionNotFound, "user not found in session", nil)
+		}
+
+		return nil
+	})
+}
+
 func (db *DB) GetSessionUsers(ctx context.Context, sessionID int64) ([]*models.SessionUser, error) {
 	query := `
 		SELECT id, session_id, user_id, role, joined_at
 		FROM session_users 
 		WHERE session_id = ?
-		ORDER BY joined_at ASC
+		ORDER BY joined_at ASC, id ASC
 	`
 
 	rows, err := db.conn.QueryContext(ctx, query, sessionID)
@@ -697,15 +1355,19 @@ func (db *DB) GetSessionOwner(ctx context.Context, sessionID int64) (int64, erro
 	return ownerID, nil
 }
 
-func (db *DB) CheckBranchNameExists(ctx context.Context, branchName string) (bool, error) {
+// CheckBranchNameExists reports whether a live session of the repository in the
+// workspace uses the branch (feature) name. Ended and errored sessions don't hold on to
+// their names.
+func (db *DB) CheckBranchNameExists(ctx context.Context, workspaceID, repoURL, branchName string) (bool, error) {
 	query := `
-		SELECT COUNT(*) 
-		FROM sessions 
-		WHERE branch_name = ?
+		SELECT COUNT(*)
+		FROM sessions
+		WHERE slack_workspace_id = ? AND repo_url = ? AND branch_name = ?
+		  AND status NOT IN ('ended', 'error')
 	`
 
 	var count int
-	err := db.conn.QueryRowContext(ctx, query, branchName).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query, workspaceID, repoURL, branchName).Scan(&count)
 	if err != nil {
 		return false, fmt.Errorf("failed to check branch name: %w", err)
 	}
@@ -713,30 +1375,61 @@ func (db *DB) CheckBranchNameExists(ctx context.Context, branchName string) (boo
 	return count > 0, nil
 }
 
-func (db *DB) GetSessionByBranchName(ctx context.Context, branchName string) (*models.Session, error) {
+// GetSessionByBranchName retrieves the workspace's session with a branch (feature) name
+// in the repository repoURL, or in any of its repositories if repoURL is empty. Names
+// can be reused once a session has ended, so a live session is preferred over ended or
+// errored ones, and then the most recent. Without a repository, a name used by live
+// sessions of several repositories is ambiguous and an ErrCodeInvalidCommand error is
+// returned.
+func (db *DB) GetSessionByBranchName(ctx context.Context, workspaceID, repoURL, branchName string) (*models.Session, error) {
 	query := `
 		SELECT id, session_id, slack_workspace_id, slack_channel_id, slack_thread_ts,
 			   repo_url, branch_name, work_tree_path, model_name, running_cost, status,
 			   created_at, updated_at, ended_at
-		FROM sessions 
-		WHERE branch_name = ?
+		FROM sessions
+		WHERE slack_workspace_id = ? AND branch_name = ? AND (? = '' OR repo_url = ?)
+		ORDER BY status IN ('ended', 'error'), created_at DESC, id DESC
+		LIMIT 2
 	`
 
-	var session models.Session
-	err := db.conn.QueryRowContext(ctx, query, branchName).Scan(
-		&session.ID, &session.SessionID, &session.SlackWorkspaceID,
-		&session.SlackChannelID, &session.SlackThreadTS, &session.RepoURL, &session.BranchName,
-		&session.WorkTreePath, &session.ModelName, &session.RunningCost, &session.Status,
-		&session.CreatedAt, &session.UpdatedAt, &session.EndedAt,
-	)
+	rows, err := db.conn.QueryContext(ctx, query, workspaceID, branchName, repoURL, repoURL)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", err)
+		return nil, fmt.Errorf("failed to get session by branch name: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		var session models.Session
+		err := rows.Scan(
+			&session.ID, &session.SessionID, &session.SlackWorkspaceID,
+			&session.SlackChannelID, &session.SlackThreadTS, &session.RepoURL, &session.BranchName,
+			&session.WorkTreePath, &session.ModelName, &session.RunningCost, &session.Status,
+			&session.CreatedAt, &session.UpdatedAt, &session.EndedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
 		}
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("failed to get session by branch name: %w", err)
 	}
 
-	return &session, nil
+	if len(sessions) == 0 {
+		return nil, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", sql.ErrNoRows)
+	}
+	if len(sessions) == 2 && isLiveSession(sessions[1]) && sessions[0].RepoURL != sessions[1].RepoURL {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("feature name '%s' is used by sessions of more than one repository, run the command in the session's thread", branchName), nil)
+	}
+
+	return sessions[0], nil
+}
+
+// isLiveSession reports whether a session still holds on to its feature name
+func isLiveSession(session *models.Session) bool {
+	return session.Status != models.SessionStatusEnded && session.Status != models.SessionStatusError
 }
 
 func (db *DB) IsUserAssociatedWithSession(ctx context.Context, sessionID int64, userID int64) (bool, error) {
@@ -792,8 +1485,168 @@ func (db *DB) RemoveSystemPromptFromUser(ctx context.Context, userID int64, syst
 	return nil
 }
 
+// MCP server operations
+
+func (db *DB) RegisterMCPServer(ctx context.Context, name, config string, createdBy int64) (*models.MCPServer, error) {
+	query := `
+		INSERT INTO mcp_servers (name, config, created_by)
+		VALUES (?, ?, ?)
+		ON CONFLICT(name) 
+		DO UPDATE SET 
+			config = excluded.config,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, name, config, created_by, created_at, updated_at
+	`
+
+	var server models.MCPServer
+	err := db.conn.QueryRowContext(ctx, query, name, config, createdBy).Scan(
+		&server.ID, &server.Name, &server.Config, &server.CreatedBy, &server.CreatedAt, &server.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register MCP server: %w", err)
+	}
+
+	return &server, nil
+}
+
+func (db *DB) GetMCPServers(ctx context.Context) ([]*models.MCPServer, error) {
+	query := `
+		SELECT id, name, config, created_by, created_at, updated_at
+		FROM mcp_servers 
+		ORDER BY name ASC
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MCP servers: %w", err)
+	}
+	defer rows.Close()
+
+	var servers []*models.MCPServer
+	for rows.Next() {
+		var server models.MCPServer
+		err := rows.Scan(
+			&server.ID, &server.Name, &server.Config, &server.CreatedBy, &server.CreatedAt, &server.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan MCP server: %w", err)
+		}
+		servers = append(servers, &server)
+	}
+
+	return servers, nil
+}
+
+// Session summary operations
+
+// SaveSessionSummary stores a session's summary, replacing any earlier summary for the
+// same session (e.g. from before it was restarted)
+func (db *DB) SaveSessionSummary(ctx context.Context, summary *models.SessionSummary) error {
+	query := `
+		INSERT INTO session_summaries (
+			session_id, feature, branch, repo_url, commits, files_changed,
+			insertions, deletions, commit_sha, total_cost, turns, duration_seconds, pr_url
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(session_id)
+		DO UPDATE SET
+			feature = excluded.feature,
+			branch = excluded.branch,
+			repo_url = excluded.repo_url,
+			commits = excluded.commits,
+			files_changed = excluded.files_changed,
+			insertions = excluded.insertions,
+			deletions = excluded.deletions,
+			commit_sha = excluded.commit_sha,
+			total_cost = excluded.total_cost,
+			turns = excluded.turns,
+			duration_seconds = excluded.duration_seconds,
+			pr_url = excluded.pr_url,
+			created_at = CURRENT_TIMESTAMP
+		RETURNING id, created_at
+	`
+
+	err := db.conn.QueryRowContext(ctx, query,
+		summary.SessionID, summary.Feature, summary.Branch, summary.RepoURL, summary.Commits, summary.FilesChanged,
+		summary.Insertions, summary.Deletions, summary.CommitSHA, summary.TotalCost, summary.Turns, summary.DurationSeconds, summary.PRURL,
+	).Scan(&summary.ID, &summary.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save session summary: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) GetSessionSummary(ctx context.Context, sessionDBID int64) (*models.SessionSummary, error) {
+	query := `
+		SELECT id, session_id, feature, branch, repo_url, commits, files_changed,
+			   insertions, deletions, commit_sha, total_cost, turns, duration_seconds, pr_url, created_at
+		FROM session_summaries
+		WHERE session_id = ?
+	`
+
+	var summary models.SessionSummary
+	err := db.conn.QueryRowContext(ctx, query, sessionDBID).Scan(
+		&summary.ID, &summary.SessionID, &summary.Feature, &summary.Branch, &summary.RepoURL, &summary.Commits,
+		&summary.FilesChanged, &summary.Insertions, &summary.Deletions, &summary.CommitSHA, &summary.TotalCost, &summary.Turns, &summary.DurationSeconds, &summary.PRURL, &summary.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.NewCBError(models.ErrCodeSessionNotFound, "session summary not found", err)
+		}
+		return nil, fmt.Errorf("failed to get session summary: %w", err)
+	}
+
+	return &summary, nil
+}
+
+// SetSessionSummaryPRURL records the pull request opened for a stopped session
+func (db *DB) SetSessionSummaryPRURL(ctx context.Context, sessionDBID int64, prURL string) error {
+	query := `UPDATE session_summaries SET pr_url = ? WHERE session_id = ?`
+
+	if _, err := db.conn.ExecContext(ctx, query, prURL, sessionDBID); err != nil {
+		return fmt.Errorf("failed to save pull request URL: %w", err)
+	}
+
+	return nil
+}
+
+// User preference operations
+
+// GetUserPrefs returns a user's preferences, or the defaults if they haven't set any
+func (db *DB) GetUserPrefs(ctx context.Context, userID int64) (*models.UserPrefs, error) {
+	query := `SELECT user_id, notify, updated_at FROM user_prefs WHERE user_id = ?`
+
+	var prefs models.UserPrefs
+	err := db.conn.QueryRowContext(ctx, query, userID).Scan(&prefs.UserID, &prefs.Notify, &prefs.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return &models.UserPrefs{UserID: userID, Notify: models.NotifyOn}, nil
+		}
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
+	}
+
+	return &prefs, nil
+}
+
+// SetNotifyPreference sets when the user is @-mentioned on session events
+func (db *DB) SetNotifyPreference(ctx context.Context, userID int64, notify string) error {
+	query := `
+		INSERT INTO user_prefs (user_id, notify)
+		VALUES (?, ?)
+		ON CONFLICT(user_id)
+		DO UPDATE SET notify = excluded.notify, updated_at = CURRENT_TIMESTAMP
+	`
+
+	if _, err := db.conn.ExecContext(ctx, query, userID, notify); err != nil {
+		return fmt.Errorf("failed to save notification preference: %w", err)
+	}
+
+	return nil
+}
+
 // Transaction helper
-func (db *DB) WithTx(ctx context.Context, fn func(*sql.Tx) error) error {
+func (db *DB) WithTx(ctx context.Context, fn func(*Tx) error) (err error) {
 	tx, err := db.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -0,0 +1,7 @@
+//go:build postgres
+
+package db
+
+// The Postgres driver is only linked into builds tagged postgres, keeping it out of the
+// default SQLite-only binary
+import _ "github.com/jackc/pgx/v5/stdlib"
@@ -0,0 +1,141 @@
+//go:build postgres
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// openPostgresTestDB opens the Postgres database at TEST_POSTGRES_DSN in a schema of its
+// own, dropped when the test ends. Start one with, for example:
+//
+//	docker run --rm -e POSTGRES_PASSWORD=cb -p 5432:5432 postgres:16
+//	TEST_POSTGRES_DSN=postgres://postgres:cb@localhost:5432/postgres go test -tags postgres ./internal/db
+func openPostgresTestDB(t *testing.T) (*DB, string) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+
+	admin, err := sql.Open(postgresDriverName, dsn)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("cb_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	if strings.Contains(dsn, "://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		dsn += separator + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+
+	encryptor, err := crypto.NewEncryptor("test-encryption-key-that-is-32-bytes-long")
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	database, err := Open(DriverPostgres, dsn, encryptor)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database, dsn
+}
+
+func TestPostgres(t *testing.T) {
+	database, dsn := openPostgresTestDB(t)
+	ctx := context.Background()
+
+	// Migrations already applied are skipped
+	encryptor, _ := crypto.NewEncryptor("test-encryption-key-that-is-32-bytes-long")
+	reopened, err := Open(DriverPostgres, dsn, encryptor)
+	if err != nil {
+		t.Fatalf("reopening error = %v", err)
+	}
+	reopened.Close()
+
+	owner, err := database.CreateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	if err := database.StoreCredential(ctx, owner.ID, models.CredentialTypeGitHub, "ghp_secret"); err != nil {
+		t.Fatalf("StoreCredential() error = %v", err)
+	}
+	if got, err := database.GetCredential(ctx, owner.ID, models.CredentialTypeGitHub); err != nil || got != "ghp_secret" {
+		t.Errorf("GetCredential() = %q, %v, want the stored token", got, err)
+	}
+
+	newSession := func(feature string) *models.Session {
+		return &models.Session{
+			SessionID:        "claude-" + feature,
+			SlackWorkspaceID: "T123456",
+			SlackChannelID:   "C123456",
+			SlackThreadTS:    feature,
+			RepoURL:          "https://github.com/test/repo",
+			BranchName:       feature,
+			WorkTreePath:     "/tmp/" + feature,
+			ModelName:        models.ModelSonnet,
+			Status:           models.SessionStatusActive,
+		}
+	}
+	session := newSession("login-page")
+	if err := database.CreateSessionWithOwner(ctx, session, owner.ID); err != nil {
+		t.Fatalf("CreateSessionWithOwner() error = %v", err)
+	}
+
+	duplicate := newSession("login-page")
+	duplicate.SlackThreadTS = "other-thread"
+	err = database.CreateSessionWithOwner(ctx, duplicate, owner.ID)
+	var cbErr *models.CBError
+	if !errors.As(err, &cbErr) || cbErr.Code != models.ErrCodeSessionExists {
+		t.Errorf("creating a duplicate feature error = %v, want %s", err, models.ErrCodeSessionExists)
+	}
+
+	total, err := database.AddSessionCostByID(ctx, session.ID, 1.25)
+	if err != nil || total != 1.25 {
+		t.Errorf("AddSessionCostByID() = %v, %v, want 1.25", total, err)
+	}
+
+	sessions, err := database.GetActiveSessionsByUser(ctx, owner.ID, 0, 0)
+	if err != nil || len(sessions) != 1 || sessions[0].BranchName != "login-page" {
+		t.Errorf("GetActiveSessionsByUser() = %v, %v, want the session", sessions, err)
+	}
+
+	if err := database.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusEnded); err != nil {
+		t.Fatalf("UpdateSessionStatusByID() error = %v", err)
+	}
+	ended, err := database.GetSessionByID(ctx, session.ID)
+	if err != nil || ended.Status != models.SessionStatusEnded || ended.EndedAt == nil {
+		t.Errorf("ended session = %+v, %v, want it ended", ended, err)
+	}
+
+	// The feature name is free again once the session has ended
+	if err := database.CreateSessionWithOwner(ctx, duplicate, owner.ID); err != nil {
+		t.Errorf("reusing an ended session's feature error = %v", err)
+	}
+}
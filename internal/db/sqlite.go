@@ -1,51 +1,120 @@
 package db
 
 import (
+	"crypto/sha256"
 	"database/sql"
 	"embed"
+	"encoding/hex"
 	"fmt"
-	"path/filepath"
+	"io/fs"
+	"slices"
 	"sort"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
 )
 
-//go:embed migrations/*.sql
+//go:embed migrations/*.sql migrations/postgres/*.sql
 var migrationFiles embed.FS
 
+// postgresDriverName is the database/sql driver registered by the pgx driver, which
+// builds tagged postgres link in
+const postgresDriverName = "pgx"
+
 type DB struct {
-	conn *sql.DB
+	conn      *conn
+	encryptor *crypto.Encryptor
+}
+
+// NewDB opens the SQLite database at dbPath and runs migrations. Credentials are
+// encrypted at rest with encryptor.
+func NewDB(dbPath string, encryptor *crypto.Encryptor) (*DB, error) {
+	return Open(DriverSQLite, dbPath, encryptor)
 }
 
-func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on")
+// Open opens a database with driver, DriverSQLite (the default when empty) or
+// DriverPostgres, and runs migrations. For SQLite dsn is the database path; for Postgres
+// it is a connection string. Credentials are encrypted at rest with encryptor.
+func Open(driver, dsn string, encryptor *crypto.Encryptor) (*DB, error) {
+	if encryptor == nil {
+		return nil, fmt.Errorf("an encryptor is required")
+	}
+	if driver == "" {
+		driver = DriverSQLite
+	}
+
+	var sqlDB *sql.DB
+	var err error
+	switch driver {
+	case DriverSQLite:
+		// Concurrent writers wait for each other rather than failing with "database is locked".
+		// WAL lets readers proceed while a write is in progress, and transactions take the
+		// write lock up front so one never fails upgrading from a read lock.
+		sqlDB, err = sql.Open("sqlite3", dsn+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate")
+	case DriverPostgres:
+		if !slices.Contains(sql.Drivers(), postgresDriverName) {
+			return nil, fmt.Errorf("this binary was built without Postgres support; rebuild it with -tags postgres")
+		}
+		sqlDB, err = sql.Open(postgresDriverName, dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	db := &DB{conn: conn}
-	
+	db := &DB{conn: &conn{DB: sqlDB, dialect: dialect(driver)}, encryptor: encryptor}
+	db.SetMaxConnections(defaultMaxConnections)
+
 	if err := db.runMigrations(); err != nil {
-		conn.Close()
+		sqlDB.Close()
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
 	return db, nil
 }
 
+// Connection pool bounds. SQLite allows a single writer at a time, so connections beyond
+// a handful only queue up for the write lock; Postgres servers limit connections too.
+const (
+	defaultMaxConnections = 10
+	maxConnections        = 32
+)
+
+// SetMaxConnections sets the size of the connection pool, capped at maxConnections.
+// Idle connections are kept up to the same limit.
+func (db *DB) SetMaxConnections(n int) {
+	n = max(1, min(n, maxConnections))
+	db.conn.SetMaxOpenConns(n)
+	db.conn.SetMaxIdleConns(n)
+}
+
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
 func (db *DB) runMigrations() error {
+	migrations, err := fs.Sub(migrationFiles, db.conn.dialect.migrationsDir())
+	if err != nil {
+		return fmt.Errorf("failed to read migration files: %w", err)
+	}
+	return db.applyMigrations(migrations)
+}
+
+// applyMigrations runs the .sql files in fsys that haven't been applied yet, in name
+// order, recording a checksum of each. A recorded migration whose file has changed
+// since is an error: the edit would otherwise never be applied and the schema would
+// silently drift from the migrations.
+func (db *DB) applyMigrations(fsys fs.FS) error {
 	// Create migrations table if it doesn't exist
 	if err := db.createMigrationsTable(); err != nil {
 		return err
 	}
 
 	// Get migration files
-	files, err := migrationFiles.ReadDir("migrations")
+	files, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return fmt.Errorf("failed to read migration files: %w", err)
 	}
@@ -56,35 +125,54 @@ func (db *DB) runMigrations() error {
 	})
 
 	// Run each migration
+	versions := make(map[string]string)
 	for _, file := range files {
 		if !strings.HasSuffix(file.Name(), ".sql") {
 			continue
 		}
 
 		migrationName := strings.TrimSuffix(file.Name(), ".sql")
-		
+
+		// Two migrations with the same version would run in an arbitrary order
+		version, _, _ := strings.Cut(migrationName, "_")
+		if other, ok := versions[version]; ok {
+			return fmt.Errorf("migrations %s and %s have the same version %s", other, migrationName, version)
+		}
+		versions[version] = migrationName
+
+		content, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return fmt.Errorf("failed to read migration %s: %w", file.Name(), err)
+		}
+		checksum := migrationChecksum(content)
+
 		// Check if migration has already been applied
-		applied, err := db.isMigrationApplied(migrationName)
+		recorded, applied, err := db.appliedMigrationChecksum(migrationName)
 		if err != nil {
 			return fmt.Errorf("failed to check migration status: %w", err)
 		}
-		
+
 		if applied {
+			switch recorded {
+			case checksum:
+			case "":
+				// Applied before checksums were recorded; trust the current file
+				if err := db.setMigrationChecksum(migrationName, checksum); err != nil {
+					return fmt.Errorf("failed to record migration checksum: %w", err)
+				}
+			default:
+				return fmt.Errorf("migration %s has changed since it was applied (checksum %s, applied %s); "+
+					"restore the original file and add a new migration for the change", migrationName, checksum, recorded)
+			}
 			continue
 		}
 
-		// Read and execute migration
-		content, err := migrationFiles.ReadFile(filepath.Join("migrations", file.Name()))
-		if err != nil {
-			return fmt.Errorf("failed to read migration %s: %w", file.Name(), err)
-		}
-
 		if _, err := db.conn.Exec(string(content)); err != nil {
 			return fmt.Errorf("failed to execute migration %s: %w", file.Name(), err)
 		}
 
 		// Mark migration as applied
-		if err := db.markMigrationApplied(migrationName); err != nil {
+		if err := db.markMigrationApplied(migrationName, checksum); err != nil {
 			return fmt.Errorf("failed to mark migration as applied: %w", err)
 		}
 	}
@@ -92,31 +180,77 @@ func (db *DB) runMigrations() error {
 	return nil
 }
 
+// migrationChecksum returns the hex SHA-256 of a migration file
+func migrationChecksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
 func (db *DB) createMigrationsTable() error {
+	if db.conn.dialect == postgresDialect {
+		_, err := db.conn.Exec(`
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				id BIGSERIAL PRIMARY KEY,
+				migration_name TEXT UNIQUE NOT NULL,
+				checksum TEXT NOT NULL DEFAULT '',
+				applied_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);
+		`)
+		return err
+	}
+
 	query := `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			migration_name TEXT UNIQUE NOT NULL,
+			checksum TEXT NOT NULL DEFAULT '',
 			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		);
 	`
-	_, err := db.conn.Exec(query)
-	return err
+	if _, err := db.conn.Exec(query); err != nil {
+		return err
+	}
+
+	// Tables created before checksums were recorded lack the column
+	var hasChecksum int
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info('schema_migrations') WHERE name = 'checksum'").Scan(&hasChecksum)
+	if err != nil {
+		return fmt.Errorf("failed to inspect schema_migrations: %w", err)
+	}
+	if hasChecksum == 0 {
+		if _, err := db.conn.Exec("ALTER TABLE schema_migrations ADD COLUMN checksum TEXT NOT NULL DEFAULT ''"); err != nil {
+			return fmt.Errorf("failed to add checksum to schema_migrations: %w", err)
+		}
+	}
+
+	return nil
 }
 
-func (db *DB) isMigrationApplied(migrationName string) (bool, error) {
-	query := "SELECT COUNT(*) FROM schema_migrations WHERE migration_name = ?"
-	var count int
-	err := db.conn.QueryRow(query, migrationName).Scan(&count)
+// appliedMigrationChecksum returns the checksum recorded for a migration and whether
+// it has been applied. Migrations applied before checksums were recorded have an
+// empty checksum.
+func (db *DB) appliedMigrationChecksum(migrationName string) (string, bool, error) {
+	query := "SELECT checksum FROM schema_migrations WHERE migration_name = ?"
+	var checksum string
+	err := db.conn.QueryRow(query, migrationName).Scan(&checksum)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
 	if err != nil {
-		return false, err
+		return "", false, err
 	}
-	return count > 0, nil
+	return checksum, true, nil
+}
+
+func (db *DB) markMigrationApplied(migrationName, checksum string) error {
+	query := "INSERT INTO schema_migrations (migration_name, checksum) VALUES (?, ?)"
+	_, err := db.conn.Exec(query, migrationName, checksum)
+	return err
 }
 
-func (db *DB) markMigrationApplied(migrationName string) error {
-	query := "INSERT INTO schema_migrations (migration_name) VALUES (?)"
-	_, err := db.conn.Exec(query, migrationName)
+func (db *DB) setMigrationChecksum(migrationName, checksum string) error {
+	query := "UPDATE schema_migrations SET checksum = ? WHERE migration_name = ?"
+	_, err := db.conn.Exec(query, checksum, migrationName)
 	return err
 }
 
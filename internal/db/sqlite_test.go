@@ -0,0 +1,284 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	encryptor, err := crypto.NewEncryptor("test-encryption-key-that-is-32-bytes-long")
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	database, err := NewDB(filepath.Join(t.TempDir(), "test.db"), encryptor)
+	if err != nil {
+		t.Fatalf("NewDB() error = %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestNewDBUsesWAL(t *testing.T) {
+	database := openTestDB(t)
+
+	var mode string
+	if err := database.conn.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil {
+		t.Fatalf("Failed to read journal mode: %v", err)
+	}
+	if mode != "wal" {
+		t.Errorf("journal_mode = %q, want wal", mode)
+	}
+
+	var timeout int
+	if err := database.conn.QueryRow("PRAGMA busy_timeout").Scan(&timeout); err != nil {
+		t.Fatalf("Failed to read busy timeout: %v", err)
+	}
+	if timeout != 5000 {
+		t.Errorf("busy_timeout = %d, want 5000", timeout)
+	}
+}
+
+func TestSetMaxConnections(t *testing.T) {
+	database := openTestDB(t)
+
+	tests := []struct {
+		n    int
+		want int
+	}{
+		{n: 5, want: 5},
+		{n: 0, want: 1},
+		{n: 1000, want: maxConnections},
+	}
+	for _, tt := range tests {
+		database.SetMaxConnections(tt.n)
+		if got := database.conn.Stats().MaxOpenConnections; got != tt.want {
+			t.Errorf("SetMaxConnections(%d) max open = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	owner, err := database.CreateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	const writers, writes = 8, 10
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*writes*2)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < writes; i++ {
+				feature := fmt.Sprintf("feature-%d-%d", w, i)
+				session := &models.Session{
+					SessionID:        "claude-" + feature,
+					SlackWorkspaceID: "T123456",
+					SlackChannelID:   "C123456",
+					SlackThreadTS:    feature,
+					RepoURL:          "https://github.com/test/repo",
+					BranchName:       feature,
+					WorkTreePath:     "/tmp/" + feature,
+					ModelName:        models.ModelSonnet,
+					Status:           models.SessionStatusActive,
+				}
+				if err := database.CreateSessionWithOwner(ctx, session, owner.ID); err != nil {
+					errs <- err
+					continue
+				}
+				// Reads interleave with the other writers
+				if _, err := database.GetActiveSessionsByUser(ctx, owner.ID, 0, 0); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent access error = %v", err)
+	}
+	sessions, err := database.GetActiveSessionsByUser(ctx, owner.ID, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to get sessions: %v", err)
+	}
+	if len(sessions) != writers*writes {
+		t.Errorf("created %d sessions, want %d", len(sessions), writers*writes)
+	}
+}
+
+func TestSumCost(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	newUser := func(workspaceID, slackUserID string) *models.User {
+		user, err := database.CreateUser(ctx, &models.CreateUserRequest{
+			SlackWorkspaceID: workspaceID,
+			SlackUserID:      slackUserID,
+			SlackUserName:    slackUserID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	alice := newUser("T111", "UALICE")
+	bob := newUser("T111", "UBOB")
+	carol := newUser("T222", "UCAROL")
+
+	newSession := func(owner *models.User, feature string, cost float64, createdAt string) {
+		session := &models.Session{
+			SessionID:        "claude-" + feature,
+			SlackWorkspaceID: owner.SlackWorkspaceID,
+			SlackChannelID:   "C123456",
+			SlackThreadTS:    feature,
+			RepoURL:          "https://github.com/test/repo",
+			BranchName:       feature,
+			WorkTreePath:     "/tmp/" + feature,
+			ModelName:        models.ModelSonnet,
+			RunningCost:      cost,
+			Status:           models.SessionStatusEnded,
+		}
+		if err := database.CreateSessionWithOwner(ctx, session, owner.ID); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if createdAt != "" {
+			if _, err := database.conn.Exec("UPDATE sessions SET created_at = ? WHERE id = ?", createdAt, session.ID); err != nil {
+				t.Fatalf("Failed to backdate session: %v", err)
+			}
+		}
+	}
+	newSession(alice, "alice-recent", 1.50, "")
+	newSession(alice, "alice-old", 4.00, "2000-01-01 00:00:00")
+	newSession(bob, "bob-recent", 0.25, "")
+	newSession(carol, "carol-recent", 8.00, "")
+
+	// Bob joining Alice's session doesn't make its cost his
+	if err := database.AddUserToSession(ctx, 1, bob.ID, models.SessionRoleCollaborator); err != nil {
+		t.Fatalf("Failed to add collaborator: %v", err)
+	}
+
+	lastWeek := time.Now().Add(-7 * 24 * time.Hour)
+	tests := []struct {
+		name string
+		sum  func() (float64, error)
+		want float64
+	}{
+		{name: "user since", sum: func() (float64, error) { return database.SumCostByUser(ctx, alice.ID, lastWeek) }, want: 1.50},
+		{name: "user all time", sum: func() (float64, error) { return database.SumCostByUser(ctx, alice.ID, time.Time{}) }, want: 5.50},
+		{name: "collaborator", sum: func() (float64, error) { return database.SumCostByUser(ctx, bob.ID, lastWeek) }, want: 0.25},
+		{name: "workspace since", sum: func() (float64, error) { return database.SumCostByWorkspace(ctx, "T111", lastWeek) }, want: 1.75},
+		{name: "workspace all time", sum: func() (float64, error) { return database.SumCostByWorkspace(ctx, "T111", time.Time{}) }, want: 5.75},
+		{name: "empty workspace", sum: func() (float64, error) { return database.SumCostByWorkspace(ctx, "T999", time.Time{}) }, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.sum()
+			if err != nil {
+				t.Fatalf("sum error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("sum = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveWorkspace(t *testing.T) {
+	database := openTestDB(t)
+	ctx := context.Background()
+
+	newUser := func(workspaceID, slackUserID string) *models.User {
+		user, err := database.CreateUser(ctx, &models.CreateUserRequest{
+			SlackWorkspaceID: workspaceID,
+			SlackUserID:      slackUserID,
+			SlackUserName:    slackUserID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	alice := newUser("T111", "UALICE")
+	newUser("T111", "UBOB")
+	// Bob has been seen under the organization already
+	newUser("E999", "UBOB")
+	if err := database.StoreCredential(ctx, alice.ID, models.CredentialTypeGitHub, "ghp_secret"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	newSession := func(workspaceID, feature, threadTS string) *models.Session {
+		session := &models.Session{
+			SessionID:        "claude-" + workspaceID + "-" + feature,
+			SlackWorkspaceID: workspaceID,
+			SlackChannelID:   "C123456",
+			SlackThreadTS:    threadTS,
+			RepoURL:          "https://github.com/test/repo",
+			BranchName:       feature,
+			WorkTreePath:     "/tmp/" + feature,
+			ModelName:        models.ModelSonnet,
+			Status:           models.SessionStatusActive,
+		}
+		if err := database.CreateSessionWithOwner(ctx, session, alice.ID); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		return session
+	}
+	moved := newSession("T111", "login-page", "1.1")
+	threadClash := newSession("T111", "signup-page", "2.2")
+	branchClash := newSession("T111", "search-page", "3.3")
+	newSession("E999", "other-page", "2.2")
+	newSession("E999", "search-page", "4.4")
+
+	users, sessions, err := database.MoveWorkspace(ctx, "T111", "E999")
+	if err != nil {
+		t.Fatalf("MoveWorkspace() error = %v", err)
+	}
+	if users != 1 || sessions != 1 {
+		t.Errorf("MoveWorkspace() moved %d users and %d sessions, want 1 and 1", users, sessions)
+	}
+
+	// Alice and her credentials are found under the organization
+	found, err := database.GetUserBySlackID(ctx, "E999", "UALICE")
+	if err != nil || found.ID != alice.ID {
+		t.Fatalf("GetUserBySlackID(E999) = %v, %v, want Alice's record", found, err)
+	}
+	if got, err := database.GetCredential(ctx, found.ID, models.CredentialTypeGitHub); err != nil || got != "ghp_secret" {
+		t.Errorf("GetCredential() = %q, %v, want the stored token", got, err)
+	}
+	if session, err := database.GetActiveSessionForChannel(ctx, "E999", "C123456", "1.1"); err != nil || session.ID != moved.ID {
+		t.Errorf("GetActiveSessionForChannel(E999) = %v, %v, want the moved session", session, err)
+	}
+
+	// Clashing records stay under the team
+	if _, err := database.GetUserBySlackID(ctx, "T111", "UBOB"); err != nil {
+		t.Errorf("Bob's team record was moved: %v", err)
+	}
+	for _, session := range []*models.Session{threadClash, branchClash} {
+		stored, err := database.GetSessionByID(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if stored.SlackWorkspaceID != "T111" {
+			t.Errorf("session %s moved to %s, want it kept under T111", session.BranchName, stored.SlackWorkspaceID)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// Store is the database's operations, as the session manager uses them. *DB implements
+// it on SQLite and on Postgres.
+type Store interface {
+	// Users and credentials
+	CreateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error)
+	GetUserBySlackID(ctx context.Context, workspaceID, userID string) (*models.User, error)
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	StoreCredential(ctx context.Context, userID int64, credType, value string) error
+	GetCredential(ctx context.Context, userID int64, credType string) (string, error)
+	DeleteCredential(ctx context.Context, userID int64, credType string) error
+	RotateCredentials(ctx context.Context, oldKey, newKey string) (*CredentialRotation, error)
+	HasCredential(ctx context.Context, userID int64, credType string) (bool, error)
+	MoveWorkspace(ctx context.Context, fromID, toID string) (users, sessions int64, err error)
+
+	// Sessions
+	CreateSession(ctx context.Context, session *models.Session) error
+	CreateSessionWithOwner(ctx context.Context, session *models.Session, ownerID int64) error
+	GetSession(ctx context.Context, sessionID string) (*models.Session, error)
+	GetSessionByID(ctx context.Context, id int64) (*models.Session, error)
+	GetSessionByIdempotencyKey(ctx context.Context, idempotencyKey string) (*models.Session, error)
+	GetLatestSessionForChannel(ctx context.Context, workspaceID, channelID, threadTS string) (*models.Session, error)
+	SaveSessionSetupRequest(ctx context.Context, sessionDBID int64, setupRequest string) error
+	GetSessionSetupRequest(ctx context.Context, sessionDBID int64) (string, error)
+	GetSessionMaxCost(ctx context.Context, sessionDBID int64) (float64, error)
+	GetActiveSessionForChannel(ctx context.Context, workspaceID, channelID, threadTS string) (*models.Session, error)
+	GetActiveSessionsByUser(ctx context.Context, userID int64, limit, offset int) ([]*models.Session, error)
+	GetSessionCountByUser(ctx context.Context, userID int64) (int, error)
+	CountActiveSessionsByUser(ctx context.Context, userID int64) (int, error)
+	GetUserTotalCost(ctx context.Context, userID int64) (float64, error)
+	SumCostByUser(ctx context.Context, userID int64, since time.Time) (float64, error)
+	SumCostByWorkspace(ctx context.Context, workspaceID string, since time.Time) (float64, error)
+	UpdateSessionStatus(ctx context.Context, sessionID, status string) error
+	ResumeDetachedSessions(ctx context.Context) (int64, error)
+	UpdateSessionCost(ctx context.Context, sessionID string, cost float64) error
+	UpdateSessionThread(ctx context.Context, sessionID string, newThreadTS string) error
+	UpdateSessionByID(ctx context.Context, sessionDBID int64, sessionID string) error
+	UpdateSessionWorkTreePath(ctx context.Context, sessionDBID int64, workTreePath string) error
+	UpdateSessionStatusByID(ctx context.Context, sessionDBID int64, status string) error
+	AddSessionTurns(ctx context.Context, sessionDBID int64, turns int) error
+	GetSessionTurns(ctx context.Context, sessionDBID int64) (int, error)
+	AddSessionCostByID(ctx context.Context, sessionDBID int64, cost float64) (float64, error)
+	GetAllActiveSessions(ctx context.Context) ([]*models.Session, error)
+	GetLiveSessionRepoURLs(ctx context.Context) ([]string, error)
+	GetLiveSessionWorkTreePaths(ctx context.Context) ([]string, error)
+
+	// Session messages
+	CreateSessionMessage(ctx context.Context, sessionID int64, messageTS, direction, content string) error
+	GetSessionMessages(ctx context.Context, sessionID int64, limit int) ([]*models.SessionMessage, error)
+
+	// System prompts
+	CreateSystemPrompt(ctx context.Context, req *models.CreateSystemPromptRequest) (*models.SystemPrompt, error)
+	GetSystemPrompt(ctx context.Context, id int64) (*models.SystemPrompt, error)
+	GetSystemPromptsByUser(ctx context.Context, userID int64) ([]*models.SystemPrompt, error)
+	GetSystemPromptByName(ctx context.Context, userID int64, name string) (*models.SystemPrompt, error)
+	SystemPromptNameExists(ctx context.Context, userID int64, name string) (bool, error)
+	UpdateSystemPrompt(ctx context.Context, req *models.UpdateSystemPromptRequest) (*models.SystemPrompt, error)
+	DeleteSystemPrompt(ctx context.Context, id int64) error
+
+	// Session membership
+	AddUserToSession(ctx context.Context, sessionID int64, userID int64, role string) error
+	RemoveUserFromSession(ctx context.Context, sessionID int64, userID int64) error
+	TransferSessionOwnership(ctx context.Context, sessionID, fromUserID, toUserID int64) error
+	GetSessionUsers(ctx context.Context, sessionID int64) ([]*models.SessionUser, error)
+	GetUserRole(ctx context.Context, sessionID int64, userID int64) (string, error)
+	GetSessionOwner(ctx context.Context, sessionID int64) (int64, error)
+	CheckBranchNameExists(ctx context.Context, workspaceID, repoURL, branchName string) (bool, error)
+	GetSessionByBranchName(ctx context.Context, workspaceID, repoURL, branchName string) (*models.Session, error)
+	IsUserAssociatedWithSession(ctx context.Context, sessionID int64, userID int64) (bool, error)
+	AddSystemPromptToUser(ctx context.Context, userID int64, systemPromptID int64) error
+	RemoveSystemPromptFromUser(ctx context.Context, userID int64, systemPromptID int64) error
+
+	// MCP servers
+	RegisterMCPServer(ctx context.Context, name, config string, createdBy int64) (*models.MCPServer, error)
+	GetMCPServers(ctx context.Context) ([]*models.MCPServer, error)
+
+	// Summaries and preferences
+	SaveSessionSummary(ctx context.Context, summary *models.SessionSummary) error
+	GetSessionSummary(ctx context.Context, sessionDBID int64) (*models.SessionSummary, error)
+	SetSessionSummaryPRURL(ctx context.Context, sessionDBID int64, prURL string) error
+	GetUserPrefs(ctx context.Context, userID int64) (*models.UserPrefs, error)
+	SetNotifyPreference(ctx context.Context, userID int64, notify string) error
+
+	Ping() error
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
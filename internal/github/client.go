@@ -0,0 +1,190 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/repo"
+)
+
+// DefaultAPIURL is the base URL of the public GitHub REST API
+const DefaultAPIURL = "https://api.github.com"
+
+var (
+	// ErrNotGitHub is returned for repositories that aren't hosted on github.com
+	ErrNotGitHub = errors.New("repository is not hosted on github.com")
+
+	// ErrTokenScope is returned when the token is rejected or can't write to the repository
+	ErrTokenScope = errors.New("GitHub token is invalid or lacks the repo scope")
+
+	// ErrInvalidToken is returned when GitHub doesn't accept the token at all
+	ErrInvalidToken = errors.New("GitHub token is invalid")
+)
+
+// Client calls the GitHub REST API
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewClient creates a GitHub API client. An empty baseURL uses DefaultAPIURL and a nil
+// httpClient a client with a 30 second timeout.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if baseURL == "" {
+		baseURL = DefaultAPIURL
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// PullRequest describes a pull request to open
+type PullRequest struct {
+	Title string `json:"title"`
+	Head  string `json:"head"`
+	Base  string `json:"base"`
+	Body  string `json:"body,omitempty"`
+}
+
+// APIError is an unexpected error response from the GitHub API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("GitHub API returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("GitHub API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// ParseRepoURL returns the owner and name of a github.com repository from any form of
+// its URL that repo.NormalizeRepoURL accepts
+func ParseRepoURL(repoURL string) (string, string, error) {
+	_, host, owner, name, err := repo.NormalizeRepoURL(repoURL)
+	if err != nil {
+		return "", "", err
+	}
+	if host != "github.com" {
+		return "", "", ErrNotGitHub
+	}
+	if strings.Contains(owner, "/") {
+		return "", "", fmt.Errorf("can't find owner/repo in %s", repoURL)
+	}
+
+	return owner, name, nil
+}
+
+// CreatePullRequest opens a pull request on owner/repo and returns its URL
+func (c *Client) CreatePullRequest(ctx context.Context, token, owner, repo string, pr *PullRequest) (string, error) {
+	body, err := json.Marshal(pr)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode pull request: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/pulls", c.baseURL, url.PathEscape(owner), url.PathEscape(repo))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to call GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", fmt.Errorf("failed to read GitHub API response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusCreated:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return "", ErrTokenScope
+	case http.StatusNotFound:
+		// GitHub hides private repositories the token can't see behind a 404
+		return "", fmt.Errorf("%w, or %s/%s doesn't exist", ErrTokenScope, owner, repo)
+	default:
+		return "", newAPIError(resp.StatusCode, data)
+	}
+
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.Unmarshal(data, &created); err != nil {
+		return "", fmt.Errorf("failed to decode GitHub API response: %w", err)
+	}
+	return created.HTMLURL, nil
+}
+
+// VerifyToken checks that GitHub accepts the token by fetching the authenticated user
+func (c *Client) VerifyToken(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/user", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read GitHub API response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return ErrInvalidToken
+	default:
+		return newAPIError(resp.StatusCode, data)
+	}
+}
+
+// newAPIError builds an APIError from an error response, including the validation
+// errors GitHub returns with 422s (e.g. "A pull request already exists")
+func newAPIError(statusCode int, data []byte) *APIError {
+	var payload struct {
+		Message string `json:"message"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return &APIError{StatusCode: statusCode}
+	}
+
+	messages := []string{payload.Message}
+	for _, e := range payload.Errors {
+		if e.Message != "" {
+			messages = append(messages, e.Message)
+		}
+	}
+	return &APIError{StatusCode: statusCode, Message: strings.Join(messages, ": ")}
+}
@@ -0,0 +1,192 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRepoURL(t *testing.T) {
+	tests := []struct {
+		repoURL   string
+		wantOwner string
+		wantRepo  string
+		wantErr   error
+	}{
+		{repoURL: "https://github.com/pbdeuchler/cb", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "https://github.com/pbdeuchler/cb.git", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "https://github.com/pbdeuchler/cb/", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "git@github.com:pbdeuchler/cb.git", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "ssh://git@github.com/pbdeuchler/cb.git", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "https://gitlab.com/pbdeuchler/cb", wantErr: ErrNotGitHub},
+		{repoURL: "git@gitlab.com:pbdeuchler/cb.git", wantErr: ErrNotGitHub},
+		{repoURL: "/tmp/origin.git", wantErr: ErrNotGitHub},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(t *testing.T) {
+			owner, repo, err := ParseRepoURL(tt.repoURL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseRepoURL() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRepoURL() error = %v", err)
+			}
+			if owner != tt.wantOwner || repo != tt.wantRepo {
+				t.Errorf("ParseRepoURL() = %s/%s, want %s/%s", owner, repo, tt.wantOwner, tt.wantRepo)
+			}
+		})
+	}
+
+	if _, _, err := ParseRepoURL("https://github.com/pbdeuchler"); err == nil {
+		t.Error("ParseRepoURL() without a repo name error = nil, want error")
+	}
+}
+
+func TestCreatePullRequest(t *testing.T) {
+	var gotPath, gotAuth string
+	var gotPR PullRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.Method + " " + r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&gotPR); err != nil {
+			t.Errorf("failed to decode request body: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number": 7, "html_url": "https://github.com/pbdeuchler/cb/pull/7"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, server.Client())
+	prURL, err := client.CreatePullRequest(context.Background(), "ghp_test", "pbdeuchler", "cb", &PullRequest{
+		Title: "Add widgets",
+		Head:  "widgets",
+		Base:  "main",
+	})
+	if err != nil {
+		t.Fatalf("CreatePullRequest() error = %v", err)
+	}
+
+	if prURL != "https://github.com/pbdeuchler/cb/pull/7" {
+		t.Errorf("CreatePullRequest() = %q, want the PR URL", prURL)
+	}
+	if gotPath != "POST /repos/pbdeuchler/cb/pulls" {
+		t.Errorf("request = %q, want POST /repos/pbdeuchler/cb/pulls", gotPath)
+	}
+	if gotAuth != "Bearer ghp_test" {
+		t.Errorf("Authorization = %q, want the token", gotAuth)
+	}
+	if gotPR.Title != "Add widgets" || gotPR.Head != "widgets" || gotPR.Base != "main" {
+		t.Errorf("request body = %+v, want the pull request", gotPR)
+	}
+}
+
+func TestCreatePullRequestErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantErr    error
+		wantSubstr string
+	}{
+		{name: "bad token", status: http.StatusUnauthorized, body: `{"message": "Bad credentials"}`, wantErr: ErrTokenScope},
+		{name: "missing scope", status: http.StatusForbidden, body: `{"message": "Resource not accessible by personal access token"}`, wantErr: ErrTokenScope},
+		{name: "hidden repo", status: http.StatusNotFound, body: `{"message": "Not Found"}`, wantErr: ErrTokenScope},
+		{
+			name:       "already exists",
+			status:     http.StatusUnprocessableEntity,
+			body:       `{"message": "Validation Failed", "errors": [{"message": "A pull request already exists for pbdeuchler:widgets."}]}`,
+			wantSubstr: "A pull request already exists",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, server.Client())
+			_, err := client.CreatePullRequest(context.Background(), "ghp_test", "pbdeuchler", "cb", &PullRequest{
+				Title: "Add widgets",
+				Head:  "widgets",
+				Base:  "main",
+			})
+			if err == nil {
+				t.Fatal("CreatePullRequest() error = nil, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("CreatePullRequest() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantSubstr != "" && !strings.Contains(err.Error(), tt.wantSubstr) {
+				t.Errorf("CreatePullRequest() error = %v, want it to contain %q", err, tt.wantSubstr)
+			}
+		})
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantErr    error
+		wantSubstr string
+	}{
+		{name: "accepted", status: http.StatusOK, body: `{"login": "octocat"}`},
+		{name: "rejected", status: http.StatusUnauthorized, body: `{"message": "Bad credentials"}`, wantErr: ErrInvalidToken},
+		{name: "rate limited", status: http.StatusForbidden, body: `{"message": "API rate limit exceeded"}`, wantSubstr: "rate limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotAuth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.Method + " " + r.URL.Path
+				gotAuth = r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			err := NewClient(server.URL, server.Client()).VerifyToken(context.Background(), "ghp_test")
+			if gotPath != "GET /user" || gotAuth != "Bearer ghp_test" {
+				t.Errorf("request = %q with Authorization %q, want GET /user with the token", gotPath, gotAuth)
+			}
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("VerifyToken() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantSubstr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantSubstr) {
+					t.Errorf("VerifyToken() error = %v, want it to contain %q", err, tt.wantSubstr)
+				}
+			default:
+				if err != nil {
+					t.Errorf("VerifyToken() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyTokenNetworkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	err := NewClient(server.URL, nil).VerifyToken(context.Background(), "ghp_test")
+	if err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyToken() error = %v, want a network error", err)
+	}
+}
@@ -2,9 +2,16 @@ package logging
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 // LogLevel represents the logging level
@@ -17,13 +24,25 @@ const (
 	LevelError
 )
 
+// Log output formats
+const (
+	// FormatText logs lines like "[INFO] msg [key value ...]"
+	FormatText = "text"
+	// FormatJSON logs one JSON object per line for log aggregators
+	FormatJSON = "json"
+)
+
 // Logger provides structured logging with levels
 type Logger struct {
 	level  LogLevel
 	logger *log.Logger
+	json   bool
+
+	// mu serializes JSON lines, which don't go through logger
+	mu sync.Mutex
 }
 
-// NewLogger creates a new logger with the specified level
+// NewLogger creates a new logger with the specified level, logging text
 func NewLogger(levelStr string) *Logger {
 	level := parseLogLevel(levelStr)
 	return &Logger{
@@ -32,6 +51,16 @@ func NewLogger(levelStr string) *Logger {
 	}
 }
 
+// SetOutput sets where the logger writes
+func (l *Logger) SetOutput(w io.Writer) {
+	l.logger.SetOutput(w)
+}
+
+// SetFormat sets the output format, FormatText or FormatJSON; anything else is text
+func (l *Logger) SetFormat(format string) {
+	l.json = strings.EqualFold(format, FormatJSON)
+}
+
 func parseLogLevel(levelStr string) LogLevel {
 	switch strings.ToLower(levelStr) {
 	case "debug":
@@ -104,6 +133,11 @@ func (l *Logger) ErrorCtx(ctx context.Context, msg string, fields ...interface{}
 }
 
 func (l *Logger) logWithLevel(level, msg string, fields ...interface{}) {
+	if l.json {
+		l.logJSON(level, msg, fields)
+		return
+	}
+
 	if len(fields) > 0 {
 		l.logger.Printf("[%s] %s %v", level, msg, fields)
 	} else {
@@ -115,18 +149,56 @@ func (l *Logger) logWithContext(ctx context.Context, level, msg string, fields .
 	// Extract context values for logging
 	contextFields := extractContextFields(ctx)
 	allFields := append(contextFields, fields...)
-	
-	if len(allFields) > 0 {
-		l.logger.Printf("[%s] %s %v", level, msg, allFields)
-	} else {
-		l.logger.Printf("[%s] %s", level, msg)
+	l.logWithLevel(level, msg, allFields...)
+}
+
+// logJSON writes a line with the level, time and message followed by fields, which
+// alternate keys and values; a trailing key without a value gets null
+func (l *Logger) logJSON(level, msg string, fields []interface{}) {
+	var line strings.Builder
+	line.WriteString(`{"level":`)
+	writeJSONValue(&line, strings.ToLower(level))
+	line.WriteString(`,"ts":`)
+	writeJSONValue(&line, time.Now().UTC().Format(time.RFC3339Nano))
+	line.WriteString(`,"msg":`)
+	writeJSONValue(&line, msg)
+	for i := 0; i < len(fields); i += 2 {
+		line.WriteByte(',')
+		writeJSONValue(&line, fmt.Sprint(fields[i]))
+		line.WriteByte(':')
+		if i+1 < len(fields) {
+			writeJSONValue(&line, fields[i+1])
+		} else {
+			line.WriteString("null")
+		}
 	}
+	line.WriteString("}\n")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logger.Writer().Write([]byte(line.String()))
+}
+
+// writeJSONValue writes value as JSON. Errors are written as their message, and values
+// that can't be marshalled as they print.
+func writeJSONValue(line *strings.Builder, value interface{}) {
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(value))
+	}
+	line.Write(data)
 }
 
 func extractContextFields(ctx context.Context) []interface{} {
 	var fields []interface{}
 	
 	// Extract common context values
+	if requestID := ctx.Value("request_id"); requestID != nil {
+		fields = append(fields, "request_id", requestID)
+	}
 	if sessionID := ctx.Value("session_id"); sessionID != nil {
 		fields = append(fields, "session_id", sessionID)
 	}
@@ -153,12 +225,39 @@ func WithChannelID(ctx context.Context, channelID string) context.Context {
 	return context.WithValue(ctx, "channel_id", channelID)
 }
 
-// Global logger instance
-var defaultLogger *Logger
+// WithRequestID adds the ID correlating everything done for one Slack event
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, "request_id", requestID)
+}
 
-// InitGlobalLogger initializes the global logger
-func InitGlobalLogger(level string) {
+// RequestID returns the context's request ID, or "" if it has none
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value("request_id").(string)
+	return requestID
+}
+
+// NewRequestID generates a short random request ID
+func NewRequestID() string {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Global logger instance; until InitGlobalLogger is called it logs at info level
+var defaultLogger = NewLogger("info")
+
+// InitGlobalLogger initializes the global logger with a level and a format, FormatText
+// or FormatJSON
+func InitGlobalLogger(level, format string) {
 	defaultLogger = NewLogger(level)
+	defaultLogger.SetFormat(format)
+}
+
+// SetOutput sets where the global logger writes
+func SetOutput(w io.Writer) {
+	defaultLogger.SetOutput(w)
 }
 
 // Global logging functions using the default logger
@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	tests := []struct {
+		level     string
+		wantDebug bool
+	}{
+		{level: "info", wantDebug: false},
+		{level: "debug", wantDebug: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := NewLogger(tt.level)
+			logger.SetOutput(&out)
+
+			logger.Debug("debug message")
+			logger.DebugCtx(context.Background(), "debug message with context")
+			logger.Info("info message")
+
+			output := out.String()
+			if got := strings.Contains(output, "debug message"); got != tt.wantDebug {
+				t.Errorf("debug message logged = %v, want %v; output:\n%s", got, tt.wantDebug, output)
+			}
+			if !strings.Contains(output, "[INFO] info message") {
+				t.Errorf("output = %q, want the info message", output)
+			}
+		})
+	}
+}
+
+func TestLoggerContextFields(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("info")
+	logger.SetOutput(&out)
+
+	ctx := WithUserID(WithSessionID(context.Background(), "claude-123"), 42)
+	logger.ErrorCtx(ctx, "Failed to commit changes", "error", "exit status 1")
+
+	output := out.String()
+	for _, want := range []string{"[ERROR] Failed to commit changes", "session_id claude-123", "user_id 42", "error exit status 1"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output = %q, want it to contain %q", output, want)
+		}
+	}
+}
+
+func TestLoggerRequestID(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("info")
+	logger.SetOutput(&out)
+
+	requestID := NewRequestID()
+	if requestID == "" || requestID == NewRequestID() {
+		t.Fatalf("NewRequestID() = %q, want a unique ID", requestID)
+	}
+	ctx := WithRequestID(context.Background(), requestID)
+	if got := RequestID(ctx); got != requestID {
+		t.Errorf("RequestID() = %q, want %q", got, requestID)
+	}
+
+	logger.InfoCtx(ctx, "Handling Slack event")
+	if want := "request_id " + requestID; !strings.Contains(out.String(), want) {
+		t.Errorf("output = %q, want it to contain %q", out.String(), want)
+	}
+}
+
+func TestLoggerJSONFormat(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("info")
+	logger.SetOutput(&out)
+	logger.SetFormat(FormatJSON)
+
+	ctx := WithSessionID(context.Background(), "claude-123")
+	logger.ErrorCtx(ctx, "Failed to commit changes", "error", errors.New("exit status 1"), "attempt", 2)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("output %q is not JSON: %v", out.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":      "error",
+		"msg":        "Failed to commit changes",
+		"session_id": "claude-123",
+		"error":      "exit status 1",
+		"attempt":    float64(2),
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["ts"].(string); !ok {
+		t.Errorf("ts = %v, want a timestamp", entry["ts"])
+	}
+}
+
+func TestLoggerJSONFormatOddFields(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger("info")
+	logger.SetOutput(&out)
+	logger.SetFormat(FormatJSON)
+
+	logger.Info("Odd fields", "branch", "main", "dangling")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("output %q is not JSON: %v", out.String(), err)
+	}
+	if entry["branch"] != "main" {
+		t.Errorf("branch = %v, want main", entry["branch"])
+	}
+	value, ok := entry["dangling"]
+	if !ok || value != nil {
+		t.Errorf("dangling = %v (present %v), want null", value, ok)
+	}
+}
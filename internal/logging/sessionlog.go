@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// secretPatterns match credentials that must never leave the host in log output
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-ant-[A-Za-z0-9_-]+`),
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]+`),
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]+`),
+	regexp.MustCompile(`xox[abposr]-[A-Za-z0-9-]+`),
+	regexp.MustCompile(`(?i)(ANTHROPIC_API_KEY|GITHUB_TOKEN|ENCRYPTION_KEY)=\S+`),
+}
+
+// Redact replaces anything that looks like a credential with [REDACTED]
+func Redact(line string) string {
+	for _, pattern := range secretPatterns {
+		line = pattern.ReplaceAllStringFunc(line, func(match string) string {
+			if i := strings.Index(match, "="); i >= 0 {
+				return match[:i+1] + "[REDACTED]"
+			}
+			return "[REDACTED]"
+		})
+	}
+	return line
+}
+
+// SessionLogPath returns the log file path for a session's feature name, ensuring the
+// result stays inside dir
+func SessionLogPath(dir, feature string) (string, error) {
+	if feature == "" {
+		return "", fmt.Errorf("feature name cannot be empty")
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve log directory: %w", err)
+	}
+
+	path := filepath.Join(absDir, feature+".log")
+	rel, err := filepath.Rel(absDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid session log path for feature '%s'", feature)
+	}
+
+	return path, nil
+}
+
+// AppendSessionLog appends a timestamped line to a session's log file
+func AppendSessionLog(dir, feature, message string) error {
+	path, err := SessionLogPath(dir, feature)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("failed to create session log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open session log: %w", err)
+	}
+	defer file.Close()
+
+	timestamp := time.Now().UTC().Format(time.RFC3339)
+	for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+		if _, err := fmt.Fprintf(file, "%s %s\n", timestamp, line); err != nil {
+			return fmt.Errorf("failed to write session log: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// TailFile returns the last n lines of the file at path
+func TailFile(path string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Keep a ring of the last n lines so large logs aren't held in memory
+	ring := make([]string, n)
+	count := 0
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		ring[count%n] = scanner.Text()
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if count <= n {
+		return ring[:count], nil
+	}
+
+	start := count % n
+	return append(ring[start:], ring[:start]...), nil
+}
@@ -5,9 +5,12 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
 )
 
-// Metrics holds all the metrics for the Claude Bot service
+// Metrics holds all the metrics for the Claude Bot service. Recording to a nil
+// *Metrics does nothing.
 type Metrics struct {
 	// Session metrics
 	SessionsCreated   prometheus.Counter
@@ -41,91 +44,97 @@ type Metrics struct {
 	DatabaseErrors     prometheus.Counter
 }
 
-// NewMetrics creates and registers all metrics
+// NewMetrics creates all metrics and registers them with the default registry
 func NewMetrics() *Metrics {
+	return NewMetricsWithRegisterer(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegisterer creates all metrics and registers them with reg
+func NewMetricsWithRegisterer(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
 	return &Metrics{
 		// Session metrics
-		SessionsCreated: promauto.NewCounter(prometheus.CounterOpts{
+		SessionsCreated: factory.NewCounter(prometheus.CounterOpts{
 			Name: "cb_sessions_created_total",
 			Help: "Total number of Claude Code sessions created",
 		}),
-		SessionsEnded: promauto.NewCounter(prometheus.CounterOpts{
+		SessionsEnded: factory.NewCounter(prometheus.CounterOpts{
 			Name: "cb_sessions_ended_total",
 			Help: "Total number of Claude Code sessions ended",
 		}),
-		SessionDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+		SessionDuration: factory.NewHistogram(prometheus.HistogramOpts{
 			Name:    "cb_session_duration_seconds",
 			Help:    "Duration of Claude Code sessions in seconds",
 			Buckets: prometheus.ExponentialBuckets(60, 2, 10), // 1 min to ~17 hours
 		}),
-		ActiveSessions: promauto.NewGauge(prometheus.GaugeOpts{
+		ActiveSessions: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "cb_active_sessions",
 			Help: "Number of currently active Claude Code sessions",
 		}),
 
 		// Command metrics
-		CommandsProcessed: promauto.NewCounterVec(prometheus.CounterOpts{
+		CommandsProcessed: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "cb_commands_processed_total",
 			Help: "Total number of commands processed",
 		}, []string{"command", "status"}),
-		CommandDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		CommandDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
 			Name:    "cb_command_duration_seconds",
 			Help:    "Duration of command processing in seconds",
 			Buckets: prometheus.DefBuckets,
 		}, []string{"command"}),
 
 		// Error metrics
-		ErrorsTotal: promauto.NewCounterVec(prometheus.CounterOpts{
+		ErrorsTotal: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "cb_errors_total",
 			Help: "Total number of errors by type and component",
 		}, []string{"error_type", "component"}),
 
 		// Claude process metrics
-		ClaudeProcesses: promauto.NewGauge(prometheus.GaugeOpts{
+		ClaudeProcesses: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "cb_claude_processes",
 			Help: "Number of running Claude Code processes",
 		}),
-		ClaudeErrors: promauto.NewCounter(prometheus.CounterOpts{
+		ClaudeErrors: factory.NewCounter(prometheus.CounterOpts{
 			Name: "cb_claude_errors_total",
 			Help: "Total number of Claude process errors",
 		}),
 
 		// Repository metrics
-		RepositoryOperations: promauto.NewCounterVec(prometheus.CounterOpts{
+		RepositoryOperations: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "cb_repository_operations_total",
 			Help: "Total number of repository operations",
 		}, []string{"operation", "status"}),
-		RepositoryDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		RepositoryDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
 			Name:    "cb_repository_operation_duration_seconds",
 			Help:    "Duration of repository operations in seconds",
 			Buckets: prometheus.DefBuckets,
 		}, []string{"operation"}),
 
 		// Slack metrics
-		SlackEvents: promauto.NewCounterVec(prometheus.CounterOpts{
+		SlackEvents: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "cb_slack_events_total",
 			Help: "Total number of Slack events received",
 		}, []string{"event_type"}),
-		SlackMessages: promauto.NewCounter(prometheus.CounterOpts{
+		SlackMessages: factory.NewCounter(prometheus.CounterOpts{
 			Name: "cb_slack_messages_total",
 			Help: "Total number of Slack messages sent",
 		}),
-		SlackErrors: promauto.NewCounter(prometheus.CounterOpts{
+		SlackErrors: factory.NewCounter(prometheus.CounterOpts{
 			Name: "cb_slack_errors_total",
 			Help: "Total number of Slack API errors",
 		}),
 
 		// Database metrics
-		DatabaseOperations: promauto.NewCounterVec(prometheus.CounterOpts{
+		DatabaseOperations: factory.NewCounterVec(prometheus.CounterOpts{
 			Name: "cb_database_operations_total",
 			Help: "Total number of database operations",
 		}, []string{"operation", "status"}),
-		DatabaseDuration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+		DatabaseDuration: factory.NewHistogramVec(prometheus.HistogramOpts{
 			Name:    "cb_database_operation_duration_seconds",
 			Help:    "Duration of database operations in seconds",
 			Buckets: prometheus.DefBuckets,
 		}, []string{"operation"}),
-		DatabaseErrors: promauto.NewCounter(prometheus.CounterOpts{
+		DatabaseErrors: factory.NewCounter(prometheus.CounterOpts{
 			Name: "cb_database_errors_total",
 			Help: "Total number of database errors",
 		}),
@@ -134,67 +143,139 @@ func NewMetrics() *Metrics {
 
 // RecordSessionCreated records a session creation
 func (m *Metrics) RecordSessionCreated() {
+	if m == nil {
+		return
+	}
 	m.SessionsCreated.Inc()
 	m.ActiveSessions.Inc()
 }
 
-// RecordSessionEnded records a session ending with its duration
+// MaxSessionDuration bounds the session durations observed; longer ones come from
+// clock changes rather than real sessions
+const MaxSessionDuration = 30 * 24 * time.Hour
+
+// RecordSessionEnded records a session ending with its duration. A negative duration
+// or one over MaxSessionDuration isn't observed, though the session is still counted.
 func (m *Metrics) RecordSessionEnded(duration time.Duration) {
+	if m == nil {
+		return
+	}
 	m.SessionsEnded.Inc()
 	m.ActiveSessions.Dec()
+	if duration < 0 || duration > MaxSessionDuration {
+		logging.Warn("Not observing implausible session duration", "duration", duration)
+		return
+	}
 	m.SessionDuration.Observe(duration.Seconds())
 }
 
+// RecordSessionFailed records a session that errored rather than ending
+func (m *Metrics) RecordSessionFailed() {
+	if m == nil {
+		return
+	}
+	m.ActiveSessions.Dec()
+}
+
+// RecordSessionRestarted records an ended or errored session being started again
+func (m *Metrics) RecordSessionRestarted() {
+	if m == nil {
+		return
+	}
+	m.ActiveSessions.Inc()
+}
+
+// SetActiveSessions sets the number of active sessions, as counted at startup
+func (m *Metrics) SetActiveSessions(n int) {
+	if m == nil {
+		return
+	}
+	m.ActiveSessions.Set(float64(n))
+}
+
 // RecordCommand records command processing
 func (m *Metrics) RecordCommand(command, status string, duration time.Duration) {
+	if m == nil {
+		return
+	}
 	m.CommandsProcessed.WithLabelValues(command, status).Inc()
 	m.CommandDuration.WithLabelValues(command).Observe(duration.Seconds())
 }
 
 // RecordError records an error by type and component
 func (m *Metrics) RecordError(errorType, component string) {
+	if m == nil {
+		return
+	}
 	m.ErrorsTotal.WithLabelValues(errorType, component).Inc()
 }
 
 // RecordClaudeProcess records Claude process metrics
 func (m *Metrics) RecordClaudeProcessStarted() {
+	if m == nil {
+		return
+	}
 	m.ClaudeProcesses.Inc()
 }
 
 func (m *Metrics) RecordClaudeProcessStopped() {
+	if m == nil {
+		return
+	}
 	m.ClaudeProcesses.Dec()
 }
 
 func (m *Metrics) RecordClaudeError() {
+	if m == nil {
+		return
+	}
 	m.ClaudeErrors.Inc()
 }
 
 // RecordRepositoryOperation records repository operations
 func (m *Metrics) RecordRepositoryOperation(operation, status string, duration time.Duration) {
+	if m == nil {
+		return
+	}
 	m.RepositoryOperations.WithLabelValues(operation, status).Inc()
 	m.RepositoryDuration.WithLabelValues(operation).Observe(duration.Seconds())
 }
 
 // RecordSlackEvent records Slack events
 func (m *Metrics) RecordSlackEvent(eventType string) {
+	if m == nil {
+		return
+	}
 	m.SlackEvents.WithLabelValues(eventType).Inc()
 }
 
 func (m *Metrics) RecordSlackMessage() {
+	if m == nil {
+		return
+	}
 	m.SlackMessages.Inc()
 }
 
 func (m *Metrics) RecordSlackError() {
+	if m == nil {
+		return
+	}
 	m.SlackErrors.Inc()
 }
 
 // RecordDatabaseOperation records database operations
 func (m *Metrics) RecordDatabaseOperation(operation, status string, duration time.Duration) {
+	if m == nil {
+		return
+	}
 	m.DatabaseOperations.WithLabelValues(operation, status).Inc()
 	m.DatabaseDuration.WithLabelValues(operation).Observe(duration.Seconds())
 }
 
 func (m *Metrics) RecordDatabaseError() {
+	if m == nil {
+		return
+	}
 	m.DatabaseErrors.Inc()
 }
 
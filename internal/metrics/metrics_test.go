@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRecordSessionEnded(t *testing.T) {
+	m := NewMetricsWithRegisterer(prometheus.NewRegistry())
+
+	m.RecordSessionEnded(90 * time.Second)
+	m.RecordSessionEnded(-time.Hour)                     // clock went backwards
+	m.RecordSessionEnded(MaxSessionDuration + time.Hour) // clock jumped forward
+
+	// Every session is counted, but only the plausible duration is observed
+	if got := testutil.ToFloat64(m.SessionsEnded); got != 3 {
+		t.Errorf("cb_sessions_ended_total = %v, want 3", got)
+	}
+	var histogram dto.Metric
+	if err := m.SessionDuration.(prometheus.Metric).Write(&histogram); err != nil {
+		t.Fatalf("Failed to read session durations: %v", err)
+	}
+	if got := histogram.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("cb_session_duration_seconds count = %d, want 1", got)
+	}
+	if got := histogram.GetHistogram().GetSampleSum(); got != 90 {
+		t.Errorf("cb_session_duration_seconds sum = %v, want 90", got)
+	}
+}
+
+func TestNilMetricsRecordNothing(t *testing.T) {
+	var m *Metrics
+	m.RecordSessionCreated()
+	m.RecordSessionEnded(time.Minute)
+	m.RecordCommand("start", "success", time.Second)
+	m.RecordError("internal", "slack")
+}
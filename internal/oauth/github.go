@@ -0,0 +1,207 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// DefaultGitHubURL is where github.com's OAuth endpoints are served
+const DefaultGitHubURL = "https://github.com"
+
+// StateTTL is how long a connect link can be used
+const StateTTL = 10 * time.Minute
+
+// stateCookie holds the state of the flow started in a browser, so a callback can only
+// finish a flow started in the same browser
+const stateCookie = "cb_github_oauth_state"
+
+// CredentialStore stores the tokens the flow obtains
+type CredentialStore interface {
+	StoreCredential(ctx context.Context, userID int64, credType, value string) error
+}
+
+// GitHubConfig identifies the GitHub OAuth app used for the flow
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+
+	// OAuthURL is where GitHub's OAuth endpoints are served; empty for DefaultGitHubURL
+	OAuthURL string
+
+	// PublicURL is the base URL the service is reachable at, under which the callback is
+	PublicURL string
+}
+
+// GitHubHandler runs the GitHub OAuth web flow at GET /oauth/github/start and
+// GET /oauth/github/callback, storing the token it obtains as the user's GitHub
+// credential
+type GitHubHandler struct {
+	config     GitHubConfig
+	signer     *StateSigner
+	store      CredentialStore
+	httpClient *http.Client
+}
+
+// NewGitHubHandler creates a handler verifying states with signer and storing tokens in store
+func NewGitHubHandler(config GitHubConfig, signer *StateSigner, store CredentialStore) *GitHubHandler {
+	if config.OAuthURL == "" {
+		config.OAuthURL = DefaultGitHubURL
+	}
+	config.OAuthURL = strings.TrimRight(config.OAuthURL, "/")
+	return &GitHubHandler{
+		config:     config,
+		signer:     signer,
+		store:      store,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Register adds the flow's routes to mux
+func (h *GitHubHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /oauth/github/start", h.start)
+	mux.HandleFunc("GET /oauth/github/callback", h.callback)
+}
+
+// ConnectURL returns the link that starts the flow with state, served under publicURL
+func ConnectURL(publicURL, state string) string {
+	return strings.TrimRight(publicURL, "/") + "/oauth/github/start?state=" + url.QueryEscape(state)
+}
+
+func (h *GitHubHandler) redirectURL() string {
+	return strings.TrimRight(h.config.PublicURL, "/") + "/oauth/github/callback"
+}
+
+// start sends the browser to GitHub to authorize the app
+func (h *GitHubHandler) start(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if _, err := h.signer.Verify(state); err != nil {
+		writeText(w, http.StatusForbidden, "This connect link is invalid or has expired. Run `credentials connect github` in Slack for a new one.")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/oauth/github",
+		MaxAge:   int(StateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.config.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	query := url.Values{
+		"client_id":    {h.config.ClientID},
+		"redirect_uri": {h.redirectURL()},
+		"scope":        {"repo"},
+		"state":        {state},
+	}
+	http.Redirect(w, r, h.config.OAuthURL+"/login/oauth/authorize?"+query.Encode(), http.StatusFound)
+}
+
+// callback exchanges the code GitHub sends back for a token and stores it for the user
+// named by the state
+func (h *GitHubHandler) callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil || cookie.Value != state {
+		writeText(w, http.StatusForbidden, "This sign-in wasn't started from this browser. Open the connect link from Slack again.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/oauth/github", MaxAge: -1})
+
+	userID, err := h.signer.Verify(state)
+	if err != nil {
+		writeText(w, http.StatusForbidden, "This connect link is invalid or has expired. Run `credentials connect github` in Slack for a new one.")
+		return
+	}
+
+	if errCode := query.Get("error"); errCode != "" {
+		writeText(w, http.StatusBadRequest, fmt.Sprintf("GitHub didn't authorize the app (%s).", errCode))
+		return
+	}
+
+	ctx := logging.WithUserID(r.Context(), userID)
+	token, err := h.exchangeCode(ctx, query.Get("code"))
+	if err != nil {
+		logging.WarnCtx(ctx, "Failed to exchange GitHub OAuth code", "error", err)
+		writeText(w, http.StatusBadGateway, "Failed to get a token from GitHub. Try the connect link again.")
+		return
+	}
+
+	if err := h.store.StoreCredential(ctx, userID, models.CredentialTypeGitHub, token); err != nil {
+		logging.ErrorCtx(ctx, "Failed to store GitHub OAuth token", "error", err)
+		writeText(w, http.StatusInternalServerError, "Failed to store your GitHub token. Try the connect link again.")
+		return
+	}
+
+	logging.InfoCtx(ctx, "Connected GitHub account")
+	writeText(w, http.StatusOK, "Your GitHub account is connected. You can close this window and return to Slack.")
+}
+
+// exchangeCode trades an authorization code for an access token
+func (h *GitHubHandler) exchangeCode(ctx context.Context, code string) (string, error) {
+	if code == "" {
+		return "", fmt.Errorf("no authorization code")
+	}
+
+	form := url.Values{
+		"client_id":     {h.config.ClientID},
+		"client_secret": {h.config.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {h.redirectURL()},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.config.OAuthURL+"/login/oauth/access_token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub returned %d", resp.StatusCode)
+	}
+
+	// GitHub reports a bad code with a 200 and an error field
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("%s: %s", result.Error, result.ErrorDescription)
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("no access token in response")
+	}
+	return result.AccessToken, nil
+}
+
+func writeText(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	io.WriteString(w, message+"\n")
+}
@@ -0,0 +1,188 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+const testSecret = "test-encryption-key-that-is-32-bytes-long"
+
+func TestStateSignerVerify(t *testing.T) {
+	signer := NewStateSigner(testSecret)
+
+	state := signer.State(42, time.Minute)
+	userID, err := signer.Verify(state)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if userID != 42 {
+		t.Errorf("Verify() = %d, want 42", userID)
+	}
+	if signer.State(42, time.Minute) == state {
+		t.Error("State() returned the same state twice")
+	}
+
+	parts := strings.Split(state, ".")
+	tests := []struct {
+		name  string
+		state string
+	}{
+		{name: "empty", state: ""},
+		{name: "other user", state: "43." + strings.Join(parts[1:], ".")},
+		{name: "extended expiry", state: parts[0] + ".9999999999." + parts[2] + "." + parts[3]},
+		{name: "other key", state: NewStateSigner("another-encryption-key-32-bytes-long").State(42, time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := signer.Verify(tt.state); !errors.Is(err, ErrInvalidState) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrInvalidState)
+			}
+		})
+	}
+
+	signer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := signer.Verify(state); !errors.Is(err, ErrExpiredState) {
+		t.Errorf("Verify() of an expired state error = %v, want %v", err, ErrExpiredState)
+	}
+}
+
+// fakeStore records the credentials stored by the flow
+type fakeStore struct {
+	userID   int64
+	credType string
+	value    string
+}
+
+func (f *fakeStore) StoreCredential(ctx context.Context, userID int64, credType, value string) error {
+	f.userID, f.credType, f.value = userID, credType, value
+	return nil
+}
+
+// fakeGitHub serves GitHub's token endpoint, accepting only the code "good-code"
+func fakeGitHub(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/login/oauth/access_token" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		if r.FormValue("client_secret") != "client-secret" || r.FormValue("code") != "good-code" {
+			w.Write([]byte(`{"error":"bad_verification_code","error_description":"The code passed is incorrect or expired."}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"gho_connected_token","token_type":"bearer","scope":"repo"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGitHubFlow(t *testing.T) {
+	github := fakeGitHub(t)
+	signer := NewStateSigner(testSecret)
+
+	tests := []struct {
+		name       string
+		code       string
+		wantStatus int
+		wantToken  string
+	}{
+		{name: "connected", code: "good-code", wantStatus: http.StatusOK, wantToken: "gho_connected_token"},
+		{name: "bad code", code: "bad-code", wantStatus: http.StatusBadGateway},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{}
+			handler := NewGitHubHandler(GitHubConfig{
+				ClientID:     "client-id",
+				ClientSecret: "client-secret",
+				OAuthURL:     github.URL,
+				PublicURL:    "https://bot.example.com",
+			}, signer, store)
+			mux := http.NewServeMux()
+			handler.Register(mux)
+
+			state := signer.State(42, StateTTL)
+
+			// Starting the flow redirects to GitHub and remembers the state
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/github/start?state="+url.QueryEscape(state), nil))
+			if rec.Code != http.StatusFound {
+				t.Fatalf("start status = %d, want %d", rec.Code, http.StatusFound)
+			}
+			location, err := url.Parse(rec.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("bad redirect: %v", err)
+			}
+			if got := location.Query(); got.Get("state") != state || got.Get("client_id") != "client-id" ||
+				got.Get("redirect_uri") != "https://bot.example.com/oauth/github/callback" {
+				t.Errorf("redirect = %s, want GitHub's authorize URL for the app and state", location)
+			}
+			cookies := rec.Result().Cookies()
+
+			// GitHub sends the browser back with a code
+			req := httptest.NewRequest(http.MethodGet, "/oauth/github/callback?code="+tt.code+"&state="+url.QueryEscape(state), nil)
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+			rec = httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("callback status = %d, want %d; body: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if store.value != tt.wantToken {
+				t.Errorf("stored token = %q, want %q", store.value, tt.wantToken)
+			}
+			if tt.wantToken != "" && (store.userID != 42 || store.credType != models.CredentialTypeGitHub) {
+				t.Errorf("stored for user %d as %q, want user 42's github credential", store.userID, store.credType)
+			}
+		})
+	}
+}
+
+func TestGitHubCallbackRejectsUnstartedFlow(t *testing.T) {
+	github := fakeGitHub(t)
+	signer := NewStateSigner(testSecret)
+	store := &fakeStore{}
+	handler := NewGitHubHandler(GitHubConfig{
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		OAuthURL:     github.URL,
+		PublicURL:    "https://bot.example.com",
+	}, signer, store)
+	mux := http.NewServeMux()
+	handler.Register(mux)
+
+	state := signer.State(42, StateTTL)
+
+	// Without the cookie set by start, e.g. a callback link sent to someone else
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/oauth/github/callback?code=good-code&state="+url.QueryEscape(state), nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("callback status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	// A forged state is rejected even with a matching cookie
+	forged := "43" + state[strings.Index(state, "."):]
+	req := httptest.NewRequest(http.MethodGet, "/oauth/github/callback?code=good-code&state="+url.QueryEscape(forged), nil)
+	req.AddCookie(&http.Cookie{Name: stateCookie, Value: forged})
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("forged callback status = %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	if store.value != "" {
+		t.Errorf("stored token %q, want none", store.value)
+	}
+}
@@ -0,0 +1,82 @@
+// Package oauth connects a Slack user's GitHub account through GitHub's OAuth web flow,
+// so they don't have to paste a token into Slack. The flow is started from a link whose
+// state names the Slack user, signed so it can't be altered or forged.
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidState is returned for a state that is malformed or wasn't signed by us
+	ErrInvalidState = errors.New("invalid OAuth state")
+	// ErrExpiredState is returned for a correctly signed state past its expiry
+	ErrExpiredState = errors.New("OAuth state has expired")
+)
+
+// StateSigner creates and verifies the state of an OAuth flow
+type StateSigner struct {
+	key []byte
+	now func() time.Time
+}
+
+// NewStateSigner creates a signer whose key is derived from secret, so the secret
+// itself is never used as a signing key
+func NewStateSigner(secret string) *StateSigner {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("claude-bot github oauth state"))
+	return &StateSigner{key: mac.Sum(nil), now: time.Now}
+}
+
+// State returns a state connecting an account to the user with database ID userID,
+// valid until ttl from now. Each state is unique.
+func (s *StateSigner) State(userID int64, ttl time.Duration) string {
+	nonce := make([]byte, 12)
+	rand.Read(nonce)
+
+	expiresAt := s.now().Add(ttl).Unix()
+	payload := fmt.Sprintf("%d.%d.%s", userID, expiresAt, base64.RawURLEncoding.EncodeToString(nonce))
+	return payload + "." + s.sign(payload)
+}
+
+// Verify checks a state's signature and expiry and returns the database ID of the user
+// it was created for
+func (s *StateSigner) Verify(state string) (int64, error) {
+	parts := strings.Split(state, ".")
+	if len(parts) != 4 {
+		return 0, ErrInvalidState
+	}
+
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(s.sign(payload))) {
+		return 0, ErrInvalidState
+	}
+
+	userID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidState
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidState
+	}
+	if !s.now().Before(time.Unix(expiry, 0)) {
+		return 0, ErrExpiredState
+	}
+
+	return userID, nil
+}
+
+func (s *StateSigner) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
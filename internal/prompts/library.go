@@ -0,0 +1,120 @@
+package prompts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxLibrarySize caps how much of a prompt library is read when fetching it
+const MaxLibrarySize = 1 << 20
+
+// LibraryPrompt is one entry of a prompt library. Libraries are a JSON or YAML list
+// of these (JSON being valid YAML, one parser handles both).
+type LibraryPrompt struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Content     string `yaml:"content"`
+}
+
+// ParseLibrary parses and validates a prompt library. Unknown fields are rejected
+// so that typos don't silently drop data.
+func ParseLibrary(data []byte) ([]LibraryPrompt, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var library []LibraryPrompt
+	if err := decoder.Decode(&library); err != nil {
+		if err == io.EOF {
+			return nil, fmt.Errorf("prompt library is empty")
+		}
+		return nil, fmt.Errorf("prompt library must be a list of {name, description, content}: %w", err)
+	}
+	if len(library) == 0 {
+		return nil, fmt.Errorf("prompt library is empty")
+	}
+
+	for i, prompt := range library {
+		if err := ValidateLibraryPrompt(prompt); err != nil {
+			return nil, fmt.Errorf("prompt %d: %w", i+1, err)
+		}
+	}
+
+	return library, nil
+}
+
+// ValidateLibraryPrompt checks that a prompt can be created and referenced with --pname
+func ValidateLibraryPrompt(prompt LibraryPrompt) error {
+	if prompt.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.ContainsAny(prompt.Name, " \t\r\n") {
+		return fmt.Errorf("name '%s' cannot contain whitespace", prompt.Name)
+	}
+	if strings.TrimSpace(prompt.Content) == "" {
+		return fmt.Errorf("content is required for '%s'", prompt.Name)
+	}
+	return nil
+}
+
+// LibraryURL returns the URL to download a library from. Gist pages are rewritten to
+// their raw content; other URLs are used as-is.
+func LibraryURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return "", fmt.Errorf("URL must be http or https")
+	}
+
+	if u.Host == "gist.github.com" && !strings.Contains(u.Path, "/raw") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/raw"
+	}
+
+	return u.String(), nil
+}
+
+// FetchLibrary downloads the prompt library at rawURL
+func FetchLibrary(ctx context.Context, client *http.Client, rawURL string) ([]byte, error) {
+	libraryURL, err := LibraryURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, libraryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prompt library: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch prompt library: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxLibrarySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt library: %w", err)
+	}
+	if len(data) > MaxLibrarySize {
+		return nil, fmt.Errorf("prompt library is larger than %d bytes", MaxLibrarySize)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,172 @@
+package prompts
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLibrary(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantNames []string
+		wantErr   bool
+	}{
+		{
+			name:      "yaml list",
+			input:     "- name: a\n  content: first\n- name: b\n  description: second prompt\n  content: second\n",
+			wantNames: []string{"a", "b"},
+		},
+		{
+			name:      "json list",
+			input:     `[{"name": "a", "content": "first"}]`,
+			wantNames: []string{"a"},
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:    "empty list",
+			input:   "[]",
+			wantErr: true,
+		},
+		{
+			name:    "not a list",
+			input:   `{"name": "a", "content": "first"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			input:   `[{"name": "a", "content": "first", "public": true}]`,
+			wantErr: true,
+		},
+		{
+			name:    "missing name",
+			input:   `[{"content": "first"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "name with whitespace",
+			input:   `[{"name": "my prompt", "content": "first"}]`,
+			wantErr: true,
+		},
+		{
+			name:    "missing content",
+			input:   `[{"name": "a", "content": "  "}]`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLibrary([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLibrary() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			var names []string
+			for _, prompt := range got {
+				names = append(names, prompt.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("ParseLibrary() names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestParseLibraryFixtures(t *testing.T) {
+	tests := []struct {
+		file      string
+		wantCount int
+	}{
+		{file: "library.yaml", wantCount: 4},
+		{file: "library.json", wantCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("Failed to read fixture: %v", err)
+			}
+			got, err := ParseLibrary(data)
+			if err != nil {
+				t.Fatalf("ParseLibrary() error = %v", err)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("ParseLibrary() returned %d prompts, want %d", len(got), tt.wantCount)
+			}
+			if got[0].Name != "reviewer" || got[0].Description == "" || got[0].Content == "" {
+				t.Errorf("ParseLibrary() first prompt = %+v, want reviewer with description and content", got[0])
+			}
+		})
+	}
+}
+
+func TestLibraryURL(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "https://example.com/prompts.yaml", want: "https://example.com/prompts.yaml"},
+		{input: "https://gist.github.com/someone/abc123", want: "https://gist.github.com/someone/abc123/raw"},
+		{input: "https://gist.github.com/someone/abc123/", want: "https://gist.github.com/someone/abc123/raw"},
+		{input: "https://gist.github.com/someone/abc123/raw/prompts.json", want: "https://gist.github.com/someone/abc123/raw/prompts.json"},
+		{input: "file:///etc/passwd", wantErr: true},
+		{input: "not a url", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := LibraryURL(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LibraryURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("LibraryURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchLibrary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/library.yaml":
+			w.Write([]byte("- name: a\n  content: first\n"))
+		case "/huge.yaml":
+			w.Write([]byte(strings.Repeat("x", MaxLibrarySize+1)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	data, err := FetchLibrary(context.Background(), server.Client(), server.URL+"/library.yaml")
+	if err != nil {
+		t.Fatalf("FetchLibrary() error = %v", err)
+	}
+	if !strings.Contains(string(data), "name: a") {
+		t.Errorf("FetchLibrary() = %q, want the library content", data)
+	}
+
+	if _, err := FetchLibrary(context.Background(), server.Client(), server.URL+"/missing.yaml"); err == nil {
+		t.Error("FetchLibrary() for missing library error = nil, want error")
+	}
+	if _, err := FetchLibrary(context.Background(), server.Client(), server.URL+"/huge.yaml"); err == nil {
+		t.Error("FetchLibrary() for oversized library error = nil, want error")
+	}
+}
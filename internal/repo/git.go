@@ -2,18 +2,28 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/pbdeuchler/claude-bot/internal/logging"
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
 // GitManager handles Git repository operations
 type GitManager struct {
 	gitPath string
+	limiter *RemoteLimiter
+
+	// protectedBranches are never pushed to
+	protectedBranches []string
 }
 
 // NewGitManager creates a new Git manager
@@ -23,8 +33,35 @@ func NewGitManager() *GitManager {
 	}
 }
 
+// SetRemoteLimiter limits concurrent clones, fetches and pushes; nil disables limiting
+func (gm *GitManager) SetRemoteLimiter(limiter *RemoteLimiter) {
+	gm.limiter = limiter
+}
+
+// SetProtectedBranches sets the branches CommitAndPush refuses to push to
+func (gm *GitManager) SetProtectedBranches(branches []string) {
+	gm.protectedBranches = branches
+}
+
+// isProtectedBranch reports whether branch is one of the protected branches, ignoring
+// case
+func isProtectedBranch(protectedBranches []string, branch string) bool {
+	for _, protected := range protectedBranches {
+		if strings.EqualFold(strings.TrimSpace(protected), branch) {
+			return true
+		}
+	}
+	return false
+}
+
 // CloneOrCreateWorkTree clones a repository or creates a work tree
 func (gm *GitManager) CloneOrCreateWorkTree(ctx context.Context, repoURL, branch, workDir string) error {
+	release, err := gm.limiter.Acquire(ctx, repoURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed waiting for a repo slot: %w", err)
+	}
+	defer release()
+
 	// Check if directory already exists
 	if _, err := os.Stat(workDir); err == nil {
 		// Directory exists, check if it's a valid git repo
@@ -67,25 +104,17 @@ func (gm *GitManager) cloneAndCheckout(ctx context.Context, repoURL, branch, wor
 		return fmt.Errorf("failed to clone repository: %w, output: %s", err, output)
 	}
 
-	// Change to the work directory
-	oldDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
-	}
-	defer os.Chdir(oldDir)
-
-	if err := os.Chdir(workDir); err != nil {
-		return fmt.Errorf("failed to change to work directory: %w", err)
-	}
-
 	// Check if branch exists
 	cmd = exec.CommandContext(ctx, gm.gitPath, "rev-parse", "--verify", "origin/"+branch)
+	cmd.Dir = workDir
 	if err := cmd.Run(); err != nil {
 		// Branch doesn't exist, create it
 		cmd = exec.CommandContext(ctx, gm.gitPath, "checkout", "-b", branch)
+		cmd.Dir = workDir
 	} else {
 		// Branch exists, check it out
 		cmd = exec.CommandContext(ctx, gm.gitPath, "checkout", "-b", branch, "origin/"+branch)
+		cmd.Dir = workDir
 	}
 
 	if output, err := cmd.CombinedOutput(); err != nil {
@@ -97,27 +126,20 @@ func (gm *GitManager) cloneAndCheckout(ctx context.Context, repoURL, branch, wor
 
 // updateRepo updates an existing repository
 func (gm *GitManager) updateRepo(ctx context.Context, workDir, branch string) error {
-	oldDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
-	}
-	defer os.Chdir(oldDir)
-
-	if err := os.Chdir(workDir); err != nil {
-		return fmt.Errorf("failed to change to work directory: %w", err)
-	}
-
 	// Fetch latest changes
 	cmd := exec.CommandContext(ctx, gm.gitPath, "fetch", "origin")
+	cmd.Dir = workDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to fetch from origin: %w, output: %s", err, output)
 	}
 
 	// Checkout the desired branch
 	cmd = exec.CommandContext(ctx, gm.gitPath, "checkout", branch)
+	cmd.Dir = workDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		// If branch doesn't exist locally, create it from origin
 		cmd = exec.CommandContext(ctx, gm.gitPath, "checkout", "-b", branch, "origin/"+branch)
+		cmd.Dir = workDir
 		if output2, err2 := cmd.CombinedOutput(); err2 != nil {
 			return fmt.Errorf("failed to checkout branch %s: %w, output: %s, %s", branch, err2, output, output2)
 		}
@@ -125,6 +147,7 @@ func (gm *GitManager) updateRepo(ctx context.Context, workDir, branch string) er
 
 	// Pull latest changes
 	cmd = exec.CommandContext(ctx, gm.gitPath, "pull", "origin", branch)
+	cmd.Dir = workDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to pull latest changes: %w, output: %s", err, output)
 	}
@@ -134,18 +157,14 @@ func (gm *GitManager) updateRepo(ctx context.Context, workDir, branch string) er
 
 // CommitAndPush commits all changes and pushes to the remote repository
 func (gm *GitManager) CommitAndPush(ctx context.Context, workDir, branch, message string) error {
-	oldDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
-	}
-	defer os.Chdir(oldDir)
-
-	if err := os.Chdir(workDir); err != nil {
-		return fmt.Errorf("failed to change to work directory: %w", err)
+	if isProtectedBranch(gm.protectedBranches, branch) {
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("refusing to push to protected branch '%s'", branch), nil)
 	}
 
 	// Check if there are any changes to commit
 	cmd := exec.CommandContext(ctx, gm.gitPath, "status", "--porcelain")
+	cmd.Dir = workDir
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to check git status: %w", err)
@@ -158,73 +177,217 @@ func (gm *GitManager) CommitAndPush(ctx context.Context, workDir, branch, messag
 
 	// Add all changes
 	cmd = exec.CommandContext(ctx, gm.gitPath, "add", ".")
+	cmd.Dir = workDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to add changes: %w, output: %s", err, output)
 	}
 
 	// Configure git user if not set
-	if err := gm.configureGitUser(ctx); err != nil {
+	if err := gm.configureGitUser(ctx, workDir); err != nil {
 		// Log warning but don't fail
-		fmt.Printf("Warning: failed to configure git user: %v\n", err)
+		logging.WarnCtx(ctx, "Failed to configure git user", "work_tree", workDir, "error", err)
 	}
 
 	// Commit changes
 	cmd = exec.CommandContext(ctx, gm.gitPath, "commit", "-m", message)
+	cmd.Dir = workDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to commit changes: %w, output: %s", err, output)
 	}
 
 	// Push changes
+	cmd = exec.CommandContext(ctx, gm.gitPath, "remote", "get-url", "origin")
+	cmd.Dir = workDir
+	remoteURL, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to get origin URL: %w", err)
+	}
+	release, err := gm.limiter.Acquire(ctx, strings.TrimSpace(string(remoteURL)), nil)
+	if err != nil {
+		return fmt.Errorf("failed waiting for a repo slot: %w", err)
+	}
+	defer release()
+
 	cmd = exec.CommandContext(ctx, gm.gitPath, "push", "origin", branch)
+	cmd.Dir = workDir
 	if output, err := cmd.CombinedOutput(); err != nil {
+		if isPushRejected(string(output)) {
+			return errPushRejected(fmt.Errorf("%w, output: %s", err, output))
+		}
 		return fmt.Errorf("failed to push changes: %w, output: %s", err, output)
 	}
 
 	return nil
 }
 
-// Cleanup removes the work directory
-func (gm *GitManager) Cleanup(ctx context.Context, workDir string) error {
-	if err := os.RemoveAll(workDir); err != nil {
-		return fmt.Errorf("failed to cleanup work directory: %w", err)
+// ErrPushRejected is wrapped by the error CommitAndPush returns when the remote branch
+// has diverged, so callers can tell it from other repository access errors
+var ErrPushRejected = errors.New("push rejected")
+
+// isPushRejected reports whether a push failed, per its error or output, because the
+// remote branch has commits the local one doesn't
+func isPushRejected(output string) bool {
+	for _, marker := range []string{"non-fast-forward", "[rejected]", "fetch first"} {
+		if strings.Contains(output, marker) {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
-// GetRepoInfo returns information about the repository
-func (gm *GitManager) GetRepoInfo(ctx context.Context, workDir string) (map[string]string, error) {
-	oldDir, err := os.Getwd()
+// errPushRejected is the error for a push rejected because the remote branch diverged.
+// The commit stays on the worktree, so the push can be retried once it's reconciled.
+func errPushRejected(err error) error {
+	return models.NewCBError(models.ErrCodeRepoAccess,
+		"Push rejected: remote branch has diverged; changes are committed locally on the worktree.",
+		fmt.Errorf("%w: %v", ErrPushRejected, err))
+}
+
+// ChangeStats counts the commits and changed files on HEAD since base
+func (gm *GitManager) ChangeStats(ctx context.Context, workDir, base string) (int, int, error) {
+	cmd := exec.CommandContext(ctx, gm.gitPath, "rev-list", "--count", base+"..HEAD")
+	cmd.Dir = workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count commits: %w", err)
+	}
+	commits, err := strconv.Atoi(strings.TrimSpace(string(output)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get current directory: %w", err)
+		return 0, 0, fmt.Errorf("failed to parse commit count: %w", err)
 	}
-	defer os.Chdir(oldDir)
 
-	if err := os.Chdir(workDir); err != nil {
-		return nil, fmt.Errorf("failed to change to work directory: %w", err)
+	cmd = exec.CommandContext(ctx, gm.gitPath, "diff", "--name-only", base, "HEAD")
+	cmd.Dir = workDir
+	output, err = cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list changed files: %w", err)
+	}
+	var files int
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.TrimSpace(line) != "" {
+			files++
+		}
+	}
+
+	return commits, files, nil
+}
+
+// shortStatPattern matches the insertion and deletion counts in git diff --shortstat output
+var shortStatPattern = regexp.MustCompile(`(\d+) (insertion|deletion)`)
+
+// LineChanges counts the lines inserted and deleted on HEAD since base
+func (gm *GitManager) LineChanges(ctx context.Context, workDir, base string) (int, int, error) {
+	cmd := exec.CommandContext(ctx, gm.gitPath, "diff", "--shortstat", base, "HEAD")
+	cmd.Dir = workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get diff stat: %w", err)
 	}
 
+	// e.g. " 3 files changed, 10 insertions(+), 2 deletions(-)"; either count is left
+	// out when zero, and the whole line when nothing changed
+	var insertions, deletions int
+	for _, match := range shortStatPattern.FindAllStringSubmatch(string(output), -1) {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse diff stat: %w", err)
+		}
+		if match[2] == "insertion" {
+			insertions = n
+		} else {
+			deletions = n
+		}
+	}
+
+	return insertions, deletions, nil
+}
+
+// HeadCommit returns the abbreviated SHA of the commit checked out in workDir
+func (gm *GitManager) HeadCommit(ctx context.Context, workDir string) (string, error) {
+	cmd := exec.CommandContext(ctx, gm.gitPath, "rev-parse", "--short", "HEAD")
+	cmd.Dir = workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get head commit: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Diff returns the unified diff of uncommitted changes (staged and unstaged) in workDir.
+// Untracked files aren't included; see DiffStat.
+func (gm *GitManager) Diff(ctx context.Context, workDir string) (string, error) {
+	cmd := exec.CommandContext(ctx, gm.gitPath, "diff", "HEAD")
+	cmd.Dir = workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get diff: %w", err)
+	}
+	return string(output), nil
+}
+
+// DiffStat returns the diffstat of uncommitted changes in workDir, followed by any
+// untracked files (which git diff doesn't show) marked with "??"
+func (gm *GitManager) DiffStat(ctx context.Context, workDir string) (string, error) {
+	cmd := exec.CommandContext(ctx, gm.gitPath, "diff", "HEAD", "--stat")
+	cmd.Dir = workDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get diff stat: %w", err)
+	}
+	stat := strings.TrimRight(string(output), "\n")
+
+	cmd = exec.CommandContext(ctx, gm.gitPath, "ls-files", "--others", "--exclude-standard")
+	cmd.Dir = workDir
+	output, err = cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to list untracked files: %w", err)
+	}
+	for _, file := range strings.Split(string(output), "\n") {
+		if file == "" {
+			continue
+		}
+		if stat != "" {
+			stat += "\n"
+		}
+		stat += "?? " + file
+	}
+
+	return stat, nil
+}
+
+// Cleanup removes the work directory; a linked worktree is removed from its mirror
+func (gm *GitManager) Cleanup(ctx context.Context, workDir string) error {
+	return removeWorktree(ctx, workDir)
+}
+
+// GetRepoInfo returns information about the repository
+func (gm *GitManager) GetRepoInfo(ctx context.Context, workDir string) (map[string]string, error) {
 	info := make(map[string]string)
 
 	// Get current branch
 	cmd := exec.CommandContext(ctx, gm.gitPath, "rev-parse", "--abbrev-ref", "HEAD")
+	cmd.Dir = workDir
 	if output, err := cmd.Output(); err == nil {
 		info["branch"] = strings.TrimSpace(string(output))
 	}
 
 	// Get current commit hash
 	cmd = exec.CommandContext(ctx, gm.gitPath, "rev-parse", "HEAD")
+	cmd.Dir = workDir
 	if output, err := cmd.Output(); err == nil {
 		info["commit"] = strings.TrimSpace(string(output))
 	}
 
 	// Get remote URL
 	cmd = exec.CommandContext(ctx, gm.gitPath, "remote", "get-url", "origin")
+	cmd.Dir = workDir
 	if output, err := cmd.Output(); err == nil {
 		info["remote"] = strings.TrimSpace(string(output))
 	}
 
 	// Get repository status
 	cmd = exec.CommandContext(ctx, gm.gitPath, "status", "--porcelain")
+	cmd.Dir = workDir
 	if output, err := cmd.Output(); err == nil {
 		if len(strings.TrimSpace(string(output))) == 0 {
 			info["status"] = "clean"
@@ -247,22 +410,81 @@ func (gm *GitManager) ValidateRepoURL(ctx context.Context, repoURL string) error
 	return nil
 }
 
-// isGitRepo checks if a directory is a git repository
+// IsPublicRepo reports whether a repository can be read without any credentials.
+// Only https URLs without embedded credentials are checked: SSH URLs always require a
+// key, and local paths and other schemes would be read with the bot's own access.
+func (gm *GitManager) IsPublicRepo(ctx context.Context, repoURL string) bool {
+	u, err := url.Parse(repoURL)
+	if err != nil || !strings.EqualFold(u.Scheme, "https") || u.User != nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Anonymous ls-remote: the bot's git config, credential helpers and askpass
+	// programs could otherwise authenticate it, so none are used and prompts get
+	// empty credentials
+	cmd := exec.CommandContext(ctx, gm.gitPath, "-c", "credential.helper=", "ls-remote", "--heads", repoURL)
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_GLOBAL="+os.DevNull,
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ASKPASS=/bin/true",
+		"SSH_ASKPASS=/bin/true",
+	)
+	return cmd.Run() == nil
+}
+
+// isGitRepo checks if a directory is a git repository: .git is a directory, or a file
+// pointing at the repository of a linked worktree
 func (gm *GitManager) isGitRepo(dir string) bool {
-	gitDir := filepath.Join(dir, ".git")
-	if stat, err := os.Stat(gitDir); err == nil {
-		return stat.IsDir()
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// VerifyWorkTree checks that workDir is a git work tree with branch checked out,
+// returning an error describing the first problem found
+func (gm *GitManager) VerifyWorkTree(ctx context.Context, workDir, branch string) error {
+	if workDir == "" {
+		return fmt.Errorf("no work tree is recorded")
 	}
-	return false
+	if stat, err := os.Stat(workDir); err != nil || !stat.IsDir() {
+		return fmt.Errorf("work tree %s doesn't exist", workDir)
+	}
+	if !gm.isGitRepo(workDir) {
+		return fmt.Errorf("work tree %s isn't a git repository", workDir)
+	}
+
+	info, err := gm.GetRepoInfo(ctx, workDir)
+	if err != nil {
+		return fmt.Errorf("failed to read work tree %s: %w", workDir, err)
+	}
+	if info["commit"] == "" {
+		return fmt.Errorf("work tree %s isn't a valid git repository", workDir)
+	}
+
+	cmd := exec.CommandContext(ctx, gm.gitPath, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch)
+	cmd.Dir = workDir
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("branch %s doesn't exist", branch)
+	}
+	if info["branch"] != branch {
+		return fmt.Errorf("work tree is on branch %s, not %s", info["branch"], branch)
+	}
+
+	return nil
 }
 
-// configureGitUser configures git user if not already set
-func (gm *GitManager) configureGitUser(ctx context.Context) error {
+// configureGitUser configures git user in workDir if not already set
+func (gm *GitManager) configureGitUser(ctx context.Context, workDir string) error {
 	// Check if user.name is set
 	cmd := exec.CommandContext(ctx, gm.gitPath, "config", "user.name")
+	cmd.Dir = workDir
 	if err := cmd.Run(); err != nil {
 		// Set default user name
 		cmd = exec.CommandContext(ctx, gm.gitPath, "config", "user.name", "Claude Bot")
+		cmd.Dir = workDir
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to set git user.name: %w", err)
 		}
@@ -270,9 +492,11 @@ func (gm *GitManager) configureGitUser(ctx context.Context) error {
 
 	// Check if user.email is set
 	cmd = exec.CommandContext(ctx, gm.gitPath, "config", "user.email")
+	cmd.Dir = workDir
 	if err := cmd.Run(); err != nil {
 		// Set default user email
 		cmd = exec.CommandContext(ctx, gm.gitPath, "config", "user.email", "claude-bot@example.com")
+		cmd.Dir = workDir
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to set git user.email: %w", err)
 		}
@@ -283,18 +507,9 @@ func (gm *GitManager) configureGitUser(ctx context.Context) error {
 
 // CreateBranch creates a new branch from the current branch
 func (gm *GitManager) CreateBranch(ctx context.Context, workDir, branchName string) error {
-	oldDir, err := os.Getwd()
-	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
-	}
-	defer os.Chdir(oldDir)
-
-	if err := os.Chdir(workDir); err != nil {
-		return fmt.Errorf("failed to change to work directory: %w", err)
-	}
-
 	// Create and checkout new branch
 	cmd := exec.CommandContext(ctx, gm.gitPath, "checkout", "-b", branchName)
+	cmd.Dir = workDir
 	if output, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("failed to create branch %s: %w, output: %s", branchName, err, output)
 	}
@@ -304,18 +519,9 @@ func (gm *GitManager) CreateBranch(ctx context.Context, workDir, branchName stri
 
 // ListBranches lists all branches in the repository
 func (gm *GitManager) ListBranches(ctx context.Context, workDir string) ([]string, error) {
-	oldDir, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get current directory: %w", err)
-	}
-	defer os.Chdir(oldDir)
-
-	if err := os.Chdir(workDir); err != nil {
-		return nil, fmt.Errorf("failed to change to work directory: %w", err)
-	}
-
 	// List all branches
 	cmd := exec.CommandContext(ctx, gm.gitPath, "branch", "-a")
+	cmd.Dir = workDir
 	output, err := cmd.Output()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list branches: %w", err)
@@ -2,38 +2,89 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
 // GoGitManager creates a new Git manager using go-git
 type GoGitManager struct {
 	reposDir     string
 	worktreesDir string
+	limiter      *RemoteLimiter
+	sshKeyPath   string
+
+	// protectedBranches are never pushed to
+	protectedBranches []string
+
+	// repoLocks serializes the clone, fetch and worktree changes of each mirror, keyed
+	// by the repository its URL normalizes to, as the mirror is
+	repoLocks *keyedMutex
 }
 
-// NewGoGitManager creates a new Git manager using go-git
+// NewGoGitManager creates a new Git manager using go-git, keeping its mirrors and
+// worktrees under ~/.claude-bot
 func NewGoGitManager() *GoGitManager {
 	homeDir, _ := os.UserHomeDir()
+	return NewGoGitManagerWithDirs(
+		filepath.Join(homeDir, ".claude-bot", "repos"),
+		filepath.Join(homeDir, ".claude-bot", "worktrees"),
+	)
+}
+
+// NewGoGitManagerWithDirs creates a new Git manager using go-git that keeps repository
+// mirrors in reposDir and session worktrees in worktreesDir
+func NewGoGitManagerWithDirs(reposDir, worktreesDir string) *GoGitManager {
 	return &GoGitManager{
-		reposDir:     filepath.Join(homeDir, ".claude-bot", "repos"),
-		worktreesDir: filepath.Join(homeDir, ".claude-bot", "worktrees"),
+		reposDir:     reposDir,
+		worktreesDir: worktreesDir,
+		repoLocks:    newKeyedMutex(),
 	}
 }
 
+// SetRemoteLimiter limits concurrent clones and fetches; nil disables limiting
+func (gm *GoGitManager) SetRemoteLimiter(limiter *RemoteLimiter) {
+	gm.limiter = limiter
+}
+
+// SetSSHKeyPath sets the private key used to clone and fetch SSH repository URLs; with
+// none set, SSH URLs can't be used
+func (gm *GoGitManager) SetSSHKeyPath(path string) {
+	gm.sshKeyPath = path
+}
+
+// SetProtectedBranches sets the branches CommitAndPush refuses to push to
+func (gm *GoGitManager) SetProtectedBranches(branches []string) {
+	gm.protectedBranches = branches
+}
+
 // SessionSetupResult contains the result of setting up a session
 type SessionSetupResult struct {
 	WorktreePath string
 	Messages     []string
 }
 
-// SetupSessionRepo sets up a repository and worktree for a session
-func (gm *GoGitManager) SetupSessionRepo(ctx context.Context, repoURL, fromCommitish, featureName string, progressCallback func(string)) (*SessionSetupResult, error) {
+// SetupSessionRepo sets up a repository and a worktree for the session with database ID
+// sessionID. githubToken, when set, authenticates the clone or fetch of a github.com
+// repository so private repositories can be used; it is never stored in the mirror's
+// remote URL.
+func (gm *GoGitManager) SetupSessionRepo(ctx context.Context, repoURL, fromCommitish, featureName string, sessionID int64, githubToken string, progressCallback func(string)) (*SessionSetupResult, error) {
 	var messages []string
 	
 	// Ensure directories exist
@@ -44,10 +95,8 @@ func (gm *GoGitManager) SetupSessionRepo(ctx context.Context, repoURL, fromCommi
 		return nil, fmt.Errorf("failed to create worktrees directory: %w", err)
 	}
 
-	// Extract repo name from URL
-	repoName := extractRepoName(repoURL)
-	repoPath := filepath.Join(gm.reposDir, repoName)
-	worktreePath := filepath.Join(gm.worktreesDir, featureName)
+	repoPath := gm.mirrorPath(repoURL)
+	worktreePath := gm.worktreePath(repoURL, featureName, sessionID)
 
 	// Check if worktree already exists
 	if _, err := os.Stat(worktreePath); err == nil {
@@ -57,6 +106,29 @@ func (gm *GoGitManager) SetupSessionRepo(ctx context.Context, repoURL, fromCommi
 	var repo *git.Repository
 	var err error
 
+	auth, err := gm.remoteAuth(repoURL, githubToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait for a slot before touching the remote (and the shared mirror)
+	release, err := gm.limiter.Acquire(ctx, repoURL, func() {
+		msg := fmt.Sprintf("⏳ Waiting for a repo slot: other sessions are cloning or fetching %s...", repoURL)
+		messages = append(messages, msg)
+		progressCallback(msg)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed waiting for a repo slot: %w", err)
+	}
+	defer release()
+
+	// Other sessions of the repository share the mirror, so only one may change it at once
+	unlock, err := gm.lockRepo(ctx, repoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed waiting for the repository lock: %w", err)
+	}
+	defer unlock()
+
 	// Check if repo exists locally
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
 		// Clone the repository
@@ -66,12 +138,15 @@ func (gm *GoGitManager) SetupSessionRepo(ctx context.Context, repoURL, fromCommi
 
 		repo, err = git.PlainClone(repoPath, false, &git.CloneOptions{
 			URL:      repoURL,
+			Auth:     auth,
 			Progress: os.Stdout,
 		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to clone repository: %w", err)
 		}
 
+		touchMirror(repoPath)
+
 		msg = "✅ Repository cloned successfully"
 		messages = append(messages, msg)
 		progressCallback(msg)
@@ -93,33 +168,19 @@ func (gm *GoGitManager) SetupSessionRepo(ctx context.Context, repoURL, fromCommi
 
 		err = repo.Fetch(&git.FetchOptions{
 			RemoteName: "origin",
+			Auth:       auth,
 		})
 		if err != nil && err != git.NoErrAlreadyUpToDate {
 			return nil, fmt.Errorf("failed to fetch from origin: %w", err)
 		}
 
+		touchMirror(repoPath)
+
 		msg = "✅ Repository updated"
 		messages = append(messages, msg)
 		progressCallback(msg)
 	}
 
-	// Check if feature branch already exists
-	branches, err := repo.Branches()
-	if err != nil {
-		return nil, fmt.Errorf("failed to list branches: %w", err)
-	}
-
-	err = branches.ForEach(func(ref *plumbing.Reference) error {
-		branchName := ref.Name().Short()
-		if branchName == featureName {
-			return fmt.Errorf("branch '%s' already exists", featureName)
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
 	// Resolve the commitish
 	msg := fmt.Sprintf("🔍 Resolving commitish '%s'...", fromCommitish)
 	messages = append(messages, msg)
@@ -130,118 +191,447 @@ func (gm *GoGitManager) SetupSessionRepo(ctx context.Context, repoURL, fromCommi
 		return nil, fmt.Errorf("failed to resolve commitish '%s': %w", fromCommitish, err)
 	}
 
-	// Create worktree from the commitish
+	// Create a git worktree of the mirror on a new feature branch. It shares the
+	// mirror's objects and origin remote, so the session can commit and push.
 	msg = fmt.Sprintf("🌿 Creating worktree for feature '%s'...", featureName)
 	messages = append(messages, msg)
 	progressCallback(msg)
 
-	mainWorktree, err := repo.Worktree()
+	// Forget worktrees whose directories were removed, so their branches can be reused.
+	// A feature name may have been used by an ended session, so its branch is reset
+	// with -B; git still refuses if a live worktree has the branch checked out.
+	if err := runGit(ctx, repoPath, "worktree", "prune"); err != nil {
+		return nil, fmt.Errorf("failed to prune worktrees: %w", err)
+	}
+	if err := runGit(ctx, repoPath, "worktree", "add", "-B", featureName, worktreePath, hash.String()); err != nil {
+		return nil, fmt.Errorf("failed to create worktree: %w", err)
+	}
+
+	msg = "✅ Worktree created successfully"
+	messages = append(messages, msg)
+	progressCallback(msg)
+
+	return &SessionSetupResult{
+		WorktreePath: worktreePath,
+		Messages:     messages,
+	}, nil
+}
+
+// ResetSessionRepo removes the worktree of the session with database ID sessionID and
+// its local branch in the mirror so that SetupSessionRepo can recreate them, e.g. when
+// restarting a failed session
+func (gm *GoGitManager) ResetSessionRepo(repoURL, featureName string, sessionID int64) error {
+	unlock, err := gm.lockRepo(context.Background(), repoURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get main worktree: %w", err)
+		return err
 	}
+	defer unlock()
 
-	// Checkout the specific commit
-	err = mainWorktree.Checkout(&git.CheckoutOptions{
-		Hash: *hash,
-	})
+	worktreePath := gm.worktreePath(repoURL, featureName, sessionID)
+	if err := removeWorktree(context.Background(), worktreePath); err != nil {
+		return fmt.Errorf("failed to remove worktree: %w", err)
+	}
+
+	repoPath := gm.mirrorPath(repoURL)
+	repo, err := git.PlainOpen(repoPath)
+	if err != nil {
+		if err == git.ErrRepositoryNotExists {
+			return nil
+		}
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	if err := runGit(context.Background(), repoPath, "worktree", "prune"); err != nil {
+		return fmt.Errorf("failed to prune worktrees: %w", err)
+	}
+
+	err = repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(featureName))
 	if err != nil {
-		return nil, fmt.Errorf("failed to checkout commitish: %w", err)
+		return fmt.Errorf("failed to remove branch '%s': %w", featureName, err)
+	}
+
+	return nil
+}
+
+// CommitAndPush commits all changes in the worktree at worktreePath, if there are any,
+// and pushes branch to origin with auth, which PushAuth returns for the worktree. With
+// nothing to commit, branch is still pushed if origin has it at another commit, so that
+// a push that was rejected can be retried.
+func (gm *GoGitManager) CommitAndPush(ctx context.Context, worktreePath, branch, message string, auth transport.AuthMethod) error {
+	if isProtectedBranch(gm.protectedBranches, branch) {
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("refusing to push to protected branch '%s'", branch), nil)
 	}
 
-	// Create new branch from current state
-	newBranchRef := plumbing.NewBranchReferenceName(featureName)
-	newRef := plumbing.NewHashReference(newBranchRef, *hash)
-	err = repo.Storer.SetReference(newRef)
+	// The worktree's repository is the mirror's .git directory
+	repo, err := openWorktree(worktreePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create branch: %w", err)
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
 	}
 
-	// Checkout the new branch
-	err = mainWorktree.Checkout(&git.CheckoutOptions{
-		Branch: newBranchRef,
+	// Check if there are any changes to commit
+	status, err := worktree.Status()
+	if err != nil {
+		return fmt.Errorf("failed to check git status: %w", err)
+	}
+	if !status.IsClean() {
+		if err := worktree.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+			return fmt.Errorf("failed to add changes: %w", err)
+		}
+		if _, err := worktree.Commit(message, &git.CommitOptions{Author: commitSignature(repo)}); err != nil {
+			return fmt.Errorf("failed to commit changes: %w", err)
+		}
+	}
+
+	remote, err := repo.Remote("origin")
+	if err != nil {
+		return fmt.Errorf("failed to get origin: %w", err)
+	}
+	release, err := gm.limiter.Acquire(ctx, remote.Config().URLs[0], nil)
+	if err != nil {
+		return fmt.Errorf("failed waiting for a repo slot: %w", err)
+	}
+	defer release()
+
+	if status.IsClean() {
+		unpushed, err := hasUnpushedCommits(ctx, repo, remote, branch, auth)
+		if err != nil || !unpushed {
+			return err
+		}
+	}
+
+	refSpec := gitconfig.RefSpec(fmt.Sprintf("refs/heads/%s:refs/heads/%s", branch, branch))
+	err = repo.PushContext(ctx, &git.PushOptions{
+		RemoteName: "origin",
+		RefSpecs:   []gitconfig.RefSpec{refSpec},
+		Auth:       auth,
 	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		if errors.Is(err, git.ErrNonFastForwardUpdate) || isPushRejected(err.Error()) {
+			return errPushRejected(err)
+		}
+		return fmt.Errorf("failed to push changes: %w", err)
+	}
+
+	return nil
+}
+
+// hasUnpushedCommits reports whether remote has branch at a commit other than the local
+// branch's. A branch remote doesn't have yet is left for a commit to push.
+func hasUnpushedCommits(ctx context.Context, repo *git.Repository, remote *git.Remote, branch string, auth transport.AuthMethod) (bool, error) {
+	local, err := repo.Reference(plumbing.NewBranchReferenceName(branch), true)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve branch '%s': %w", branch, err)
+	}
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return false, fmt.Errorf("failed to list remote branches: %w", err)
+	}
+	for _, ref := range refs {
+		if ref.Name() == local.Name() {
+			return ref.Hash() != local.Hash(), nil
+		}
+	}
+	return false, nil
+}
+
+// PushAuth returns the credentials for pushing the worktree at worktreePath to its
+// origin, as remoteAuth chooses them for the origin URL
+func (gm *GoGitManager) PushAuth(worktreePath, githubToken string) (transport.AuthMethod, error) {
+	repo, err := openWorktree(worktreePath)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.Remote("origin")
 	if err != nil {
-		return nil, fmt.Errorf("failed to checkout new branch: %w", err)
+		return nil, fmt.Errorf("failed to get origin: %w", err)
 	}
+	return gm.remoteAuth(remote.Config().URLs[0], githubToken)
+}
 
-	// Create the actual worktree directory by copying
-	err = copyDir(repoPath, worktreePath)
+// openWorktree opens the repository of a session worktree, whose objects and refs are
+// kept in the mirror it was added from
+func openWorktree(worktreePath string) (*git.Repository, error) {
+	repo, err := git.PlainOpenWithOptions(worktreePath, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create worktree: %w", err)
+		return nil, fmt.Errorf("failed to open worktree: %w", err)
 	}
+	return repo, nil
+}
 
-	msg = "✅ Worktree created successfully"
-	messages = append(messages, msg)
-	progressCallback(msg)
+// commitSignature returns the author of session commits: the git user configured for
+// the repository or globally, or Claude Bot if there is none
+func commitSignature(repo *git.Repository) *object.Signature {
+	signature := &object.Signature{
+		Name:  "Claude Bot",
+		Email: "claude-bot@example.com",
+		When:  time.Now(),
+	}
+	if cfg, err := repo.ConfigScoped(gitconfig.GlobalScope); err == nil {
+		if cfg.User.Name != "" {
+			signature.Name = cfg.User.Name
+		}
+		if cfg.User.Email != "" {
+			signature.Email = cfg.User.Email
+		}
+	}
+	return signature
+}
 
-	return &SessionSetupResult{
-		WorktreePath: worktreePath,
-		Messages:     messages,
-	}, nil
+// remoteAuth returns the credentials for cloning or fetching repoURL, chosen by its
+// scheme: SSH URLs (ssh:// or git@host:path) use the configured private key, and HTTPS
+// github.com URLs use the GitHub token when there is one. Anything else is accessed
+// anonymously (nil). The token is only ever sent to github.com.
+func (gm *GoGitManager) remoteAuth(repoURL, githubToken string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(repoURL)
+	if err != nil {
+		return nil, models.NewCBError(models.ErrCodeRepoAccess, fmt.Sprintf("invalid repository URL: %s", repoURL), err)
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		if gm.sshKeyPath == "" {
+			return nil, models.NewCBError(models.ErrCodeRepoAccess,
+				fmt.Sprintf("can't clone %s: SSH access isn't configured (set SSH_PRIVATE_KEY_PATH), use an HTTPS URL instead", repoURL), nil)
+		}
+		user := endpoint.User
+		if user == "" {
+			user = "git"
+		}
+		auth, err := ssh.NewPublicKeysFromFile(user, gm.sshKeyPath, "")
+		if err != nil {
+			return nil, models.NewCBError(models.ErrCodeRepoAccess, "failed to load the SSH private key", err)
+		}
+		return auth, nil
+	case "https":
+		if githubToken == "" || !strings.EqualFold(endpoint.Host, "github.com") {
+			return nil, nil
+		}
+		return &http.BasicAuth{Username: "x-access-token", Password: githubToken}, nil
+	default:
+		return nil, nil
+	}
 }
 
-// extractRepoName extracts repository name from URL
-func extractRepoName(repoURL string) string {
-	// Remove .git suffix if present
-	name := strings.TrimSuffix(repoURL, ".git")
-	
-	// Extract the last part of the path
-	parts := strings.Split(name, "/")
-	if len(parts) > 0 {
-		return parts[len(parts)-1]
+// touchMirror records a clone or fetch by updating the mirror directory's modification
+// time, which SweepMirrors uses as the last-fetched time
+func touchMirror(repoPath string) {
+	now := time.Now()
+	if err := os.Chtimes(repoPath, now, now); err != nil {
+		logging.Warn("Failed to update mirror timestamp", "path", repoPath, "error", err)
 	}
-	
-	return "unknown-repo"
 }
 
-// copyDir recursively copies a directory
-func copyDir(src, dst string) error {
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+// SweepMirrors removes local mirror repos that no live session references, that have
+// no worktrees left and that haven't been fetched within ttl. inUseURLs are the
+// repository URLs of sessions whose worktrees may still be in use; their mirrors are
+// never removed. Returns the removed mirrors, relative to the repos directory.
+func (gm *GoGitManager) SweepMirrors(inUseURLs []string, ttl time.Duration) ([]string, error) {
+	reposDir := filepath.Clean(gm.reposDir)
+	if _, err := os.Stat(reposDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	inUse := make(map[string]bool, len(inUseURLs))
+	for _, repoURL := range inUseURLs {
+		inUse[gm.mirrorPath(repoURL)] = true
+	}
+
+	// Mirrors are nested by host and owner; any directory holding a .git is one
+	var mirrors []string
+	err := filepath.WalkDir(reposDir, func(dir string, entry os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-
-		// Skip .git directory to avoid conflicts
-		if info.IsDir() && info.Name() == ".git" {
+		if !entry.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			mirrors = append(mirrors, dir)
 			return filepath.SkipDir
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repos directory: %w", err)
+	}
 
-		// Calculate destination path
-		relPath, err := filepath.Rel(src, path)
+	cutoff := time.Now().Add(-ttl)
+	var removed []string
+	for _, mirror := range mirrors {
+		name, _ := filepath.Rel(reposDir, mirror)
+		if inUse[mirror] || hasWorktrees(mirror) {
+			continue
+		}
+
+		info, err := os.Stat(mirror)
 		if err != nil {
-			return err
+			return removed, fmt.Errorf("failed to stat mirror %s: %w", name, err)
+		}
+		if info.ModTime().After(cutoff) {
+			continue
+		}
+
+		if err := os.RemoveAll(mirror); err != nil {
+			return removed, fmt.Errorf("failed to remove mirror %s: %w", name, err)
+		}
+		removed = append(removed, filepath.ToSlash(name))
+
+		// Drop the host and owner directories once they're empty
+		for dir := filepath.Dir(mirror); dir != reposDir && strings.HasPrefix(dir, reposDir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
 		}
-		dstPath := filepath.Join(dst, relPath)
+	}
+
+	return removed, nil
+}
 
-		if info.IsDir() {
-			return os.MkdirAll(dstPath, info.Mode())
+// ReconcileWorktrees removes the session worktrees left behind by sessions that are no
+// longer live, as after a crash. liveWorktreePaths are the worktrees of live sessions,
+// which are kept. Any directory under the worktrees directory holding a .git is a
+// worktree. Returns the removed worktrees, relative to the worktrees directory.
+func (gm *GoGitManager) ReconcileWorktrees(ctx context.Context, liveWorktreePaths []string) ([]string, error) {
+	worktreesDir := filepath.Clean(gm.worktreesDir)
+	if _, err := os.Stat(worktreesDir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	live := make(map[string]bool, len(liveWorktreePaths))
+	for _, worktreePath := range liveWorktreePaths {
+		if worktreePath != "" {
+			live[filepath.Clean(worktreePath)] = true
 		}
+	}
 
-		// Copy file
-		srcFile, err := os.Open(path)
+	// Worktrees are nested by repository; any directory holding a .git is one
+	var orphans []string
+	err := filepath.WalkDir(worktreesDir, func(dir string, entry os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		defer srcFile.Close()
+		if !entry.IsDir() {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			if !live[dir] {
+				orphans = append(orphans, dir)
+			}
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read worktrees directory: %w", err)
+	}
 
-		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-			return err
+	var removed []string
+	for _, worktree := range orphans {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+
+		name, _ := filepath.Rel(worktreesDir, worktree)
+		if err := os.RemoveAll(worktree); err != nil {
+			return removed, fmt.Errorf("failed to remove worktree %s: %w", name, err)
+		}
+		removed = append(removed, filepath.ToSlash(name))
+
+		// Drop the repository directories once they're empty
+		for dir := filepath.Dir(worktree); dir != worktreesDir && strings.HasPrefix(dir, worktreesDir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
 		}
+	}
+
+	return removed, nil
+}
 
-		dstFile, err := os.Create(dstPath)
+// lockRepo locks the mirror of repoURL until the returned function is called
+func (gm *GoGitManager) lockRepo(ctx context.Context, repoURL string) (func(), error) {
+	_, key := remoteKeys(repoURL)
+	return gm.repoLocks.Lock(ctx, key)
+}
+
+// mirrorPath returns where repoURL's mirror is kept: under the repos directory by host,
+// owner and repository, so that same-named repositories of different owners don't
+// share a mirror
+func (gm *GoGitManager) mirrorPath(repoURL string) string {
+	_, repo := remoteKeys(repoURL)
+	return filepath.Join(gm.reposDir, filepath.FromSlash(path.Clean("/"+repo)))
+}
+
+// worktreePath returns where a session's worktree is created: under the worktrees
+// directory by repository, then by feature name and session ID, since a feature name is
+// only unique among a repository's live sessions
+func (gm *GoGitManager) worktreePath(repoURL, featureName string, sessionID int64) string {
+	_, repo := remoteKeys(repoURL)
+	name := fmt.Sprintf("%s-%d", featureName, sessionID)
+	return filepath.Join(gm.worktreesDir, filepath.FromSlash(path.Clean("/"+repo+"/"+name)))
+}
+
+// hasWorktrees reports whether any worktree created from the mirror at repoPath still
+// exists. Each is registered under .git/worktrees with a gitdir file pointing back at
+// the worktree's .git file.
+func hasWorktrees(repoPath string) bool {
+	entries, err := os.ReadDir(filepath.Join(repoPath, ".git", "worktrees"))
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		gitdir, err := os.ReadFile(filepath.Join(repoPath, ".git", "worktrees", entry.Name(), "gitdir"))
 		if err != nil {
-			return err
+			continue
 		}
-		defer dstFile.Close()
+		if _, err := os.Stat(strings.TrimSpace(string(gitdir))); err == nil {
+			return true
+		}
+	}
+	return false
+}
 
-		_, err = dstFile.ReadFrom(srcFile)
-		return err
-	})
+// runGit runs a git command in dir, including its output in any error. It's used for
+// worktrees, which go-git doesn't support.
+func runGit(ctx context.Context, dir string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %w, output: %s", strings.Join(args, " "), err, output)
+	}
+	return nil
 }
 
-// Cleanup removes the worktree directory
+// Cleanup removes a session's worktree, leaving the shared mirror it was created from
 func (gm *GoGitManager) Cleanup(ctx context.Context, worktreePath string) error {
-	return os.RemoveAll(worktreePath)
+	return removeWorktree(ctx, worktreePath)
+}
+
+// removeWorktree removes the directory at worktreePath. A linked worktree is removed
+// with git worktree remove, run in the mirror it belongs to, so the mirror forgets it
+// and its branch can be checked out again; the mirror itself is never touched. Anything
+// else, or a worktree git can't remove, is deleted outright.
+func removeWorktree(ctx context.Context, worktreePath string) error {
+	if info, err := os.Stat(filepath.Join(worktreePath, ".git")); err == nil && !info.IsDir() {
+		cmd := exec.CommandContext(ctx, "git", "rev-parse", "--path-format=absolute", "--git-common-dir")
+		cmd.Dir = worktreePath
+		if output, err := cmd.Output(); err == nil {
+			repoPath := filepath.Dir(strings.TrimSpace(string(output)))
+			if err := runGit(ctx, repoPath, "worktree", "remove", "--force", worktreePath); err == nil {
+				return nil
+			}
+		}
+	}
+
+	if err := os.RemoveAll(worktreePath); err != nil {
+		return fmt.Errorf("failed to cleanup work directory: %w", err)
+	}
+	return nil
 }
 
 // ValidateRepoURL validates if the repository URL is accessible
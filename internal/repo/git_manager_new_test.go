@@ -0,0 +1,494 @@
+package repo
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestSetupSessionRepoCreatesWorktree(t *testing.T) {
+	origin := initTestRepo(t)
+	home := t.TempDir()
+	gm := &GoGitManager{
+		reposDir:     filepath.Join(home, "repos"),
+		worktreesDir: filepath.Join(home, "worktrees"),
+	}
+	ctx := context.Background()
+
+	result, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "my-feature", 1, "", func(string) {})
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() error = %v", err)
+	}
+
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = result.WorktreePath
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+
+	// The worktree is a checkout of the feature branch with the repository's files
+	if branch := git("rev-parse", "--abbrev-ref", "HEAD"); branch != "my-feature" {
+		t.Errorf("worktree branch = %q, want %q", branch, "my-feature")
+	}
+	if _, err := os.Stat(filepath.Join(result.WorktreePath, "main.go")); err != nil {
+		t.Errorf("worktree is missing the repository's files: %v", err)
+	}
+	if err := NewGitManager().VerifyWorkTree(ctx, result.WorktreePath, "my-feature"); err != nil {
+		t.Errorf("VerifyWorkTree() error = %v", err)
+	}
+
+	// Work committed in the worktree can be pushed to origin
+	if err := os.WriteFile(filepath.Join(result.WorktreePath, "feature.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	git("add", ".")
+	git("commit", "-m", "Add feature")
+	git("push", "origin", "my-feature")
+
+	cmd := exec.Command("git", "log", "-1", "--format=%s", "my-feature")
+	cmd.Dir = origin
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("my-feature wasn't pushed to origin: %v", err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "Add feature" {
+		t.Errorf("origin my-feature head = %q, want %q", got, "Add feature")
+	}
+
+	// After a reset the same feature can be set up again
+	if err := gm.ResetSessionRepo(origin, "my-feature", 1); err != nil {
+		t.Fatalf("ResetSessionRepo() error = %v", err)
+	}
+	if _, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "my-feature", 1, "", func(string) {}); err != nil {
+		t.Fatalf("SetupSessionRepo() after reset error = %v", err)
+	}
+}
+
+func TestSetupSessionRepoReusesFeatureName(t *testing.T) {
+	origin := initTestRepo(t)
+	other := initTestRepo(t)
+	home := t.TempDir()
+	gm := &GoGitManager{
+		reposDir:     filepath.Join(home, "repos"),
+		worktreesDir: filepath.Join(home, "worktrees"),
+	}
+	ctx := context.Background()
+
+	first, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "shared", 1, "", func(string) {})
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() error = %v", err)
+	}
+
+	// A session of another repository with the same feature name gets its own worktree
+	elsewhere, err := gm.SetupSessionRepo(ctx, other, "HEAD", "shared", 2, "", func(string) {})
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() for another repository error = %v", err)
+	}
+	if elsewhere.WorktreePath == first.WorktreePath {
+		t.Errorf("sessions of two repositories share the worktree %s", first.WorktreePath)
+	}
+
+	// Once the first session has ended, which removes its worktree but leaves its branch
+	// behind, a new session of the same repository can take the name
+	if err := gm.Cleanup(ctx, first.WorktreePath); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	reused, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "shared", 3, "", func(string) {})
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() reusing the name error = %v", err)
+	}
+	if reused.WorktreePath == first.WorktreePath {
+		t.Errorf("reused name got the ended session's worktree %s", first.WorktreePath)
+	}
+
+	// Resetting the new session leaves the other repository's worktree alone
+	if err := gm.ResetSessionRepo(origin, "shared", 3); err != nil {
+		t.Fatalf("ResetSessionRepo() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(elsewhere.WorktreePath, "main.go")); err != nil {
+		t.Errorf("worktree %s was removed by another session's reset: %v", elsewhere.WorktreePath, err)
+	}
+}
+
+func TestSetupSessionRepoSharesMirror(t *testing.T) {
+	origin := initTestRepo(t)
+	home := t.TempDir()
+	gm := &GoGitManager{
+		reposDir:     filepath.Join(home, "repos"),
+		worktreesDir: filepath.Join(home, "worktrees"),
+	}
+	ctx := context.Background()
+
+	var messages []string
+	progress := func(msg string) { messages = append(messages, msg) }
+	first, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "first", 1, "", progress)
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() error = %v", err)
+	}
+	messages = nil
+	second, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "second", 2, "", progress)
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() for the second session error = %v", err)
+	}
+
+	// The second session fetches into the first one's clone rather than cloning again
+	for _, msg := range messages {
+		if strings.Contains(msg, "Cloning") {
+			t.Errorf("second session cloned the repository again: %q", msg)
+		}
+	}
+	commonDir := func(worktreePath string) string {
+		t.Helper()
+		cmd := exec.Command("git", "rev-parse", "--path-format=absolute", "--git-common-dir")
+		cmd.Dir = worktreePath
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git rev-parse in %s failed: %v", worktreePath, err)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	mirror := filepath.Join(gm.mirrorPath(origin), ".git")
+	if got := commonDir(first.WorktreePath); got != mirror {
+		t.Errorf("first worktree's repository = %s, want the mirror %s", got, mirror)
+	}
+	if got := commonDir(second.WorktreePath); got != mirror {
+		t.Errorf("second worktree's repository = %s, want the mirror %s", got, mirror)
+	}
+
+	// Cleaning up one session removes its worktree only
+	if err := gm.Cleanup(ctx, first.WorktreePath); err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if _, err := os.Stat(first.WorktreePath); !os.IsNotExist(err) {
+		t.Errorf("cleaned up worktree still exists: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(second.WorktreePath, "main.go")); err != nil {
+		t.Errorf("other session's worktree was removed: %v", err)
+	}
+	if _, err := os.Stat(mirror); err != nil {
+		t.Errorf("shared mirror was removed: %v", err)
+	}
+
+	// The mirror no longer lists the removed worktree
+	cmd := exec.Command("git", "worktree", "list", "--porcelain")
+	cmd.Dir = gm.mirrorPath(origin)
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git worktree list failed: %v", err)
+	}
+	if strings.Contains(string(output), first.WorktreePath) {
+		t.Errorf("mirror still lists the removed worktree:\n%s", output)
+	}
+	if !strings.Contains(string(output), second.WorktreePath) {
+		t.Errorf("mirror no longer lists the other worktree:\n%s", output)
+	}
+}
+
+func TestSetupSessionRepoConcurrentSameRepo(t *testing.T) {
+	origin := initTestRepo(t)
+	home := t.TempDir()
+	gm := NewGoGitManagerWithDirs(filepath.Join(home, "repos"), filepath.Join(home, "worktrees"))
+	ctx := context.Background()
+
+	// Both sessions need the clone, so they race to create it
+	features := []string{"first", "second"}
+	results := make([]*SessionSetupResult, len(features))
+	errs := make([]error, len(features))
+	var wg sync.WaitGroup
+	for i, feature := range features {
+		wg.Add(1)
+		go func(i int, feature string) {
+			defer wg.Done()
+			results[i], errs[i] = gm.SetupSessionRepo(ctx, origin, "HEAD", feature, int64(i+1), "", func(string) {})
+		}(i, feature)
+	}
+	wg.Wait()
+
+	for i, feature := range features {
+		if errs[i] != nil {
+			t.Fatalf("SetupSessionRepo(%s) error = %v", feature, errs[i])
+		}
+		if err := NewGitManager().VerifyWorkTree(ctx, results[i].WorktreePath, feature); err != nil {
+			t.Errorf("worktree of %s is invalid: %v", feature, err)
+		}
+	}
+
+	cmd := exec.Command("git", "fsck")
+	cmd.Dir = gm.mirrorPath(origin)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("git fsck of the mirror failed: %v\n%s", err, output)
+	}
+}
+
+// writeTestSSHKey writes a new private key to a temp file and returns its path
+func TestGoGitManagerCommitAndPush(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	if output, err := exec.Command("git", "clone", "--bare", initTestRepo(t), origin).CombinedOutput(); err != nil {
+		t.Fatalf("git clone --bare failed: %v\n%s", err, output)
+	}
+	home := t.TempDir()
+	gm := NewGoGitManagerWithDirs(filepath.Join(home, "repos"), filepath.Join(home, "worktrees"))
+	gm.SetProtectedBranches([]string{"main"})
+	ctx := context.Background()
+
+	result, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "push-feature", 1, "", func(string) {})
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() error = %v", err)
+	}
+	files := map[string]string{
+		"change.txt": "change",
+		".gitignore": "*.log\n",
+		"debug.log":  "ignored",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(result.WorktreePath, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	err = gm.CommitAndPush(ctx, result.WorktreePath, "main", "Change", nil)
+	if !errors.Is(err, models.ErrInvalidCommand) {
+		t.Errorf("CommitAndPush(main) error = %v, want a protected branch error", err)
+	}
+
+	auth, err := gm.PushAuth(result.WorktreePath, "")
+	if err != nil {
+		t.Fatalf("PushAuth() error = %v", err)
+	}
+	const message = "Fix the login redirect"
+	if err := gm.CommitAndPush(ctx, result.WorktreePath, "push-feature", message, auth); err != nil {
+		t.Fatalf("CommitAndPush() error = %v", err)
+	}
+
+	// The remote has the commit with the changes, but not the ignored file
+	git := func(args ...string) (string, error) {
+		output, err := exec.Command("git", append([]string{"-C", origin}, args...)...).Output()
+		return strings.TrimSpace(string(output)), err
+	}
+	if got, err := git("log", "-1", "--format=%B", "push-feature"); err != nil || got != message {
+		t.Errorf("pushed commit message = %q (error %v), want %q", got, err, message)
+	}
+	if got, err := git("show", "push-feature:change.txt"); err != nil || got != "change" {
+		t.Errorf("pushed change.txt = %q (error %v), want %q", got, err, "change")
+	}
+	if _, err := git("cat-file", "-e", "push-feature:debug.log"); err == nil {
+		t.Error("ignored debug.log was pushed")
+	}
+
+	// With nothing left to commit, nothing is pushed
+	head, _ := git("rev-parse", "push-feature")
+	if err := gm.CommitAndPush(ctx, result.WorktreePath, "push-feature", "Empty", auth); err != nil {
+		t.Fatalf("CommitAndPush() without changes error = %v", err)
+	}
+	if got, _ := git("rev-parse", "push-feature"); got != head {
+		t.Errorf("remote branch moved to %s without changes, want %s", got, head)
+	}
+}
+
+func TestGoGitManagerCommitAndPushRejected(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	if output, err := exec.Command("git", "clone", "--bare", initTestRepo(t), origin).CombinedOutput(); err != nil {
+		t.Fatalf("git clone --bare failed: %v\n%s", err, output)
+	}
+	home := t.TempDir()
+	gm := NewGoGitManagerWithDirs(filepath.Join(home, "repos"), filepath.Join(home, "worktrees"))
+	ctx := context.Background()
+
+	result, err := gm.SetupSessionRepo(ctx, origin, "HEAD", "diverged", 1, "", func(string) {})
+	if err != nil {
+		t.Fatalf("SetupSessionRepo() error = %v", err)
+	}
+	write := func(dir, name string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	write(result.WorktreePath, "first.txt")
+	if err := gm.CommitAndPush(ctx, result.WorktreePath, "diverged", "First", nil); err != nil {
+		t.Fatalf("CommitAndPush() error = %v", err)
+	}
+
+	// Someone else pushes to the branch
+	other := filepath.Join(t.TempDir(), "other")
+	for _, args := range [][]string{
+		{"clone", "--branch", "diverged", origin, other},
+		{"-C", other, "-c", "user.name=Other", "-c", "user.email=other@example.com", "commit", "--allow-empty", "-m", "Other"},
+		{"-C", other, "push", "origin", "diverged"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	write(result.WorktreePath, "second.txt")
+	err = gm.CommitAndPush(ctx, result.WorktreePath, "diverged", "Second", nil)
+	if !errors.Is(err, ErrPushRejected) || !errors.Is(err, models.ErrRepoAccess) || !strings.Contains(err.Error(), "Push rejected: remote branch has diverged") {
+		t.Fatalf("CommitAndPush() error = %v, want a push rejected error", err)
+	}
+
+	// The commit is kept on the worktree
+	output, err := exec.Command("git", "-C", result.WorktreePath, "log", "-1", "--format=%s").Output()
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "Second" {
+		t.Errorf("worktree HEAD = %q, want the rejected commit", got)
+	}
+
+	// Once the remote branch is merged, the commit is pushed with nothing new to commit
+	pull := exec.Command("git", "-c", "user.name=Test", "-c", "user.email=test@example.com",
+		"-C", result.WorktreePath, "pull", "--no-rebase", "--no-edit", "origin", "diverged")
+	if output, err := pull.CombinedOutput(); err != nil {
+		t.Fatalf("git pull failed: %v\n%s", err, output)
+	}
+	if err := gm.CommitAndPush(ctx, result.WorktreePath, "diverged", "Unused", nil); err != nil {
+		t.Fatalf("CommitAndPush() after merging error = %v", err)
+	}
+	output, err = exec.Command("git", "-C", origin, "log", "--format=%s", "diverged").Output()
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	if log := string(output); !strings.Contains(log, "Second") || strings.Contains(log, "Unused") {
+		t.Errorf("origin history = %q, want the merged commit and no empty one", log)
+	}
+}
+
+func writeTestSSHKey(t *testing.T) string {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return path
+}
+
+func TestRemoteAuth(t *testing.T) {
+	withKey := &GoGitManager{}
+	withKey.SetSSHKeyPath(writeTestSSHKey(t))
+	withoutKey := &GoGitManager{}
+
+	tests := []struct {
+		name     string
+		gm       *GoGitManager
+		repoURL  string
+		token    string
+		wantAuth string // "ssh", "token" or "" for anonymous access
+		wantErr  bool
+	}{
+		{name: "github https with token", gm: withKey, repoURL: "https://github.com/org/private-repo.git", token: "ghp_secret", wantAuth: "token"},
+		{name: "github https without token", gm: withKey, repoURL: "https://github.com/org/repo.git"},
+		{name: "other https host", gm: withKey, repoURL: "https://gitlab.com/org/repo.git", token: "ghp_secret"},
+		{name: "github over http", gm: withKey, repoURL: "http://github.com/org/repo.git", token: "ghp_secret"},
+		{name: "local path", gm: withKey, repoURL: "/srv/git/repo.git", token: "ghp_secret"},
+		{name: "scp-style ssh", gm: withKey, repoURL: "git@github.com:org/repo.git", token: "ghp_secret", wantAuth: "ssh"},
+		{name: "ssh scheme", gm: withKey, repoURL: "ssh://git@github.com/org/repo.git", wantAuth: "ssh"},
+		{name: "ssh without a key", gm: withoutKey, repoURL: "git@github.com:org/repo.git", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := tt.gm.remoteAuth(tt.repoURL, tt.token)
+			if tt.wantErr {
+				var cbErr *models.CBError
+				if !errors.As(err, &cbErr) || cbErr.Code != models.ErrCodeRepoAccess || !strings.Contains(err.Error(), "SSH_PRIVATE_KEY_PATH") {
+					t.Errorf("remoteAuth() error = %v, want a repo access error about SSH", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("remoteAuth() error = %v", err)
+			}
+
+			switch tt.wantAuth {
+			case "ssh":
+				keys, ok := auth.(*ssh.PublicKeys)
+				if !ok {
+					t.Fatalf("Auth = %T, want *ssh.PublicKeys", auth)
+				}
+				if keys.User != "git" {
+					t.Errorf("SSH user = %q, want git", keys.User)
+				}
+			case "token":
+				basic, ok := auth.(*http.BasicAuth)
+				if !ok {
+					t.Fatalf("Auth = %T, want *http.BasicAuth", auth)
+				}
+				if basic.Username != "x-access-token" || basic.Password != tt.token {
+					t.Errorf("Auth = %s/%s, want x-access-token/%s", basic.Username, basic.Password, tt.token)
+				}
+			default:
+				if auth != nil {
+					t.Errorf("Auth = %v, want none", auth)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileWorktrees(t *testing.T) {
+	worktreesDir := filepath.Join(t.TempDir(), "worktrees")
+	gm := &GoGitManager{reposDir: filepath.Join(t.TempDir(), "repos"), worktreesDir: worktreesDir}
+
+	// Worktrees hold a .git file pointing at their mirror
+	makeWorktree := func(repoURL, feature string, sessionID int64) string {
+		t.Helper()
+		dir := gm.worktreePath(repoURL, feature, sessionID)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create worktree: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: /repos/.git/worktrees/x\n"), 0644); err != nil {
+			t.Fatalf("Failed to write .git: %v", err)
+		}
+		return dir
+	}
+	active := makeWorktree("https://github.com/acme/app", "login-page", 1)
+	makeWorktree("https://github.com/acme/app", "login-page", 2)
+	makeWorktree("https://github.com/acme/tools", "stray", 3)
+
+	removed, err := gm.ReconcileWorktrees(context.Background(), []string{active})
+	if err != nil {
+		t.Fatalf("ReconcileWorktrees() error = %v", err)
+	}
+
+	want := []string{"github.com/acme/app/login-page-2", "github.com/acme/tools/stray-3"}
+	if strings.Join(removed, ",") != strings.Join(want, ",") {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+	if _, err := os.Stat(active); err != nil {
+		t.Errorf("active session's worktree was removed: %v", err)
+	}
+	// The stray repository's now empty directory goes with it
+	if _, err := os.Stat(filepath.Join(worktreesDir, "github.com", "acme", "tools")); !os.IsNotExist(err) {
+		t.Errorf("empty repository directory left behind: %v", err)
+	}
+}
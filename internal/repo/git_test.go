@@ -0,0 +1,307 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// initTestRepo creates a git repository with a single committed file
+func initTestRepo(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	run("init")
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	run("add", ".")
+	run("commit", "-m", "Initial commit")
+
+	return dir
+}
+
+func TestGitManagerLineChanges(t *testing.T) {
+	dir := initTestRepo(t)
+	gm := NewGitManager()
+	ctx := context.Background()
+
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	base := git("rev-parse", "HEAD")
+
+	// No commits since base
+	insertions, deletions, err := gm.LineChanges(ctx, dir, base)
+	if err != nil {
+		t.Fatalf("LineChanges() error = %v", err)
+	}
+	if insertions != 0 || deletions != 0 {
+		t.Errorf("LineChanges() with no changes = +%d/-%d, want +0/-0", insertions, deletions)
+	}
+
+	// main.go's one line is replaced by three, and a new two-line file is added
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package app\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "util.go"), []byte("package app\n\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	git("add", ".")
+	git("commit", "-m", "Change")
+
+	insertions, deletions, err = gm.LineChanges(ctx, dir, base)
+	if err != nil {
+		t.Fatalf("LineChanges() error = %v", err)
+	}
+	if insertions != 5 || deletions != 1 {
+		t.Errorf("LineChanges() = +%d/-%d, want +5/-1", insertions, deletions)
+	}
+
+	sha, err := gm.HeadCommit(ctx, dir)
+	if err != nil {
+		t.Fatalf("HeadCommit() error = %v", err)
+	}
+	if head := git("rev-parse", "HEAD"); sha == "" || !strings.HasPrefix(head, sha) {
+		t.Errorf("HeadCommit() = %q, want an abbreviation of %s", sha, head)
+	}
+}
+
+func TestGitManagerDiff(t *testing.T) {
+	dir := initTestRepo(t)
+	gm := NewGitManager()
+	ctx := context.Background()
+
+	diff, err := gm.Diff(ctx, dir)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if diff != "" {
+		t.Errorf("Diff() on a clean repo = %q, want empty", diff)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "new.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	diff, err = gm.Diff(ctx, dir)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	for _, want := range []string{"diff --git a/main.go b/main.go", "+func main() {}"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("Diff() = %q, want it to contain %q", diff, want)
+		}
+	}
+
+	stat, err := gm.DiffStat(ctx, dir)
+	if err != nil {
+		t.Fatalf("DiffStat() error = %v", err)
+	}
+	for _, want := range []string{"main.go | 2 ++", "1 file changed", "?? new.go"} {
+		if !strings.Contains(stat, want) {
+			t.Errorf("DiffStat() = %q, want it to contain %q", stat, want)
+		}
+	}
+
+	if _, err := gm.Diff(ctx, t.TempDir()); err == nil {
+		t.Error("Diff() outside a repository error = nil, want error")
+	}
+}
+
+// initTestClone creates a bare origin repository and returns a clone of it with one
+// commit pushed to main
+func initTestClone(t *testing.T) string {
+	t.Helper()
+
+	dir := initTestRepo(t)
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	for _, args := range [][]string{
+		{"init", "--bare", origin},
+		{"-C", dir, "branch", "-M", "main"},
+		{"-C", dir, "remote", "add", "origin", origin},
+		{"-C", dir, "push", "origin", "main"},
+		{"-C", dir, "config", "user.name", "Test"},
+		{"-C", dir, "config", "user.email", "test@example.com"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	return dir
+}
+
+func TestGitManagerCommitAndPushConcurrent(t *testing.T) {
+	dirs := []string{initTestClone(t), initTestClone(t)}
+	gm := NewGitManager()
+	ctx := context.Background()
+
+	// Each session commits repeatedly in its own repository at the same time
+	const rounds = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, len(dirs)*rounds)
+	for i, dir := range dirs {
+		wg.Add(1)
+		go func(i int, dir string) {
+			defer wg.Done()
+			for round := 0; round < rounds; round++ {
+				name := fmt.Sprintf("repo%d-round%d.txt", i, round)
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+					errs <- err
+					return
+				}
+				if err := gm.CommitAndPush(ctx, dir, "main", fmt.Sprintf("repo %d round %d", i, round)); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}(i, dir)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("CommitAndPush() error = %v", err)
+	}
+
+	for i, dir := range dirs {
+		output, err := exec.Command("git", "-C", dir, "log", "origin/main", "--format=%s", "--name-only").Output()
+		if err != nil {
+			t.Fatalf("git log failed: %v", err)
+		}
+		log := string(output)
+		for round := 0; round < rounds; round++ {
+			for _, want := range []string{fmt.Sprintf("repo %d round %d", i, round), fmt.Sprintf("repo%d-round%d.txt", i, round)} {
+				if !strings.Contains(log, want) {
+					t.Errorf("repo %d history = %q, want it to contain %q", i, log, want)
+				}
+			}
+		}
+		if other := fmt.Sprintf("repo %d", 1-i); strings.Contains(log, other) {
+			t.Errorf("repo %d history = %q, must not contain commits from %s", i, log, other)
+		}
+	}
+}
+
+func TestGitManagerCommitAndPushMessage(t *testing.T) {
+	dir := initTestClone(t)
+	gm := NewGitManager()
+	ctx := context.Background()
+
+	if output, err := exec.Command("git", "-C", dir, "checkout", "-b", "message-feature").CombinedOutput(); err != nil {
+		t.Fatalf("git checkout failed: %v\n%s", err, output)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "change.txt"), []byte("change"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	const message = "Fix the login redirect"
+	if err := gm.CommitAndPush(ctx, dir, "message-feature", message); err != nil {
+		t.Fatalf("CommitAndPush() error = %v", err)
+	}
+
+	// The pushed commit carries the message
+	output, err := exec.Command("git", "-C", dir, "log", "-1", "--format=%B", "origin/message-feature").Output()
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	if got := strings.TrimSpace(string(output)); got != message {
+		t.Errorf("pushed commit message = %q, want %q", got, message)
+	}
+}
+
+func TestGitManagerCommitAndPushRejected(t *testing.T) {
+	dir := initTestClone(t)
+	gm := NewGitManager()
+	ctx := context.Background()
+
+	// Someone else pushes to main
+	output, err := exec.Command("git", "-C", dir, "remote", "get-url", "origin").Output()
+	if err != nil {
+		t.Fatalf("git remote get-url failed: %v", err)
+	}
+	other := filepath.Join(t.TempDir(), "other")
+	for _, args := range [][]string{
+		{"clone", "--branch", "main", strings.TrimSpace(string(output)), other},
+		{"-C", other, "-c", "user.name=Other", "-c", "user.email=other@example.com", "commit", "--allow-empty", "-m", "Other"},
+		{"-C", other, "push", "origin", "main"},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, output)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "change.txt"), []byte("change"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	err = gm.CommitAndPush(ctx, dir, "main", "Change")
+	if !errors.Is(err, models.ErrRepoAccess) || !strings.Contains(err.Error(), "Push rejected: remote branch has diverged") {
+		t.Fatalf("CommitAndPush() error = %v, want a push rejected error", err)
+	}
+
+	// The commit is kept locally
+	output, err = exec.Command("git", "-C", dir, "log", "-1", "--format=%s").Output()
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "Change" {
+		t.Errorf("HEAD = %q, want the rejected commit", got)
+	}
+}
+
+func TestGitManagerCommitAndPushRefusesProtectedBranch(t *testing.T) {
+	dir := initTestClone(t)
+	gm := NewGitManager()
+	gm.SetProtectedBranches([]string{"main", "develop"})
+	ctx := context.Background()
+
+	if err := os.WriteFile(filepath.Join(dir, "change.txt"), []byte("change"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	for _, branch := range []string{"main", "Develop"} {
+		err := gm.CommitAndPush(ctx, dir, branch, "Change")
+		if !errors.Is(err, models.ErrInvalidCommand) || !strings.Contains(err.Error(), "protected branch") {
+			t.Errorf("CommitAndPush(%s) error = %v, want a protected branch error", branch, err)
+		}
+	}
+
+	// Nothing was committed or pushed
+	output, err := exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+	if err != nil {
+		t.Fatalf("git status failed: %v", err)
+	}
+	if !strings.Contains(string(output), "change.txt") {
+		t.Errorf("git status = %q, want change.txt still uncommitted", output)
+	}
+}
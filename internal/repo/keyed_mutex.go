@@ -0,0 +1,40 @@
+package repo
+
+import (
+	"context"
+	"sync"
+)
+
+// keyedMutex is a set of mutexes, one per key, so that work on one key is serialized
+// while work on different keys runs in parallel
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func newKeyedMutex() *keyedMutex {
+	return &keyedMutex{locks: make(map[string]chan struct{})}
+}
+
+// Lock waits until key is free or ctx is done, and returns a function that unlocks it.
+// A nil keyedMutex never blocks
+func (k *keyedMutex) Lock(ctx context.Context, key string) (func(), error) {
+	if k == nil {
+		return func() {}, nil
+	}
+
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		k.locks[key] = lock
+	}
+	k.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
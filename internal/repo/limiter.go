@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// RemoteLimiter caps how many remote operations (clone, fetch, push) run at once
+// against the same host and the same repository. Many sessions hitting one host
+// together can trip its secondary rate limits, and sessions on one repository
+// share a local mirror.
+type RemoteLimiter struct {
+	perHost int
+	perRepo int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+	repos map[string]chan struct{}
+}
+
+// NewRemoteLimiter creates a limiter allowing perHost concurrent operations per host
+// and perRepo per repository. A limit of zero or less disables that limit.
+func NewRemoteLimiter(perHost, perRepo int) *RemoteLimiter {
+	return &RemoteLimiter{
+		perHost: perHost,
+		perRepo: perRepo,
+		hosts:   make(map[string]chan struct{}),
+		repos:   make(map[string]chan struct{}),
+	}
+}
+
+// Acquire waits for a slot to run a remote operation on repoURL and returns a
+// function that releases it. If a slot isn't free right away, onWait (if set) is
+// called once before waiting. A nil limiter doesn't limit anything.
+func (l *RemoteLimiter) Acquire(ctx context.Context, repoURL string, onWait func()) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	host, repo := remoteKeys(repoURL)
+
+	// Always take the repository slot before the host slot so waiters can't deadlock
+	var slots []chan struct{}
+	if l.perRepo > 0 {
+		slots = append(slots, l.slot(l.repos, repo, l.perRepo))
+	}
+	if l.perHost > 0 {
+		slots = append(slots, l.slot(l.hosts, host, l.perHost))
+	}
+
+	var acquired []chan struct{}
+	release := func() {
+		for _, slot := range acquired {
+			<-slot
+		}
+	}
+
+	waited := false
+	for _, slot := range slots {
+		select {
+		case slot <- struct{}{}:
+		default:
+			if !waited && onWait != nil {
+				onWait()
+			}
+			waited = true
+
+			select {
+			case slot <- struct{}{}:
+			case <-ctx.Done():
+				release()
+				return nil, ctx.Err()
+			}
+		}
+		acquired = append(acquired, slot)
+	}
+
+	return release, nil
+}
+
+// slot returns the semaphore for key, creating it with the given capacity
+func (l *RemoteLimiter) slot(slots map[string]chan struct{}, key string, capacity int) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot, ok := slots[key]
+	if !ok {
+		slot = make(chan struct{}, capacity)
+		slots[key] = slot
+	}
+	return slot
+}
+
+// remoteKeys returns the host and repository a remote URL refers to, so that the
+// HTTPS and SSH URLs of one repository share a slot
+func remoteKeys(repoURL string) (string, string) {
+	if _, host, owner, name, err := NormalizeRepoURL(repoURL); err == nil && host != "" {
+		return host, host + "/" + owner + "/" + name
+	}
+
+	// A local path, or a URL without an owner and repository
+	remote := strings.TrimSuffix(strings.TrimSuffix(strings.TrimSpace(repoURL), "/"), ".git")
+	return "", "/" + strings.ToLower(strings.Trim(remote, "/"))
+}
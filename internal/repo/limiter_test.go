@@ -0,0 +1,119 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRemoteKeys(t *testing.T) {
+	tests := []struct {
+		repoURL  string
+		wantHost string
+		wantRepo string
+	}{
+		{repoURL: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantRepo: "github.com/pbdeuchler/cb"},
+		{repoURL: "https://github.com/pbdeuchler/cb.git", wantHost: "github.com", wantRepo: "github.com/pbdeuchler/cb"},
+		{repoURL: "git@github.com:pbdeuchler/cb.git", wantHost: "github.com", wantRepo: "github.com/pbdeuchler/cb"},
+		{repoURL: "ssh://git@GitHub.com/pbdeuchler/cb", wantHost: "github.com", wantRepo: "github.com/pbdeuchler/cb"},
+		{repoURL: "/tmp/origin.git", wantHost: "", wantRepo: "/tmp/origin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(t *testing.T) {
+			host, repo := remoteKeys(tt.repoURL)
+			if host != tt.wantHost || repo != tt.wantRepo {
+				t.Errorf("remoteKeys() = %q, %q, want %q, %q", host, repo, tt.wantHost, tt.wantRepo)
+			}
+		})
+	}
+}
+
+func TestRemoteLimiterWaitsForRepoSlot(t *testing.T) {
+	limiter := NewRemoteLimiter(0, 2)
+	ctx := context.Background()
+
+	// Both URLs name the same repository
+	first, err := limiter.Acquire(ctx, "https://github.com/pbdeuchler/cb", nil)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	second, err := limiter.Acquire(ctx, "git@github.com:pbdeuchler/cb.git", nil)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// Another repository on the same host isn't held up
+	other, err := limiter.Acquire(ctx, "https://github.com/pbdeuchler/other", func() {
+		t.Error("Acquire() of another repository waited for a slot")
+	})
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	other()
+
+	waiting := make(chan struct{})
+	acquired := make(chan func())
+	go func() {
+		release, err := limiter.Acquire(ctx, "https://github.com/pbdeuchler/cb", func() { close(waiting) })
+		if err != nil {
+			t.Errorf("Acquire() error = %v", err)
+			return
+		}
+		acquired <- release
+	}()
+
+	select {
+	case <-waiting:
+	case <-time.After(time.Second):
+		t.Fatal("third Acquire() didn't report waiting for a slot")
+	}
+	select {
+	case <-acquired:
+		t.Fatal("third Acquire() got a slot while both were taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first()
+	select {
+	case release := <-acquired:
+		release()
+	case <-time.After(time.Second):
+		t.Fatal("third Acquire() didn't get the released slot")
+	}
+	second()
+}
+
+func TestRemoteLimiterHostLimit(t *testing.T) {
+	limiter := NewRemoteLimiter(1, 0)
+
+	release, err := limiter.Acquire(context.Background(), "https://github.com/pbdeuchler/cb", nil)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer release()
+
+	// A different repository on the same host has to wait, until the context ends
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := limiter.Acquire(ctx, "https://github.com/pbdeuchler/other", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Acquire() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Other hosts are unaffected
+	otherHost, err := limiter.Acquire(context.Background(), "https://gitlab.com/pbdeuchler/cb", nil)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	otherHost()
+}
+
+func TestRemoteLimiterNil(t *testing.T) {
+	var limiter *RemoteLimiter
+	release, err := limiter.Acquire(context.Background(), "https://github.com/pbdeuchler/cb", nil)
+	if err != nil {
+		t.Fatalf("Acquire() on a nil limiter error = %v", err)
+	}
+	release()
+}
@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// NormalizeRepoURL returns the canonical form of a repository URL along with its host,
+// owner and repository name, so that the forms users give for one repository are
+// stored and compared as one. HTTPS, SSH and SCP-like (git@host:owner/repo) URLs, with
+// or without a trailing .git or slash, all become https://host/owner/repo, in lower
+// case as hosts match paths case-insensitively. The owner holds every path segment
+// but the last, for hosts with nested groups. A local path is only cleaned, and has no
+// host or owner.
+func NormalizeRepoURL(rawURL string) (canonical, host, owner, repo string, err error) {
+	remote := strings.TrimSpace(rawURL)
+	if remote == "" {
+		return "", "", "", "", fmt.Errorf("repository URL is empty")
+	}
+
+	scheme := "https"
+	var port, repoPath string
+	switch {
+	case strings.HasPrefix(remote, "file://"):
+		return normalizeLocalPath(strings.TrimPrefix(remote, "file://"))
+	case strings.Contains(remote, "://"):
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", "", "", fmt.Errorf("invalid repository URL %s: %w", rawURL, err)
+		}
+		switch u.Scheme {
+		case "http", "https":
+			scheme, port = u.Scheme, u.Port()
+		case "ssh", "git", "git+ssh":
+			// The SSH port says nothing about where the repository is served over HTTPS
+		default:
+			return "", "", "", "", fmt.Errorf("unsupported repository URL scheme %q in %s", u.Scheme, rawURL)
+		}
+		host, repoPath = u.Hostname(), u.Path
+	case strings.Contains(remote, ":") && !strings.HasPrefix(remote, "/") && !strings.HasPrefix(remote, "."):
+		// SCP-like syntax: [user@]host:path
+		i := strings.Index(remote, ":")
+		host, repoPath = remote[:i], remote[i+1:]
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+	default:
+		return normalizeLocalPath(remote)
+	}
+
+	if host == "" {
+		return "", "", "", "", fmt.Errorf("no host in repository URL %s", rawURL)
+	}
+	host = strings.ToLower(host)
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	segments := strings.Split(strings.ToLower(repoPath), "/")
+	if len(segments) < 2 {
+		return "", "", "", "", fmt.Errorf("can't find owner/repo in %s", rawURL)
+	}
+	for _, segment := range segments {
+		if segment == "" {
+			return "", "", "", "", fmt.Errorf("can't find owner/repo in %s", rawURL)
+		}
+	}
+	owner = strings.Join(segments[:len(segments)-1], "/")
+	repo = segments[len(segments)-1]
+
+	authority := host
+	if port != "" && !(scheme == "https" && port == "443") && !(scheme == "http" && port == "80") {
+		authority += ":" + port
+	}
+	return fmt.Sprintf("%s://%s/%s/%s", scheme, authority, owner, repo), host, owner, repo, nil
+}
+
+// normalizeLocalPath normalizes a repository on the local filesystem, which is kept as
+// is apart from cleaning, since its path is what git opens
+func normalizeLocalPath(localPath string) (canonical, host, owner, repo string, err error) {
+	if localPath == "" {
+		return "", "", "", "", fmt.Errorf("repository path is empty")
+	}
+	canonical = filepath.Clean(localPath)
+	return canonical, "", "", strings.TrimSuffix(filepath.Base(canonical), ".git"), nil
+}
+
+// CanonicalRepoURL returns the canonical form of repoURL from NormalizeRepoURL, or
+// repoURL itself if it can't be normalized, leaving the error to whatever uses it next
+func CanonicalRepoURL(repoURL string) string {
+	canonical, _, _, _, err := NormalizeRepoURL(repoURL)
+	if err != nil {
+		return repoURL
+	}
+	return canonical
+}
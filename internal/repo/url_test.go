@@ -0,0 +1,64 @@
+package repo
+
+import "testing"
+
+func TestNormalizeRepoURL(t *testing.T) {
+	tests := []struct {
+		repoURL       string
+		wantCanonical string
+		wantHost      string
+		wantOwner     string
+		wantRepo      string
+	}{
+		// Every form of one repository has the same canonical URL
+		{repoURL: "https://github.com/pbdeuchler/cb", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "https://github.com/pbdeuchler/cb.git", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "https://github.com/pbdeuchler/cb/", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "https://github.com/pbdeuchler/cb.git/", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: " https://GitHub.com/PBDeuchler/CB ", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "https://token@github.com:443/pbdeuchler/cb", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "git@github.com:pbdeuchler/cb.git", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "git@github.com:pbdeuchler/cb", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "ssh://git@github.com/pbdeuchler/cb.git", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+		{repoURL: "ssh://git@github.com:22/pbdeuchler/cb.git", wantCanonical: "https://github.com/pbdeuchler/cb", wantHost: "github.com", wantOwner: "pbdeuchler", wantRepo: "cb"},
+
+		// Other hosts keep their scheme and port, and nested groups are the owner
+		{repoURL: "https://gitlab.com/group/subgroup/project.git", wantCanonical: "https://gitlab.com/group/subgroup/project", wantHost: "gitlab.com", wantOwner: "group/subgroup", wantRepo: "project"},
+		{repoURL: "http://git.internal:8080/team/app", wantCanonical: "http://git.internal:8080/team/app", wantHost: "git.internal", wantOwner: "team", wantRepo: "app"},
+
+		// Local paths are only cleaned
+		{repoURL: "/tmp/origin.git/", wantCanonical: "/tmp/origin.git", wantRepo: "origin"},
+		{repoURL: "file:///tmp/origin.git", wantCanonical: "/tmp/origin.git", wantRepo: "origin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoURL, func(t *testing.T) {
+			canonical, host, owner, repo, err := NormalizeRepoURL(tt.repoURL)
+			if err != nil {
+				t.Fatalf("NormalizeRepoURL() error = %v", err)
+			}
+			if canonical != tt.wantCanonical || host != tt.wantHost || owner != tt.wantOwner || repo != tt.wantRepo {
+				t.Errorf("NormalizeRepoURL() = %q, %q, %q, %q, want %q, %q, %q, %q",
+					canonical, host, owner, repo, tt.wantCanonical, tt.wantHost, tt.wantOwner, tt.wantRepo)
+			}
+		})
+	}
+}
+
+func TestNormalizeRepoURLInvalid(t *testing.T) {
+	for _, repoURL := range []string{
+		"",
+		"https://github.com/pbdeuchler",
+		"https://github.com//cb",
+		"git@github.com:cb.git",
+		"ftp://github.com/pbdeuchler/cb",
+		"https:///pbdeuchler/cb",
+	} {
+		if canonical, _, _, _, err := NormalizeRepoURL(repoURL); err == nil {
+			t.Errorf("NormalizeRepoURL(%q) = %q, want an error", repoURL, canonical)
+		}
+		if got := CanonicalRepoURL(repoURL); got != repoURL {
+			t.Errorf("CanonicalRepoURL(%q) = %q, want it unchanged", repoURL, got)
+		}
+	}
+}
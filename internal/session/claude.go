@@ -5,12 +5,11 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"os/exec"
 	"sync"
-	"syscall"
 	"time"
 
+	"github.com/pbdeuchler/claude-bot/internal/logging"
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
@@ -39,6 +38,7 @@ type ClaudeProcess struct {
 	
 	// Shutdown handling
 	done       chan struct{}
+	exited     chan struct{} // closed by waitForExit, the only caller of Cmd.Wait
 	cancelFunc context.CancelFunc
 }
 
@@ -70,6 +70,11 @@ func (cm *ClaudeManager) StartSession(ctx context.Context, sessionID, workDir, a
 		"--work-dir", workDir,
 		"--enable-mcp-servers",
 	)
+	// Claude and the tools it starts share a process group so they're killed together
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd.Process.Pid)
+	}
 	
 	// Set up pipes
 	stdin, err := cmd.StdinPipe()
@@ -115,6 +120,7 @@ func (cm *ClaudeManager) StartSession(ctx context.Context, sessionID, workDir, a
 		OutputChan: make(chan string, 100),
 		ErrorChan:  make(chan error, 10),
 		done:       make(chan struct{}),
+		exited:     make(chan struct{}),
 		cancelFunc: cancel,
 	}
 	
@@ -126,7 +132,7 @@ func (cm *ClaudeManager) StartSession(ctx context.Context, sessionID, workDir, a
 	go process.readErrors()
 	go process.waitForExit()
 	
-	log.Printf("Started Claude session %s with PID %d", sessionID, process.PID)
+	logging.Info("Started Claude session", "session_id", sessionID, "pid", process.PID)
 	
 	return process, nil
 }
@@ -241,7 +247,7 @@ func (cp *ClaudeProcess) Stop(ctx context.Context) error {
 	cp.Status = "stopping"
 	cp.mu.Unlock()
 	
-	log.Printf("Stopping Claude session %s (PID %d)", cp.SessionID, cp.PID)
+	logging.Info("Stopping Claude session", "session_id", cp.SessionID, "pid", cp.PID)
 	
 	// Try graceful shutdown first
 	if cp.Stdin != nil {
@@ -250,21 +256,17 @@ func (cp *ClaudeProcess) Stop(ctx context.Context) error {
 	}
 	
 	// Wait for graceful exit with timeout
-	done := make(chan error, 1)
-	go func() {
-		done <- cp.Cmd.Wait()
-	}()
-	
 	select {
-	case <-done:
-		// Process exited gracefully
+	case <-cp.exited:
+		// Process exited gracefully, but may have left tools it started running
+		_ = killProcessGroup(cp.PID)
 	case <-time.After(5 * time.Second):
-		// Force kill
-		log.Printf("Force killing Claude process %d", cp.PID)
-		if err := cp.Cmd.Process.Signal(syscall.SIGKILL); err != nil {
-			log.Printf("Failed to kill process: %v", err)
+		// Force kill Claude along with any tools it started
+		logging.Warn("Force killing Claude process group", "session_id", cp.SessionID, "pid", cp.PID)
+		if err := killProcessGroup(cp.PID); err != nil {
+			logging.Error("Failed to kill process group", "session_id", cp.SessionID, "pid", cp.PID, "error", err)
 		}
-		<-done // Wait for process to be reaped
+		<-cp.exited // Wait for process to be reaped
 	}
 	
 	// Cancel context and close channels
@@ -275,7 +277,7 @@ func (cp *ClaudeProcess) Stop(ctx context.Context) error {
 	cp.Status = "stopped"
 	cp.mu.Unlock()
 	
-	log.Printf("Claude session %s stopped", cp.SessionID)
+	logging.Info("Claude session stopped", "session_id", cp.SessionID)
 	return nil
 }
 
@@ -335,16 +337,18 @@ func (cp *ClaudeProcess) readErrors() {
 
 // waitForExit waits for the process to exit and updates status
 func (cp *ClaudeProcess) waitForExit() {
+	defer close(cp.exited)
+
 	err := cp.Cmd.Wait()
 	
 	cp.mu.Lock()
 	if cp.Status == "running" {
 		if err != nil {
 			cp.Status = "error"
-			log.Printf("Claude process %d exited with error: %v", cp.PID, err)
+			logging.Error("Claude process exited with error", "session_id", cp.SessionID, "pid", cp.PID, "error", err)
 		} else {
 			cp.Status = "stopped"
-			log.Printf("Claude process %d exited normally", cp.PID)
+			logging.Info("Claude process exited", "session_id", cp.SessionID, "pid", cp.PID)
 		}
 	}
 	cp.mu.Unlock()
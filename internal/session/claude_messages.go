@@ -0,0 +1,225 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Longest tool input summary and tool result shown in Slack, in characters
+const (
+	maxToolInputLength  = 120
+	maxToolResultLength = 200
+)
+
+// AnthropicMessage is the Anthropic API message carried by assistant and user stream
+// messages
+type AnthropicMessage struct {
+	Role    string         `json:"role"`
+	Content []ContentBlock `json:"content"`
+}
+
+// ContentBlock is one block of a message's content. Which fields are set depends on
+// the type: text blocks carry Text, tool_use blocks Name and Input, and tool_result
+// blocks ToolUseID, Content and IsError.
+type ContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// UnmarshalJSON accepts content given as a plain string, which user messages may use,
+// as well as a list of blocks
+func (m *AnthropicMessage) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Role    string          `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	m.Role = raw.Role
+	m.Content = nil
+
+	blocks, err := parseContent(raw.Content)
+	if err != nil {
+		return err
+	}
+	m.Content = blocks
+	return nil
+}
+
+// parseContent parses message or tool result content, which is either a string or a
+// list of blocks
+func parseContent(data json.RawMessage) ([]ContentBlock, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		return []ContentBlock{{Type: "text", Text: text}}, nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return nil, fmt.Errorf("unexpected message content: %w", err)
+	}
+	return blocks, nil
+}
+
+// FormatContent renders an assistant or user message as readable text for Slack:
+// text blocks as prose, each tool call on its own line (see formatToolUse) and tool
+// results as a short excerpt. It returns an empty string when there's nothing to show.
+func (msg *ClaudeMessage) FormatContent() string {
+	if len(msg.Message) == 0 {
+		return ""
+	}
+
+	prefix := "🤖 "
+	if msg.Type == "user" {
+		prefix = "👤 "
+	}
+
+	var message AnthropicMessage
+	if err := json.Unmarshal(msg.Message, &message); err != nil {
+		// Show the raw JSON rather than nothing
+		return prefix + string(msg.Message)
+	}
+
+	var lines, text []string
+	flushText := func() {
+		if prose := strings.TrimSpace(strings.Join(text, "")); prose != "" {
+			lines = append(lines, prefix+prose)
+		}
+		text = nil
+	}
+
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			flushText()
+			lines = append(lines, formatToolUse(block))
+		case "tool_result":
+			flushText()
+			lines = append(lines, formatToolResult(block))
+		}
+		// Other blocks, such as thinking, aren't shown
+	}
+	flushText()
+
+	return strings.Join(lines, "\n")
+}
+
+// toolKeyInputs names the input that best describes a call to each of Claude Code's
+// built-in tools, and the label it's shown with
+var toolKeyInputs = map[string]struct{ field, label string }{
+	"Read":         {"file_path", "path"},
+	"Write":        {"file_path", "path"},
+	"Edit":         {"file_path", "path"},
+	"MultiEdit":    {"file_path", "path"},
+	"NotebookEdit": {"notebook_path", "path"},
+	"LS":           {"path", "path"},
+	"Glob":         {"pattern", "pattern"},
+	"Grep":         {"pattern", "pattern"},
+	"WebFetch":     {"url", "url"},
+	"WebSearch":    {"query", "query"},
+	"Task":         {"description", "task"},
+}
+
+// formatToolUse renders a tool call as a single line: shell commands as
+// "🖥️ Bash(<command>)", built-in tools by their key input, e.g. "🔧 Edit(path=main.go)",
+// and other tools with a summary of all their inputs
+func formatToolUse(block ContentBlock) string {
+	var fields map[string]json.RawMessage
+	_ = json.Unmarshal(block.Input, &fields)
+	stringField := func(name string) (string, bool) {
+		var value string
+		if err := json.Unmarshal(fields[name], &value); err != nil || value == "" {
+			return "", false
+		}
+		return value, true
+	}
+
+	if block.Name == "Bash" {
+		if command, ok := stringField("command"); ok {
+			command = strings.Join(strings.Fields(command), " ")
+			return fmt.Sprintf("🖥️ Bash(%s)", truncate(command, maxToolInputLength))
+		}
+	}
+	if key, ok := toolKeyInputs[block.Name]; ok {
+		if value, ok := stringField(key.field); ok {
+			return fmt.Sprintf("🔧 %s(%s=%s)", block.Name, key.label, truncate(value, maxToolInputLength))
+		}
+	}
+
+	return fmt.Sprintf("🔧 %s(%s)", block.Name, formatToolInput(block.Input))
+}
+
+// formatToolInput summarizes a tool call's input as "key: value" pairs
+func formatToolInput(input json.RawMessage) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(input, &fields); err != nil {
+		return truncate(string(input), maxToolInputLength)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %s", key, fields[key]))
+	}
+	return truncate(strings.Join(parts, ", "), maxToolInputLength)
+}
+
+// formatToolResult shows the first line of a tool's output
+func formatToolResult(block ContentBlock) string {
+	var output string
+	if blocks, err := parseContent(block.Content); err == nil {
+		for _, b := range blocks {
+			if b.Type == "text" && strings.TrimSpace(b.Text) != "" {
+				output = strings.TrimSpace(b.Text)
+				break
+			}
+		}
+	}
+
+	lines := strings.Split(output, "\n")
+	excerpt := truncate(lines[0], maxToolResultLength)
+	if len(lines) > 1 {
+		excerpt += fmt.Sprintf(" (+%d lines)", len(lines)-1)
+	}
+
+	if block.IsError {
+		return "⚠️ Tool error: " + excerpt
+	}
+	if excerpt == "" {
+		return "↳ (no output)"
+	}
+	return "↳ " + excerpt
+}
+
+// truncate shortens text to at most max characters, marking the cut with an ellipsis
+func truncate(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	return string(runes[:max-1]) + "…"
+}
@@ -4,9 +4,14 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
 // Messages streamed from Claude with the stream-json output format are strictly typed as follows:
@@ -25,11 +30,12 @@ import (
 //       session_id: string;
 //     }
 //
-//   // Emitted as the last message
+//   // Emitted as the last message. Some CLI versions report usage instead of cost_usd.
 //   | {
 //       type: "result";
 //       subtype: "success";
 //       cost_usd: float;
+//       usage?: { input_tokens: int; output_tokens: int };
 //       duration_ms: float;
 //       duration_api_ms: float;
 //       is_error: boolean;
@@ -62,20 +68,80 @@ import (
 //       }[];
 //     };
 
+// ErrStaleSession is returned when Claude no longer has the session being resumed,
+// e.g. because it expired server-side
+var ErrStaleSession = errors.New("claude session not found or expired")
+
+// staleSessionMarkers are lowercase fragments of the errors the Claude CLI prints
+// when asked to resume a session it doesn't know
+var staleSessionMarkers = []string{
+	"no conversation found",
+	"session not found",
+	"session expired",
+	"session has expired",
+}
+
+// isStaleSessionOutput reports whether Claude's stderr indicates a failed resume
+func isStaleSessionOutput(lines []string) bool {
+	for _, line := range lines {
+		line = strings.ToLower(line)
+		for _, marker := range staleSessionMarkers {
+			if strings.Contains(line, marker) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ClaudeStreamManager manages stateless Claude command execution
-type ClaudeStreamManager struct{}
+type ClaudeStreamManager struct {
+	// mcpConfig is the JSON MCP server configuration passed via --mcp-config
+	mcpConfig string
+	// mcpStatusCallback receives the MCP server statuses reported on system/init
+	mcpStatusCallback func([]models.MCPServerStatus)
+	// turnsCallback receives the number of turns reported with each result
+	turnsCallback func(int)
+	// commandTimeout bounds each Claude invocation; 0 for no limit
+	commandTimeout time.Duration
+}
 
 // ClaudeMessage represents a parsed message from Claude's stream output
 type ClaudeMessage struct {
-	Type      string      `json:"type"`
-	Subtype   string      `json:"subtype,omitempty"`
-	SessionID string      `json:"session_id,omitempty"`
-	Message   interface{} `json:"message,omitempty"`
-	Result    string      `json:"result,omitempty"`
-	CostUSD   float64     `json:"cost_usd,omitempty"`
-	IsError   bool        `json:"is_error,omitempty"`
-	NumTurns  int         `json:"num_turns,omitempty"`
-	Tools     []string    `json:"tools,omitempty"`
+	Type      string          `json:"type"`
+	Subtype   string          `json:"subtype,omitempty"`
+	SessionID string          `json:"session_id,omitempty"`
+	Message   json.RawMessage `json:"message,omitempty"`
+	Result    string          `json:"result,omitempty"`
+	CostUSD   float64         `json:"cost_usd,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+	NumTurns  int             `json:"num_turns,omitempty"`
+	Tools     []string        `json:"tools,omitempty"`
+	Usage     *Usage          `json:"usage,omitempty"`
+
+	MCPServers []models.MCPServerStatus `json:"mcp_servers,omitempty"`
+}
+
+// Usage is the token usage reported with a result
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Cost returns the cost of a result: cost_usd when Claude reports it, otherwise the
+// cost of its token usage at modelName's registered prices. It's 0 when neither is known.
+func (msg *ClaudeMessage) Cost(modelName string) float64 {
+	if msg.CostUSD > 0 {
+		return msg.CostUSD
+	}
+	if msg.Usage == nil {
+		return 0
+	}
+	model, err := models.Models.Resolve(modelName)
+	if err != nil {
+		return 0
+	}
+	return model.Cost(msg.Usage.InputTokens, msg.Usage.OutputTokens)
 }
 
 // NewClaudeStreamManager creates a new streaming Claude manager
@@ -83,7 +149,27 @@ func NewClaudeStreamManager() *ClaudeStreamManager {
 	return &ClaudeStreamManager{}
 }
 
-func buildClaudeCommand(ctx context.Context, prompt, modelName, worktreePath, apiKey, claudeSessionID string) *exec.Cmd {
+// SetMCPConfig sets the MCP server configuration passed to each Claude invocation
+func (csm *ClaudeStreamManager) SetMCPConfig(mcpConfig string) {
+	csm.mcpConfig = mcpConfig
+}
+
+// SetMCPStatusCallback sets the callback that receives MCP server statuses from Claude's init message
+func (csm *ClaudeStreamManager) SetMCPStatusCallback(cb func([]models.MCPServerStatus)) {
+	csm.mcpStatusCallback = cb
+}
+
+// SetTurnsCallback sets the callback that receives the number of turns Claude took for each result
+func (csm *ClaudeStreamManager) SetTurnsCallback(cb func(int)) {
+	csm.turnsCallback = cb
+}
+
+// SetCommandTimeout sets how long each Claude invocation may run before it's killed; 0 for no limit
+func (csm *ClaudeStreamManager) SetCommandTimeout(timeout time.Duration) {
+	csm.commandTimeout = timeout
+}
+
+func buildClaudeCommand(ctx context.Context, prompt, modelName, worktreePath, apiKey, claudeSessionID, mcpConfig string) *exec.Cmd {
 	args := []string{}
 	args = append(args, "-p")
 	if claudeSessionID != "" {
@@ -91,6 +177,9 @@ func buildClaudeCommand(ctx context.Context, prompt, modelName, worktreePath, ap
 	}
 	args = append(args, "--output", "stream-json")
 	args = append(args, "--model", modelName)
+	if mcpConfig != "" {
+		args = append(args, "--mcp-config", mcpConfig)
+	}
 	args = append(args, prompt)
 
 	cmd := exec.CommandContext(ctx, "claude", args...)
@@ -103,26 +192,63 @@ func buildClaudeCommand(ctx context.Context, prompt, modelName, worktreePath, ap
 		"DISABLE_TELEMETRY=1",
 		"ANTHROPIC_API_KEY="+apiKey,
 	)
+	// Run Claude in its own process group so that cancelling the command also kills
+	// the tools it started, not just the claude process
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd.Process.Pid)
+	}
 	return cmd
 }
 
+// runClaudeCommand runs one Claude invocation, killing it if it outlasts the command timeout
+func (csm *ClaudeStreamManager) runClaudeCommand(ctx context.Context, prompt, modelName, worktreePath, apiKey, claudeSessionID string, messageCallback func(string), costCallback func(float64)) (string, error) {
+	cmdCtx := ctx
+	if csm.commandTimeout > 0 {
+		var cancel context.CancelFunc
+		cmdCtx, cancel = context.WithTimeout(ctx, csm.commandTimeout)
+		defer cancel()
+	}
+
+	cmd := buildClaudeCommand(cmdCtx, prompt, modelName, worktreePath, apiKey, claudeSessionID, csm.mcpConfig)
+	return csm.executeClaudeCommand(cmdCtx, cmd, modelName, messageCallback, costCallback)
+}
+
 // StartSession starts a new Claude session with a system prompt
 func (csm *ClaudeStreamManager) StartSession(ctx context.Context, featureName, worktreePath, systemPrompt, modelName, anthropicAPIKey string, messageCallback func(string), costCallback func(float64)) (string, error) {
-	cmd := buildClaudeCommand(ctx, systemPrompt, modelName, worktreePath, anthropicAPIKey, "")
-
-	return csm.executeClaudeCommand(cmd, messageCallback, costCallback)
+	return csm.runClaudeCommand(ctx, systemPrompt, modelName, worktreePath, anthropicAPIKey, "", messageCallback, costCallback)
 }
 
-// SendMessage sends a message to an existing Claude session
-func (csm *ClaudeStreamManager) SendMessage(ctx context.Context, claudeSessionID, featureName, worktreePath, message, modelName, anthropicAPIKey string, messageCallback func(string), costCallback func(float64)) error {
-	cmd := buildClaudeCommand(ctx, message, modelName, worktreePath, anthropicAPIKey, claudeSessionID)
+// SendMessage sends a message to an existing Claude session and returns the ID of the
+// Claude session now in use. If Claude no longer has the session, the message is
+// retried once in a fresh session seeded with the system prompt, and the new ID is
+// returned.
+func (csm *ClaudeStreamManager) SendMessage(ctx context.Context, claudeSessionID, featureName, worktreePath, systemPrompt, message, modelName, anthropicAPIKey string, messageCallback func(string), costCallback func(float64)) (string, error) {
+	_, err := csm.runClaudeCommand(ctx, message, modelName, worktreePath, anthropicAPIKey, claudeSessionID, messageCallback, costCallback)
+	if !errors.Is(err, ErrStaleSession) {
+		return claudeSessionID, err
+	}
+
+	messageCallback("♻️ Claude session expired, starting a fresh one. Earlier conversation context was reset.")
 
-	_, err := csm.executeClaudeCommand(cmd, messageCallback, costCallback)
-	return err
+	prompt := message
+	if systemPrompt != "" {
+		prompt = systemPrompt + "\n\n" + message
+	}
+	newSessionID, err := csm.runClaudeCommand(ctx, prompt, modelName, worktreePath, anthropicAPIKey, "", messageCallback, costCallback)
+	if err != nil {
+		return claudeSessionID, err
+	}
+	if newSessionID == "" {
+		return claudeSessionID, fmt.Errorf("Claude did not report a session ID for the fresh session")
+	}
+	return newSessionID, nil
 }
 
-// executeClaudeCommand executes a Claude command and streams output
-func (csm *ClaudeStreamManager) executeClaudeCommand(cmd *exec.Cmd, messageCallback func(string), costCallback func(float64)) (string, error) {
+// executeClaudeCommand executes a Claude command built with ctx and streams output. Each
+// result's cost is passed to costCallback, priced for modelName if Claude only reports
+// token usage.
+func (csm *ClaudeStreamManager) executeClaudeCommand(ctx context.Context, cmd *exec.Cmd, modelName string, messageCallback func(string), costCallback func(float64)) (string, error) {
 	// Create pipes for stdout and stderr
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -159,30 +285,29 @@ func (csm *ClaudeStreamManager) executeClaudeCommand(cmd *exec.Cmd, messageCallb
 		case "system":
 			if msg.Subtype == "init" {
 				claudeSessionID = msg.SessionID
+				if csm.mcpStatusCallback != nil {
+					csm.mcpStatusCallback(msg.MCPServers)
+				}
 				messageCallback(fmt.Sprintf("🔧 Claude session initialized: %s", msg.SessionID))
 			}
-		case "assistant":
-			// Forward assistant messages
-			if msg.Message != nil {
-				messageCallback(fmt.Sprintf("🤖 %v", msg.Message))
-			}
-		case "user":
-			// Forward user messages (for debugging)
-			if msg.Message != nil {
-				messageCallback(fmt.Sprintf("👤 %v", msg.Message))
+		case "assistant", "user":
+			// Forward assistant messages, and user messages (mostly tool results)
+			if text := msg.FormatContent(); text != "" {
+				messageCallback(text)
 			}
 		case "result":
+			if msg.NumTurns > 0 && csm.turnsCallback != nil {
+				csm.turnsCallback(msg.NumTurns)
+			}
 			if msg.Subtype == "success" {
 				messageCallback(fmt.Sprintf("✅ %s", msg.Result))
-				// Update cost when available from Claude
-				if msg.CostUSD > 0 {
-					costCallback(msg.CostUSD)
-				}
 			} else if msg.Subtype == "error_max_turns" {
 				messageCallback("❌ Maximum turns reached")
-				// Update cost when available from Claude
-				if msg.CostUSD > 0 {
-					costCallback(msg.CostUSD)
+			}
+			if msg.Subtype == "success" || msg.Subtype == "error_max_turns" {
+				// Update cost when Claude reports it or its token usage
+				if cost := msg.Cost(modelName); cost > 0 {
+					costCallback(cost)
 				}
 			}
 		default:
@@ -196,14 +321,23 @@ func (csm *ClaudeStreamManager) executeClaudeCommand(cmd *exec.Cmd, messageCallb
 	}
 
 	// Handle stderr - forward all stderr output
+	var stderrLines []string
 	errScanner := bufio.NewScanner(stderr)
 	for errScanner.Scan() {
 		line := errScanner.Text()
+		stderrLines = append(stderrLines, line)
 		messageCallback(fmt.Sprintf("⚠️ %s", line))
 	}
 
 	// Wait for command to complete
 	if err := cmd.Wait(); err != nil {
+		if csm.commandTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return claudeSessionID, models.NewCBError(models.ErrCodeCommandTimeout,
+				fmt.Sprintf("Claude didn't finish within %s and was stopped", csm.commandTimeout), err)
+		}
+		if isStaleSessionOutput(stderrLines) {
+			return claudeSessionID, fmt.Errorf("%w: %v", ErrStaleSession, err)
+		}
 		return claudeSessionID, fmt.Errorf("Claude command failed: %w", err)
 	}
 
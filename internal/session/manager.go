@@ -2,80 +2,220 @@ package session
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
+	"github.com/pbdeuchler/claude-bot/internal/anthropic"
 	"github.com/pbdeuchler/claude-bot/internal/config"
 	"github.com/pbdeuchler/claude-bot/internal/db"
+	"github.com/pbdeuchler/claude-bot/internal/github"
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/internal/prompts"
+	"github.com/pbdeuchler/claude-bot/internal/metrics"
 	"github.com/pbdeuchler/claude-bot/internal/repo"
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
 // Manager manages Claude Code sessions
 type Manager struct {
-	db        *db.DB
+	db        db.Store
 	claudeMgr *ClaudeManager
 	repoMgr   *repo.GitManager
+	github    *github.Client
+	anthropic *anthropic.Client
 	config    *config.Config
 	mu        sync.RWMutex
+
+	// alertCallback cross-posts budget warnings outside the session thread
+	alertCallback func(string)
+
+	// threadCallback posts to a session's thread outside of a command or message
+	threadCallback func(channelID, threadTS, message string)
+
+	// createLimiter limits how often each user can create sessions
+	createLimiter *RateLimiter
+
+	// remoteLimiter caps concurrent clones, fetches and pushes per host and repository
+	remoteLimiter *repo.RemoteLimiter
+
+	// gitMgr keeps the session mirrors and worktrees. It is shared by all sessions so
+	// that it can serialize changes to each repository's mirror
+	gitMgr *repo.GoGitManager
+
+	// mcpStatuses holds the MCP server statuses last reported by Claude, keyed by session ID
+	mcpStatuses map[int64][]models.MCPServerStatus
+
+	// frozen blocks new sessions and Claude invocations while set
+	frozen bool
+
+	// turns holds the Claude turns in flight, keyed by session ID, so they can be interrupted
+	turns map[int64]map[*claudeTurn]struct{}
+
+	// output fans each session's output out to API stream subscribers
+	output *OutputBroker
+
+	// messageLocks serializes the messages sent to each session, keyed by session
+	// database ID, which unlike its Claude session ID never changes; a session's channel
+	// holds a token while one of its messages is being handled
+	messageLocks map[int64]chan struct{}
+
+	// idleWarnings holds when idle sessions were warned they're about to be closed,
+	// keyed by session ID; idleMu also keeps cleanups from overlapping
+	idleMu       sync.Mutex
+	idleWarnings map[int64]time.Time
+
+	// now returns the current time; tests replace it to move the clock
+	now func() time.Time
+
+	// newTicker starts the idle session monitor's ticker, returning its channel and a
+	// function that stops it
+	newTicker func(time.Duration) (<-chan time.Time, func())
+
+	// metrics records session and repository metrics; nil records nothing
+	metrics *metrics.Metrics
 }
 
 // NewManager creates a new session manager
-func NewManager(database *db.DB, cfg *config.Config) *Manager {
+func NewManager(database db.Store, cfg *config.Config) *Manager {
+	remoteLimiter := repo.NewRemoteLimiter(cfg.Git.HostConcurrency, cfg.Git.RepoConcurrency)
+	repoMgr := repo.NewGitManager()
+	repoMgr.SetRemoteLimiter(remoteLimiter)
+	repoMgr.SetProtectedBranches(protectedBranches(cfg))
+
+	gitMgr := newGoGitManager(cfg)
+	gitMgr.SetRemoteLimiter(remoteLimiter)
+	gitMgr.SetProtectedBranches(protectedBranches(cfg))
+
 	return &Manager{
 		db:        database,
 		claudeMgr: NewClaudeManager(cfg.Session.ClaudeCodePath),
-		repoMgr:   repo.NewGitManager(),
+		repoMgr:   repoMgr,
+		github:    github.NewClient(cfg.GitHub.APIURL, nil),
+		anthropic: anthropic.NewClient(cfg.Anthropic.APIURL, nil),
 		config:    cfg,
+
+		createLimiter: NewRateLimiter(cfg.Session.CreateLimit, time.Duration(cfg.Session.CreateWindow)*time.Second),
+		remoteLimiter: remoteLimiter,
+		gitMgr:        gitMgr,
+		mcpStatuses:   make(map[int64][]models.MCPServerStatus),
+		frozen:        cfg.Budget.Frozen,
+		turns:         make(map[int64]map[*claudeTurn]struct{}),
+		output:        NewOutputBroker(),
+		messageLocks:  make(map[int64]chan struct{}),
+		idleWarnings:  make(map[int64]time.Time),
+		now:           time.Now,
+		newTicker:     newTicker,
+	}
+}
+
+// SetMetrics sets where session and repository metrics are recorded
+func (m *Manager) SetMetrics(metrics *metrics.Metrics) {
+	m.metrics = metrics
+}
+
+// recordRepoOperation records the outcome and duration of a repository operation
+func (m *Manager) recordRepoOperation(operation string, timer *metrics.Timer, err error) {
+	status := "success"
+	if err != nil {
+		status = "error"
 	}
+	m.metrics.RecordRepositoryOperation(operation, status, timer.Duration())
 }
 
-// CreateSession creates a new Claude Code session (immediate response)
+// CreateSession creates a new Claude Code session (immediate response). If a session was
+// already created with the request's idempotency key, nothing is created and that
+// session is returned with models.ErrRequestReplayed, so the caller can skip its setup.
 func (m *Manager) CreateSession(ctx context.Context, req *models.CreateSessionRequest) (*models.Session, error) {
+	if err := m.CheckNotFrozen(); err != nil {
+		return nil, err
+	}
+
 	// Validate request
 	if err := m.validateCreateSessionRequest(req); err != nil {
 		return nil, err
 	}
 
-	// Check if branch name already exists
-	exists, err := m.db.CheckBranchNameExists(ctx, req.FeatureName)
+	// A retried create returns the session created by the original request
+	if req.IdempotencyKey != "" {
+		existing, err := m.db.GetSessionByIdempotencyKey(ctx, req.IdempotencyKey)
+		if err == nil {
+			logging.InfoCtx(ctx, "Returning existing session for idempotency key", "branch", existing.BranchName, "idempotency_key", req.IdempotencyKey)
+			return existing, replayedRequest(existing)
+		}
+		if !errors.Is(err, models.ErrSessionNotFound) {
+			return nil, err
+		}
+	}
+
+	// Enforce the per-user concurrent session limit
+	activeSessions, err := m.db.CountActiveSessionsByUser(ctx, req.CreatedByUserID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check branch name: %w", err)
+		return nil, err
 	}
-	if exists {
-		return nil, models.NewCBError(models.ErrCodeSessionExists,
-			fmt.Sprintf("session with feature name '%s' already exists", req.FeatureName), nil)
+	if activeSessions >= m.config.Session.MaxPerUser {
+		return nil, models.NewCBError(models.ErrCodeQuotaExceeded,
+			fmt.Sprintf("you already have %d active sessions (maximum %d), stop one before starting another",
+				activeSessions, m.config.Session.MaxPerUser), nil)
+	}
+
+	// Enforce the per-user session creation rate limit
+	if !m.createLimiter.Allow(req.CreatedByUserID) {
+		return nil, models.NewCBError(models.ErrCodeRateLimited,
+			"session creation limit reached, try again later (see `limits`)", nil)
 	}
 
 	// Create session record immediately (status will be updated by background process)
-	// SessionID will be set when Claude returns the session ID
+	// SessionID will be set when Claude returns the session ID. The repository URL is
+	// stored canonically, so feature names are scoped alike whichever form was given.
 	session := &models.Session{
 		SessionID:        "", // Will be set by Claude during setup
 		SlackWorkspaceID: req.WorkspaceID,
 		SlackChannelID:   req.ChannelID,
 		SlackThreadTS:    req.ThreadTS,
-		RepoURL:          req.RepoURL,
+		RepoURL:          repo.CanonicalRepoURL(req.RepoURL),
 		BranchName:       req.FeatureName, // Use feature name as branch name
 		WorkTreePath:     "",              // Will be set by background process
 		ModelName:        req.ModelName,
 		RunningCost:      0.0,
-		Status:           "starting", // Custom status for setup phase
+		Status:           models.SessionStatusStarting,
+		IdempotencyKey:   req.IdempotencyKey,
+		MaxCost:          req.MaxCostUSD,
 	}
 
-	// Store session in database
-	if err := m.db.CreateSession(ctx, session); err != nil {
+	// Store the session with the creating user as its owner. The insert fails if the
+	// feature name is taken, even by a create racing this one
+	if err := m.db.CreateSessionWithOwner(ctx, session, req.CreatedByUserID); err != nil {
+		// A concurrent create with the same key may have won the race
+		if req.IdempotencyKey != "" {
+			if existing, lookupErr := m.db.GetSessionByIdempotencyKey(ctx, req.IdempotencyKey); lookupErr == nil {
+				return existing, replayedRequest(existing)
+			}
+		}
+		if errors.Is(err, models.ErrSessionExists) {
+			return nil, err
+		}
 		return nil, fmt.Errorf("failed to store session: %w", err)
 	}
 
-	// Add the creating user as the owner of the session
-	if err := m.db.AddUserToSession(ctx, session.ID, req.CreatedByUserID, models.SessionRoleOwner); err != nil {
-		return nil, fmt.Errorf("failed to add owner to session: %w", err)
+	// Keep the creation parameters so the session can be restarted
+	setupRequest, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode setup request: %w", err)
+	}
+	if err := m.db.SaveSessionSetupRequest(ctx, session.ID, string(setupRequest)); err != nil {
+		return nil, err
 	}
 
-	log.Printf("Created session (branch: %s) for user %d in channel %s", session.BranchName, req.CreatedByUserID, req.ChannelID)
+	m.metrics.RecordSessionCreated()
+	logging.InfoCtx(logging.WithUserID(ctx, req.CreatedByUserID), "Created session", "branch", session.BranchName, "channel_id", req.ChannelID)
 	return session, nil
 }
 
@@ -84,58 +224,98 @@ func (m *Manager) SetupSessionAsync(ctx context.Context, session *models.Session
 	// This will run in a goroutine
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Panic in session setup: %v", r)
+			logging.ErrorCtx(ctx, "Panic in session setup", "branch", session.BranchName, "panic", r)
 			progressCallback(fmt.Sprintf("❌ Session setup failed: %v", r))
 			m.db.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusError)
+			m.metrics.RecordError("setup_panic", "session")
+			m.metrics.RecordSessionFailed()
 		}
 	}()
 
-	// Initialize new git manager
-	gitMgr := repo.NewGoGitManager()
+	progressCallback = m.loggingCallback(session, progressCallback)
+
+	// The message saying how setup ended mentions the owner as their notification
+	// preference allows; failures are alerts
+	fail := func(message string) {
+		progressCallback(m.OwnerMention(ctx, session.ID, true) + message)
+		m.db.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusError)
+		m.metrics.RecordError("setup_failed", "session")
+		m.metrics.RecordSessionFailed()
+	}
+
+	// Restarts don't go through CreateSession, so check the branch here too
+	if m.isProtectedBranch(req.FeatureName, req.FromCommitish) {
+		fail(fmt.Sprintf("❌ '%s' is a protected branch and can't be used as the feature name", req.FeatureName))
+		return
+	}
+
+	// Private repositories are cloned with the creator's GitHub token, when they have one
+	var githubToken string
+	hasGitHub, err := m.db.HasCredential(ctx, req.CreatedByUserID, models.CredentialTypeGitHub)
+	if err == nil && hasGitHub {
+		githubToken, err = m.db.GetCredential(ctx, req.CreatedByUserID, models.CredentialTypeGitHub)
+	}
+	if err != nil {
+		fail(fmt.Sprintf("❌ Failed to get GitHub token: %v", err))
+		return
+	}
 
 	// Setup repository and worktree
-	result, err := gitMgr.SetupSessionRepo(ctx, req.RepoURL, req.FromCommitish, req.FeatureName, progressCallback)
+	timer := metrics.NewTimer()
+	result, err := m.gitMgr.SetupSessionRepo(ctx, req.RepoURL, req.FromCommitish, req.FeatureName, session.ID, githubToken, progressCallback)
+	m.recordRepoOperation("setup", timer, err)
 	if err != nil {
-		progressCallback(fmt.Sprintf("❌ Repository setup failed: %v", err))
-		m.db.UpdateSessionStatus(ctx, session.SessionID, models.SessionStatusError)
+		fail(fmt.Sprintf("❌ Repository setup failed: %v", err))
 		return
 	}
 
 	// Update session with worktree path
+	if err := m.db.UpdateSessionWorkTreePath(ctx, session.ID, result.WorktreePath); err != nil {
+		fail(fmt.Sprintf("❌ Failed to save work tree path: %v", err))
+		return
+	}
 	session.WorkTreePath = result.WorktreePath
-	// Note: We would need to add an UpdateSessionWorkTreePath method to update this
 
 	// Get system prompt content
 	systemPrompt, err := m.getSystemPromptContent(ctx, req)
 	if err != nil {
-		progressCallback(fmt.Sprintf("❌ Failed to get system prompt: %v", err))
-		m.db.UpdateSessionStatus(ctx, session.SessionID, models.SessionStatusError)
+		fail(fmt.Sprintf("❌ Failed to get system prompt: %v", err))
 		return
 	}
 
 	// Get Anthropic API key from user credentials
 	anthropicAPIKey, err := m.db.GetCredential(ctx, req.CreatedByUserID, models.CredentialTypeAnthropic)
 	if err != nil {
-		progressCallback(fmt.Sprintf("❌ Failed to get Anthropic API key: %v", err))
-		m.db.UpdateSessionStatus(ctx, session.SessionID, models.SessionStatusError)
+		fail(fmt.Sprintf("❌ Failed to get Anthropic API key: %v", err))
+		return
+	}
+
+	// The freeze may have started while the repository was being set up
+	if err := m.CheckNotFrozen(); err != nil {
+		fail("❌ Session setup stopped: Claude usage was frozen by an admin")
 		return
 	}
 
 	// Start Claude session
-	streamMgr := NewClaudeStreamManager()
+	streamMgr, err := m.newStreamManager(ctx, session.ID)
+	if err != nil {
+		fail(fmt.Sprintf("❌ Failed to load MCP servers: %v", err))
+		return
+	}
 
 	messageCallback := func(message string) {
 		progressCallback(message)
 	}
 
 	costCallback := func(cost float64) {
-		m.db.UpdateSessionCostByID(ctx, session.ID, cost)
+		if err := m.RecordSessionCost(ctx, session, cost, progressCallback); err != nil {
+			logging.ErrorCtx(ctx, "Failed to record cost", "branch", session.BranchName, "error", err)
+		}
 	}
 
 	claudeSessionID, err := streamMgr.StartSession(ctx, req.FeatureName, result.WorktreePath, systemPrompt, req.ModelName, anthropicAPIKey, messageCallback, costCallback)
 	if err != nil {
-		progressCallback(fmt.Sprintf("❌ Failed to start Claude session: %v", err))
-		m.db.UpdateSessionStatus(ctx, session.SessionID, models.SessionStatusError)
+		fail(fmt.Sprintf("❌ Failed to start Claude session: %v", err))
 		return
 	}
 
@@ -143,21 +323,94 @@ func (m *Manager) SetupSessionAsync(ctx context.Context, session *models.Session
 	if claudeSessionID != "" {
 		err = m.db.UpdateSessionByID(ctx, session.ID, claudeSessionID)
 		if err != nil {
-			progressCallback(fmt.Sprintf("⚠️ Failed to save Claude session ID: %v", err))
-			m.db.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusError)
+			fail(fmt.Sprintf("⚠️ Failed to save Claude session ID: %v", err))
 			return
 		}
 		// Update our local session object
 		session.SessionID = claudeSessionID
 	} else {
-		progressCallback("⚠️ No Claude session ID received")
-		m.db.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusError)
+		fail("⚠️ No Claude session ID received")
 		return
 	}
 
 	// Mark session as active
 	m.db.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusActive)
-	progressCallback("✅ Session setup complete! Ready for instructions.")
+	session.Status = models.SessionStatusActive
+
+	// A first turn that used up the budget stops the session straight away
+	if budget := m.sessionBudget(ctx, session); budget > 0 && session.RunningCost >= budget {
+		if err := m.EndSession(ctx, session.SessionID, ""); err != nil {
+			fail(fmt.Sprintf("❌ Failed to stop session over its budget: %v", err))
+			return
+		}
+		progressCallback(m.OwnerMention(ctx, session.ID, true) +
+			fmt.Sprintf("🛑 Session stopped: its first turn used up its $%.2f budget", budget))
+		return
+	}
+
+	progressCallback(m.OwnerMention(ctx, session.ID, false) + "✅ Session setup complete! Ready for instructions.")
+}
+
+// sessionSystemPrompt returns the system prompt a session was set up with, falling
+// back to the default for sessions created before setup requests were stored
+func (m *Manager) sessionSystemPrompt(ctx context.Context, session *models.Session) (string, error) {
+	setupRequest, err := m.db.GetSessionSetupRequest(ctx, session.ID)
+	if err != nil {
+		return "", err
+	}
+	if setupRequest == "" {
+		return NewClaudeStreamManager().GetDefaultSystemPrompt(), nil
+	}
+
+	var req models.CreateSessionRequest
+	if err := json.Unmarshal([]byte(setupRequest), &req); err != nil {
+		return "", fmt.Errorf("failed to decode setup request: %w", err)
+	}
+	return m.getSystemPromptContent(ctx, &req)
+}
+
+// ImportSystemPrompts creates the prompts of a library for a user, as public prompts if
+// public is set. Prompts whose name the user can already see are skipped, as are
+// repeats within the library.
+func (m *Manager) ImportSystemPrompts(ctx context.Context, userID int64, library []prompts.LibraryPrompt, public bool) (*models.PromptImportResult, error) {
+	result := &models.PromptImportResult{}
+	seen := make(map[string]bool, len(library))
+
+	for _, prompt := range library {
+		if err := prompts.ValidateLibraryPrompt(prompt); err != nil {
+			result.Skipped = append(result.Skipped, models.PromptImportSkip{Name: prompt.Name, Reason: err.Error()})
+			continue
+		}
+		if seen[prompt.Name] {
+			result.Skipped = append(result.Skipped, models.PromptImportSkip{Name: prompt.Name, Reason: "duplicate in library"})
+			continue
+		}
+		seen[prompt.Name] = true
+
+		exists, err := m.db.SystemPromptNameExists(ctx, userID, prompt.Name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			result.Skipped = append(result.Skipped, models.PromptImportSkip{Name: prompt.Name, Reason: "already exists"})
+			continue
+		}
+
+		_, err = m.db.CreateSystemPrompt(ctx, &models.CreateSystemPromptRequest{
+			Name:        prompt.Name,
+			Description: prompt.Description,
+			Content:     prompt.Content,
+			IsPublic:    public,
+			CreatedBy:   userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Created = append(result.Created, prompt.Name)
+	}
+
+	logging.InfoCtx(logging.WithUserID(ctx, userID), "Imported system prompts", "created", len(result.Created), "skipped", len(result.Skipped))
+	return result, nil
 }
 
 // getSystemPromptContent retrieves the system prompt content based on the request
@@ -186,19 +439,125 @@ func (m *Manager) GetSession(ctx context.Context, sessionID string) (*models.Ses
 	return m.db.GetSession(ctx, sessionID)
 }
 
-// GetActiveSessionForChannel retrieves an active session for a specific channel/thread
+// GetSessionByID retrieves a session by its database ID
+func (m *Manager) GetSessionByID(ctx context.Context, id int64) (*models.Session, error) {
+	return m.db.GetSessionByID(ctx, id)
+}
+
+// replayedRequest is the error CreateSession returns with the session a replayed request
+// already created
+func replayedRequest(existing *models.Session) error {
+	return models.NewCBError(models.ErrCodeRequestReplayed,
+		fmt.Sprintf("this request already created session '%s'", existing.BranchName), nil)
+}
+
+// GetSessionByIdempotencyKey retrieves the session created with an idempotency key,
+// returning a models.ErrSessionNotFound error if none exists
+func (m *Manager) GetSessionByIdempotencyKey(ctx context.Context, idempotencyKey string) (*models.Session, error) {
+	return m.db.GetSessionByIdempotencyKey(ctx, idempotencyKey)
+}
+
+// GetLatestSessionForChannel retrieves the most recent session in a channel/thread regardless of status
+func (m *Manager) GetLatestSessionForChannel(ctx context.Context, workspaceID, channelID, threadTS string) (*models.Session, error) {
+	return m.db.GetLatestSessionForChannel(ctx, workspaceID, channelID, threadTS)
+}
+
+// PrepareRestart readies a session in error or ended state to be set up again and
+// returns the request to pass to SetupSessionAsync. The session keeps its record,
+// branch name and thread; its status is reset to starting.
+func (m *Manager) PrepareRestart(ctx context.Context, session *models.Session) (*models.CreateSessionRequest, error) {
+	if err := m.CheckNotFrozen(); err != nil {
+		return nil, err
+	}
+
+	switch session.Status {
+	case models.SessionStatusError, models.SessionStatusEnded:
+	case models.SessionStatusActive:
+		return nil, models.NewCBError(models.ErrCodeSessionExists,
+			fmt.Sprintf("session '%s' is still active, use `stop` before restarting it", session.BranchName), nil)
+	default:
+		return nil, models.NewCBError(models.ErrCodeSessionExists,
+			fmt.Sprintf("session '%s' is %s and can't be restarted right now", session.BranchName, session.Status), nil)
+	}
+
+	setupRequest, err := m.db.GetSessionSetupRequest(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if setupRequest == "" {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("session '%s' was created before restarts were supported, start a new session instead", session.BranchName), nil)
+	}
+
+	var req models.CreateSessionRequest
+	if err := json.Unmarshal([]byte(setupRequest), &req); err != nil {
+		return nil, fmt.Errorf("failed to decode setup request: %w", err)
+	}
+
+	// Ended sessions pushed their work, so pick up from the pushed branch
+	if session.Status == models.SessionStatusEnded {
+		req.FromCommitish = "origin/" + session.BranchName
+	}
+
+	// Clear what's left of the previous attempt so setup can recreate it
+	timer := metrics.NewTimer()
+	err = m.gitMgr.ResetSessionRepo(req.RepoURL, session.BranchName, session.ID)
+	m.recordRepoOperation("reset", timer, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reset session repository: %w", err)
+	}
+
+	if err := m.db.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusStarting); err != nil {
+		return nil, err
+	}
+	session.Status = models.SessionStatusStarting
+	m.metrics.RecordSessionRestarted()
+
+	logging.InfoCtx(ctx, "Restarting session", "branch", session.BranchName)
+	return &req, nil
+}
+
+// GetActiveSessionForChannel retrieves an active session for a specific channel/thread,
+// returning models.ErrNoActiveSession if there is none
 func (m *Manager) GetActiveSessionForChannel(ctx context.Context, workspaceID, channelID, threadTS string) (*models.Session, error) {
 	return m.db.GetActiveSessionForChannel(ctx, workspaceID, channelID, threadTS)
 }
 
 // SendToSession sends a command to a Claude session
 func (m *Manager) SendToSession(ctx context.Context, sessionID, message string, messageCallback func(string), costCallback func(float64)) error {
-	// Get session from database
+	if err := m.CheckNotFrozen(); err != nil {
+		return err
+	}
+
+	ctx = logging.WithSessionID(ctx, sessionID)
+
 	session, err := m.db.GetSession(ctx, sessionID)
 	if err != nil {
 		return err
 	}
 
+	// Messages sent while Claude is still working on an earlier one wait their turn, as
+	// two turns at once would both change the work tree and Claude's conversation
+	lock := m.messageLock(session.ID)
+	select {
+	case lock <- struct{}{}:
+	default:
+		messageCallback("⏳ Claude is still working on the previous message; this one will be sent when it's done.")
+		select {
+		case lock <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() { <-lock }()
+
+	// Read the session again once the message's turn has come, since it may have ended
+	// or had its Claude session reset while the message waited
+	session, err = m.db.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+
 	if session.Status != models.SessionStatusActive {
 		return models.NewCBError(models.ErrCodeClaudeUnavailable, "session is not active", nil)
 	}
@@ -219,19 +578,73 @@ func (m *Manager) SendToSession(ctx context.Context, sessionID, message string,
 		return fmt.Errorf("failed to get Anthropic API key: %w", err)
 	}
 
+	m.logSessionOutput(session.BranchName, "> "+message)
+	m.output.Publish(session.ID, "> "+message)
+	messageCallback = m.loggingCallback(session, messageCallback)
+
+	if m.config.Session.LogMessages {
+		m.recordSessionMessage(ctx, session.ID, models.MessageDirectionUserToClaude, message)
+
+		// Claude's reply is recorded as one message once the turn is over
+		var reply []string
+		forward := messageCallback
+		messageCallback = func(message string) {
+			reply = append(reply, message)
+			forward(message)
+		}
+		defer func() {
+			if len(reply) > 0 {
+				m.recordSessionMessage(ctx, session.ID, models.MessageDirectionClaudeToUser, strings.Join(reply, "\n"))
+			}
+		}()
+	}
+
 	// Send message to Claude session
-	streamMgr := NewClaudeStreamManager()
+	streamMgr, err := m.newStreamManager(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+
+	// Needed to seed a fresh Claude session if the current one has expired
+	systemPrompt, err := m.sessionSystemPrompt(ctx, session)
+	if err != nil {
+		return err
+	}
+
+	turnCtx, endTurn := m.startTurn(ctx, session.ID)
+	defer endTurn()
 
-	err = streamMgr.SendMessage(ctx, session.SessionID, session.BranchName, session.WorkTreePath, message, session.ModelName, anthropicAPIKey, messageCallback, costCallback)
+	// Each Claude invocation reports its own cost, which is added to the session's running
+	// cost before being handed to the caller. It's recorded under the turn's context so
+	// that a budget stop doesn't wait for this turn to end, but isn't cancelled with it.
+	recordingCostCallback := func(cost float64) {
+		if err := m.RecordSessionCost(context.WithoutCancel(turnCtx), session, cost, messageCallback); err != nil {
+			logging.ErrorCtx(ctx, "Failed to record cost", "branch", session.BranchName, "error", err)
+		}
+		costCallback(cost)
+	}
+
+	claudeSessionID, err := streamMgr.SendMessage(turnCtx, session.SessionID, session.BranchName, session.WorkTreePath, systemPrompt, message, session.ModelName, anthropicAPIKey, messageCallback, recordingCostCallback)
 	if err != nil {
+		if errors.Is(context.Cause(turnCtx), errTurnInterrupted) {
+			return models.NewCBError(models.ErrCodeTurnInterrupted, "Claude's turn was interrupted", nil)
+		}
 		return fmt.Errorf("failed to send message to Claude: %w", err)
 	}
 
+	if claudeSessionID != session.SessionID {
+		logging.InfoCtx(ctx, "Claude session was reset", "branch", session.BranchName, "new_session_id", claudeSessionID)
+		if err := m.db.UpdateSessionByID(ctx, session.ID, claudeSessionID); err != nil {
+			return fmt.Errorf("failed to save new Claude session ID: %w", err)
+		}
+	}
+
 	return nil
 }
 
-// EndSession gracefully ends a Claude session
-func (m *Manager) EndSession(ctx context.Context, sessionID string) error {
+// EndSession gracefully ends a Claude session, committing its changes with commitMsg or,
+// if that's empty, a default message
+func (m *Manager) EndSession(ctx context.Context, sessionID, commitMsg string) error {
 	session, err := m.db.GetSession(ctx, sessionID)
 	if err != nil {
 		return err
@@ -241,27 +654,38 @@ func (m *Manager) EndSession(ctx context.Context, sessionID string) error {
 		return models.NewCBError(models.ErrCodeSessionNotFound, "session is not active", nil)
 	}
 
-	log.Printf("Ending session %s", sessionID)
+	ctx = logging.WithSessionID(ctx, sessionID)
+	logging.InfoCtx(ctx, "Ending session", "branch", session.BranchName)
 
 	// Update status to ending
 	if err := m.db.UpdateSessionStatus(ctx, sessionID, models.SessionStatusEnding); err != nil {
 		return fmt.Errorf("failed to update session status: %w", err)
 	}
 
-	// Stop Claude process
-	if err := m.claudeMgr.StopSession(ctx, sessionID); err != nil {
-		log.Printf("Failed to stop Claude process for session %s: %v", sessionID, err)
-	}
+	pushErr := m.stopAndPush(ctx, session, commitMsg)
 
-	// Commit and push changes
-	commitMsg := fmt.Sprintf("CB Session %s changes", sessionID)
-	if err := m.repoMgr.CommitAndPush(ctx, session.WorkTreePath, session.BranchName, commitMsg); err != nil {
-		log.Printf("Failed to commit changes for session %s: %v", sessionID, err)
+	// If the remote branch has diverged, the commit is only on the work tree. The session
+	// stays active with it, so Claude can be asked to merge the remote changes and the
+	// session stopped again; its next message resumes Claude as after a detach.
+	if errors.Is(pushErr, repo.ErrPushRejected) {
+		if err := m.db.UpdateSessionStatus(ctx, sessionID, models.SessionStatusActive); err != nil {
+			return fmt.Errorf("failed to keep session active: %w", err)
+		}
+		logging.WarnCtx(ctx, "Push rejected, keeping session active", "branch", session.BranchName)
+		return models.NewCBError(models.ErrCodeRepoAccess,
+			fmt.Sprintf("push rejected: remote branch '%s' has diverged. The changes are committed on the session's work tree "+
+				"and the session is still active: ask Claude to merge the remote branch, then stop it again", session.BranchName), pushErr)
 	}
 
+	// Gather the change stats for the summary while the work tree still exists
+	summary := m.newSessionSummary(ctx, session, pushErr == nil)
+
 	// Cleanup work tree
-	if err := m.repoMgr.Cleanup(ctx, session.WorkTreePath); err != nil {
-		log.Printf("Failed to cleanup work tree for session %s: %v", sessionID, err)
+	timer := metrics.NewTimer()
+	err = m.repoMgr.Cleanup(ctx, session.WorkTreePath)
+	m.recordRepoOperation("cleanup", timer, err)
+	if err != nil {
+		logging.ErrorCtx(ctx, "Failed to clean up work tree", "error", err)
 	}
 
 	// Update status to ended
@@ -269,12 +693,109 @@ func (m *Manager) EndSession(ctx context.Context, sessionID string) error {
 		return fmt.Errorf("failed to mark session as ended: %w", err)
 	}
 
-	log.Printf("Session %s ended successfully", sessionID)
+	// Messages still waiting hold the lock they're waiting on; they'll find the session ended
+	m.mu.Lock()
+	delete(m.messageLocks, session.ID)
+	m.mu.Unlock()
+	m.output.Close(session.ID)
+
+	// The session ran from its creation until now
+	m.metrics.RecordSessionEnded(time.Since(session.CreatedAt))
+
+	if err := m.db.SaveSessionSummary(ctx, summary); err != nil {
+		logging.ErrorCtx(ctx, "Failed to save session summary", "error", err)
+	}
+
+	logging.InfoCtx(ctx, "Session ended", "branch", session.BranchName)
 	return nil
 }
 
-// EndAllActiveSessions ends all active sessions (used during shutdown)
-func (m *Manager) EndAllActiveSessions(ctx context.Context) error {
+// stopAndPush stops Claude working in a session's work tree, then commits and pushes
+// what it left there. A commit or push failure is logged and returned, but the session
+// is stopped regardless.
+func (m *Manager) stopAndPush(ctx context.Context, session *models.Session, commitMsg string) error {
+	// Interrupt a turn Claude is still working on, so it doesn't change the work tree
+	// while it's committed or after it's removed
+	m.interruptTurns(ctx, session.ID)
+
+	// Stop Claude process
+	if err := m.claudeMgr.StopSession(ctx, session.SessionID); err != nil {
+		logging.ErrorCtx(ctx, "Failed to stop Claude process", "error", err)
+	}
+
+	// Commit and push changes
+	commitMsg = sanitizeCommitMessage(commitMsg)
+	if commitMsg == "" {
+		commitMsg = fmt.Sprintf("CB Session %s changes", session.SessionID)
+	}
+	timer := metrics.NewTimer()
+	err := m.commitAndPush(ctx, session, commitMsg)
+	m.recordRepoOperation("commit_push", timer, err)
+	if err != nil {
+		logging.ErrorCtx(ctx, "Failed to commit changes", "error", err)
+	}
+	return err
+}
+
+// commitAndPush commits the session's changes and pushes its branch, with the session
+// owner's GitHub token for github.com HTTPS remotes
+func (m *Manager) commitAndPush(ctx context.Context, session *models.Session, commitMsg string) error {
+	var githubToken string
+	ownerID, err := m.GetSessionOwner(ctx, session.ID)
+	if err == nil {
+		var hasGitHub bool
+		hasGitHub, err = m.db.HasCredential(ctx, ownerID, models.CredentialTypeGitHub)
+		if err == nil && hasGitHub {
+			githubToken, err = m.db.GetCredential(ctx, ownerID, models.CredentialTypeGitHub)
+		}
+	}
+	if err != nil {
+		logging.WarnCtx(ctx, "Pushing without the owner's GitHub token", "error", err)
+	}
+
+	auth, err := m.gitMgr.PushAuth(session.WorkTreePath, githubToken)
+	if err != nil {
+		return err
+	}
+	return m.gitMgr.CommitAndPush(ctx, session.WorkTreePath, session.BranchName, commitMsg, auth)
+}
+
+// DetachSession stops an active session for a restart of the service: Claude is stopped
+// and its work committed and pushed as EndSession does, but the work tree is kept and
+// the session is marked detached rather than ended. ResumeDetachedSessions makes it
+// active again, and its next message resumes the same Claude session.
+func (m *Manager) DetachSession(ctx context.Context, sessionID string) error {
+	session, err := m.db.GetSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if session.Status != models.SessionStatusActive {
+		return models.NewCBError(models.ErrCodeSessionNotFound, "session is not active", nil)
+	}
+
+	ctx = logging.WithSessionID(ctx, sessionID)
+	logging.InfoCtx(ctx, "Detaching session", "branch", session.BranchName)
+
+	// The work tree is kept, so a failed push can be retried when the session ends
+	_ = m.stopAndPush(ctx, session, "")
+
+	if err := m.db.UpdateSessionStatus(ctx, sessionID, models.SessionStatusDetached); err != nil {
+		return fmt.Errorf("failed to mark session as detached: %w", err)
+	}
+
+	m.mu.Lock()
+	delete(m.messageLocks, session.ID)
+	m.mu.Unlock()
+	m.output.Close(session.ID)
+
+	logging.InfoCtx(ctx, "Session detached", "branch", session.BranchName)
+	return nil
+}
+
+// DetachAllActiveSessions detaches every active session, for a shutdown in the detach
+// mode
+func (m *Manager) DetachAllActiveSessions(ctx context.Context) error {
 	sessions, err := m.db.GetAllActiveSessions(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get active sessions: %w", err)
@@ -282,76 +803,838 @@ func (m *Manager) EndAllActiveSessions(ctx context.Context) error {
 
 	var errors []error
 	for _, session := range sessions {
-		if err := m.EndSession(ctx, session.SessionID); err != nil {
-			errors = append(errors, fmt.Errorf("failed to end session %s: %w", session.SessionID, err))
+		if err := m.DetachSession(ctx, session.SessionID); err != nil {
+			errors = append(errors, fmt.Errorf("failed to detach session %s: %w", session.SessionID, err))
 		}
 	}
 
 	if len(errors) > 0 {
-		return fmt.Errorf("errors ending sessions: %v", errors)
+		return fmt.Errorf("errors detaching sessions: %v", errors)
 	}
 
 	return nil
 }
 
-// GetUserSessions returns all sessions for a user
-func (m *Manager) GetUserSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
-	return m.db.GetActiveSessionsByUser(ctx, userID)
+// ResumeDetachedSessions makes the sessions detached by the last shutdown active again,
+// returning how many there were
+func (m *Manager) ResumeDetachedSessions(ctx context.Context) (int64, error) {
+	resumed, err := m.db.ResumeDetachedSessions(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if resumed > 0 {
+		logging.InfoCtx(ctx, "Resumed detached sessions", "count", resumed)
+	}
+	return resumed, nil
 }
 
-// StoreCredential stores user credentials
-func (m *Manager) StoreCredential(ctx context.Context, userID int64, credType, value string) error {
-	return m.db.StoreCredential(ctx, userID, credType, value)
-}
+// newSessionSummary compiles the summary of a session that is being stopped. Change
+// stats are counted from the commitish the session started from; if that can't be
+// determined they are left at zero. The head commit is only recorded if it was pushed.
+func (m *Manager) newSessionSummary(ctx context.Context, session *models.Session, pushed bool) *models.SessionSummary {
+	summary := &models.SessionSummary{
+		SessionID:       session.ID,
+		Feature:         session.BranchName,
+		Branch:          session.BranchName,
+		RepoURL:         session.RepoURL,
+		TotalCost:       session.RunningCost,
+		DurationSeconds: int64(time.Since(session.CreatedAt).Seconds()),
+	}
 
-// GetCredential retrieves user credentials
-func (m *Manager) GetCredential(ctx context.Context, userID int64, credType string) (string, error) {
-	return m.db.GetCredential(ctx, userID, credType)
-}
+	turns, err := m.db.GetSessionTurns(ctx, session.ID)
+	if err != nil {
+		logging.WarnCtx(ctx, "Failed to get turns for summary", "branch", session.BranchName, "error", err)
+	}
+	summary.Turns = turns
 
-// HasRequiredCredentials checks if user has all required credentials
-func (m *Manager) HasRequiredCredentials(ctx context.Context, userID int64) (bool, error) {
-	return m.db.HasRequiredCredentials(ctx, userID)
-}
+	// EndSession has committed by now; if the push succeeded too, this is the pushed commit
+	if pushed {
+		sha, err := m.repoMgr.HeadCommit(ctx, session.WorkTreePath)
+		if err != nil {
+			logging.WarnCtx(ctx, "Failed to get head commit for summary", "branch", session.BranchName, "error", err)
+		}
+		summary.CommitSHA = sha
+	}
 
-// CreateOrUpdateUser creates or updates a user
-func (m *Manager) CreateOrUpdateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error) {
-	return m.db.CreateUser(ctx, req)
-}
+	setupRequest, err := m.db.GetSessionSetupRequest(ctx, session.ID)
+	if err != nil || setupRequest == "" {
+		return summary
+	}
+	var req models.CreateSessionRequest
+	if err := json.Unmarshal([]byte(setupRequest), &req); err != nil || req.FromCommitish == "" {
+		return summary
+	}
 
-// GetUserBySlackID retrieves a user by Slack workspace and user ID
-func (m *Manager) GetUserBySlackID(ctx context.Context, workspaceID, userID string) (*models.User, error) {
-	return m.db.GetUserBySlackID(ctx, workspaceID, userID)
-}
+	commits, files, err := m.repoMgr.ChangeStats(ctx, session.WorkTreePath, req.FromCommitish)
+	if err != nil {
+		logging.WarnCtx(ctx, "Failed to get change stats for summary", "branch", session.BranchName, "error", err)
+		return summary
+	}
+	summary.Commits = commits
+	summary.FilesChanged = files
 
-// GetSessionOwner retrieves the owner user ID for a session
-func (m *Manager) GetSessionOwner(ctx context.Context, sessionID int64) (int64, error) {
-	return m.db.GetSessionOwner(ctx, sessionID)
-}
+	insertions, deletions, err := m.repoMgr.LineChanges(ctx, session.WorkTreePath, req.FromCommitish)
+	if err != nil {
+		logging.WarnCtx(ctx, "Failed to get line changes for summary", "branch", session.BranchName, "error", err)
+		return summary
+	}
+	summary.Insertions = insertions
+	summary.Deletions = deletions
 
-// UpdateSessionCost updates the running cost for a session
-func (m *Manager) UpdateSessionCost(ctx context.Context, sessionID string, cost float64) error {
-	return m.db.UpdateSessionCost(ctx, sessionID, cost)
+	return summary
 }
 
-// GetSystemPromptByName retrieves a system prompt by name for a user
-func (m *Manager) GetSystemPromptByName(ctx context.Context, userID int64, name string) (*models.SystemPrompt, error) {
-	return m.db.GetSystemPromptByName(ctx, userID, name)
-}
+// GetSessionDiff returns the diffstat and unified diff of a session's uncommitted changes
+func (m *Manager) GetSessionDiff(ctx context.Context, session *models.Session) (string, string, error) {
+	if session.WorkTreePath == "" {
+		return "", "", models.NewCBError(models.ErrCodeSessionNotFound,
+			fmt.Sprintf("session '%s' has no work tree yet", session.BranchName), nil)
+	}
 
-// CheckBranchNameExists checks if a branch name is already in use
-func (m *Manager) CheckBranchNameExists(ctx context.Context, branchName string) (bool, error) {
-	return m.db.CheckBranchNameExists(ctx, branchName)
-}
+	stat, err := m.repoMgr.DiffStat(ctx, session.WorkTreePath)
+	if err != nil {
+		return "", "", err
+	}
+	diff, err := m.repoMgr.Diff(ctx, session.WorkTreePath)
+	if err != nil {
+		return "", "", err
+	}
 
-// GetSessionByBranchName retrieves a session by its branch name
-func (m *Manager) GetSessionByBranchName(ctx context.Context, branchName string) (*models.Session, error) {
-	return m.db.GetSessionByBranchName(ctx, branchName)
+	return stat, diff, nil
 }
 
-// IsUserAssociatedWithSession checks if a user is associated with a session
-func (m *Manager) IsUserAssociatedWithSession(ctx context.Context, sessionID int64, userID int64) (bool, error) {
-	return m.db.IsUserAssociatedWithSession(ctx, sessionID, userID)
+// OpenPullRequest opens a GitHub pull request for a stopped session's branch with the
+// user's GitHub token and returns its URL. An empty title uses the feature name and an
+// empty base the branch the session started from.
+func (m *Manager) OpenPullRequest(ctx context.Context, session *models.Session, userID int64, title, base string) (string, error) {
+	if session.Status != models.SessionStatusEnded {
+		return "", models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("session '%s' is %s, use `stop` first so its changes are pushed", session.BranchName, session.Status), nil)
+	}
+
+	owner, repoName, err := github.ParseRepoURL(session.RepoURL)
+	if err != nil {
+		if errors.Is(err, github.ErrNotGitHub) {
+			return "", models.NewCBError(models.ErrCodeRepoAccess,
+				"pull requests can only be opened for repositories on github.com", err)
+		}
+		return "", models.NewCBError(models.ErrCodeRepoAccess, err.Error(), err)
+	}
+
+	token, err := m.db.GetCredential(ctx, userID, models.CredentialTypeGitHub)
+	if err != nil {
+		return "", models.NewCBError(models.ErrCodeNoCredentials,
+			"a GitHub token is required to open pull requests, set one with `credentials set github <token>`", err)
+	}
+
+	if title == "" {
+		title = session.BranchName
+	}
+	if base == "" {
+		base = m.sessionBaseBranch(ctx, session)
+	}
+
+	prURL, err := m.github.CreatePullRequest(ctx, token, owner, repoName, &github.PullRequest{
+		Title: title,
+		Head:  session.BranchName,
+		Base:  base,
+	})
+	if err != nil {
+		if errors.Is(err, github.ErrTokenScope) {
+			return "", models.NewCBError(models.ErrCodeUnauthorized,
+				fmt.Sprintf("%v; it needs the `repo` scope (or pull request write access) on %s/%s", err, owner, repoName), err)
+		}
+		return "", err
+	}
+
+	if err := m.db.SetSessionSummaryPRURL(ctx, session.ID, prURL); err != nil {
+		logging.ErrorCtx(ctx, "Failed to record pull request", "branch", session.BranchName, "error", err)
+	}
+
+	logging.InfoCtx(logging.WithUserID(ctx, userID), "Opened pull request", "branch", session.BranchName, "url", prURL)
+	return prURL, nil
+}
+
+// sessionBaseBranch returns the branch a session started from, or main if it started
+// from something other than a branch
+func (m *Manager) sessionBaseBranch(ctx context.Context, session *models.Session) string {
+	setupRequest, err := m.db.GetSessionSetupRequest(ctx, session.ID)
+	if err != nil || setupRequest == "" {
+		return "main"
+	}
+	var req models.CreateSessionRequest
+	if err := json.Unmarshal([]byte(setupRequest), &req); err != nil {
+		return "main"
+	}
+
+	base := strings.TrimPrefix(req.FromCommitish, "origin/")
+	if base == "" || base == "HEAD" || base == session.BranchName || isCommitHash(base) {
+		return "main"
+	}
+	return base
+}
+
+// isCommitHash reports whether ref looks like an abbreviated or full commit hash
+func isCommitHash(ref string) bool {
+	if len(ref) < 7 || len(ref) > 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// GetSessionSummary retrieves the summary recorded when a session was stopped
+func (m *Manager) GetSessionSummary(ctx context.Context, sessionID int64) (*models.SessionSummary, error) {
+	return m.db.GetSessionSummary(ctx, sessionID)
+}
+
+// EndAllActiveSessions ends all active sessions (used during shutdown)
+func (m *Manager) EndAllActiveSessions(ctx context.Context) error {
+	sessions, err := m.db.GetAllActiveSessions(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get active sessions: %w", err)
+	}
+
+	var errors []error
+	for _, session := range sessions {
+		if err := m.EndSession(ctx, session.SessionID, ""); err != nil {
+			errors = append(errors, fmt.Errorf("failed to end session %s: %w", session.SessionID, err))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("errors ending sessions: %v", errors)
+	}
+
+	return nil
+}
+
+// maxCommitMessageLength caps the characters of a user-supplied commit message
+const maxCommitMessageLength = 200
+
+// sanitizeCommitMessage puts a user-supplied commit message on a single line, dropping
+// control characters, and truncates it to maxCommitMessageLength characters
+func sanitizeCommitMessage(message string) string {
+	message = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, message)
+	message = strings.Join(strings.Fields(message), " ")
+	if runes := []rune(message); len(runes) > maxCommitMessageLength {
+		message = strings.TrimSpace(string(runes[:maxCommitMessageLength]))
+	}
+	return message
+}
+
+// GetAllActiveSessions returns every active session, regardless of owner
+func (m *Manager) GetAllActiveSessions(ctx context.Context) ([]*models.Session, error) {
+	return m.db.GetAllActiveSessions(ctx)
+}
+
+// GetUserSessions returns a page of a user's active sessions, newest first
+func (m *Manager) GetUserSessions(ctx context.Context, userID int64, limit, offset int) ([]*models.Session, error) {
+	return m.db.GetActiveSessionsByUser(ctx, userID, limit, offset)
+}
+
+// GetUserSessionCount counts a user's active sessions
+func (m *Manager) GetUserSessionCount(ctx context.Context, userID int64) (int, error) {
+	return m.db.GetSessionCountByUser(ctx, userID)
+}
+
+// StoreCredential stores user credentials, first checking them with the provider if
+// VERIFY_CREDENTIALS_ON_SET is enabled
+func (m *Manager) StoreCredential(ctx context.Context, userID int64, credType, value string) error {
+	if m.config.Credentials.VerifyOnSet {
+		if err := m.verifyCredential(ctx, credType, value); err != nil {
+			return err
+		}
+	}
+	return m.db.StoreCredential(ctx, userID, credType, value)
+}
+
+// verifyCredential checks that Anthropic or GitHub accepts a credential
+func (m *Manager) verifyCredential(ctx context.Context, credType, value string) error {
+	var err error
+	switch credType {
+	case models.CredentialTypeAnthropic:
+		err = m.anthropic.VerifyKey(ctx, value)
+	case models.CredentialTypeGitHub:
+		err = m.github.VerifyToken(ctx, value)
+	default:
+		return nil
+	}
+
+	switch {
+	case errors.Is(err, anthropic.ErrInvalidKey):
+		return models.NewCBError(models.ErrCodeInvalidCommand, "Anthropic rejected this API key; check it and set it again", nil)
+	case errors.Is(err, github.ErrInvalidToken):
+		return models.NewCBError(models.ErrCodeInvalidCommand, "GitHub rejected this token; check it and set it again", nil)
+	case err != nil:
+		return fmt.Errorf("couldn't verify the %s credential, try again later: %w", credType, err)
+	}
+	return nil
+}
+
+// GetCredential retrieves user credentials
+func (m *Manager) GetCredential(ctx context.Context, userID int64, credType string) (string, error) {
+	return m.db.GetCredential(ctx, userID, credType)
+}
+
+// DeleteCredential removes a user's stored credential
+func (m *Manager) DeleteCredential(ctx context.Context, userID int64, credType string) error {
+	return m.db.DeleteCredential(ctx, userID, credType)
+}
+
+// HasRequiredCredentials checks if user has all credentials required to start a session on repoURL
+func (m *Manager) HasRequiredCredentials(ctx context.Context, userID int64, repoURL string) (bool, error) {
+	missing, err := m.MissingCredentials(ctx, userID, repoURL)
+	if err != nil {
+		return false, err
+	}
+	return len(missing) == 0, nil
+}
+
+// MissingCredentials returns the credential types the user still needs to start a session
+// on repoURL. An Anthropic key is always required; a GitHub token is only required when
+// the repository can't be read anonymously (private repos and SSH URLs).
+func (m *Manager) MissingCredentials(ctx context.Context, userID int64, repoURL string) ([]string, error) {
+	var missing []string
+
+	hasAnthropic, err := m.db.HasCredential(ctx, userID, models.CredentialTypeAnthropic)
+	if err != nil {
+		return nil, err
+	}
+	if !hasAnthropic {
+		missing = append(missing, models.CredentialTypeAnthropic)
+	}
+
+	hasGitHub, err := m.db.HasCredential(ctx, userID, models.CredentialTypeGitHub)
+	if err != nil {
+		return nil, err
+	}
+	if !hasGitHub && !m.repoMgr.IsPublicRepo(ctx, repoURL) {
+		missing = append(missing, models.CredentialTypeGitHub)
+	}
+
+	return missing, nil
+}
+
+// MoveWorkspace re-keys the users and sessions of workspace key fromID to toID, logging
+// what was moved
+func (m *Manager) MoveWorkspace(ctx context.Context, fromID, toID string) error {
+	users, sessions, err := m.db.MoveWorkspace(ctx, fromID, toID)
+	if err != nil {
+		return err
+	}
+	if users > 0 || sessions > 0 {
+		logging.InfoCtx(ctx, "Moved records to the new workspace key", "from", fromID, "to", toID, "users", users, "sessions", sessions)
+	}
+	return nil
+}
+
+// CreateOrUpdateUser creates or updates a user
+func (m *Manager) CreateOrUpdateUser(ctx context.Context, req *models.CreateUserRequest) (*models.User, error) {
+	return m.db.CreateUser(ctx, req)
+}
+
+// GetUserBySlackID retrieves a user by Slack workspace and user ID, returning
+// models.ErrUserNotFound if they haven't used the bot yet
+func (m *Manager) GetUserBySlackID(ctx context.Context, workspaceID, userID string) (*models.User, error) {
+	return m.db.GetUserBySlackID(ctx, workspaceID, userID)
+}
+
+// GetSessionOwner retrieves the owner user ID for a session
+func (m *Manager) GetSessionOwner(ctx context.Context, sessionID int64) (int64, error) {
+	return m.db.GetSessionOwner(ctx, sessionID)
+}
+
+// JoinSession adds a user to a session with the given role (collaborator or viewer).
+// Joining again changes the user's role; the owner can't join their own session.
+func (m *Manager) JoinSession(ctx context.Context, session *models.Session, userID int64, role string) error {
+	if role != models.SessionRoleCollaborator && role != models.SessionRoleViewer {
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("invalid role '%s', must be collaborator or viewer", role), nil)
+	}
+
+	if session.Status == models.SessionStatusEnded {
+		return models.NewCBError(models.ErrCodeSessionNotFound,
+			fmt.Sprintf("session '%s' has ended", session.BranchName), nil)
+	}
+
+	currentRole, err := m.db.GetUserRole(ctx, session.ID, userID)
+	if err != nil {
+		return err
+	}
+	if currentRole == models.SessionRoleOwner {
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("you already own session '%s'", session.BranchName), nil)
+	}
+
+	return m.db.AddUserToSession(ctx, session.ID, userID, role)
+}
+
+// LeaveSession removes a user from a session. When the owner leaves, ownership passes
+// to the member who joined earliest, preferring collaborators over viewers. If the
+// owner is the last member the session is ended instead; the owner stays recorded
+// against the ended session so its cost remains attributed.
+func (m *Manager) LeaveSession(ctx context.Context, session *models.Session, userID int64) (*models.LeaveResult, error) {
+	role, err := m.db.GetUserRole(ctx, session.ID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, models.NewCBError(models.ErrCodeUnauthorized,
+			fmt.Sprintf("you are not part of session '%s'", session.BranchName), nil)
+	}
+
+	if role != models.SessionRoleOwner {
+		if err := m.db.RemoveUserFromSession(ctx, session.ID, userID); err != nil {
+			return nil, err
+		}
+		return &models.LeaveResult{Outcome: models.LeaveOutcomeLeft}, nil
+	}
+
+	users, err := m.db.GetSessionUsers(ctx, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users are ordered by joined_at, so the first match is the longest-standing member
+	var newOwner *models.SessionUser
+	for _, u := range users {
+		if u.UserID == userID {
+			continue
+		}
+		if u.Role == models.SessionRoleCollaborator {
+			newOwner = u
+			break
+		}
+		if newOwner == nil {
+			newOwner = u
+		}
+	}
+
+	if newOwner != nil {
+		if err := m.db.TransferSessionOwnership(ctx, session.ID, userID, newOwner.UserID); err != nil {
+			return nil, err
+		}
+		logging.InfoCtx(logging.WithUserID(ctx, newOwner.UserID), "Transferred session ownership", "branch", session.BranchName)
+		return &models.LeaveResult{Outcome: models.LeaveOutcomeTransferred, NewOwnerID: newOwner.UserID}, nil
+	}
+
+	switch session.Status {
+	case models.SessionStatusActive:
+		if err := m.EndSession(ctx, session.SessionID, ""); err != nil {
+			return nil, err
+		}
+	case models.SessionStatusStarting, models.SessionStatusEnding:
+		return nil, models.NewCBError(models.ErrCodeSessionExists,
+			fmt.Sprintf("session '%s' is %s, try again once it has settled", session.BranchName, session.Status), nil)
+	}
+
+	return &models.LeaveResult{Outcome: models.LeaveOutcomeEnded}, nil
+}
+
+// GetUserByID retrieves a user by their internal ID
+func (m *Manager) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	return m.db.GetUserByID(ctx, id)
+}
+
+// GetUserPrefs retrieves a user's preferences
+func (m *Manager) GetUserPrefs(ctx context.Context, userID int64) (*models.UserPrefs, error) {
+	return m.db.GetUserPrefs(ctx, userID)
+}
+
+// SetNotifyPreference sets when a user is @-mentioned on session events: on, off or
+// mentions (alerts only)
+func (m *Manager) SetNotifyPreference(ctx context.Context, userID int64, notify string) error {
+	switch notify {
+	case models.NotifyOn, models.NotifyOff, models.NotifyMentions:
+	default:
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("invalid notification preference '%s', must be on, off or mentions", notify), nil)
+	}
+	return m.db.SetNotifyPreference(ctx, userID, notify)
+}
+
+// OwnerMention returns the @-mention of a session's owner to start a message about a
+// session event with, or "" if the owner's notification preference leaves it out.
+// Alerts (budget alerts and errors) also mention owners who only want mentions for
+// alerts. Lookup failures are logged and leave the mention out.
+func (m *Manager) OwnerMention(ctx context.Context, sessionID int64, alert bool) string {
+	ownerID, err := m.db.GetSessionOwner(ctx, sessionID)
+	if err != nil {
+		logging.WarnCtx(ctx, "Failed to get session owner to mention", "session", sessionID, "error", err)
+		return ""
+	}
+
+	prefs, err := m.db.GetUserPrefs(ctx, ownerID)
+	if err != nil {
+		logging.WarnCtx(logging.WithUserID(ctx, ownerID), "Failed to get notification preference", "error", err)
+		return ""
+	}
+	switch prefs.Notify {
+	case models.NotifyOff:
+		return ""
+	case models.NotifyMentions:
+		if !alert {
+			return ""
+		}
+	}
+
+	owner, err := m.db.GetUserByID(ctx, ownerID)
+	if err != nil {
+		logging.WarnCtx(logging.WithUserID(ctx, ownerID), "Failed to get user to mention", "error", err)
+		return ""
+	}
+	return fmt.Sprintf("<@%s> ", owner.SlackUserID)
+}
+
+// GetSessionUsers retrieves the users associated with a session and their roles
+func (m *Manager) GetSessionUsers(ctx context.Context, sessionID int64) ([]*models.SessionUser, error) {
+	return m.db.GetSessionUsers(ctx, sessionID)
+}
+
+// UpdateSessionCost updates the running cost for a session
+func (m *Manager) UpdateSessionCost(ctx context.Context, sessionID string, cost float64) error {
+	return m.db.UpdateSessionCost(ctx, sessionID, cost)
+}
+
+// SetThreadCallback sets the callback used to post to a session's thread from
+// background work such as idle cleanup
+func (m *Manager) SetThreadCallback(callback func(channelID, threadTS, message string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.threadCallback = callback
+}
+
+// SetTickerFactory replaces how the idle session monitor's ticker is started
+func (m *Manager) SetTickerFactory(factory func(time.Duration) (<-chan time.Time, func())) {
+	m.newTicker = factory
+}
+
+// newTicker starts a time.Ticker
+func newTicker(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// SetClock replaces the clock idle cleanup measures session age and idleness with
+func (m *Manager) SetClock(now func() time.Time) {
+	m.now = now
+}
+
+// postToThread posts a message to a session's thread, if a thread callback is set
+func (m *Manager) postToThread(session *models.Session, message string) {
+	m.mu.RLock()
+	callback := m.threadCallback
+	m.mu.RUnlock()
+
+	if callback != nil {
+		callback(session.SlackChannelID, session.SlackThreadTS, message)
+	}
+}
+
+// SetAlertCallback sets the callback used to cross-post budget alerts (e.g. to a
+// dedicated Slack channel) in addition to the session thread
+func (m *Manager) SetAlertCallback(callback func(string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.alertCallback = callback
+}
+
+// SetFrozen turns the spend freeze on or off. While frozen, new sessions and new Claude
+// invocations are rejected; turns already running are left to complete.
+func (m *Manager) SetFrozen(frozen bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.frozen = frozen
+}
+
+// IsFrozen reports whether new Claude spend is frozen
+func (m *Manager) IsFrozen() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.frozen
+}
+
+// CheckNotFrozen returns an error if new Claude spend is frozen, letting callers reject
+// a request before doing any work for it
+func (m *Manager) CheckNotFrozen() error {
+	if m.IsFrozen() {
+		return models.NewCBError(models.ErrCodeSpendFrozen,
+			"Claude usage is frozen by an admin; new sessions and messages are blocked until it's unfrozen", nil)
+	}
+	return nil
+}
+
+// errTurnInterrupted is the cause of a turn cancelled by InterruptSession
+var errTurnInterrupted = errors.New("Claude turn interrupted")
+
+// claudeTurn is a Claude turn in flight
+type claudeTurn struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{} // closed once the turn is over
+}
+
+// turnContextKey is the context key of the Claude turn a context belongs to
+type turnContextKey struct{}
+
+// startTurn registers a Claude turn for a session so InterruptSession can cancel it.
+// The returned context ends the turn's claude process when cancelled; call the
+// returned function once the turn is over.
+func (m *Manager) startTurn(ctx context.Context, sessionID int64) (context.Context, func()) {
+	turn := &claudeTurn{done: make(chan struct{})}
+	turnCtx, cancel := context.WithCancelCause(context.WithValue(ctx, turnContextKey{}, turn))
+	turn.cancel = cancel
+
+	m.mu.Lock()
+	if m.turns[sessionID] == nil {
+		m.turns[sessionID] = make(map[*claudeTurn]struct{})
+	}
+	m.turns[sessionID][turn] = struct{}{}
+	m.mu.Unlock()
+
+	return turnCtx, func() {
+		m.mu.Lock()
+		delete(m.turns[sessionID], turn)
+		if len(m.turns[sessionID]) == 0 {
+			delete(m.turns, sessionID)
+		}
+		m.mu.Unlock()
+		cancel(nil)
+		close(turn.done)
+	}
+}
+
+// messageLock returns the lock serializing a session's messages, which a message holds
+// by sending to it
+func (m *Manager) messageLock(sessionID int64) chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lock, ok := m.messageLocks[sessionID]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		m.messageLocks[sessionID] = lock
+	}
+	return lock
+}
+
+// InterruptSession cancels a session's in-flight Claude turns, killing their claude
+// processes. The session stays active with its work tree and Claude session intact, so
+// the next message resumes the conversation. It reports whether any turn was running.
+func (m *Manager) InterruptSession(sessionID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	turns := m.turns[sessionID]
+	for turn := range turns {
+		turn.cancel(errTurnInterrupted)
+	}
+	return len(turns) > 0
+}
+
+// interruptTurns cancels a session's in-flight Claude turns like InterruptSession and
+// waits until they are over or ctx is done. A turn that ctx belongs to, e.g. when its
+// cost ends the session, isn't waited for since it can't end before its caller returns.
+func (m *Manager) interruptTurns(ctx context.Context, sessionID int64) {
+	m.mu.Lock()
+	var turns []*claudeTurn
+	for turn := range m.turns[sessionID] {
+		turn.cancel(errTurnInterrupted)
+		turns = append(turns, turn)
+	}
+	m.mu.Unlock()
+
+	own, _ := ctx.Value(turnContextKey{}).(*claudeTurn)
+	for _, turn := range turns {
+		if turn == own {
+			continue
+		}
+		select {
+		case <-turn.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RecordSessionCost adds the cost of one Claude invocation to a session's running cost
+// and raises a budget alert when the running cost crosses the configured warning
+// threshold. An active session whose cost reaches its budget is ended; a session still
+// being set up is left for setup to end. The thresholds are checked against the total
+// in the database rather than session.RunningCost, which may be stale.
+func (m *Manager) RecordSessionCost(ctx context.Context, session *models.Session, added float64, threadCallback func(string)) error {
+	cost, err := m.db.AddSessionCostByID(ctx, session.ID, added)
+	if err != nil {
+		return err
+	}
+	previousCost := cost - added
+	session.RunningCost = cost
+
+	threshold := m.config.Budget.WarnThresholdUSD
+	if threshold > 0 && previousCost < threshold && cost >= threshold {
+		m.sendBudgetAlert(fmt.Sprintf("⚠️ Session '%s' has reached $%.4f, crossing the $%.2f cost warning threshold",
+			session.BranchName, cost, threshold), m.OwnerMention(ctx, session.ID, true), threadCallback)
+	}
+
+	budget := m.sessionBudget(ctx, session)
+	if budget > 0 && previousCost < budget && cost >= budget {
+		m.sendBudgetAlert(fmt.Sprintf("🛑 Session '%s' has reached $%.4f, over its $%.2f budget, and is being stopped",
+			session.BranchName, cost, budget), m.OwnerMention(ctx, session.ID, true), threadCallback)
+
+		if session.Status == models.SessionStatusActive {
+			if err := m.EndSession(ctx, session.SessionID, ""); err != nil {
+				return fmt.Errorf("failed to stop session over its budget: %w", err)
+			}
+			session.Status = models.SessionStatusEnded
+		}
+	}
+
+	return nil
+}
+
+// sessionBudget returns the cost in USD at which a session is stopped, 0 for none: the
+// lower of its own budget and MAX_SESSION_COST_USD
+func (m *Manager) sessionBudget(ctx context.Context, session *models.Session) float64 {
+	budget := m.config.Budget.MaxSessionCostUSD
+
+	own, err := m.db.GetSessionMaxCost(ctx, session.ID)
+	if err != nil {
+		logging.WarnCtx(ctx, "Failed to get session budget", "branch", session.BranchName, "error", err)
+		return budget
+	}
+	if own > 0 && (budget <= 0 || own < budget) {
+		budget = own
+	}
+	return budget
+}
+
+// sendBudgetAlert posts a budget alert to the session thread, mentioning the owner when
+// mention is set, and cross-posts it to the alert channel when one is configured
+func (m *Manager) sendBudgetAlert(message, mention string, threadCallback func(string)) {
+	if threadCallback != nil {
+		threadCallback(mention + message)
+	}
+
+	m.mu.RLock()
+	alertCallback := m.alertCallback
+	m.mu.RUnlock()
+
+	if alertCallback != nil {
+		alertCallback(message)
+	}
+}
+
+// GetUserLimits reports the user's current usage against the configured limits
+func (m *Manager) GetUserLimits(ctx context.Context, userID int64) (*models.UserLimits, error) {
+	activeSessions, err := m.db.CountActiveSessionsByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	totalCost, err := m.db.GetUserTotalCost(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserLimits{
+		SessionCreatesRemaining: m.createLimiter.Remaining(userID),
+		SessionCreateLimit:      m.createLimiter.Capacity(),
+		SessionCreateWindow:     m.config.Session.CreateWindow,
+		ActiveSessions:          activeSessions,
+		MaxSessions:             m.config.Session.MaxPerUser,
+		TotalCostUSD:            totalCost,
+	}, nil
+}
+
+// SumCostByUser returns the running cost of the sessions a user owns that were created
+// at or after since, or of all of them for a zero since
+func (m *Manager) SumCostByUser(ctx context.Context, userID int64, since time.Time) (float64, error) {
+	return m.db.SumCostByUser(ctx, userID, since)
+}
+
+// SumCostByWorkspace returns the running cost of a workspace's sessions that were
+// created at or after since, or of all of them for a zero since
+func (m *Manager) SumCostByWorkspace(ctx context.Context, workspaceID string, since time.Time) (float64, error) {
+	return m.db.SumCostByWorkspace(ctx, workspaceID, since)
+}
+
+// GetSystemPromptByName retrieves a system prompt by name for a user
+func (m *Manager) GetSystemPromptByName(ctx context.Context, userID int64, name string) (*models.SystemPrompt, error) {
+	return m.db.GetSystemPromptByName(ctx, userID, name)
+}
+
+// GetSystemPrompts returns the system prompts a user can use: their own, those shared
+// with them and public ones
+func (m *Manager) GetSystemPrompts(ctx context.Context, userID int64) ([]*models.SystemPrompt, error) {
+	return m.db.GetSystemPromptsByUser(ctx, userID)
+}
+
+// CreateSystemPrompt creates a system prompt owned by the user. Names must be unique
+// among the prompts the user can already see so --pname stays unambiguous.
+func (m *Manager) CreateSystemPrompt(ctx context.Context, req *models.CreateSystemPromptRequest) (*models.SystemPrompt, error) {
+	if err := prompts.ValidateLibraryPrompt(prompts.LibraryPrompt{Name: req.Name, Content: req.Content}); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, err.Error(), nil)
+	}
+
+	exists, err := m.db.SystemPromptNameExists(ctx, req.CreatedBy, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("a system prompt named '%s' already exists", req.Name), nil)
+	}
+
+	return m.db.CreateSystemPrompt(ctx, req)
+}
+
+// DeleteSystemPrompt deletes a system prompt by name. Only its creator may delete it.
+func (m *Manager) DeleteSystemPrompt(ctx context.Context, userID int64, name string) error {
+	prompt, err := m.db.GetSystemPromptByName(ctx, userID, name)
+	if err != nil {
+		return err
+	}
+
+	if prompt.CreatedBy != userID {
+		return models.NewCBError(models.ErrCodeUnauthorized,
+			fmt.Sprintf("only the creator of '%s' can delete it", name), nil)
+	}
+
+	return m.db.DeleteSystemPrompt(ctx, prompt.ID)
+}
+
+// CheckBranchNameExists checks if a branch name is in use by a live session of the
+// repository in the workspace
+func (m *Manager) CheckBranchNameExists(ctx context.Context, workspaceID, repoURL, branchName string) (bool, error) {
+	return m.db.CheckBranchNameExists(ctx, workspaceID, repo.CanonicalRepoURL(repoURL), branchName)
+}
+
+// GetSessionByBranchName retrieves a workspace's session by its branch name, in the
+// repository repoURL or, if it's empty, in any of the workspace's repositories
+func (m *Manager) GetSessionByBranchName(ctx context.Context, workspaceID, repoURL, branchName string) (*models.Session, error) {
+	if repoURL != "" {
+		repoURL = repo.CanonicalRepoURL(repoURL)
+	}
+	return m.db.GetSessionByBranchName(ctx, workspaceID, repoURL, branchName)
+}
+
+// IsUserAssociatedWithSession checks if a user is associated with a session
+func (m *Manager) IsUserAssociatedWithSession(ctx context.Context, sessionID int64, userID int64) (bool, error) {
+	return m.db.IsUserAssociatedWithSession(ctx, sessionID, userID)
+}
+
+// GetUserRole returns a user's role in a session, or "" if they aren't a member
+func (m *Manager) GetUserRole(ctx context.Context, sessionID int64, userID int64) (string, error) {
+	return m.db.GetUserRole(ctx, sessionID, userID)
 }
 
 // UpdateSessionThread updates the thread timestamp for a session
@@ -418,15 +1701,19 @@ func (m *Manager) validateCreateSessionRequest(req *models.CreateSessionRequest)
 	}
 
 	// Validate model name
-	if req.ModelName != models.ModelSonnet && req.ModelName != models.ModelOpus {
-		return models.NewCBError(models.ErrCodeInvalidCommand,
-			fmt.Sprintf("invalid model '%s', must be 'sonnet' or 'opus'", req.ModelName), nil)
+	if _, err := models.Models.Resolve(req.ModelName); err != nil {
+		return err
 	}
 
 	// Validate feature name for git branch compatibility
 	if err := ValidateFeatureName(req.FeatureName); err != nil {
 		return models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("invalid feature name: %v", err), nil)
 	}
+	if m.isProtectedBranch(req.FeatureName, req.FromCommitish) {
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("'%s' is a protected branch and can't be used as the feature name; sessions work on their own branch, e.g. `--feat %s-changes`",
+				req.FeatureName, req.FeatureName), nil)
+	}
 
 	// Check channel restrictions
 	if req.ChannelID == "general" {
@@ -437,6 +1724,90 @@ func (m *Manager) validateCreateSessionRequest(req *models.CreateSessionRequest)
 }
 
 
+// Limits for generated feature names
+const (
+	maxFeatureSlugWords = 5
+	maxFeatureSlugLen   = 40
+)
+
+// GenerateFeatureName derives a feature name for a session started without --feat:
+// a slug of the first words of text (the start command's prompt) or, if that yields
+// nothing, session-YYYYMMDD-hhmm from now. A numeric suffix is added when the name is
+// already used by a live session of the repository in the workspace or is a protected
+// branch.
+func (m *Manager) GenerateFeatureName(ctx context.Context, workspaceID, repoURL, text, fromCommitish string, now time.Time) (string, error) {
+	base := FeatureSlug(text)
+	if base == "" {
+		base = "session-" + now.Format("20060102-1504")
+	}
+
+	for i := 1; i <= 100; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", base, i)
+		}
+		if m.isProtectedBranch(name, fromCommitish) {
+			continue
+		}
+
+		exists, err := m.CheckBranchNameExists(ctx, workspaceID, repoURL, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to check branch name: %w", err)
+		}
+		if !exists {
+			return name, nil
+		}
+	}
+
+	return "", models.NewCBError(models.ErrCodeSessionExists,
+		fmt.Sprintf("couldn't find an unused feature name based on '%s', use --feat", base), nil)
+}
+
+// FeatureSlug turns the first words of text into a lowercase, hyphenated name that is
+// valid as a feature name, or "" if text has no letters or digits
+func FeatureSlug(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	if len(words) > maxFeatureSlugWords {
+		words = words[:maxFeatureSlugWords]
+	}
+
+	slug := strings.Join(words, "-")
+	if len(slug) > maxFeatureSlugLen {
+		slug = strings.TrimRight(slug[:maxFeatureSlugLen], "-")
+	}
+	return slug
+}
+
+// defaultProtectedBranches are protected when PROTECTED_BRANCHES is unset
+var defaultProtectedBranches = []string{"main", "master", "develop"}
+
+// protectedBranches returns the branches configured in PROTECTED_BRANCHES, or the
+// defaults if none are
+func protectedBranches(cfg *config.Config) []string {
+	if len(cfg.Session.ProtectedBranches) == 0 {
+		return defaultProtectedBranches
+	}
+	return cfg.Session.ProtectedBranches
+}
+
+// isProtectedBranch reports whether a feature name would have the session commit to a
+// protected branch: one configured in PROTECTED_BRANCHES (main, master and develop if
+// unset) or the branch the session starts from
+func (m *Manager) isProtectedBranch(featureName, fromCommitish string) bool {
+	if strings.EqualFold(strings.TrimPrefix(fromCommitish, "origin/"), featureName) {
+		return true
+	}
+
+	for _, branch := range protectedBranches(m.config) {
+		if strings.EqualFold(strings.TrimSpace(branch), featureName) {
+			return true
+		}
+	}
+	return false
+}
+
 // ValidateFeatureName ensures the feature name is valid for use as a git branch name
 func ValidateFeatureName(name string) error {
 	if name == "" {
@@ -460,37 +1831,370 @@ func ValidateFeatureName(name string) error {
 	return nil
 }
 
-// StartIdleSessionMonitor starts a goroutine to monitor and cleanup idle sessions
+// StartIdleSessionMonitor checks for idle sessions every IDLE_CHECK_INTERVAL until ctx
+// is cancelled
 func (m *Manager) StartIdleSessionMonitor(ctx context.Context) {
-	// ticker := time.NewTicker(5 * time.Minute) // Check every 5 minutes
-	// defer ticker.Stop()
-	//
-	// for {
-	// 	select {
-	// 	case <-ctx.Done():
-	// 		return
-	// 	case <-ticker.C:
-	// 		m.cleanupIdleSessions(ctx)
-	// 	}
-	// }
-}
-
-func (m *Manager) cleanupIdleSessions(ctx context.Context) {
+	interval := time.Duration(m.config.Session.IdleCheck) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	ticks, stop := m.newTicker(interval)
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+			ended, err := m.CleanupIdleSessions(ctx)
+			if err != nil {
+				logging.ErrorCtx(ctx, "Failed to clean up idle sessions", "error", err)
+				continue
+			}
+			logging.DebugCtx(ctx, "Idle session check done", "ended", ended)
+		}
+	}
+}
+
+// StartMirrorSweeper periodically removes stale local mirror repos. It returns
+// immediately when no mirror TTL is configured.
+func (m *Manager) StartMirrorSweeper(ctx context.Context) {
+	if m.config.Session.MirrorTTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(m.config.Session.MirrorSweep) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := m.SweepMirrors(ctx); err != nil {
+				logging.ErrorCtx(ctx, "Failed to sweep mirror repos", "error", err)
+			}
+		}
+	}
+}
+
+// SweepMirrors removes local mirror repos that no live session references and that
+// haven't been fetched within the configured TTL
+func (m *Manager) SweepMirrors(ctx context.Context) ([]string, error) {
+	inUseURLs, err := m.db.GetLiveSessionRepoURLs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := m.gitMgr.SweepMirrors(inUseURLs, time.Duration(m.config.Session.MirrorTTL)*time.Second)
+	for _, name := range removed {
+		logging.InfoCtx(ctx, "Removed stale mirror repo", "mirror", name)
+	}
+	return removed, err
+}
+
+// ReconcileWorktrees removes the worktrees of sessions that are no longer live, left
+// behind when the server stopped without ending them, logging each one removed
+func (m *Manager) ReconcileWorktrees(ctx context.Context) ([]string, error) {
+	livePaths, err := m.db.GetLiveSessionWorkTreePaths(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := m.gitMgr.ReconcileWorktrees(ctx, livePaths)
+	for _, name := range removed {
+		logging.InfoCtx(ctx, "Removed orphaned worktree", "worktree", name)
+	}
+	return removed, err
+}
+
+// VerifySessions checks every active session's work tree exists, is a git repository
+// and has the session's branch checked out. It returns the number of sessions checked
+// and the discrepancies found; with mark set, the affected sessions are marked as
+// errored so they can be restarted.
+func (m *Manager) VerifySessions(ctx context.Context, mark bool) (int, []*models.SessionDiscrepancy, error) {
 	sessions, err := m.db.GetAllActiveSessions(ctx)
 	if err != nil {
-		log.Printf("Failed to get active sessions for cleanup: %v", err)
+		return 0, nil, err
+	}
+
+	var discrepancies []*models.SessionDiscrepancy
+	for _, session := range sessions {
+		verifyErr := m.repoMgr.VerifyWorkTree(ctx, session.WorkTreePath, session.BranchName)
+		if verifyErr == nil {
+			continue
+		}
+
+		discrepancy := &models.SessionDiscrepancy{
+			SessionID: session.ID,
+			Feature:   session.BranchName,
+			Problem:   verifyErr.Error(),
+		}
+		if mark {
+			if err := m.db.UpdateSessionStatusByID(ctx, session.ID, models.SessionStatusError); err != nil {
+				return len(sessions), discrepancies, err
+			}
+			discrepancy.Marked = true
+			m.metrics.RecordSessionFailed()
+			logging.WarnCtx(ctx, "Marked session as errored", "branch", session.BranchName, "error", verifyErr)
+		}
+		discrepancies = append(discrepancies, discrepancy)
+	}
+
+	return len(sessions), discrepancies, nil
+}
+
+// newGoGitManager creates the git manager for session mirrors and worktrees, which are
+// kept under the configured work directory
+func newGoGitManager(cfg *config.Config) *repo.GoGitManager {
+	// Worktree paths are recorded in the mirrors, so they must not be relative
+	workDir, err := filepath.Abs(cfg.Session.WorkDir)
+	if err != nil {
+		workDir = cfg.Session.WorkDir
+	}
+
+	gitMgr := repo.NewGoGitManagerWithDirs(
+		filepath.Join(workDir, "repos"),
+		filepath.Join(workDir, "worktrees"),
+	)
+	gitMgr.SetSSHKeyPath(cfg.Git.SSHPrivateKeyPath)
+	return gitMgr
+}
+
+// SubscribeOutput subscribes to the output of the session with database ID sessionID,
+// as OutputBroker.Subscribe does
+func (m *Manager) SubscribeOutput(sessionID int64) (<-chan OutputLine, func()) {
+	return m.output.Subscribe(sessionID)
+}
+
+// loggingCallback wraps a message callback so that messages are also published to the
+// session's output subscribers and written to the
+// session's log file
+func (m *Manager) loggingCallback(session *models.Session, callback func(string)) func(string) {
+	return func(message string) {
+		m.logSessionOutput(session.BranchName, message)
+		m.output.Publish(session.ID, message)
+		callback(message)
+	}
+}
+
+// recordSessionMessage adds a message to the session's audit trail. Failures are only
+// logged so they never interrupt the conversation.
+func (m *Manager) recordSessionMessage(ctx context.Context, sessionID int64, direction, content string) {
+	if err := m.db.CreateSessionMessage(ctx, sessionID, "", direction, content); err != nil {
+		logging.ErrorCtx(ctx, "Failed to record session message", "session", sessionID, "error", err)
+	}
+}
+
+// GetSessionMessages returns up to limit of a session's most recently recorded messages,
+// newest first
+func (m *Manager) GetSessionMessages(ctx context.Context, sessionID int64, limit int) ([]*models.SessionMessage, error) {
+	return m.db.GetSessionMessages(ctx, sessionID, limit)
+}
+
+// logSessionOutput appends a message to the session's log file
+func (m *Manager) logSessionOutput(feature, message string) {
+	if m.config.Session.LogDir == "" {
 		return
 	}
+	if err := logging.AppendSessionLog(m.config.Session.LogDir, feature, message); err != nil {
+		logging.Error("Failed to write session log", "branch", feature, "error", err)
+	}
+}
+
+// TailSessionLog returns the last n lines of a session's log file with credentials redacted
+func (m *Manager) TailSessionLog(ctx context.Context, workspaceID, feature string, n int) ([]string, error) {
+	if _, err := m.db.GetSessionByBranchName(ctx, workspaceID, "", feature); err != nil {
+		return nil, err
+	}
+
+	path, err := logging.SessionLogPath(m.config.Session.LogDir, feature)
+	if err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, err.Error(), err)
+	}
+
+	lines, err := logging.TailFile(path, n)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read session log: %w", err)
+	}
+
+	for i, line := range lines {
+		lines[i] = logging.Redact(line)
+	}
+	return lines, nil
+}
+
+// CleanupIdleSessions ends active sessions idle for longer than SESSION_IDLE_TIMEOUT
+// or, when MAX_SESSION_LIFETIME is set, started longer ago than that however active
+// they are. With SESSION_IDLE_WARNING set, an idle session is first warned in its
+// thread and only ended if it's still idle that long after the warning. It returns
+// the number of sessions ended.
+func (m *Manager) CleanupIdleSessions(ctx context.Context) (int, error) {
+	sessions, err := m.db.GetAllActiveSessions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get active sessions for cleanup: %w", err)
+	}
 
 	idleTimeout := time.Duration(m.config.Session.IdleTimeout) * time.Second
-	now := time.Now()
+	idleWarning := time.Duration(m.config.Session.IdleWarning) * time.Second
+	maxLifetime := time.Duration(m.config.Session.MaxLifetime) * time.Second
+	now := m.now()
 
+	m.idleMu.Lock()
+	defer m.idleMu.Unlock()
+
+	// Forget warnings for sessions that have since ended
+	active := make(map[int64]bool, len(sessions))
 	for _, session := range sessions {
-		if now.Sub(session.UpdatedAt) > idleTimeout {
-			log.Printf("Cleaning up idle session %s", session.SessionID)
-			if err := m.EndSession(ctx, session.SessionID); err != nil {
-				log.Printf("Failed to cleanup idle session %s: %v", session.SessionID, err)
+		active[session.ID] = true
+	}
+	for id := range m.idleWarnings {
+		if !active[id] {
+			delete(m.idleWarnings, id)
+		}
+	}
+
+	var toEnd []*models.Session
+	for _, session := range sessions {
+		// Activity since the warning is a reprieve
+		warnedAt, warned := m.idleWarnings[session.ID]
+		if warned && session.UpdatedAt.After(warnedAt) {
+			delete(m.idleWarnings, session.ID)
+			warned = false
+		}
+
+		idle := now.Sub(session.UpdatedAt)
+		switch {
+		case maxLifetime > 0 && now.Sub(session.CreatedAt) > maxLifetime:
+			logging.InfoCtx(logging.WithSessionID(ctx, session.SessionID), "Ending session that reached its maximum lifetime", "branch", session.BranchName)
+			m.postToThread(session, fmt.Sprintf("%s⏰ This session reached its maximum lifetime of %s and is being stopped. Its work is pushed to branch `%s`.",
+				m.OwnerMention(ctx, session.ID, true), maxLifetime, session.BranchName))
+		case idleWarning > 0 && !warned && idle > idleTimeout-idleWarning:
+			logging.InfoCtx(logging.WithSessionID(ctx, session.SessionID), "Warning idle session that it will be closed", "branch", session.BranchName)
+			m.idleWarnings[session.ID] = now
+			m.postToThread(session, fmt.Sprintf("%s⏳ This session will be closed in %d minutes due to inactivity; send a message to keep it alive.",
+				m.OwnerMention(ctx, session.ID, true), int(math.Ceil(idleWarning.Minutes()))))
+			continue
+		case idle > idleTimeout && (idleWarning <= 0 || now.Sub(warnedAt) >= idleWarning):
+			logging.InfoCtx(logging.WithSessionID(ctx, session.SessionID), "Cleaning up idle session", "branch", session.BranchName)
+		default:
+			continue
+		}
+
+		delete(m.idleWarnings, session.ID)
+		toEnd = append(toEnd, session)
+	}
+
+	return m.endSessions(ctx, toEnd), nil
+}
+
+// endSessions ends sessions with up to IDLE_CLEANUP_WORKERS at once, so a backlog
+// doesn't wait on each push in turn, and returns how many ended
+func (m *Manager) endSessions(ctx context.Context, sessions []*models.Session) int {
+	workers := m.config.Session.IdleWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		ended int
+	)
+	slots := make(chan struct{}, workers)
+	for _, session := range sessions {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(session *models.Session) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := m.EndSession(ctx, session.SessionID, ""); err != nil {
+				logging.ErrorCtx(logging.WithSessionID(ctx, session.SessionID), "Failed to clean up idle session", "error", err)
+				return
 			}
+			mu.Lock()
+			ended++
+			mu.Unlock()
+		}(session)
+	}
+	wg.Wait()
+
+	return ended
+}
+
+// newStreamManager creates a stream manager configured with the registered MCP servers
+// that records the statuses Claude reports for them against the session
+func (m *Manager) newStreamManager(ctx context.Context, sessionID int64) (*ClaudeStreamManager, error) {
+	streamMgr := NewClaudeStreamManager()
+	streamMgr.SetCommandTimeout(time.Duration(m.config.Session.CommandTimeout) * time.Second)
+
+	servers, err := m.db.GetMCPServers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(servers) > 0 {
+		mcpConfig, err := buildMCPConfig(servers)
+		if err != nil {
+			return nil, err
 		}
+		streamMgr.SetMCPConfig(mcpConfig)
+	}
+
+	streamMgr.SetMCPStatusCallback(func(statuses []models.MCPServerStatus) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.mcpStatuses[sessionID] = statuses
+	})
+
+	streamMgr.SetTurnsCallback(func(turns int) {
+		if err := m.db.AddSessionTurns(ctx, sessionID, turns); err != nil {
+			logging.ErrorCtx(ctx, "Failed to record turns", "session", sessionID, "error", err)
+		}
+	})
+
+	return streamMgr, nil
+}
+
+// buildMCPConfig renders registered servers in the format expected by claude --mcp-config
+func buildMCPConfig(servers []*models.MCPServer) (string, error) {
+	mcpServers := make(map[string]json.RawMessage, len(servers))
+	for _, server := range servers {
+		mcpServers[server.Name] = json.RawMessage(server.Config)
 	}
+
+	data, err := json.Marshal(map[string]interface{}{"mcpServers": mcpServers})
+	if err != nil {
+		return "", fmt.Errorf("failed to build MCP config: %w", err)
+	}
+	return string(data), nil
+}
+
+// RegisterMCPServer registers or replaces an MCP server definition. The config must be a JSON object.
+func (m *Manager) RegisterMCPServer(ctx context.Context, userID int64, name, serverConfig string) (*models.MCPServer, error) {
+	if name == "" {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "MCP server name is required", nil)
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(serverConfig), &parsed); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "MCP server config must be a JSON object", err)
+	}
+
+	return m.db.RegisterMCPServer(ctx, name, serverConfig, userID)
+}
+
+// GetMCPServers returns all registered MCP servers
+func (m *Manager) GetMCPServers(ctx context.Context) ([]*models.MCPServer, error) {
+	return m.db.GetMCPServers(ctx)
+}
+
+// GetMCPServerStatuses returns the MCP server statuses Claude last reported for a session
+func (m *Manager) GetMCPServerStatuses(sessionID int64) []models.MCPServerStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.mcpStatuses[sessionID]
 }
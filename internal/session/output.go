@@ -0,0 +1,81 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// outputBuffer is how many lines a subscriber can fall behind before lines are dropped
+const outputBuffer = 256
+
+// OutputLine is one line of a session's output: a message from Claude or setup, or a
+// message sent to Claude prefixed with "> "
+type OutputLine struct {
+	Time time.Time
+	Text string
+}
+
+// OutputBroker fans a session's output out to subscribers, such as API stream clients.
+// A slow subscriber misses lines rather than holding up the session.
+type OutputBroker struct {
+	mu          sync.Mutex
+	subscribers map[int64]map[chan OutputLine]struct{}
+}
+
+// NewOutputBroker creates a broker with no subscribers
+func NewOutputBroker() *OutputBroker {
+	return &OutputBroker{subscribers: make(map[int64]map[chan OutputLine]struct{})}
+}
+
+// Subscribe returns a channel receiving the session with database ID sessionID's
+// output from now on, and a function ending the subscription. The channel is closed
+// when the subscription ends or the session ends.
+func (b *OutputBroker) Subscribe(sessionID int64) (<-chan OutputLine, func()) {
+	lines := make(chan OutputLine, outputBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[sessionID] == nil {
+		b.subscribers[sessionID] = make(map[chan OutputLine]struct{})
+	}
+	b.subscribers[sessionID][lines] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return lines, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subscribers[sessionID][lines]; ok {
+				delete(b.subscribers[sessionID], lines)
+				if len(b.subscribers[sessionID]) == 0 {
+					delete(b.subscribers, sessionID)
+				}
+				close(lines)
+			}
+		})
+	}
+}
+
+// Publish sends a line of a session's output to its subscribers
+func (b *OutputBroker) Publish(sessionID int64, text string) {
+	line := OutputLine{Time: time.Now(), Text: text}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for lines := range b.subscribers[sessionID] {
+		select {
+		case lines <- line:
+		default:
+		}
+	}
+}
+
+// Close ends every subscription to a session, as when it has ended
+func (b *OutputBroker) Close(sessionID int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for lines := range b.subscribers[sessionID] {
+		close(lines)
+	}
+	delete(b.subscribers, sessionID)
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package session
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op without Unix process groups
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills only the process pid, since there are no Unix process groups
+func killProcessGroup(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
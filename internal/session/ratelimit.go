@@ -0,0 +1,96 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is a per-user token bucket. Each user starts with a full bucket of
+// capacity tokens, and one token is refilled every window/capacity.
+type RateLimiter struct {
+	capacity int
+	refill   time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[int64]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing capacity events per window for each user.
+// A capacity of zero or less disables limiting.
+func NewRateLimiter(capacity int, window time.Duration) *RateLimiter {
+	rl := &RateLimiter{
+		capacity: capacity,
+		now:      time.Now,
+		buckets:  make(map[int64]*tokenBucket),
+	}
+	if capacity > 0 {
+		rl.refill = window / time.Duration(capacity)
+	}
+	return rl
+}
+
+// Enabled reports whether the limiter enforces a limit
+func (rl *RateLimiter) Enabled() bool {
+	return rl.capacity > 0
+}
+
+// Capacity returns the maximum number of tokens a user can hold
+func (rl *RateLimiter) Capacity() int {
+	return rl.capacity
+}
+
+// Allow consumes a token for the user, reporting whether one was available
+func (rl *RateLimiter) Allow(userID int64) bool {
+	if !rl.Enabled() {
+		return true
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	bucket := rl.bucket(userID)
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// Remaining returns the number of whole tokens the user currently has
+func (rl *RateLimiter) Remaining(userID int64) int {
+	if !rl.Enabled() {
+		return 0
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return int(rl.bucket(userID).tokens)
+}
+
+// bucket returns the user's bucket topped up for the time elapsed; callers must hold mu
+func (rl *RateLimiter) bucket(userID int64) *tokenBucket {
+	now := rl.now()
+
+	bucket, ok := rl.buckets[userID]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(rl.capacity), last: now}
+		rl.buckets[userID] = bucket
+		return bucket
+	}
+
+	if rl.refill > 0 {
+		bucket.tokens += float64(now.Sub(bucket.last)) / float64(rl.refill)
+		if bucket.tokens > float64(rl.capacity) {
+			bucket.tokens = float64(rl.capacity)
+		}
+	}
+	bucket.last = now
+	return bucket
+}
@@ -0,0 +1,101 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// SessionSource looks up the sessions shown by the read-only view
+type SessionSource interface {
+	GetSessionByID(ctx context.Context, id int64) (*models.Session, error)
+	GetSessionSummary(ctx context.Context, sessionID int64) (*models.SessionSummary, error)
+}
+
+// SessionView is the read-only view of a session. It leaves out anything internal,
+// such as Slack IDs, the work tree path and the Claude session ID.
+type SessionView struct {
+	Feature     string                 `json:"feature"`
+	RepoURL     string                 `json:"repo_url"`
+	Model       string                 `json:"model"`
+	Status      string                 `json:"status"`
+	RunningCost float64                `json:"running_cost"`
+	CreatedAt   time.Time              `json:"created_at"`
+	EndedAt     *time.Time             `json:"ended_at"`
+	Summary     *models.SessionSummary `json:"summary"` // nil until the session is stopped
+}
+
+// Handler serves the read-only view of the session a share token grants access to,
+// at GET /share/{token}
+type Handler struct {
+	signer   *Signer
+	sessions SessionSource
+}
+
+// NewHandler creates a handler verifying tokens with signer
+func NewHandler(signer *Signer, sessions SessionSource) *Handler {
+	return &Handler{signer: signer, sessions: sessions}
+}
+
+// Register adds the view's route to mux
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.Handle("GET /share/{token}", h)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sessionID, err := h.signer.Verify(r.PathValue("token"))
+	if err != nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": err.Error()})
+		return
+	}
+
+	session, err := h.sessions.GetSessionByID(r.Context(), sessionID)
+	if err != nil {
+		if isNotFound(err) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "session not found"})
+			return
+		}
+		logging.ErrorCtx(r.Context(), "Failed to get shared session", "session", sessionID, "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to get session"})
+		return
+	}
+
+	view := SessionView{
+		Feature:     session.BranchName,
+		RepoURL:     session.RepoURL,
+		Model:       session.ModelName,
+		Status:      session.Status,
+		RunningCost: session.RunningCost,
+		CreatedAt:   session.CreatedAt,
+		EndedAt:     session.EndedAt,
+	}
+
+	summary, err := h.sessions.GetSessionSummary(r.Context(), sessionID)
+	switch {
+	case err == nil:
+		view.Summary = summary
+	case !isNotFound(err):
+		logging.ErrorCtx(r.Context(), "Failed to get summary for shared session", "session", sessionID, "error", err)
+	}
+
+	writeJSON(w, http.StatusOK, view)
+}
+
+// isNotFound reports whether err is a session (or summary) not found error
+func isNotFound(err error) bool {
+	return errors.Is(err, models.ErrSessionNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logging.Error("Failed to write share response", "error", err)
+	}
+}
@@ -0,0 +1,149 @@
+package share
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestSignerVerify(t *testing.T) {
+	signer := NewSigner("test-encryption-key-that-is-32-bytes-long")
+
+	token, expiresAt := signer.Token(42, time.Hour)
+	if got := time.Until(expiresAt); got <= 59*time.Minute || got > time.Hour {
+		t.Errorf("Token() expires in %v, want about an hour", got)
+	}
+
+	sessionID, err := signer.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if sessionID != 42 {
+		t.Errorf("Verify() = %d, want 42", sessionID)
+	}
+
+	parts := strings.Split(token, ".")
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "other session", token: "43." + parts[1] + "." + parts[2]},
+		{name: "extended expiry", token: parts[0] + ".9999999999." + parts[2]},
+		{name: "other key", token: func() string {
+			other, _ := NewSigner("another-encryption-key-32-bytes-long").Token(42, time.Hour)
+			return other
+		}()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := signer.Verify(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestSignerVerifyExpired(t *testing.T) {
+	signer := NewSigner("test-encryption-key-that-is-32-bytes-long")
+	token, _ := signer.Token(42, time.Minute)
+
+	signer.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := signer.Verify(token); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify() error = %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestLinkURL(t *testing.T) {
+	if got := LinkURL("https://bot.example.com/", "abc"); got != "https://bot.example.com/share/abc" {
+		t.Errorf("LinkURL() = %q", got)
+	}
+}
+
+// fakeSessions serves a single session with database ID 1 and no summary
+type fakeSessions struct{}
+
+func (fakeSessions) GetSessionByID(_ context.Context, id int64) (*models.Session, error) {
+	if id != 1 {
+		return nil, models.NewCBError(models.ErrCodeSessionNotFound, "session not found", nil)
+	}
+	return &models.Session{
+		ID:           1,
+		SessionID:    "claude-secret",
+		BranchName:   "shared-feature",
+		RepoURL:      "https://github.com/test/repo",
+		WorkTreePath: "/srv/sessions/shared-feature",
+		ModelName:    models.ModelSonnet,
+		Status:       models.SessionStatusActive,
+		RunningCost:  1.25,
+	}, nil
+}
+
+func (fakeSessions) GetSessionSummary(context.Context, int64) (*models.SessionSummary, error) {
+	return nil, models.NewCBError(models.ErrCodeSessionNotFound, "session summary not found", nil)
+}
+
+func TestHandler(t *testing.T) {
+	signer := NewSigner("test-encryption-key-that-is-32-bytes-long")
+	mux := http.NewServeMux()
+	NewHandler(signer, fakeSessions{}).Register(mux)
+
+	valid, _ := signer.Token(1, time.Hour)
+	missing, _ := signer.Token(2, time.Hour)
+
+	expiredSigner := NewSigner("test-encryption-key-that-is-32-bytes-long")
+	expiredSigner.now = func() time.Time { return time.Now().Add(-2 * time.Hour) }
+	expired, _ := expiredSigner.Token(1, time.Hour)
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+		want       string
+	}{
+		{name: "valid token", token: valid, wantStatus: http.StatusOK, want: `"feature":"shared-feature"`},
+		{name: "expired token", token: expired, wantStatus: http.StatusForbidden, want: "expired"},
+		{name: "invalid token", token: valid + "x", wantStatus: http.StatusForbidden, want: "invalid share token"},
+		{name: "deleted session", token: missing, wantStatus: http.StatusNotFound, want: "session not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/share/"+tt.token, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			body := rec.Body.String()
+			if !strings.Contains(body, tt.want) {
+				t.Errorf("body = %q, want it to contain %q", body, tt.want)
+			}
+		})
+	}
+
+	t.Run("internal details are left out", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/share/"+valid, nil))
+
+		var view map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &view); err != nil {
+			t.Fatalf("Failed to decode view: %v", err)
+		}
+		for _, leaked := range []string{"claude-secret", "/srv/sessions"} {
+			if strings.Contains(rec.Body.String(), leaked) {
+				t.Errorf("view = %q, must not contain %q", rec.Body.String(), leaked)
+			}
+		}
+		if view["summary"] != nil {
+			t.Errorf("summary = %v, want null for an active session", view["summary"])
+		}
+	})
+}
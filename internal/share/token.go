@@ -0,0 +1,83 @@
+// Package share issues links to a read-only view of a session for people outside
+// Slack. A link's token names a single session and an expiry, signed so it can't be
+// altered or forged; nothing is stored server-side.
+package share
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for a token that is malformed or wasn't signed by us
+	ErrInvalidToken = errors.New("invalid share token")
+	// ErrExpiredToken is returned for a correctly signed token past its expiry
+	ErrExpiredToken = errors.New("share token has expired")
+)
+
+// Signer creates and verifies share tokens
+type Signer struct {
+	key []byte
+	now func() time.Time
+}
+
+// NewSigner creates a signer whose key is derived from secret, so the secret itself is
+// never used as a signing key
+func NewSigner(secret string) *Signer {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("claude-bot share links"))
+	return &Signer{key: mac.Sum(nil), now: time.Now}
+}
+
+// Token returns a token granting read-only access to the session with database ID
+// sessionID until ttl from now, and when it expires
+func (s *Signer) Token(sessionID int64, ttl time.Duration) (string, time.Time) {
+	expiresAt := s.now().Add(ttl).Truncate(time.Second)
+	payload := fmt.Sprintf("%d.%d", sessionID, expiresAt.Unix())
+	return payload + "." + s.sign(payload), expiresAt
+}
+
+// Verify checks a token's signature and expiry and returns the database ID of the
+// session it grants access to
+func (s *Signer) Verify(token string) (int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalidToken
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(payload))) {
+		return 0, ErrInvalidToken
+	}
+
+	sessionID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	expiry, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	if !s.now().Before(time.Unix(expiry, 0)) {
+		return 0, ErrExpiredToken
+	}
+
+	return sessionID, nil
+}
+
+func (s *Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// LinkURL returns the URL of the read-only view for token, served under baseURL
+func LinkURL(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + "/share/" + token
+}
@@ -3,7 +3,10 @@ package slack
 import (
 	"flag"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
@@ -16,6 +19,7 @@ type StartCommandArgs struct {
 	Model   string
 	Prompt  string
 	PName   string
+	Budget  float64 // cost in USD at which the session is stopped; 0 for none
 }
 
 // ContinueCommandArgs represents parsed continue command arguments
@@ -23,10 +27,106 @@ type ContinueCommandArgs struct {
 	Feature string
 }
 
+// StatusCommandArgs represents parsed status command arguments
+type StatusCommandArgs struct {
+	Feature string // empty to report the session in the current channel/thread
+}
+
+// CostCommandArgs represents parsed cost command arguments
+type CostCommandArgs struct {
+	Feature string // empty to report the session in the current channel/thread
+}
+
+// DefaultCostReportPeriod is how far back cost report looks without --since
+const DefaultCostReportPeriod = 30 * 24 * time.Hour
+
+// CostReportCommandArgs represents parsed cost report command arguments
+type CostReportCommandArgs struct {
+	Since     time.Duration // how far back to count sessions
+	Workspace bool          // report the whole workspace; admins only
+}
+
+// MembersCommandArgs represents parsed members command arguments
+type MembersCommandArgs struct {
+	Feature string // empty to list the members of the session in the current channel/thread
+}
+
+// StopCommandArgs represents parsed stop command arguments
+type StopCommandArgs struct {
+	Message string // commit message for the session's changes; empty for the default
+}
+
+// ListCommandArgs represents parsed list command arguments
+type ListCommandArgs struct {
+	All  bool // list every active session; admins only
+	Page int  // 1-based page of the user's own sessions
+}
+
+// HistoryCommandArgs represents parsed history command arguments
+type HistoryCommandArgs struct {
+	Limit int // number of most recent messages to show
+}
+
+// InterruptCommandArgs represents parsed interrupt command arguments
+type InterruptCommandArgs struct {
+	Feature string // empty to interrupt the session in the current channel/thread
+}
+
+// ShareLinkCommandArgs represents parsed share-link command arguments
+type ShareLinkCommandArgs struct {
+	Feature string // empty to share the session in the current channel/thread
+}
+
+// NotifyCommandArgs represents parsed notify command arguments
+type NotifyCommandArgs struct {
+	Preference string // one of the models.Notify constants, or empty to show the current one
+}
+
+// VerifyCommandArgs represents parsed verify command arguments
+type VerifyCommandArgs struct {
+	Mark bool // mark sessions with discrepancies as errored
+}
+
+// LeaveCommandArgs represents parsed leave command arguments
+type LeaveCommandArgs struct {
+	Feature string // empty to leave the session in the current channel/thread
+}
+
+// JoinCommandArgs represents parsed join command arguments
+type JoinCommandArgs struct {
+	Feature string
+	Role    string
+}
+
+// RestartCommandArgs represents parsed restart command arguments
+type RestartCommandArgs struct {
+	Feature string // empty to restart the session in the current channel/thread
+}
+
+// PRCommandArgs represents parsed pr command arguments
+type PRCommandArgs struct {
+	Feature string // empty to use the session in the current channel/thread
+	Title   string // empty to use the feature name
+	Base    string // empty to use the branch the session started from
+}
+
+// PromptCommandArgs represents parsed prompt command arguments
+type PromptCommandArgs struct {
+	Action      string // create, show or delete
+	Name        string
+	Description string
+	Content     string
+	Public      bool
+}
+
 // ParseStartCommandNew parses the new start command syntax using the flag package
 func ParseStartCommandNew(text string) (*StartCommandArgs, error) {
-	// Remove the bot mention and "start" command from the text
-	parts := strings.Fields(text)
+	// Remove the bot mention and "start" command from the text, keeping quoted values
+	// such as a multi-word --prompt together
+	parts, err := tokenizeArgs(text)
+	if err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse start command: %v", err), nil)
+	}
 	if len(parts) < 2 {
 		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "start command requires arguments", nil)
 	}
@@ -54,13 +154,14 @@ func ParseStartCommandNew(text string) (*StartCommandArgs, error) {
 	// Define flags
 	repo := fs.String("repo", "", "Git repository URL")
 	from := fs.String("from", "", "Git commitish to checkout from")
-	feat := fs.String("feat", "", "Feature name (becomes session identifier)")
-	model := fs.String("model", "", "Model name (sonnet or opus)")
+	feat := fs.String("feat", "", "Feature name (becomes session identifier, generated if omitted)")
+	model := fs.String("model", "", "Model name, e.g. sonnet, opus or haiku")
 	prompt := fs.String("prompt", "", "System prompt text")
 	pname := fs.String("pname", "", "System prompt name")
+	budget := fs.Float64("budget", 0, "Cost in USD at which the session is stopped")
 
 	// Parse the arguments
-	err := fs.Parse(args)
+	err = fs.Parse(args)
 	if err != nil {
 		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse start command: %v", err), err)
 	}
@@ -72,14 +173,16 @@ func ParseStartCommandNew(text string) (*StartCommandArgs, error) {
 	if *from == "" {
 		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--from is required", nil)
 	}
-	if *feat == "" {
-		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--feat is required", nil)
-	}
+	// --feat is optional; without it a name is generated when the session is created
 
 	// Validate model name
-	if *model != models.ModelOpus {
+	if *model == "" {
 		*model = models.ModelSonnet // Default to Sonnet if not specified
 	}
+	modelInfo, err := models.Models.Resolve(*model)
+	if err != nil {
+		return nil, err
+	}
 
 	// Validate that either prompt or pname is provided (but not both)
 	if *prompt != "" && *pname != "" {
@@ -87,13 +190,18 @@ func ParseStartCommandNew(text string) (*StartCommandArgs, error) {
 			"cannot specify both --prompt and --pname", nil)
 	}
 
+	if *budget < 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--budget cannot be negative", nil)
+	}
+
 	return &StartCommandArgs{
 		RepoURL: *repo,
 		From:    *from,
 		Feature: *feat,
-		Model:   *model,
+		Model:   modelInfo.Name,
 		Prompt:  *prompt,
 		PName:   *pname,
+		Budget:  *budget,
 	}, nil
 }
 
@@ -172,3 +280,505 @@ func ParseContinueCommand(text string) (*ContinueCommandArgs, error) {
 	}, nil
 }
 
+// ParseStatusCommand parses the status command arguments (after "status")
+func ParseStatusCommand(args []string) (*StatusCommandArgs, error) {
+	feature, err := parseOptionalFeature("status", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatusCommandArgs{
+		Feature: feature,
+	}, nil
+}
+
+// ParseCostCommand parses the cost command arguments (after "cost")
+func ParseCostCommand(args []string) (*CostCommandArgs, error) {
+	feature, err := parseOptionalFeature("cost", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CostCommandArgs{
+		Feature: feature,
+	}, nil
+}
+
+// ParseCostReportCommand parses the cost report command arguments (after "cost report")
+// Format: cost report [--since <period>] [--workspace]
+func ParseCostReportCommand(args []string) (*CostReportCommandArgs, error) {
+	fs := flag.NewFlagSet("cost report", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	since := fs.String("since", formatPeriod(DefaultCostReportPeriod), "How far back to count sessions, such as 7d or 24h")
+	workspace := fs.Bool("workspace", false, "Report the whole workspace")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse cost report command: %v", err), err)
+	}
+	if fs.NArg() > 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "usage: cost report [--since <period>] [--workspace]", nil)
+	}
+
+	period, err := ParsePeriod(*since)
+	if err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("invalid --since: %v", err), nil)
+	}
+
+	return &CostReportCommandArgs{
+		Since:     period,
+		Workspace: *workspace,
+	}, nil
+}
+
+// ParsePeriod parses a positive length of time such as 30d, 24h or 90m. Days are
+// whole days; anything else is as time.ParseDuration takes it.
+func ParsePeriod(s string) (time.Duration, error) {
+	var period time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number of days", s)
+		}
+		period = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if period, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("%q is not a period like 7d or 24h", s)
+		}
+	}
+	if period <= 0 {
+		return 0, fmt.Errorf("%q must be positive", s)
+	}
+	return period, nil
+}
+
+// ParseMembersCommand parses the members command arguments (after "members")
+func ParseMembersCommand(args []string) (*MembersCommandArgs, error) {
+	feature, err := parseOptionalFeature("members", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MembersCommandArgs{
+		Feature: feature,
+	}, nil
+}
+
+// ParseStopCommand parses the stop command arguments (after "stop")
+// Format: stop [--message "<commit message>"]
+func ParseStopCommand(args []string) (*StopCommandArgs, error) {
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	message := fs.String("message", "", "Commit message for the session's changes")
+
+	if err := fs.Parse(joinQuotedArgs(args)); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse stop command: %v", err), err)
+	}
+	if fs.NArg() > 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, `usage: stop [--message "<commit message>"]`, nil)
+	}
+
+	return &StopCommandArgs{
+		Message: strings.TrimSpace(*message),
+	}, nil
+}
+
+// ParseListCommand parses the list command arguments (after "list")
+// Format: list [--page N] | list --all
+func ParseListCommand(args []string) (*ListCommandArgs, error) {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	all := fs.Bool("all", false, "List every active session")
+	page := fs.Int("page", 1, "Page of sessions to show")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse list command: %v", err), err)
+	}
+	if fs.NArg() > 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "usage: list [--page N] | list --all", nil)
+	}
+	if *page < 1 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "page must be a positive integer", nil)
+	}
+	if *all && *page != 1 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--page can't be used with --all", nil)
+	}
+
+	return &ListCommandArgs{
+		All:  *all,
+		Page: *page,
+	}, nil
+}
+
+// ParseHistoryCommand parses the history command arguments (after "history")
+// Format: history [--limit N]
+func ParseHistoryCommand(args []string) (*HistoryCommandArgs, error) {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	limit := fs.Int("limit", DefaultHistoryMessages, "Number of most recent messages to show")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse history command: %v", err), err)
+	}
+	if fs.NArg() > 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "usage: history [--limit N]", nil)
+	}
+	if *limit <= 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "limit must be a positive integer", nil)
+	}
+
+	return &HistoryCommandArgs{
+		Limit: min(*limit, MaxHistoryMessages),
+	}, nil
+}
+
+// ParseInterruptCommand parses the interrupt command arguments (after "interrupt")
+func ParseInterruptCommand(args []string) (*InterruptCommandArgs, error) {
+	feature, err := parseOptionalFeature("interrupt", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InterruptCommandArgs{
+		Feature: feature,
+	}, nil
+}
+
+// ParseShareLinkCommand parses the share-link command arguments (after "share-link")
+func ParseShareLinkCommand(args []string) (*ShareLinkCommandArgs, error) {
+	feature, err := parseOptionalFeature("share-link", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ShareLinkCommandArgs{
+		Feature: feature,
+	}, nil
+}
+
+// ParseNotifyCommand parses the notify command arguments (after "notify")
+// Format: notify [on|off|mentions]
+func ParseNotifyCommand(args []string) (*NotifyCommandArgs, error) {
+	usage := models.NewCBError(models.ErrCodeInvalidCommand, "usage: notify [on|off|mentions]", nil)
+	if len(args) > 1 {
+		return nil, usage
+	}
+	if len(args) == 0 {
+		return &NotifyCommandArgs{}, nil
+	}
+
+	preference := strings.ToLower(args[0])
+	switch preference {
+	case models.NotifyOn, models.NotifyOff, models.NotifyMentions:
+	default:
+		return nil, usage
+	}
+
+	return &NotifyCommandArgs{
+		Preference: preference,
+	}, nil
+}
+
+// ParseVerifyCommand parses the verify command arguments (after "verify")
+// Format: verify [--mark]
+func ParseVerifyCommand(args []string) (*VerifyCommandArgs, error) {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	mark := fs.Bool("mark", false, "Mark sessions with discrepancies as errored")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse verify command: %v", err), err)
+	}
+	if fs.NArg() > 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "usage: verify [--mark]", nil)
+	}
+
+	return &VerifyCommandArgs{
+		Mark: *mark,
+	}, nil
+}
+
+// ParseRestartCommand parses the restart command arguments (after "restart")
+func ParseRestartCommand(args []string) (*RestartCommandArgs, error) {
+	feature, err := parseOptionalFeature("restart", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RestartCommandArgs{
+		Feature: feature,
+	}, nil
+}
+
+// ParseJoinCommand parses the join command arguments (after "join") using the flag package
+func ParseJoinCommand(args []string) (*JoinCommandArgs, error) {
+	fs := flag.NewFlagSet("join", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	feat := fs.String("feat", "", "Feature name (session identifier)")
+	role := fs.String("role", models.SessionRoleCollaborator, "Role in the session (collaborator or viewer)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse join command: %v", err), err)
+	}
+	if fs.NArg() > 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "usage: join --feat <name> [--role collaborator|viewer]", nil)
+	}
+
+	if *feat == "" {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--feat is required", nil)
+	}
+	if err := ValidateFeatureName(*feat); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("invalid feature name: %v", err), nil)
+	}
+
+	if *role != models.SessionRoleCollaborator && *role != models.SessionRoleViewer {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--role must be collaborator or viewer", nil)
+	}
+
+	return &JoinCommandArgs{
+		Feature: *feat,
+		Role:    *role,
+	}, nil
+}
+
+// ParseLeaveCommand parses the leave command arguments (after "leave")
+func ParseLeaveCommand(args []string) (*LeaveCommandArgs, error) {
+	feature, err := parseOptionalFeature("leave", args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LeaveCommandArgs{
+		Feature: feature,
+	}, nil
+}
+
+// ParsePRCommand parses the pr command arguments (after "pr") using the flag package.
+// The title may span several words when quoted.
+func ParsePRCommand(args []string) (*PRCommandArgs, error) {
+	fs := flag.NewFlagSet("pr", flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	feat := fs.String("feat", "", "Feature name (session identifier)")
+	title := fs.String("title", "", "Pull request title")
+	base := fs.String("base", "", "Branch to merge into")
+
+	if err := fs.Parse(joinQuotedArgs(args)); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse pr command: %v", err), err)
+	}
+	if fs.NArg() > 0 {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand,
+			`usage: pr [--title "<title>"] [--base <branch>] [--feat <name>]`, nil)
+	}
+
+	if *feat != "" {
+		if err := ValidateFeatureName(*feat); err != nil {
+			return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("invalid feature name: %v", err), nil)
+		}
+	}
+	if *base != "" && !isValidBranchName(*base) {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "invalid base branch name", nil)
+	}
+
+	return &PRCommandArgs{
+		Feature: *feat,
+		Title:   strings.TrimSpace(*title),
+		Base:    *base,
+	}, nil
+}
+
+// ParsePromptCommand parses the prompt command arguments (after "prompt") using the flag
+// package. For create, the arguments after the flags are the prompt content.
+func ParsePromptCommand(args []string) (*PromptCommandArgs, error) {
+	usage := models.NewCBError(models.ErrCodeInvalidCommand,
+		`usage: prompt create --name <name> [--desc "<description>"] [--public] <content...> | prompt show --name <name> | prompt delete --name <name>`, nil)
+	if len(args) == 0 {
+		return nil, usage
+	}
+
+	action := strings.ToLower(args[0])
+	if action != "create" && action != "show" && action != "delete" {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "prompt action must be 'create', 'show' or 'delete'", nil)
+	}
+
+	fs := flag.NewFlagSet("prompt "+action, flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	name := fs.String("name", "", "System prompt name")
+	var desc *string
+	var public *bool
+	if action == "create" {
+		desc = fs.String("desc", "", "System prompt description")
+		public = fs.Bool("public", false, "Make the prompt available to everyone")
+	}
+
+	flagArgs, starts := splitQuotedArgs(args[1:])
+	if err := fs.Parse(flagArgs); err != nil {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse prompt %s command: %v", action, err), err)
+	}
+
+	if *name == "" {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--name is required", nil)
+	}
+	if strings.ContainsAny(*name, " \t\r\n") {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "--name cannot contain whitespace", nil)
+	}
+
+	cmdArgs := &PromptCommandArgs{
+		Action: action,
+		Name:   *name,
+	}
+	if action != "create" {
+		if fs.NArg() > 0 {
+			return nil, usage
+		}
+		return cmdArgs, nil
+	}
+
+	cmdArgs.Description = strings.TrimSpace(*desc)
+	cmdArgs.Public = *public
+	// Take the content from the original arguments so quotes in it are kept
+	if fs.NArg() > 0 {
+		contentStart := starts[len(flagArgs)-fs.NArg()]
+		cmdArgs.Content = strings.TrimSpace(strings.Join(args[1+contentStart:], " "))
+	}
+	if cmdArgs.Content == "" {
+		return nil, models.NewCBError(models.ErrCodeInvalidCommand, "prompt content is required after the flags", nil)
+	}
+
+	return cmdArgs, nil
+}
+
+// tokenizeArgs splits text into arguments on whitespace as a shell would. Single quotes
+// keep everything up to the closing quote literally; double quotes, including the curly
+// quotes Slack substitutes, keep whitespace but let a backslash escape a double quote or
+// backslash. Outside quotes a backslash escapes the next character.
+func tokenizeArgs(text string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false // distinguishes an empty quoted argument from no argument
+	var quote rune // the quote being read, or 0 outside quotes
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote != 0:
+			switch {
+			case isDoubleQuote(r):
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && (isDoubleQuote(runes[i+1]) || runes[i+1] == '\\'):
+				i++
+				current.WriteRune(runes[i])
+			default:
+				current.WriteRune(r)
+			}
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		case r == '\'':
+			quote, inArg = r, true
+		case isDoubleQuote(r):
+			quote, inArg = '"', true
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// isDoubleQuote reports whether r is a straight double quote or a curly one
+func isDoubleQuote(r rune) bool {
+	return r == '"' || r == '“' || r == '”'
+}
+
+// joinQuotedArgs rejoins arguments that were split inside double quotes, including the
+// curly quotes Slack substitutes, and strips the quotes
+func joinQuotedArgs(args []string) []string {
+	joined, _ := splitQuotedArgs(args)
+	return joined
+}
+
+// splitQuotedArgs is joinQuotedArgs that also returns the index in args at which each
+// joined argument starts
+func splitQuotedArgs(args []string) ([]string, []int) {
+	const quotes = `"“”`
+
+	var joined, quoted []string
+	var starts []int
+	inQuote := false
+	for i, arg := range args {
+		if !inQuote {
+			starts = append(starts, i)
+			if strings.IndexAny(arg, quotes) != 0 {
+				joined = append(joined, arg)
+				continue
+			}
+			arg = strings.TrimLeft(arg, quotes)
+			inQuote = true
+		}
+
+		if trimmed := strings.TrimRight(arg, quotes); trimmed != arg {
+			joined = append(joined, strings.Join(append(quoted, trimmed), " "))
+			quoted, inQuote = nil, false
+			continue
+		}
+		quoted = append(quoted, arg)
+	}
+	if inQuote {
+		// Unterminated quote: keep what was collected
+		joined = append(joined, strings.Join(quoted, " "))
+	}
+	return joined, starts
+}
+
+// parseOptionalFeature parses the arguments of commands that act on the session in the
+// current channel/thread unless one is named with --feat
+func parseOptionalFeature(command string, args []string) (string, error) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.SetOutput(&strings.Builder{}) // Suppress default error output
+
+	feat := fs.String("feat", "", "Feature name (session identifier)")
+
+	if err := fs.Parse(args); err != nil {
+		return "", models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("failed to parse %s command: %v", command, err), err)
+	}
+	if fs.NArg() > 0 {
+		return "", models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("usage: %s [--feat <name>]", command), nil)
+	}
+
+	if *feat != "" {
+		if err := ValidateFeatureName(*feat); err != nil {
+			return "", models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("invalid feature name: %v", err), nil)
+		}
+	}
+
+	return *feat, nil
+}
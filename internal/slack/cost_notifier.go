@@ -0,0 +1,119 @@
+package slack
+
+import (
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+)
+
+// CostUpdateInterval is the minimum time between edits of a running cost message
+const CostUpdateInterval = 30 * time.Second
+
+// costMessenger is the part of the Slack client a CostNotifier needs
+type costMessenger interface {
+	messageEditor
+	AddPin(channel string, item slack.ItemRef) error
+}
+
+// CostNotifier keeps a session's running cost in a single pinned message in its thread.
+// The first cost is posted immediately; later ones edit the message at most once per
+// interval, the latest cost being sent when the interval has passed.
+type CostNotifier struct {
+	client    costMessenger
+	channelID string
+	threadTS  string
+	interval  time.Duration
+
+	// now and afterFunc are the clock, replaced in tests
+	now       func() time.Time
+	afterFunc func(time.Duration, func())
+
+	// sendMu serializes Slack calls so edits are applied in order
+	sendMu sync.Mutex
+
+	mu        sync.Mutex
+	messageTS string    // timestamp of the cost message, empty until it's posted
+	cost      float64   // latest running cost
+	sentCost  float64   // running cost as last sent to Slack
+	lastSend  time.Time // when the last send started
+	scheduled bool      // a send of the latest cost is waiting for the interval
+}
+
+// NewCostNotifier creates a notifier posting to threadTS in channelID
+func NewCostNotifier(client costMessenger, channelID, threadTS string) *CostNotifier {
+	return &CostNotifier{
+		client:    client,
+		channelID: channelID,
+		threadTS:  threadTS,
+		interval:  CostUpdateInterval,
+		now:       time.Now,
+		afterFunc: func(d time.Duration, f func()) { time.AfterFunc(d, f) },
+	}
+}
+
+// Update records the session's running cost, sending it now or once the interval since
+// the last send has passed. It's safe to call from the Claude cost callback.
+func (n *CostNotifier) Update(cost float64) {
+	n.mu.Lock()
+	n.cost = cost
+	if n.scheduled {
+		// The pending send will pick up this cost
+		n.mu.Unlock()
+		return
+	}
+	wait := n.interval - n.now().Sub(n.lastSend)
+	if n.messageTS == "" || wait <= 0 {
+		n.mu.Unlock()
+		n.flush()
+		return
+	}
+	n.scheduled = true
+	n.mu.Unlock()
+	n.afterFunc(wait, n.flush)
+}
+
+// flush sends the latest cost if it changed since it was sent
+func (n *CostNotifier) flush() {
+	n.sendMu.Lock()
+	defer n.sendMu.Unlock()
+
+	n.mu.Lock()
+	n.scheduled = false
+	cost, messageTS := n.cost, n.messageTS
+	if messageTS != "" && cost == n.sentCost {
+		n.mu.Unlock()
+		return
+	}
+	n.lastSend = n.now()
+	n.mu.Unlock()
+
+	text := FormatRunningCost(cost)
+	if messageTS != "" {
+		if _, _, _, err := n.client.UpdateMessage(n.channelID, messageTS, slack.MsgOptionText(text, false)); err != nil {
+			logging.Error("Failed to update cost message", "channel_id", n.channelID, "error", err)
+			return
+		}
+	} else {
+		_, ts, err := n.client.PostMessage(n.channelID,
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionAsUser(true),
+			slack.MsgOptionTS(n.threadTS))
+		if err != nil {
+			logging.Error("Failed to post cost message", "channel_id", n.channelID, "error", err)
+			return
+		}
+		messageTS = ts
+		// Pinning needs the pins:write scope; the message is still updated without it
+		if err := n.client.AddPin(n.channelID, slack.NewRefToMessage(n.channelID, ts)); err != nil {
+			logging.Warn("Failed to pin cost message", "channel_id", n.channelID, "error", err)
+		}
+	}
+
+	n.mu.Lock()
+	n.messageTS = messageTS
+	n.sentCost = cost
+	n.mu.Unlock()
+}
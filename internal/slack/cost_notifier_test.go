@@ -0,0 +1,77 @@
+package slack
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// fakePinner is a fakeEditor that also records pinned messages
+type fakePinner struct {
+	*fakeEditor
+
+	mu     sync.Mutex
+	pinned []string
+}
+
+func (f *fakePinner) AddPin(channel string, item slack.ItemRef) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pinned = append(f.pinned, item.Timestamp)
+	return nil
+}
+
+func TestCostNotifierThrottlesUpdates(t *testing.T) {
+	fake := &fakePinner{fakeEditor: newFakeEditor(t)}
+	notifier := NewCostNotifier(fake, "C123456", "1234567890.123456")
+
+	now := time.Unix(1700000000, 0)
+	var scheduled []time.Duration
+	var pending func()
+	notifier.now = func() time.Time { return now }
+	notifier.afterFunc = func(d time.Duration, f func()) {
+		scheduled = append(scheduled, d)
+		pending = f
+	}
+
+	// The first cost is posted and pinned right away
+	notifier.Update(0.10)
+	if fake.posts != 1 || fake.updates != 0 {
+		t.Fatalf("posts = %d, updates = %d, want the first cost posted", fake.posts, fake.updates)
+	}
+	ts := fake.order[0]
+	if len(fake.pinned) != 1 || fake.pinned[0] != ts {
+		t.Errorf("pinned = %v, want the cost message %s", fake.pinned, ts)
+	}
+
+	// Costs within the window wait for it to pass, and only the latest is sent
+	now = now.Add(10 * time.Second)
+	notifier.Update(0.20)
+	now = now.Add(5 * time.Second)
+	notifier.Update(0.30)
+	if fake.updates != 0 {
+		t.Fatalf("updates = %d within the window, want none", fake.updates)
+	}
+	if len(scheduled) != 1 || scheduled[0] != 20*time.Second {
+		t.Fatalf("scheduled = %v, want one send after the remaining 20s", scheduled)
+	}
+
+	now = now.Add(15 * time.Second)
+	pending()
+	if fake.updates != 1 || fake.messages[ts] != FormatRunningCost(0.30) {
+		t.Errorf("after the window: updates = %d, message = %q, want one edit to %q", fake.updates, fake.messages[ts], FormatRunningCost(0.30))
+	}
+
+	// Once a window has passed without a send, the next cost goes out right away
+	now = now.Add(CostUpdateInterval)
+	notifier.Update(0.45)
+	if fake.posts != 1 || fake.updates != 2 || fake.messages[ts] != FormatRunningCost(0.45) {
+		t.Errorf("posts = %d, updates = %d, message = %q, want the one message edited to %q",
+			fake.posts, fake.updates, fake.messages[ts], FormatRunningCost(0.45))
+	}
+	if len(scheduled) != 1 {
+		t.Errorf("scheduled = %v, want no more delayed sends", scheduled)
+	}
+}
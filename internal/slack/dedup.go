@@ -0,0 +1,78 @@
+package slack
+
+import (
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+// Slack retries an event up to three times, the last about five minutes after the
+// first delivery, so IDs are remembered for a little longer than that
+const (
+	DefaultEventDedupTTL  = 10 * time.Minute
+	defaultEventDedupSize = 10000
+)
+
+// eventCache remembers the IDs of recently handled events so redeliveries are skipped.
+// IDs are forgotten after ttl, and once size IDs are held the oldest are dropped.
+type eventCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+	ttl  time.Duration
+	size int
+	now  func() time.Time
+}
+
+func newEventCache(ttl time.Duration, size int) *eventCache {
+	return &eventCache{
+		seen: make(map[string]time.Time),
+		ttl:  ttl,
+		size: size,
+		now:  time.Now,
+	}
+}
+
+// Seen records the event ID and reports whether it was already recorded
+func (c *eventCache) Seen(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if at, ok := c.seen[id]; ok && now.Sub(at) < c.ttl {
+		return true
+	}
+
+	if len(c.seen) >= c.size {
+		c.evict(now)
+	}
+	c.seen[id] = now
+	return false
+}
+
+// evict drops the expired IDs, or the oldest one if none have expired
+func (c *eventCache) evict(now time.Time) {
+	var oldestID string
+	var oldest time.Time
+	for id, at := range c.seen {
+		if now.Sub(at) >= c.ttl {
+			delete(c.seen, id)
+			continue
+		}
+		if oldestID == "" || at.Before(oldest) {
+			oldestID, oldest = id, at
+		}
+	}
+	if len(c.seen) >= c.size {
+		delete(c.seen, oldestID)
+	}
+}
+
+// EventID returns the ID Slack assigned to a callback event, the same across its
+// redeliveries, or "" if the envelope has none
+func EventID(event slackevents.EventsAPIEvent) string {
+	if callback, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok {
+		return callback.EventID
+	}
+	return ""
+}
@@ -0,0 +1,90 @@
+package slack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+func TestEventCache(t *testing.T) {
+	now := time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC)
+	cache := newEventCache(5*time.Minute, 3)
+	cache.now = func() time.Time { return now }
+
+	if cache.Seen("Ev1") {
+		t.Fatal("Seen() = true for a new event")
+	}
+	if !cache.Seen("Ev1") {
+		t.Fatal("Seen() = false for a repeated event")
+	}
+
+	// IDs are forgotten once they expire
+	now = now.Add(6 * time.Minute)
+	if cache.Seen("Ev1") {
+		t.Error("Seen() = true for an expired event")
+	}
+
+	// A full cache drops its oldest ID
+	now = now.Add(time.Second)
+	cache.Seen("Ev2")
+	now = now.Add(time.Second)
+	cache.Seen("Ev3")
+	cache.Seen("Ev4")
+	if len(cache.seen) != 3 {
+		t.Errorf("cache holds %d IDs, want 3", len(cache.seen))
+	}
+	if !cache.Seen("Ev3") || !cache.Seen("Ev4") {
+		t.Error("the newest IDs were dropped")
+	}
+	if cache.Seen("Ev1") {
+		t.Error("the oldest ID was kept")
+	}
+}
+
+// callbackEvent wraps an inner event in an Events API envelope with an event ID
+func callbackEvent(eventID string, inner interface{}) slackevents.EventsAPIEvent {
+	return slackevents.EventsAPIEvent{
+		Type:       slackevents.CallbackEvent,
+		TeamID:     "T123456",
+		Data:       &slackevents.EventsAPICallbackEvent{EventID: eventID},
+		InnerEvent: slackevents.EventsAPIInnerEvent{Data: inner},
+	}
+}
+
+func TestHandleEventsAPIEventSkipsRedeliveries(t *testing.T) {
+	h, _, fake := newTestHandler(t)
+	createTestUser(t, h, "UALICE")
+	ctx := context.Background()
+
+	mention := &slackevents.AppMentionEvent{
+		User:      "UALICE",
+		Channel:   "C123456",
+		Text:      "<@UBOT123> help",
+		TimeStamp: "1700000000.000100",
+	}
+	posted := func() int {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.messages)
+	}
+
+	// Slack's first delivery and two retries
+	for i := 0; i < 3; i++ {
+		if err := h.HandleEventsAPIEvent(ctx, callbackEvent("Ev123", mention), false); err != nil {
+			t.Fatalf("HandleEventsAPIEvent() error = %v", err)
+		}
+	}
+	if got := posted(); got != 1 {
+		t.Errorf("posted %d replies across three deliveries, want 1", got)
+	}
+
+	// Another event is handled
+	if err := h.HandleEventsAPIEvent(ctx, callbackEvent("Ev456", mention), false); err != nil {
+		t.Fatalf("HandleEventsAPIEvent() error = %v", err)
+	}
+	if got := posted(); got != 2 {
+		t.Errorf("posted %d replies, want 2 after a new event", got)
+	}
+}
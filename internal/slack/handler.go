@@ -2,14 +2,22 @@ package slack
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/internal/metrics"
+	"github.com/pbdeuchler/claude-bot/internal/oauth"
+	"github.com/pbdeuchler/claude-bot/internal/prompts"
 	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/internal/share"
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
@@ -20,6 +28,45 @@ type EventHandler struct {
 	parser        *CommandParser
 	botUserID     string
 	signingSecret string
+
+	// adminUserIDs are the Slack user IDs allowed to run admin commands
+	adminUserIDs map[string]bool
+
+	// runAsync runs background work such as session setup
+	runAsync func(func())
+
+	// events remembers handled event IDs so Slack's redeliveries are skipped
+	events *eventCache
+
+	// movedTeams holds the team IDs whose records have been moved to their enterprise
+	// ID since the server started. movedTeamsMu is held during a move, so the team's
+	// other events wait for it rather than creating records under the new key first.
+	movedTeamsMu sync.Mutex
+	movedTeams   map[string]bool
+
+	// streamInterval is the minimum time between edits of streamed Claude output
+	streamInterval time.Duration
+
+	// maxMessagesPerTurn caps the messages one Claude turn posts; 0 for no cap
+	maxMessagesPerTurn int
+
+	// costNotifiers keep sessions' running cost messages, by session database ID; nil
+	// when cost notifications are off
+	costNotifiersMu sync.Mutex
+	costNotifiers   map[int64]*CostNotifier
+
+	// shareSigner signs read-only share links; nil when the read-only API is disabled
+	shareSigner    *share.Signer
+	sharePublicURL string
+	shareTTL       time.Duration
+
+	// githubConnect signs the links that connect a GitHub account; nil when GitHub
+	// OAuth isn't configured
+	githubConnect   *oauth.StateSigner
+	githubPublicURL string
+
+	// metrics records events, commands and errors; nil records nothing
+	metrics *metrics.Metrics
 }
 
 // NewEventHandler creates a new Slack event handler
@@ -30,112 +77,388 @@ func NewEventHandler(client *slack.Client, sessionMgr *session.Manager, botUserI
 		parser:        NewCommandParser(botUserID),
 		botUserID:     botUserID,
 		signingSecret: signingSecret,
+		runAsync:      func(f func()) { go f() },
+		events:        newEventCache(DefaultEventDedupTTL, defaultEventDedupSize),
+		movedTeams:    make(map[string]bool),
+
+		streamInterval: DefaultStreamUpdateInterval,
+	}
+}
+
+// SetShareLinks enables the share-link command, issuing links under publicURL that
+// are valid for ttl
+func (h *EventHandler) SetShareLinks(signer *share.Signer, publicURL string, ttl time.Duration) {
+	h.shareSigner = signer
+	h.sharePublicURL = publicURL
+	h.shareTTL = ttl
+}
+
+// SetGitHubConnect enables credentials connect github, issuing links under publicURL
+// that start the GitHub OAuth flow
+func (h *EventHandler) SetGitHubConnect(signer *oauth.StateSigner, publicURL string) {
+	h.githubConnect = signer
+	h.githubPublicURL = publicURL
+}
+
+// SetMetrics sets where event, command and error metrics are recorded
+func (h *EventHandler) SetMetrics(metrics *metrics.Metrics) {
+	h.metrics = metrics
+}
+
+// SetMaxMessagesPerTurn caps the messages one Claude turn posts to a thread. Output past
+// the cap is replaced by a truncation notice and the full output uploaded as a snippet.
+// Zero or less means no cap.
+func (h *EventHandler) SetMaxMessagesPerTurn(max int) {
+	h.maxMessagesPerTurn = max
+}
+
+// SetCostNotifications turns on keeping each session's running cost in a pinned message
+// in its thread, updated at most every CostUpdateInterval. Pinning needs the pins:write
+// scope.
+func (h *EventHandler) SetCostNotifications(enabled bool) {
+	h.costNotifiersMu.Lock()
+	defer h.costNotifiersMu.Unlock()
+	if !enabled {
+		h.costNotifiers = nil
+	} else if h.costNotifiers == nil {
+		h.costNotifiers = make(map[int64]*CostNotifier)
 	}
 }
 
-// HandleAppMention handles app mention events
-func (h *EventHandler) HandleAppMention(ctx context.Context, event *slackevents.AppMentionEvent) error {
+// costNotifier returns the running cost notifier of a session, or nil when cost
+// notifications are off. The notifier lives as long as the handler so that every turn
+// updates the same message.
+func (h *EventHandler) costNotifier(session *models.Session) *CostNotifier {
+	h.costNotifiersMu.Lock()
+	defer h.costNotifiersMu.Unlock()
+	if h.costNotifiers == nil {
+		return nil
+	}
+	notifier, ok := h.costNotifiers[session.ID]
+	if !ok {
+		notifier = NewCostNotifier(h.client, session.SlackChannelID, session.SlackThreadTS)
+		h.costNotifiers[session.ID] = notifier
+	}
+	return notifier
+}
+
+// SetAdminUserIDs sets the Slack user IDs allowed to run admin commands
+func (h *EventHandler) SetAdminUserIDs(userIDs []string) {
+	h.adminUserIDs = make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if userID = strings.TrimSpace(userID); userID != "" {
+			h.adminUserIDs[userID] = true
+		}
+	}
+}
+
+// isAdmin reports whether the Slack user may run admin commands
+func (h *EventHandler) isAdmin(slackUserID string) bool {
+	return h.adminUserIDs[slackUserID]
+}
+
+// HandleAppMention handles app mention events. The workspaceID is the key resolved
+// from the event envelope (see ResolveWorkspaceID).
+func (h *EventHandler) HandleAppMention(ctx context.Context, event *slackevents.AppMentionEvent, workspaceID string) error {
 	// Ignore messages from the bot itself
 	if h.parser.IsBotMessage(event.User) {
 		return nil
 	}
 
-	log.Printf("Received app mention from user %s in channel %s: %s", event.User, event.Channel, event.Text)
-
-	// For now, use a placeholder workspace ID - in production this would come from the event context
-	workspaceID := "default-workspace"
+	// The text isn't logged since it may hold credentials
+	ctx = logging.WithChannelID(ctx, event.Channel)
+	logging.InfoCtx(ctx, "Received app mention", "slack_user", event.User, "workspace", workspaceID)
 
 	// Get or create user
 	user, err := h.getOrCreateUser(ctx, workspaceID, event.User)
 	if err != nil {
-		return h.sendErrorMessage(event.Channel, event.ThreadTimeStamp, "Failed to process user information", err)
+		return h.sendErrorMessage(ctx, event.Channel, event.ThreadTimeStamp, "Failed to process user information", err)
 	}
+	ctx = logging.WithUserID(ctx, user.ID)
 
 	// Parse command
 	command, args, err := h.parser.ParseCommand(event.Text)
 	if err != nil {
-		return h.sendErrorMessage(event.Channel, event.ThreadTimeStamp, "", err)
+		return h.sendErrorMessage(ctx, event.Channel, event.ThreadTimeStamp, "", err)
 	}
 
 	// Handle command
-	return h.handleCommand(ctx, user, event.Channel, event.ThreadTimeStamp, command, args)
+	return h.handleCommand(ctx, user, event.Channel, event.ThreadTimeStamp, event.TimeStamp, command, args)
 }
 
 // HandleMessage handles regular message events (for active sessions)
-func (h *EventHandler) HandleMessage(ctx context.Context, event *slackevents.MessageEvent) error {
+func (h *EventHandler) HandleMessage(ctx context.Context, event *slackevents.MessageEvent, workspaceID string) error {
 	// Ignore bot messages, edits, and deletes
 	if h.parser.IsBotMessage(event.User) || event.SubType != "" {
 		return nil
 	}
 
-	// For now, use a placeholder workspace ID - in production this would come from the event context
-	workspaceID := "default-workspace"
+	ctx = logging.WithChannelID(ctx, event.Channel)
 
 	// Check if there's an active session in this channel/thread
 	session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, workspaceID, event.Channel, event.ThreadTimeStamp)
-	if err != nil || session == nil {
+	if errors.Is(err, models.ErrNoActiveSession) {
 		// No active session, ignore message
 		return nil
 	}
+	if err != nil {
+		return fmt.Errorf("failed to find session: %w", err)
+	}
 
-	// Forward message to Claude session with streaming callbacks
+	// Only owners and collaborators instruct Claude; viewers can follow a session, and
+	// anyone else in the channel isn't a member of it at all
+	role := ""
+	if user, err := h.sessionMgr.GetUserBySlackID(ctx, workspaceID, event.User); err != nil && !errors.Is(err, models.ErrUserNotFound) {
+		return h.sendErrorMessage(ctx, event.Channel, event.ThreadTimeStamp, "Failed to process user information", err)
+	} else if err == nil {
+		role, err = h.sessionMgr.GetUserRole(ctx, session.ID, user.ID)
+		if err != nil {
+			return h.sendErrorMessage(ctx, event.Channel, event.ThreadTimeStamp, "Failed to check session access", err)
+		}
+	}
+	switch role {
+	case models.SessionRoleOwner, models.SessionRoleCollaborator:
+	case models.SessionRoleViewer:
+		return h.sendEphemeralMessage(event.Channel, event.User, "You have viewer access and can't send commands.")
+	default:
+		return h.sendEphemeralMessage(event.Channel, event.User,
+			fmt.Sprintf("You aren't a member of this session, so your messages aren't sent to Claude. Use `@cb join --feat %s` to join it.", session.BranchName))
+	}
+
+	// Forward message to Claude session, streaming its output into a message that is
+	// edited in place rather than posting every line
+	updater := NewStreamingMessageUpdater(h.client, event.Channel, event.ThreadTimeStamp, h.streamInterval)
+	updater.SetMaxMessages(h.maxMessagesPerTurn)
 	messageCallback := func(message string) {
-		h.sendMessage(event.Channel, event.ThreadTimeStamp, message)
+		updater.Append(message)
 	}
 
+	// The session manager records each cost; the notifier shows the running total
+	costNotifier := h.costNotifier(session)
 	costCallback := func(cost float64) {
-		// Cost updates are handled by the session manager
+		if costNotifier == nil {
+			return
+		}
+		updated, err := h.sessionMgr.GetSessionByID(context.WithoutCancel(ctx), session.ID)
+		if err != nil {
+			logging.WarnCtx(ctx, "Failed to read running cost", "branch", session.BranchName, "error", err)
+			return
+		}
+		costNotifier.Update(updated.RunningCost)
 	}
 
 	err = h.sessionMgr.SendToSession(ctx, session.SessionID, event.Text, messageCallback, costCallback)
+	updater.Finish()
+	if updater.Omitted() > 0 {
+		h.uploadTurnOutput(ctx, event.Channel, event.ThreadTimeStamp, session.BranchName, updater.Output())
+	}
+	if errors.Is(err, models.ErrTurnInterrupted) {
+		// The interrupt command has already replied
+		return nil
+	}
+	if err != nil {
+		return h.sendErrorMessage(ctx, event.Channel, event.ThreadTimeStamp,
+			h.sessionMgr.OwnerMention(ctx, session.ID, true)+"Failed to process message", err)
+	}
+
+	return nil
+}
+
+// VerifyRequest checks the signature Slack puts on every HTTP request against the
+// signing secret, so events (and the user IDs that admin commands trust) can't be
+// forged by anyone who can reach the events endpoint. Requests signed more than five
+// minutes ago are rejected as replays. Socket Mode events need no check: they arrive
+// over a connection authenticated with the app-level token.
+func (h *EventHandler) VerifyRequest(header http.Header, body []byte) error {
+	verifier, err := slack.NewSecretsVerifier(header, h.signingSecret)
 	if err != nil {
-		return h.sendErrorMessage(event.Channel, event.ThreadTimeStamp, "Failed to process message", err)
+		return fmt.Errorf("invalid request signature headers: %w", err)
+	}
+	if _, err := verifier.Write(body); err != nil {
+		return fmt.Errorf("failed to hash request body: %w", err)
+	}
+	if err := verifier.Ensure(); err != nil {
+		return fmt.Errorf("request signature doesn't match: %w", err)
+	}
+	return nil
+}
+
+// HandleEventsAPIEvent dispatches an Events API callback event to its handler, whether
+// it arrived over HTTP or Socket Mode. useEnterpriseID is passed to WorkspaceIDFromEvent.
+func (h *EventHandler) HandleEventsAPIEvent(ctx context.Context, event slackevents.EventsAPIEvent, useEnterpriseID bool) error {
+	if event.Type != slackevents.CallbackEvent {
+		return nil
+	}
+
+	// Slack redelivers events it thinks weren't handled in time; handle each only once
+	if id := EventID(event); id != "" && h.events.Seen(id) {
+		logging.InfoCtx(ctx, "Ignoring redelivered event", "event_id", id)
+		return nil
+	}
+
+	h.metrics.RecordSlackEvent(event.InnerEvent.Type)
+	workspaceID := WorkspaceIDFromEvent(event, useEnterpriseID)
+	if event.TeamID != "" && workspaceID != event.TeamID {
+		h.moveTeamRecords(ctx, event.TeamID, workspaceID)
+	}
+
+	switch evData := event.InnerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		if err := h.HandleAppMention(ctx, evData, workspaceID); err != nil {
+			return fmt.Errorf("failed to handle app mention: %w", err)
+		}
+	case *slackevents.MessageEvent:
+		if err := h.HandleMessage(ctx, evData, workspaceID); err != nil {
+			return fmt.Errorf("failed to handle message: %w", err)
+		}
+	default:
+		logging.DebugCtx(ctx, "Unhandled event type", "type", fmt.Sprintf("%T", evData))
 	}
 
 	return nil
 }
 
-// handleCommand processes a parsed command
-func (h *EventHandler) handleCommand(ctx context.Context, user *models.User, channelID, threadTS, command string, args []string) error {
+// moveTeamRecords moves the records kept under a team ID to the enterprise ID that now
+// keys the team's events, the first time the team is seen, so that what its users
+// stored before USE_ENTERPRISE_ID was turned on is still theirs. A failed move is logged
+// and retried on the team's next event.
+func (h *EventHandler) moveTeamRecords(ctx context.Context, teamID, workspaceID string) {
+	h.movedTeamsMu.Lock()
+	defer h.movedTeamsMu.Unlock()
+
+	if h.movedTeams[teamID] {
+		return
+	}
+	if err := h.sessionMgr.MoveWorkspace(ctx, teamID, workspaceID); err != nil {
+		logging.ErrorCtx(ctx, "Failed to move team records to the enterprise ID", "team_id", teamID, "error", err)
+		return
+	}
+	h.movedTeams[teamID] = true
+}
+
+// handleCommand processes a parsed command. messageTS is the timestamp of the message
+// carrying the command and identifies Slack retries of the same event.
+func (h *EventHandler) handleCommand(ctx context.Context, user *models.User, channelID, threadTS, messageTS, command string, args []string) error {
+	timer := metrics.NewTimer()
+	err := h.dispatchCommand(ctx, user, channelID, threadTS, messageTS, command, args)
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	h.metrics.RecordCommand(command, status, timer.Duration())
+	return err
+}
+
+// dispatchCommand runs the handler for a command
+func (h *EventHandler) dispatchCommand(ctx context.Context, user *models.User, channelID, threadTS, messageTS, command string, args []string) error {
 	switch command {
 	case "start":
-		return h.handleStartCommand(ctx, user, channelID, threadTS, args)
+		return h.handleStartCommand(ctx, user, channelID, threadTS, messageTS, args)
 	case "continue":
 		return h.handleContinueCommand(ctx, user, channelID, threadTS, args)
 	case "stop":
-		return h.handleStopCommand(ctx, user, channelID, threadTS)
+		return h.handleStopCommand(ctx, user, channelID, threadTS, args)
+	case "interrupt":
+		return h.handleInterruptCommand(ctx, user, channelID, threadTS, args)
 	case "status":
-		return h.handleStatusCommand(ctx, user, channelID, threadTS)
+		return h.handleStatusCommand(ctx, user, channelID, threadTS, args)
 	case "list":
-		return h.handleListCommand(ctx, user, channelID, threadTS)
+		return h.handleListCommand(ctx, user, channelID, threadTS, args)
+	case "history":
+		return h.handleHistoryCommand(ctx, user, channelID, threadTS, args)
+	case "diff":
+		return h.handleDiffCommand(ctx, user, channelID, threadTS)
+	case "pr":
+		return h.handlePRCommand(ctx, user, channelID, threadTS, args)
 	case "credentials":
 		return h.handleCredentialsCommand(ctx, user, channelID, threadTS, args)
+	case "join":
+		return h.handleJoinCommand(ctx, user, channelID, threadTS, args)
+	case "leave":
+		return h.handleLeaveCommand(ctx, user, channelID, threadTS, args)
+	case "restart":
+		return h.handleRestartCommand(ctx, user, channelID, threadTS, args)
+	case "cost":
+		return h.handleCostCommand(ctx, user, channelID, threadTS, args)
+	case "members":
+		return h.handleMembersCommand(ctx, user, channelID, threadTS, args)
+	case "share-link":
+		return h.handleShareLinkCommand(ctx, user, channelID, threadTS, args)
+	case "logs":
+		return h.handleLogsCommand(ctx, user, channelID, threadTS, args)
+	case "verify":
+		return h.handleVerifyCommand(ctx, user, channelID, threadTS, args)
+	case "limits":
+		return h.handleLimitsCommand(ctx, user, channelID, threadTS)
+	case "whoami":
+		return h.handleWhoamiCommand(ctx, user, channelID, threadTS)
+	case "notify":
+		return h.handleNotifyCommand(ctx, user, channelID, threadTS, args)
+	case "prompts":
+		return h.handlePromptsCommand(ctx, user, channelID, threadTS, args)
+	case "prompt":
+		return h.handlePromptCommand(ctx, user, channelID, threadTS, args)
+	case "mcp":
+		return h.handleMCPCommand(ctx, user, channelID, threadTS, args)
+	case "freeze":
+		return h.handleFreezeCommand(ctx, user, channelID, threadTS, true)
+	case "unfreeze":
+		return h.handleFreezeCommand(ctx, user, channelID, threadTS, false)
 	case "help":
 		return h.handleHelpCommand(channelID, threadTS)
 	default:
-		return h.sendErrorMessage(channelID, threadTS, "",
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
 			models.NewCBError(models.ErrCodeInvalidCommand, "Unknown command", nil))
 	}
 }
 
 // handleStartCommand handles the start command
-func (h *EventHandler) handleStartCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+func (h *EventHandler) handleStartCommand(ctx context.Context, user *models.User, channelID, threadTS, messageTS string, args []string) error {
 	// Parse start command arguments using new parser
 	fullCommand := fmt.Sprintf("@%s start %s", h.botUserID, strings.Join(args, " "))
 	cmdArgs, err := ParseStartCommandNew(fullCommand)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	if err := h.sessionMgr.CheckNotFrozen(); err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
 	}
 
-	// Check if user has required credentials
-	hasCredentials, err := h.sessionMgr.HasRequiredCredentials(ctx, user.ID)
+	// Check if user has required credentials (GitHub is only needed for private repos)
+	missing, err := h.sessionMgr.MissingCredentials(ctx, user.ID, cmdArgs.RepoURL)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to check credentials", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check credentials", err)
 	}
-	if !hasCredentials {
-		return h.sendErrorMessage(channelID, threadTS, "",
+	if len(missing) > 0 {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
 			models.NewCBError(models.ErrCodeNoCredentials,
-				"Missing required credentials. Use `credentials set {github|anthropic} <secret>` to continue", nil))
+				fmt.Sprintf("Missing required credentials: %s. Use `credentials set {github|anthropic} <secret>` to continue "+
+					"(a GitHub token is only required for private repositories)", strings.Join(missing, ", ")), nil))
+	}
+
+	// Slack redelivers events it considers unacknowledged; the originating message
+	// identifies the request so a retry doesn't start a second session
+	var idempotencyKey string
+	if messageTS != "" {
+		idempotencyKey = fmt.Sprintf("slack:%s:%s:%s", user.SlackWorkspaceID, channelID, messageTS)
+		existing, err := h.sessionMgr.GetSessionByIdempotencyKey(ctx, idempotencyKey)
+		if err == nil {
+			logging.InfoCtx(ctx, "Ignoring retried start command", "branch", existing.BranchName)
+			return nil
+		}
+		if !errors.Is(err, models.ErrSessionNotFound) {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check for existing session", err)
+		}
+	}
+
+	// Without --feat, name the session after its prompt or the time it was started
+	if cmdArgs.Feature == "" {
+		cmdArgs.Feature, err = h.sessionMgr.GenerateFeatureName(ctx, user.SlackWorkspaceID, cmdArgs.RepoURL, cmdArgs.Prompt, cmdArgs.From, time.Now())
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to generate a feature name", err)
+		}
 	}
 
 	// Create a new thread for this session
@@ -159,12 +482,20 @@ func (h *EventHandler) handleStartCommand(ctx context.Context, user *models.User
 		ModelName:       cmdArgs.Model,
 		PromptText:      cmdArgs.Prompt,
 		PromptName:      cmdArgs.PName,
+		IdempotencyKey:  idempotencyKey,
+		MaxCostUSD:      cmdArgs.Budget,
 	}
 
 	// Create session (immediate response)
 	session, err := h.sessionMgr.CreateSession(ctx, req)
+	if errors.Is(err, models.ErrRequestReplayed) {
+		// A retry of this command won the race and is setting the session up
+		logging.InfoCtx(ctx, "Ignoring retried start command", "branch", session.BranchName)
+		h.sendMessage(channelID, sessionThreadTS, fmt.Sprintf("This command already started session '%s'; follow it in its own thread.", session.BranchName))
+		return nil
+	}
 	if err != nil {
-		return h.sendErrorMessage(channelID, sessionThreadTS, "Failed to start session", err)
+		return h.sendErrorMessage(ctx, channelID, sessionThreadTS, "Failed to start session", err)
 	}
 
 	// Send success message
@@ -172,38 +503,98 @@ func (h *EventHandler) handleStartCommand(ctx context.Context, user *models.User
 	h.sendMessage(channelID, sessionThreadTS, successMsg)
 
 	// Start background setup
-	go func() {
-		progressCallback := func(message string) {
-			h.sendMessage(channelID, sessionThreadTS, message)
-		}
-		h.sessionMgr.SetupSessionAsync(context.Background(), session, req, progressCallback)
-	}()
+	h.runAsync(func() {
+		h.runSetup(ctx, session, req, channelID, sessionThreadTS)
+	})
 
 	return nil
 }
 
+// runSetup runs a session's setup, including Claude's first turn, posting its progress
+// to the session thread. Like any turn, the messages posted are capped. Setup outlives
+// the event that started it, so only ctx's values, such as its request ID, are kept.
+func (h *EventHandler) runSetup(ctx context.Context, session *models.Session, req *models.CreateSessionRequest, channelID, threadTS string) {
+	ctx = context.WithoutCancel(ctx)
+
+	var (
+		mu      sync.Mutex
+		posted  int
+		omitted []string
+		output  []string
+	)
+	progressCallback := func(message string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if h.maxMessagesPerTurn <= 0 {
+			h.sendMessage(channelID, threadTS, message)
+			return
+		}
+		output = append(output, message)
+		if posted < h.maxMessagesPerTurn {
+			posted++
+			h.sendMessage(channelID, threadTS, message)
+			return
+		}
+		omitted = append(omitted, message)
+	}
+
+	h.sessionMgr.SetupSessionAsync(ctx, session, req, progressCallback)
+
+	// The last message says how setup ended, so it's always posted
+	if len(omitted) > 1 {
+		h.sendMessage(channelID, threadTS, FormatTruncationNotice(len(omitted)-1))
+	}
+	if len(omitted) > 0 {
+		h.sendMessage(channelID, threadTS, omitted[len(omitted)-1])
+	}
+	if len(omitted) > 1 {
+		h.uploadTurnOutput(ctx, channelID, threadTS, session.BranchName, strings.Join(output, "\n"))
+	}
+}
+
+// uploadTurnOutput uploads the full output of a truncated turn to the thread as a
+// snippet. Failures are only logged; the turn itself has already been reported.
+func (h *EventHandler) uploadTurnOutput(ctx context.Context, channelID, threadTS, feature, output string) {
+	if output == "" {
+		return
+	}
+	_, err := h.client.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+		Content:         output,
+		FileSize:        len(output),
+		Filename:        feature + "-output.txt",
+		Title:           fmt.Sprintf("Full output for %s", feature),
+		Channel:         channelID,
+		ThreadTimestamp: threadTS,
+		SnippetType:     "text",
+	})
+	if err != nil {
+		logging.ErrorCtx(ctx, "Failed to upload turn output", "branch", feature, "error", err)
+	}
+}
+
 // handleContinueCommand handles the continue command
 func (h *EventHandler) handleContinueCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
 	// Parse continue command arguments
 	fullCommand := fmt.Sprintf("@%s continue %s", h.botUserID, strings.Join(args, " "))
 	cmdArgs, err := ParseContinueCommand(fullCommand)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
 	}
 
 	// Find session by branch name
-	session, err := h.sessionMgr.GetSessionByBranchName(ctx, cmdArgs.Feature)
+	session, err := h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to find session", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
 	}
 
 	// Check if user is associated with this session
 	isAssociated, err := h.sessionMgr.IsUserAssociatedWithSession(ctx, session.ID, user.ID)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to check session access", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check session access", err)
 	}
 	if !isAssociated {
-		return h.sendErrorMessage(channelID, threadTS, "",
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
 			models.NewCBError(models.ErrCodeUnauthorized,
 				fmt.Sprintf("You are not associated with session '%s'", cmdArgs.Feature), nil))
 	}
@@ -223,7 +614,7 @@ func (h *EventHandler) handleContinueCommand(ctx context.Context, user *models.U
 	// Update the session thread
 	err = h.sessionMgr.UpdateSessionThread(ctx, session.SessionID, threadTS)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to update session thread", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to update session thread", err)
 	}
 
 	// Send success message in new thread
@@ -248,68 +639,398 @@ func (h *EventHandler) handleContinueCommand(ctx context.Context, user *models.U
 }
 
 // handleStopCommand handles the stop command
-func (h *EventHandler) handleStopCommand(ctx context.Context, user *models.User, channelID, threadTS string) error {
-	// Find active session in this channel/thread
-	session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+func (h *EventHandler) handleStopCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseStopCommand(args)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to find session", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
 	}
-	if session == nil {
-		return h.sendErrorMessage(channelID, threadTS, "",
+
+	// Find active session in this channel/thread
+	session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+	if errors.Is(err, models.ErrNoActiveSession) {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
 			models.NewCBError(models.ErrCodeSessionNotFound, "No active session in this channel/thread", nil))
 	}
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+	}
 
 	// Check if user owns the session
 	ownerID, err := h.sessionMgr.GetSessionOwner(ctx, session.ID)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to get session owner", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get session owner", err)
 	}
 	if ownerID != user.ID {
-		return h.sendErrorMessage(channelID, threadTS, "",
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
 			models.NewCBError(models.ErrCodeUnauthorized, "You can only stop your own sessions", nil))
 	}
 
 	// End session
-	if err := h.sessionMgr.EndSession(ctx, session.SessionID); err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to stop session", err)
+	if err := h.sessionMgr.EndSession(ctx, session.SessionID, cmdArgs.Message); err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to stop session", err)
 	}
 
-	return h.sendMessage(channelID, threadTS, FormatSuccessMessage("Session stopped and changes committed"))
+	summary, err := h.sessionMgr.GetSessionSummary(ctx, session.ID)
+	if err != nil {
+		logging.ErrorCtx(ctx, "Failed to get session summary", "branch", session.BranchName, "error", err)
+		return h.sendMessage(channelID, threadTS, FormatSuccessMessage("Session stopped and changes committed"))
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatSessionSummary(summary))
 }
 
-// handleStatusCommand handles the status command
-func (h *EventHandler) handleStatusCommand(ctx context.Context, user *models.User, channelID, threadTS string) error {
-	// Find active session in this channel/thread
-	session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+// handleInterruptCommand handles the interrupt command, cancelling Claude's current
+// turn in a session while leaving the session active for further messages
+func (h *EventHandler) handleInterruptCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseInterruptCommand(args)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to find session", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
 	}
-	if session == nil {
-		return h.sendMessage(channelID, threadTS, "No active session in this channel/thread")
+
+	var session *models.Session
+	if cmdArgs.Feature == "" {
+		session, err = h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if errors.Is(err, models.ErrNoActiveSession) {
+			return h.sendMessage(channelID, threadTS, "No active session in this channel/thread.")
+		}
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	} else {
+		session, err = h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	}
+
+	// Only members can interrupt a session
+	isAssociated, err := h.sessionMgr.IsUserAssociatedWithSession(ctx, session.ID, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check session access", err)
+	}
+	if !isAssociated {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized,
+				fmt.Sprintf("You are not a member of session '%s'", session.BranchName), nil))
+	}
+
+	if !h.sessionMgr.InterruptSession(session.ID) {
+		return h.sendMessage(channelID, threadTS,
+			fmt.Sprintf("Claude isn't working on anything in session '%s'", slackEscape(session.BranchName)))
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatSuccessMessage(
+		fmt.Sprintf("Interrupted Claude's current turn in '%s'. Send a message to continue with new instructions", slackEscape(session.BranchName))))
+}
+
+// handleJoinCommand handles the join command, adding the user to a session as a
+// collaborator or viewer
+func (h *EventHandler) handleJoinCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseJoinCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	session, err := h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+	}
+
+	if err := h.sessionMgr.JoinSession(ctx, session, user.ID, cmdArgs.Role); err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to join session", err)
+	}
+
+	joinedMsg := fmt.Sprintf("👋 <@%s> joined session '%s' as %s", user.SlackUserID, session.BranchName, cmdArgs.Role)
+	h.sendMessage(session.SlackChannelID, session.SlackThreadTS, joinedMsg)
+
+	// Confirm where the command was issued too, if that's not the session thread
+	if session.SlackChannelID != channelID || session.SlackThreadTS != threadTS {
+		return h.sendMessage(channelID, threadTS, FormatSuccessMessage(
+			fmt.Sprintf("Joined session '%s' as %s, follow along in <#%s>", session.BranchName, cmdArgs.Role, session.SlackChannelID)))
+	}
+
+	return nil
+}
+
+// handleLeaveCommand handles the leave command, detaching the user from a session and
+// handing ownership on (or ending the session) when the owner leaves
+func (h *EventHandler) handleLeaveCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseLeaveCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	var session *models.Session
+	if cmdArgs.Feature == "" {
+		session, err = h.sessionMgr.GetLatestSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+		if session == nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeSessionNotFound, "No session in this channel/thread, use `leave --feat <name>`", nil))
+		}
+	} else {
+		session, err = h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	}
+
+	previousStatus := session.Status
+	result, err := h.sessionMgr.LeaveSession(ctx, session, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to leave session", err)
+	}
+
+	var msg string
+	switch result.Outcome {
+	case models.LeaveOutcomeTransferred:
+		newOwner, err := h.sessionMgr.GetUserByID(ctx, result.NewOwnerID)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Left session but failed to look up the new owner", err)
+		}
+		msg = fmt.Sprintf("👋 <@%s> left session '%s'. <@%s> is now the owner", user.SlackUserID, session.BranchName, newOwner.SlackUserID)
+	case models.LeaveOutcomeEnded:
+		if previousStatus == models.SessionStatusActive {
+			msg = fmt.Sprintf("👋 <@%s> was the last member of session '%s', so it has been stopped and its changes committed",
+				user.SlackUserID, session.BranchName)
+		} else {
+			msg = fmt.Sprintf("👋 <@%s> was the last member of session '%s', which stays %s",
+				user.SlackUserID, session.BranchName, previousStatus)
+		}
+	default:
+		msg = fmt.Sprintf("👋 <@%s> left session '%s'", user.SlackUserID, session.BranchName)
+	}
+
+	// Let the session thread know, and confirm where the command was issued if elsewhere
+	h.sendMessage(session.SlackChannelID, session.SlackThreadTS, msg)
+	if session.SlackChannelID != channelID || session.SlackThreadTS != threadTS {
+		return h.sendMessage(channelID, threadTS, msg)
+	}
+
+	return nil
+}
+
+// handleRestartCommand handles the restart command, re-running setup for the owner's
+// errored or ended session in place of starting a new one
+func (h *EventHandler) handleRestartCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseRestartCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	var session *models.Session
+	if cmdArgs.Feature == "" {
+		session, err = h.sessionMgr.GetLatestSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+		if session == nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeSessionNotFound, "No session in this channel/thread, use `restart --feat <name>`", nil))
+		}
+	} else {
+		session, err = h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	}
+
+	// Check if user owns the session
+	ownerID, err := h.sessionMgr.GetSessionOwner(ctx, session.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get session owner", err)
+	}
+	if ownerID != user.ID {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized, "You can only restart your own sessions", nil))
+	}
+
+	req, err := h.sessionMgr.PrepareRestart(ctx, session)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to restart session", err)
+	}
+
+	// Progress goes to the session's own thread, wherever the command was issued
+	sessionChannelID, sessionThreadTS := session.SlackChannelID, session.SlackThreadTS
+	h.sendMessage(sessionChannelID, sessionThreadTS,
+		fmt.Sprintf("🔁 Restarting session '%s'...\n\nSetup is now running in the background...", session.BranchName))
+
+	h.runAsync(func() {
+		h.runSetup(ctx, session, req, sessionChannelID, sessionThreadTS)
+	})
+
+	return nil
+}
+
+// handleStatusCommand handles the status command, reporting the active session in this
+// channel/thread or, with --feat, any session the user is a member of
+func (h *EventHandler) handleStatusCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseStatusCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	var session *models.Session
+	if cmdArgs.Feature == "" {
+		session, err = h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if errors.Is(err, models.ErrNoActiveSession) {
+			return h.sendMessage(channelID, threadTS, "No active session in this channel/thread")
+		}
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	} else {
+		session, err = h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+
+		isAssociated, err := h.sessionMgr.IsUserAssociatedWithSession(ctx, session.ID, user.ID)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check session access", err)
+		}
+		if !isAssociated {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeUnauthorized,
+					fmt.Sprintf("You are not associated with session '%s'", cmdArgs.Feature), nil))
+		}
 	}
 
 	// Get detailed session info
 	info, err := h.sessionMgr.GetSessionInfo(ctx, session.SessionID)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to get session info", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get session info", err)
 	}
 
 	return h.sendMessage(channelID, threadTS, FormatSessionInfo(info))
 }
 
+// handleDiffCommand handles the diff command, posting the uncommitted changes of the
+// active session in this channel/thread
+func (h *EventHandler) handleDiffCommand(ctx context.Context, user *models.User, channelID, threadTS string) error {
+	session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+	if errors.Is(err, models.ErrNoActiveSession) {
+		return h.sendMessage(channelID, threadTS, "No active session in this channel/thread")
+	}
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+	}
+
+	stat, diff, err := h.sessionMgr.GetSessionDiff(ctx, session)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get diff", err)
+	}
+
+	for _, message := range FormatDiff(stat, diff) {
+		if err := h.sendMessage(channelID, threadTS, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleHistoryCommand handles the history command, posting the recent messages
+// exchanged with Claude in the session in this channel/thread
+func (h *EventHandler) handleHistoryCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseHistoryCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+	if errors.Is(err, models.ErrNoActiveSession) {
+		return h.sendMessage(channelID, threadTS, "No active session in this channel/thread")
+	}
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+	}
+
+	messages, err := h.sessionMgr.GetSessionMessages(ctx, session.ID, cmdArgs.Limit)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get session history", err)
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatSessionHistory(session, messages))
+}
+
+// handlePRCommand handles the pr command, opening a pull request for a stopped
+// session's branch with the user's GitHub token
+func (h *EventHandler) handlePRCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParsePRCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	var session *models.Session
+	if cmdArgs.Feature == "" {
+		session, err = h.sessionMgr.GetLatestSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+		if session == nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeSessionNotFound, "No session in this channel/thread, use `pr --feat <name>`", nil))
+		}
+	} else {
+		session, err = h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	}
+
+	// Only members of the session can open a pull request for it
+	isMember, err := h.sessionMgr.IsUserAssociatedWithSession(ctx, session.ID, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check session access", err)
+	}
+	if !isMember {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized, "You can only open pull requests for sessions you're part of", nil))
+	}
+
+	prURL, err := h.sessionMgr.OpenPullRequest(ctx, session, user.ID, cmdArgs.Title, cmdArgs.Base)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to open pull request", err)
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatSuccessMessage(
+		fmt.Sprintf("Opened a pull request for '%s': %s", slackEscape(session.BranchName), slackLink(prURL))))
+}
+
 // handleListCommand handles the list command
-func (h *EventHandler) handleListCommand(ctx context.Context, user *models.User, channelID, threadTS string) error {
-	sessions, err := h.sessionMgr.GetUserSessions(ctx, user.ID)
+func (h *EventHandler) handleListCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseListCommand(args)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "Failed to get sessions", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+	if cmdArgs.All {
+		return h.handleListAllCommand(ctx, user, channelID, threadTS)
 	}
 
-	if len(sessions) == 0 {
+	total, err := h.sessionMgr.GetUserSessionCount(ctx, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get sessions", err)
+	}
+	if total == 0 {
 		return h.sendMessage(channelID, threadTS, "You have no active sessions")
 	}
 
+	pages := (total + ListPageSize - 1) / ListPageSize
+	if cmdArgs.Page > pages {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("page %d doesn't exist, your sessions fill %d page(s)", cmdArgs.Page, pages), nil))
+	}
+
+	sessions, err := h.sessionMgr.GetUserSessions(ctx, user.ID, ListPageSize, (cmdArgs.Page-1)*ListPageSize)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get sessions", err)
+	}
+
 	var parts []string
-	parts = append(parts, fmt.Sprintf("*Your Active Sessions (%d):*", len(sessions)))
+	parts = append(parts, fmt.Sprintf("*Your Active Sessions (%d):*", total))
 
 	for _, session := range sessions {
 		info := map[string]any{
@@ -322,51 +1043,503 @@ func (h *EventHandler) handleListCommand(ctx context.Context, user *models.User,
 		parts = append(parts, FormatSessionInfo(info))
 	}
 
+	footer := fmt.Sprintf("\n_Page %d of %d_", cmdArgs.Page, pages)
+	if cmdArgs.Page < pages {
+		footer += fmt.Sprintf(" - `list --page %d` for more", cmdArgs.Page+1)
+	}
+	parts = append(parts, footer)
+
 	return h.sendMessage(channelID, threadTS, strings.Join(parts, "\n"))
 }
 
+// handleListAllCommand lists every active session with its owner and cost (admins only)
+func (h *EventHandler) handleListAllCommand(ctx context.Context, user *models.User, channelID, threadTS string) error {
+	if !h.isAdmin(user.SlackUserID) {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized, "You are not authorized.", nil))
+	}
+
+	sessions, err := h.sessionMgr.GetAllActiveSessions(ctx)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get sessions", err)
+	}
+
+	owners := make(map[int64]*models.User, len(sessions))
+	for _, session := range sessions {
+		ownerID, err := h.sessionMgr.GetSessionOwner(ctx, session.ID)
+		if err != nil {
+			logging.WarnCtx(ctx, "Failed to get session owner", "branch", session.BranchName, "error", err)
+			continue
+		}
+		owner, err := h.sessionMgr.GetUserByID(ctx, ownerID)
+		if err != nil {
+			logging.WarnCtx(ctx, "Failed to get session owner", "branch", session.BranchName, "owner_id", ownerID, "error", err)
+			continue
+		}
+		owners[session.ID] = owner
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatAllSessions(sessions, owners))
+}
+
+// handleCostCommand handles the cost command
+func (h *EventHandler) handleCostCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	if len(args) > 0 && args[0] == "report" {
+		return h.handleCostReportCommand(ctx, user, channelID, threadTS, args[1:])
+	}
+
+	cmdArgs, err := ParseCostCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	if cmdArgs.Feature == "" {
+		session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if errors.Is(err, models.ErrNoActiveSession) {
+			return h.sendMessage(channelID, threadTS, "No active session in this channel/thread.")
+		}
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+		return h.sendMessage(channelID, threadTS, FormatSessionCost(session))
+	}
+
+	session, err := h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+	}
+
+	isAssociated, err := h.sessionMgr.IsUserAssociatedWithSession(ctx, session.ID, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check session access", err)
+	}
+	if !isAssociated {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized,
+				fmt.Sprintf("You are not associated with session '%s'", cmdArgs.Feature), nil))
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatSessionCost(session))
+}
+
+// handleCostReportCommand handles cost report, totalling the cost of the user's sessions
+// or, for admins with --workspace, the workspace's over a period
+func (h *EventHandler) handleCostReportCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseCostReportCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	since := time.Now().Add(-cmdArgs.Since)
+	var total float64
+	if cmdArgs.Workspace {
+		if !h.isAdmin(user.SlackUserID) {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeUnauthorized, "Only admins can report the workspace's cost", nil))
+		}
+		total, err = h.sessionMgr.SumCostByWorkspace(ctx, user.SlackWorkspaceID, since)
+	} else {
+		total, err = h.sessionMgr.SumCostByUser(ctx, user.ID, since)
+	}
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to report cost", err)
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatCostReport(total, cmdArgs.Since, cmdArgs.Workspace))
+}
+
+// handleMembersCommand handles the members command, listing who is in a session
+func (h *EventHandler) handleMembersCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseMembersCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	var session *models.Session
+	if cmdArgs.Feature == "" {
+		session, err = h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if errors.Is(err, models.ErrNoActiveSession) {
+			return h.sendMessage(channelID, threadTS, "No active session in this channel/thread.")
+		}
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	} else {
+		session, err = h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	}
+
+	// Only members can see who else is in a session
+	isAssociated, err := h.sessionMgr.IsUserAssociatedWithSession(ctx, session.ID, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check session access", err)
+	}
+	if !isAssociated {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized,
+				fmt.Sprintf("You are not a member of session '%s'", session.BranchName), nil))
+	}
+
+	members, err := h.sessionMgr.GetSessionUsers(ctx, session.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get session members", err)
+	}
+
+	users := make(map[int64]*models.User, len(members))
+	for _, member := range members {
+		memberUser, err := h.sessionMgr.GetUserByID(ctx, member.UserID)
+		if err != nil {
+			logging.WarnCtx(ctx, "Failed to look up session member", "member_id", member.UserID, "error", err)
+			continue
+		}
+		users[member.UserID] = memberUser
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatSessionMembers(session, members, users))
+}
+
+// handleShareLinkCommand handles the share-link command, posting an expiring link to a
+// read-only view of a session for people outside Slack
+func (h *EventHandler) handleShareLinkCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	if h.shareSigner == nil {
+		return h.sendMessage(channelID, threadTS, "Share links aren't enabled. An admin can enable the read-only API with READONLY_API_ENABLED and PUBLIC_URL.")
+	}
+
+	cmdArgs, err := ParseShareLinkCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	var session *models.Session
+	if cmdArgs.Feature == "" {
+		session, err = h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if errors.Is(err, models.ErrNoActiveSession) {
+			return h.sendMessage(channelID, threadTS, "No active session in this channel/thread.")
+		}
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	} else {
+		session, err = h.sessionMgr.GetSessionByBranchName(ctx, user.SlackWorkspaceID, "", cmdArgs.Feature)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to find session", err)
+		}
+	}
+
+	// Only members can share a session
+	isAssociated, err := h.sessionMgr.IsUserAssociatedWithSession(ctx, session.ID, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to check session access", err)
+	}
+	if !isAssociated {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized,
+				fmt.Sprintf("You are not a member of session '%s'", session.BranchName), nil))
+	}
+
+	token, expiresAt := h.shareSigner.Token(session.ID, h.shareTTL)
+	return h.sendMessage(channelID, threadTS, FormatShareLink(session, share.LinkURL(h.sharePublicURL, token), expiresAt))
+}
+
+// handleLogsCommand handles the admin logs command
+func (h *EventHandler) handleLogsCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	if !h.isAdmin(user.SlackUserID) {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized, "Only admins can view session logs", nil))
+	}
+
+	feature, n, err := ParseLogsCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	lines, err := h.sessionMgr.TailSessionLog(ctx, user.SlackWorkspaceID, feature, n)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to read session log", err)
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatLogLines(feature, lines))
+}
+
+// handleVerifyCommand handles the admin verify command, which checks active sessions
+// against their work trees and optionally marks the broken ones as errored
+func (h *EventHandler) handleVerifyCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	if !h.isAdmin(user.SlackUserID) {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized, "Only admins can verify sessions", nil))
+	}
+
+	cmdArgs, err := ParseVerifyCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	checked, discrepancies, err := h.sessionMgr.VerifySessions(ctx, cmdArgs.Mark)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to verify sessions", err)
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatSessionDiscrepancies(checked, discrepancies))
+}
+
+// handleLimitsCommand handles the limits command
+func (h *EventHandler) handleLimitsCommand(ctx context.Context, user *models.User, channelID, threadTS string) error {
+	limits, err := h.sessionMgr.GetUserLimits(ctx, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get limits", err)
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatUserLimits(limits))
+}
+
+// handleNotifyCommand handles the notify command, which shows or sets when the user is
+// @-mentioned on events in the sessions they own
+func (h *EventHandler) handleNotifyCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParseNotifyCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	if cmdArgs.Preference == "" {
+		prefs, err := h.sessionMgr.GetUserPrefs(ctx, user.ID)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get notification preference", err)
+		}
+		return h.sendMessage(channelID, threadTS, FormatNotifyPreference(prefs.Notify))
+	}
+
+	if err := h.sessionMgr.SetNotifyPreference(ctx, user.ID, cmdArgs.Preference); err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to set notification preference", err)
+	}
+	return h.sendMessage(channelID, threadTS, FormatSuccessMessage(FormatNotifyPreference(cmdArgs.Preference)))
+}
+
 // handleCredentialsCommand handles credential-related commands
 func (h *EventHandler) handleCredentialsCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
 	action, credType, value, err := ParseCredentialCommand(args)
 	if err != nil {
-		return h.sendErrorMessage(channelID, threadTS, "", err)
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
 	}
 
 	switch action {
+	case "connect":
+		if h.githubConnect == nil {
+			return h.sendMessage(channelID, threadTS, "Connecting a GitHub account isn't set up on this server; use `credentials set github <token>` in a DM with me instead.")
+		}
+		// The link connects whoever opens it to this user, so only they see it
+		connectURL := oauth.ConnectURL(h.githubPublicURL, h.githubConnect.State(user.ID, oauth.StateTTL))
+		return h.sendEphemeralMessage(channelID, user.SlackUserID, fmt.Sprintf(
+			"<%s|Connect your GitHub account> to store a token without pasting it into Slack. The link is yours alone and works for %d minutes.",
+			connectURL, int(oauth.StateTTL.Minutes())))
+
 	case "set":
 		if err := h.sessionMgr.StoreCredential(ctx, user.ID, credType, value); err != nil {
-			return h.sendErrorMessage(channelID, threadTS, "Failed to store credential", err)
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to store credential", err)
 		}
 		return h.sendMessage(channelID, threadTS, FormatSuccessMessage(fmt.Sprintf("%s credential stored securely", credType)))
 
+	case "delete":
+		err := h.sessionMgr.DeleteCredential(ctx, user.ID, credType)
+		if errors.Is(err, models.ErrNoCredentials) {
+			return h.sendMessage(channelID, threadTS, fmt.Sprintf("You have no stored %s credential.", credType))
+		}
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to delete credential", err)
+		}
+		return h.sendMessage(channelID, threadTS, FormatSuccessMessage(fmt.Sprintf("%s credential deleted", credType)))
+
 	case "list":
-		// Get stored credential types (without values for security)
-		hasAnthropic := false
-		hasGithub := false
+		parts := append([]string{"*Your Stored Credentials:*"}, h.credentialLines(ctx, user)...)
+		return h.sendMessage(channelID, threadTS, strings.Join(parts, "\n"))
+	}
+
+	return nil
+}
+
+// credentialLines lists which of the user's credentials are stored, one bullet each,
+// without their values
+func (h *EventHandler) credentialLines(ctx context.Context, user *models.User) []string {
+	hasAnthropic := false
+	hasGithub := false
+
+	if _, err := h.sessionMgr.GetCredential(ctx, user.ID, models.CredentialTypeAnthropic); err == nil {
+		hasAnthropic = true
+	}
+	if _, err := h.sessionMgr.GetCredential(ctx, user.ID, models.CredentialTypeGitHub); err == nil {
+		hasGithub = true
+	}
+
+	var parts []string
+	if hasAnthropic {
+		parts = append(parts, "• :white_check_mark: Anthropic API key")
+	} else {
+		parts = append(parts, "• :x: Anthropic API key (required)")
+	}
+
+	if hasGithub {
+		parts = append(parts, "• :white_check_mark: GitHub token")
+	} else if h.githubConnect != nil {
+		parts = append(parts, "• :x: GitHub token (required for private repositories; use `credentials connect github`)")
+	} else {
+		parts = append(parts, "• :x: GitHub token (required for private repositories)")
+	}
+	return parts
+}
+
+// handleWhoamiCommand handles the whoami command, which shows what the bot knows about
+// the user: who they are, which credentials they've stored, and their sessions and cost
+func (h *EventHandler) handleWhoamiCommand(ctx context.Context, user *models.User, channelID, threadTS string) error {
+	limits, err := h.sessionMgr.GetUserLimits(ctx, user.ID)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get your account", err)
+	}
+
+	return h.sendMessage(channelID, threadTS, FormatWhoami(user, h.credentialLines(ctx, user), limits))
+}
+
+// handleFreezeCommand handles the admin freeze and unfreeze commands
+func (h *EventHandler) handleFreezeCommand(ctx context.Context, user *models.User, channelID, threadTS string, frozen bool) error {
+	if !h.isAdmin(user.SlackUserID) {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "",
+			models.NewCBError(models.ErrCodeUnauthorized, "Only admins can freeze or unfreeze Claude usage", nil))
+	}
+
+	h.sessionMgr.SetFrozen(frozen)
+
+	if frozen {
+		logging.Warn("Claude usage frozen", "slack_user", user.SlackUserID)
+		return h.sendMessage(channelID, threadTS,
+			":ice_cube: Claude usage is frozen. New sessions and messages are blocked; turns already running will finish. Use `unfreeze` to resume")
+	}
 
-		if _, err := h.sessionMgr.GetCredential(ctx, user.ID, models.CredentialTypeAnthropic); err == nil {
-			hasAnthropic = true
+	logging.Warn("Claude usage unfrozen", "slack_user", user.SlackUserID)
+	return h.sendMessage(channelID, threadTS, FormatSuccessMessage("Claude usage is unfrozen"))
+}
+
+// handleMCPCommand handles MCP server commands
+func (h *EventHandler) handleMCPCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	action, name, serverConfig, err := ParseMCPCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	switch action {
+	case "register":
+		if !h.isAdmin(user.SlackUserID) {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeUnauthorized, "Only admins can register MCP servers", nil))
 		}
-		if _, err := h.sessionMgr.GetCredential(ctx, user.ID, models.CredentialTypeGitHub); err == nil {
-			hasGithub = true
+		if _, err := h.sessionMgr.RegisterMCPServer(ctx, user.ID, name, serverConfig); err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to register MCP server", err)
 		}
+		return h.sendMessage(channelID, threadTS, FormatSuccessMessage(
+			fmt.Sprintf("MCP server `%s` registered. It will be available to new Claude invocations", name)))
 
-		var parts []string
-		parts = append(parts, "*Your Stored Credentials:*")
+	case "list":
+		servers, err := h.sessionMgr.GetMCPServers(ctx)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get MCP servers", err)
+		}
 
-		if hasAnthropic {
-			parts = append(parts, "• :white_check_mark: Anthropic API key")
-		} else {
-			parts = append(parts, "• :x: Anthropic API key (required)")
+		// Include the statuses reported by the session in this thread, if any
+		var statuses []models.MCPServerStatus
+		session, err := h.sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, channelID, threadTS)
+		if err == nil {
+			statuses = h.sessionMgr.GetMCPServerStatuses(session.ID)
 		}
 
-		if hasGithub {
-			parts = append(parts, "• :white_check_mark: GitHub token")
-		} else {
-			parts = append(parts, "• :x: GitHub token (optional)")
+		return h.sendMessage(channelID, threadTS, FormatMCPServers(servers, statuses))
+	}
+
+	return nil
+}
+
+// handlePromptsCommand handles the admin prompts command
+func (h *EventHandler) handlePromptsCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	action, libraryURL, public, err := ParsePromptsCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	switch action {
+	case "list":
+		systemPrompts, err := h.sessionMgr.GetSystemPrompts(ctx, user.ID)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get system prompts", err)
 		}
 
-		return h.sendMessage(channelID, threadTS, strings.Join(parts, "\n"))
+		return h.sendMessage(channelID, threadTS, FormatSystemPrompts(systemPrompts, user.ID))
+	case "import":
+		if !h.isAdmin(user.SlackUserID) {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeUnauthorized, "Only admins can import system prompts", nil))
+		}
+
+		data, err := prompts.FetchLibrary(ctx, nil, libraryURL)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to fetch prompt library", err)
+		}
+
+		library, err := prompts.ParseLibrary(data)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "",
+				models.NewCBError(models.ErrCodeInvalidCommand, fmt.Sprintf("Invalid prompt library: %v", err), err))
+		}
+
+		result, err := h.sessionMgr.ImportSystemPrompts(ctx, user.ID, library, public)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to import system prompts", err)
+		}
+
+		return h.sendMessage(channelID, threadTS, FormatPromptImport(result))
+	}
+
+	return nil
+}
+
+// handlePromptCommand handles the prompt command for creating, showing and deleting
+// individual system prompts
+func (h *EventHandler) handlePromptCommand(ctx context.Context, user *models.User, channelID, threadTS string, args []string) error {
+	cmdArgs, err := ParsePromptCommand(args)
+	if err != nil {
+		return h.sendErrorMessage(ctx, channelID, threadTS, "", err)
+	}
+
+	switch cmdArgs.Action {
+	case "create":
+		prompt, err := h.sessionMgr.CreateSystemPrompt(ctx, &models.CreateSystemPromptRequest{
+			Name:        cmdArgs.Name,
+			Description: cmdArgs.Description,
+			Content:     cmdArgs.Content,
+			IsPublic:    cmdArgs.Public,
+			CreatedBy:   user.ID,
+		})
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to create system prompt", err)
+		}
+
+		visibility := "private"
+		if prompt.IsPublic {
+			visibility = "public"
+		}
+		return h.sendMessage(channelID, threadTS, FormatSuccessMessage(
+			fmt.Sprintf("Created %s system prompt %s, use it with %s", visibility, slackCode(prompt.Name), slackCode("--pname "+prompt.Name))))
+	case "show":
+		prompt, err := h.sessionMgr.GetSystemPromptByName(ctx, user.ID, cmdArgs.Name)
+		if err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to get system prompt", err)
+		}
+
+		return h.sendMessage(channelID, threadTS, FormatSystemPrompt(prompt))
+	case "delete":
+		if err := h.sessionMgr.DeleteSystemPrompt(ctx, user.ID, cmdArgs.Name); err != nil {
+			return h.sendErrorMessage(ctx, channelID, threadTS, "Failed to delete system prompt", err)
+		}
+
+		return h.sendMessage(channelID, threadTS, FormatSuccessMessage(
+			fmt.Sprintf("Deleted system prompt %s", slackCode(cmdArgs.Name))))
 	}
 
 	return nil
@@ -381,9 +1554,10 @@ func (h *EventHandler) handleHelpCommand(channelID, threadTS string) error {
 func (h *EventHandler) getOrCreateUser(ctx context.Context, workspaceID, userID string) (*models.User, error) {
 	// Try to get existing user
 	user, err := h.sessionMgr.GetUserBySlackID(ctx, workspaceID, userID)
-	if user != nil && err == nil {
+	if err == nil {
 		return user, nil
-	} else if err != nil {
+	}
+	if !errors.Is(err, models.ErrUserNotFound) {
 		return nil, err
 	}
 
@@ -405,28 +1579,49 @@ func (h *EventHandler) getOrCreateUser(ctx context.Context, workspaceID, userID
 
 // sendMessage sends a message to Slack
 func (h *EventHandler) sendMessage(channelID, threadTS, text string) error {
-	options := []slack.MsgOption{
-		slack.MsgOptionText(text, false),
-		slack.MsgOptionAsUser(true),
-	}
+	// Long messages are posted in chunks Slack won't truncate
+	for _, chunk := range splitForSlack(text) {
+		options := []slack.MsgOption{
+			slack.MsgOptionText(chunk, false),
+			slack.MsgOptionAsUser(true),
+		}
 
-	if threadTS != "" {
-		options = append(options, slack.MsgOptionTS(threadTS))
-	}
+		if threadTS != "" {
+			options = append(options, slack.MsgOptionTS(threadTS))
+		}
 
-	_, _, err := h.client.PostMessage(channelID, options...)
-	if err != nil {
-		log.Printf("Failed to send message to Slack: %v", err)
+		_, ts, err := h.client.PostMessage(channelID, options...)
+		if err != nil {
+			logging.Error("Failed to send message to Slack", "channel_id", channelID, "error", err)
+			return err
+		}
+
+		// Thread the rest of a long channel message under its first chunk
+		if threadTS == "" {
+			threadTS = ts
+		}
 	}
-	return err
+	return nil
 }
 
-// sendErrorMessage sends an error message to Slack
-func (h *EventHandler) sendErrorMessage(channelID, threadTS, context string, err error) error {
+// sendErrorMessage sends an error message to Slack, with the request ID users can
+// quote in bug reports
+func (h *EventHandler) sendErrorMessage(ctx context.Context, channelID, threadTS, context string, err error) error {
+	errorType := "internal"
+	var cbErr *models.CBError
+	if errors.As(err, &cbErr) {
+		errorType = cbErr.Code
+	}
+	h.metrics.RecordError(errorType, "slack")
+
 	message := FormatErrorMessage(err)
 	if context != "" {
 		message = fmt.Sprintf("%s: %s", context, message)
 	}
+	if requestID := logging.RequestID(ctx); requestID != "" {
+		message = fmt.Sprintf("%s (request ID: %s)", message, requestID)
+	}
+	logging.WarnCtx(ctx, "Reporting error to Slack", "channel_id", channelID, "error", err)
 
 	return h.sendMessage(channelID, threadTS, message)
 }
@@ -435,7 +1630,7 @@ func (h *EventHandler) sendErrorMessage(channelID, threadTS, context string, err
 func (h *EventHandler) sendEphemeralMessage(channelID, userID, text string) error {
 	_, err := h.client.PostEphemeral(channelID, userID, slack.MsgOptionText(text, false))
 	if err != nil {
-		log.Printf("Failed to send ephemeral message to Slack: %v", err)
+		logging.Error("Failed to send ephemeral message to Slack", "channel_id", channelID, "error", err)
 	}
 	return err
 }
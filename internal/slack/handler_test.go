@@ -0,0 +1,1433 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
+	"github.com/pbdeuchler/claude-bot/internal/db"
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+	"github.com/pbdeuchler/claude-bot/internal/metrics"
+	"github.com/pbdeuchler/claude-bot/internal/oauth"
+	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/internal/share"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// postedMessage is a chat.postMessage or chat.postEphemeral call received by the fake
+// Slack API
+type postedMessage struct {
+	Channel  string
+	ThreadTS string
+	User     string // recipient of an ephemeral message
+	Text     string
+}
+
+// fakeSlack records messages posted through the Slack Web API
+type fakeSlack struct {
+	mu         sync.Mutex
+	messages   []postedMessage
+	ephemerals []postedMessage
+}
+
+func (f *fakeSlack) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/chat.postMessage") {
+		f.mu.Lock()
+		f.messages = append(f.messages, postedMessage{
+			Channel:  r.FormValue("channel"),
+			ThreadTS: r.FormValue("thread_ts"),
+			Text:     r.FormValue("text"),
+		})
+		f.mu.Unlock()
+	}
+	if strings.HasSuffix(r.URL.Path, "/chat.postEphemeral") {
+		f.mu.Lock()
+		f.ephemerals = append(f.ephemerals, postedMessage{
+			Channel: r.FormValue("channel"),
+			User:    r.FormValue("user"),
+			Text:    r.FormValue("text"),
+		})
+		f.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok":      true,
+		"channel": r.FormValue("channel"),
+		"ts":      "1700000000.000100",
+	})
+}
+
+// lastMessage returns the text of the most recent posted message
+func (f *fakeSlack) lastMessage(t *testing.T) string {
+	t.Helper()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.messages) == 0 {
+		t.Fatal("Expected a message to be posted")
+	}
+	return f.messages[len(f.messages)-1].Text
+}
+
+// newTestHandler creates an event handler backed by a temporary database and a fake Slack API
+func newTestHandler(t *testing.T) (*EventHandler, *db.DB, *fakeSlack) {
+	t.Helper()
+	return newTestHandlerWithConfig(t, nil)
+}
+
+// newTestHandlerWithConfig is like newTestHandler but lets the caller adjust the configuration
+func newTestHandlerWithConfig(t *testing.T, configure func(*config.Config)) (*EventHandler, *db.DB, *fakeSlack) {
+	t.Helper()
+
+	encryptor, err := crypto.NewEncryptor("test-encryption-key-that-is-32-bytes-long")
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	database, err := db.NewDB(filepath.Join(t.TempDir(), "test.db"), encryptor)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+
+	cfg := &config.Config{}
+	cfg.Session.MaxPerUser = 5
+	cfg.Session.IdleTimeout = 3600
+	cfg.Session.WorkDir = t.TempDir()
+	if configure != nil {
+		configure(cfg)
+	}
+	sessionMgr := session.NewManager(database, cfg)
+
+	fake := &fakeSlack{}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := slack.New("xoxb-test", slack.OptionAPIURL(server.URL+"/"))
+	return NewEventHandler(client, sessionMgr, "UBOT123", "test-signing-secret"), database, fake
+}
+
+// createTestUser creates a user in workspace T123456
+func createTestUser(t *testing.T, h *EventHandler, slackUserID string) *models.User {
+	t.Helper()
+
+	user, err := h.sessionMgr.CreateOrUpdateUser(context.Background(), &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      slackUserID,
+		SlackUserName:    strings.ToLower(slackUserID),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return user
+}
+
+// createTestSession creates an active session owned by owner in the given thread
+func createTestSession(t *testing.T, database *db.DB, owner *models.User, feature, threadTS string, cost float64) *models.Session {
+	t.Helper()
+
+	ctx := context.Background()
+	s := &models.Session{
+		SessionID:        "claude-" + feature,
+		SlackWorkspaceID: owner.SlackWorkspaceID,
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    threadTS,
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       feature,
+		WorkTreePath:     "/tmp/" + feature,
+		ModelName:        models.ModelSonnet,
+		RunningCost:      cost,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, s); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, s.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+	return s
+}
+
+func TestHandleCostCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	stranger := createTestUser(t, h, "USTRANGER")
+	createTestSession(t, database, owner, "cost-feature", "1234567890.123456", 1.23456)
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		threadTS string
+		args     []string
+		want     string
+	}{
+		{
+			name:     "active session in thread",
+			user:     owner,
+			threadTS: "1234567890.123456",
+			want:     "Session 'cost-feature' has cost $1.2346 so far",
+		},
+		{
+			name:     "no active session",
+			user:     owner,
+			threadTS: "9999999999.999999",
+			want:     "No active session in this channel/thread.",
+		},
+		{
+			name:     "named session",
+			user:     owner,
+			threadTS: "9999999999.999999",
+			args:     []string{"--feat", "cost-feature"},
+			want:     "$1.2346",
+		},
+		{
+			name:     "named session without access",
+			user:     stranger,
+			threadTS: "9999999999.999999",
+			args:     []string{"--feat", "cost-feature"},
+			want:     "You are not associated with session 'cost-feature'",
+		},
+		{
+			name:     "unknown session",
+			user:     owner,
+			threadTS: "9999999999.999999",
+			args:     []string{"--feat", "missing-feature"},
+			want:     "Failed to find session",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", tt.threadTS, "", "cost", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			if got := fake.lastMessage(t); !strings.Contains(got, tt.want) {
+				t.Errorf("reply = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCostReportCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	admin := createTestUser(t, h, "UADMIN")
+	h.SetAdminUserIDs([]string{"UADMIN"})
+	createTestSession(t, database, owner, "owner-feature", "1111111111.111111", 1.25)
+	createTestSession(t, database, admin, "admin-feature", "2222222222.222222", 2.00)
+
+	tests := []struct {
+		name string
+		user *models.User
+		args []string
+		want string
+	}{
+		{name: "own sessions", user: owner, args: []string{"report"}, want: "Your sessions started in the last 30d have cost $1.2500"},
+		{name: "since", user: owner, args: []string{"report", "--since", "24h"}, want: "in the last 1d have cost $1.2500"},
+		{name: "workspace", user: admin, args: []string{"report", "--workspace"}, want: "This workspace's sessions started in the last 30d have cost $3.2500"},
+		{name: "workspace without admin", user: owner, args: []string{"report", "--workspace"}, want: "Only admins can report the workspace's cost"},
+		{name: "invalid since", user: owner, args: []string{"report", "--since", "soon"}, want: "invalid --since"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", "", "", "cost", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			if got := fake.lastMessage(t); !strings.Contains(got, tt.want) {
+				t.Errorf("reply = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleStatusCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	stranger := createTestUser(t, h, "USTRANGER")
+	createTestSession(t, database, owner, "status-feature", "1234567890.123456", 0)
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		threadTS string
+		args     []string
+		want     string
+	}{
+		{
+			name:     "active session in thread",
+			user:     owner,
+			threadTS: "1234567890.123456",
+			want:     "*Branch:* status-feature",
+		},
+		{
+			name:     "no active session",
+			user:     owner,
+			threadTS: "9999999999.999999",
+			want:     "No active session in this channel/thread",
+		},
+		{
+			name:     "named session from another thread",
+			user:     owner,
+			threadTS: "9999999999.999999",
+			args:     []string{"--feat", "status-feature"},
+			want:     "*Branch:* status-feature",
+		},
+		{
+			name:     "named session without access",
+			user:     stranger,
+			threadTS: "9999999999.999999",
+			args:     []string{"--feat", "status-feature"},
+			want:     "You are not associated with session 'status-feature'",
+		},
+		{
+			name:     "unknown session",
+			user:     owner,
+			threadTS: "9999999999.999999",
+			args:     []string{"--feat", "missing-feature"},
+			want:     "Failed to find session",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", tt.threadTS, "", "status", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			if got := fake.lastMessage(t); !strings.Contains(got, tt.want) {
+				t.Errorf("reply = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleLogsCommand(t *testing.T) {
+	logDir := t.TempDir()
+	h, database, fake := newTestHandlerWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.LogDir = logDir
+	})
+	h.SetAdminUserIDs([]string{"UADMIN"})
+	ctx := context.Background()
+
+	admin := createTestUser(t, h, "UADMIN")
+	owner := createTestUser(t, h, "UOWNER")
+	createTestSession(t, database, owner, "logs-feature", "1234567890.123456", 0)
+
+	for i := 1; i <= 5; i++ {
+		if err := logging.AppendSessionLog(logDir, "logs-feature", fmt.Sprintf("output line %d", i)); err != nil {
+			t.Fatalf("Failed to write session log: %v", err)
+		}
+	}
+	if err := logging.AppendSessionLog(logDir, "logs-feature", "export ANTHROPIC_API_KEY=sk-ant-secret123"); err != nil {
+		t.Fatalf("Failed to write session log: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		user      *models.User
+		args      []string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name: "non-admin rejected",
+			user: owner,
+			args: []string{"logs-feature"},
+			want: []string{"Only admins can view session logs"},
+		},
+		{
+			name:      "admin tails last lines redacted",
+			user:      admin,
+			args:      []string{"logs-feature", "2"},
+			want:      []string{"Last 2 log lines", "output line 5", "ANTHROPIC_API_KEY=[REDACTED]"},
+			wantNotIn: []string{"output line 4", "sk-ant-secret123"},
+		},
+		{
+			name: "path traversal rejected",
+			user: admin,
+			args: []string{"../../etc/passwd"},
+			want: []string{"invalid feature name"},
+		},
+		{
+			name: "unknown session",
+			user: admin,
+			args: []string{"missing-feature"},
+			want: []string{"Failed to read session log"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", "", "", "logs", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			got := fake.lastMessage(t)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("reply = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.wantNotIn {
+				if strings.Contains(got, notWant) {
+					t.Errorf("reply = %q, must not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleListCommandPages(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	for i := 1; i <= 23; i++ {
+		createTestSession(t, database, owner, fmt.Sprintf("feature-%02d", i), fmt.Sprintf("1234567890.%06d", i), 0)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name:      "first page has the newest sessions",
+			args:      nil,
+			want:      []string{"Active Sessions (23)", "feature-23", "feature-14", "Page 1 of 3", "list --page 2"},
+			wantNotIn: []string{"feature-13"},
+		},
+		{
+			name:      "last page is partial",
+			args:      []string{"--page", "3"},
+			want:      []string{"feature-03", "feature-01", "Page 3 of 3"},
+			wantNotIn: []string{"feature-04", "list --page"},
+		},
+		{
+			name: "past the last page",
+			args: []string{"--page", "4"},
+			want: []string{"page 4 doesn't exist", "3 page(s)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, owner, "C123456", "", "", "list", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			got := fake.lastMessage(t)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("reply = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.wantNotIn {
+				if strings.Contains(got, notWant) {
+					t.Errorf("reply = %q, must not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleListAllCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	h.SetAdminUserIDs([]string{"UADMIN"})
+	ctx := context.Background()
+
+	admin := createTestUser(t, h, "UADMIN")
+	alice := createTestUser(t, h, "UALICE")
+	bob := createTestUser(t, h, "UBOB")
+	createTestSession(t, database, alice, "alice-feature", "1234567890.000001", 1.25)
+	createTestSession(t, database, bob, "bob-feature", "1234567890.000002", 0.5)
+
+	tests := []struct {
+		name      string
+		user      *models.User
+		args      []string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name:      "non-admin rejected",
+			user:      alice,
+			args:      []string{"--all"},
+			want:      []string{"You are not authorized."},
+			wantNotIn: []string{"bob-feature"},
+		},
+		{
+			name: "admin sees every session",
+			user: admin,
+			args: []string{"--all"},
+			want: []string{"All Active Sessions (2)", "alice-feature", "<@UALICE>", "$1.2500", "bob-feature", "<@UBOB>", "$0.5000"},
+		},
+		{
+			name:      "without --all only own sessions",
+			user:      alice,
+			args:      nil,
+			want:      []string{"alice-feature"},
+			wantNotIn: []string{"bob-feature"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", "", "", "list", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			got := fake.lastMessage(t)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("reply = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.wantNotIn {
+				if strings.Contains(got, notWant) {
+					t.Errorf("reply = %q, must not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleHistoryCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	session := createTestSession(t, database, owner, "history-feature", "1234567890.123456", 0)
+	for i, message := range []struct{ direction, content string }{
+		{models.MessageDirectionUserToClaude, "first request"},
+		{models.MessageDirectionClaudeToUser, "first reply"},
+		{models.MessageDirectionUserToClaude, "second request"},
+	} {
+		if err := database.CreateSessionMessage(ctx, session.ID, fmt.Sprintf("ts-%d", i), message.direction, message.content); err != nil {
+			t.Fatalf("Failed to record message: %v", err)
+		}
+	}
+
+	if err := h.handleCommand(ctx, owner, "C123456", "1234567890.123456", "", "history", []string{"--limit", "2"}); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	got := fake.lastMessage(t)
+	if strings.Contains(got, "first request") {
+		t.Errorf("reply = %q, want only the last 2 messages", got)
+	}
+	reply, request := strings.Index(got, "← *Claude*"), strings.Index(got, "→ *You*")
+	if reply < 0 || request < reply || !strings.Contains(got, "first reply") || !strings.Contains(got, "second request") {
+		t.Errorf("reply = %q, want the last 2 messages oldest first", got)
+	}
+
+	if err := h.handleCommand(ctx, owner, "C999999", "", "", "history", nil); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	if got := fake.lastMessage(t); !strings.Contains(got, "No active session") {
+		t.Errorf("reply = %q, want no active session", got)
+	}
+}
+
+func TestHandleRestartCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	h, database, fake := newTestHandler(t)
+	h.runAsync = func(f func()) { f() }
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	stranger := createTestUser(t, h, "USTRANGER")
+
+	// Setup against a repository that doesn't exist fails again, which
+	// exercises the restart path without network access
+	setupRequest, err := json.Marshal(&models.CreateSessionRequest{
+		WorkspaceID:     owner.SlackWorkspaceID,
+		CreatedByUserID: owner.ID,
+		ChannelID:       "C123456",
+		RepoURL:         "file://" + filepath.Join(t.TempDir(), "missing-repo"),
+		FromCommitish:   "main",
+		ModelName:       models.ModelSonnet,
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode setup request: %v", err)
+	}
+
+	newSession := func(feature, threadTS, status string) *models.Session {
+		s := createTestSession(t, database, owner, feature, threadTS, 0)
+		if err := database.UpdateSessionStatusByID(ctx, s.ID, status); err != nil {
+			t.Fatalf("Failed to set session status: %v", err)
+		}
+		if err := database.SaveSessionSetupRequest(ctx, s.ID, string(setupRequest)); err != nil {
+			t.Fatalf("Failed to save setup request: %v", err)
+		}
+		return s
+	}
+
+	newSession("errored-feature", "1111111111.111111", models.SessionStatusError)
+	newSession("active-feature", "2222222222.222222", models.SessionStatusActive)
+	newSession("ending-feature", "3333333333.333333", models.SessionStatusEnding)
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		threadTS   string
+		args       []string
+		want       string
+		feature    string // session whose status is checked afterwards
+		wantStatus string
+	}{
+		{
+			name:       "not the owner",
+			user:       stranger,
+			threadTS:   "1111111111.111111",
+			want:       "You can only restart your own sessions",
+			feature:    "errored-feature",
+			wantStatus: models.SessionStatusError,
+		},
+		{
+			name:       "active session",
+			user:       owner,
+			threadTS:   "9999999999.999999",
+			args:       []string{"--feat", "active-feature"},
+			want:       "use `stop` before restarting it",
+			feature:    "active-feature",
+			wantStatus: models.SessionStatusActive,
+		},
+		{
+			name:       "ending session",
+			user:       owner,
+			threadTS:   "3333333333.333333",
+			want:       "can't be restarted right now",
+			feature:    "ending-feature",
+			wantStatus: models.SessionStatusEnding,
+		},
+		{
+			name:     "no session in thread",
+			user:     owner,
+			threadTS: "9999999999.999999",
+			want:     "No session in this channel/thread",
+		},
+		{
+			name:       "errored session in thread",
+			user:       owner,
+			threadTS:   "1111111111.111111",
+			want:       "Repository setup failed",
+			feature:    "errored-feature",
+			wantStatus: models.SessionStatusError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", tt.threadTS, "", "restart", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			if got := fake.lastMessage(t); !strings.Contains(got, tt.want) {
+				t.Errorf("reply = %q, want it to contain %q", got, tt.want)
+			}
+			if tt.feature == "" {
+				return
+			}
+			s, err := database.GetSessionByBranchName(ctx, tt.user.SlackWorkspaceID, "", tt.feature)
+			if err != nil {
+				t.Fatalf("GetSessionByBranchName() error = %v", err)
+			}
+			if s.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", s.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandlePRCommand(t *testing.T) {
+	var gotRequest map[string]string
+	var gotAuth string
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/test/repo/pulls" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAuth = r.Header.Get("Authorization")
+		if gotAuth == "Bearer ghp_readonly" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "Resource not accessible by personal access token"}`))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&gotRequest)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url": "https://github.com/test/repo/pull/42"}`))
+	}))
+	t.Cleanup(github.Close)
+
+	h, database, fake := newTestHandlerWithConfig(t, func(cfg *config.Config) {
+		cfg.GitHub.APIURL = github.URL
+	})
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	readonly := createTestUser(t, h, "UREADONLY")
+	stranger := createTestUser(t, h, "USTRANGER")
+	if err := h.sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeGitHub, "ghp_owner"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+	if err := h.sessionMgr.StoreCredential(ctx, readonly.ID, models.CredentialTypeGitHub, "ghp_readonly"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	setupRequest, err := json.Marshal(&models.CreateSessionRequest{
+		RepoURL:       "https://github.com/test/repo",
+		FromCommitish: "develop",
+		FeatureName:   "pr-feature",
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode setup request: %v", err)
+	}
+
+	ended := createTestSession(t, database, owner, "pr-feature", "1111111111.111111", 0)
+	if err := database.UpdateSessionStatusByID(ctx, ended.ID, models.SessionStatusEnded); err != nil {
+		t.Fatalf("Failed to set session status: %v", err)
+	}
+	if err := database.SaveSessionSetupRequest(ctx, ended.ID, string(setupRequest)); err != nil {
+		t.Fatalf("Failed to save setup request: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, ended.ID, readonly.ID, models.SessionRoleCollaborator); err != nil {
+		t.Fatalf("Failed to add collaborator: %v", err)
+	}
+	createTestSession(t, database, owner, "pr-active", "2222222222.222222", 0)
+
+	gitlab := &models.Session{
+		SessionID:        "claude-pr-gitlab",
+		SlackWorkspaceID: owner.SlackWorkspaceID,
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "3333333333.333333",
+		RepoURL:          "https://gitlab.com/test/repo",
+		BranchName:       "pr-gitlab",
+		WorkTreePath:     "/tmp/pr-gitlab",
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusEnded,
+	}
+	if err := database.CreateSession(ctx, gitlab); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, gitlab.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		threadTS string
+		args     []string
+		want     string
+	}{
+		{
+			name:     "not a member",
+			user:     stranger,
+			threadTS: "1111111111.111111",
+			want:     "You can only open pull requests for sessions you're part of",
+		},
+		{
+			name:     "active session",
+			user:     owner,
+			threadTS: "2222222222.222222",
+			want:     "use `stop` first",
+		},
+		{
+			name:     "not on github",
+			user:     owner,
+			threadTS: "3333333333.333333",
+			want:     "only be opened for repositories on github.com",
+		},
+		{
+			name:     "token without scope",
+			user:     readonly,
+			threadTS: "1111111111.111111",
+			want:     "needs the `repo` scope",
+		},
+		{
+			name:     "opened",
+			user:     owner,
+			threadTS: "1111111111.111111",
+			want:     "Opened a pull request for 'pr-feature': <https://github.com/test/repo/pull/42>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", tt.threadTS, "", "pr", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			if got := fake.lastMessage(t); !strings.Contains(got, tt.want) {
+				t.Errorf("reply = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+
+	// The base defaults to the branch the session started from
+	want := map[string]string{"title": "pr-feature", "head": "pr-feature", "base": "develop"}
+	for key, value := range want {
+		if gotRequest[key] != value {
+			t.Errorf("pull request %s = %q, want %q", key, gotRequest[key], value)
+		}
+	}
+	if gotAuth != "Bearer ghp_owner" {
+		t.Errorf("Authorization = %q, want the owner's token", gotAuth)
+	}
+}
+
+func TestHandlePromptCommands(t *testing.T) {
+	h, _, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	author := createTestUser(t, h, "UAUTHOR")
+	other := createTestUser(t, h, "UOTHER")
+
+	steps := []struct {
+		name      string
+		user      *models.User
+		command   string
+		args      string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name:    "empty list",
+			user:    other,
+			command: "prompts",
+			want:    []string{"No system prompts yet"},
+		},
+		{
+			name:    "create public",
+			user:    author,
+			command: "prompt",
+			args:    `create --name reviewer --desc "Strict reviewer" --public Review every change carefully.`,
+			want:    []string{"Created public system prompt `reviewer`"},
+		},
+		{
+			name:    "create private",
+			user:    author,
+			command: "prompt",
+			args:    "create --name scratch Notes to self.",
+			want:    []string{"Created private system prompt `scratch`"},
+		},
+		{
+			name:    "duplicate name",
+			user:    author,
+			command: "prompt",
+			args:    "create --name reviewer Something else.",
+			want:    []string{"already exists"},
+		},
+		{
+			name:      "list shows public prompts to others",
+			user:      other,
+			command:   "prompts",
+			want:      []string{"`reviewer` - Strict reviewer _(public)_"},
+			wantNotIn: []string{"scratch"},
+		},
+		{
+			name:    "list marks own prompts",
+			user:    author,
+			command: "prompts",
+			want:    []string{"`reviewer` - Strict reviewer _(public, yours)_", "`scratch` _(yours)_"},
+		},
+		{
+			name:    "show",
+			user:    other,
+			command: "prompt",
+			args:    "show --name reviewer",
+			want:    []string{"*reviewer* _(public)_", "Review every change carefully."},
+		},
+		{
+			name:    "show private prompt of another user",
+			user:    other,
+			command: "prompt",
+			args:    "show --name scratch",
+			want:    []string{"system prompt not found"},
+		},
+		{
+			name:    "delete by non-creator",
+			user:    other,
+			command: "prompt",
+			args:    "delete --name reviewer",
+			want:    []string{"only the creator of 'reviewer' can delete it"},
+		},
+		{
+			name:    "delete by creator",
+			user:    author,
+			command: "prompt",
+			args:    "delete --name reviewer",
+			want:    []string{"Deleted system prompt `reviewer`"},
+		},
+		{
+			name:      "deleted prompt is gone",
+			user:      author,
+			command:   "prompts",
+			want:      []string{"scratch"},
+			wantNotIn: []string{"reviewer"},
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, step.user, "C123456", "", "", step.command, strings.Fields(step.args)); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			got := fake.lastMessage(t)
+			for _, want := range step.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("reply = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range step.wantNotIn {
+				if strings.Contains(got, notWant) {
+					t.Errorf("reply = %q, must not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleFreezeCommands(t *testing.T) {
+	h, _, fake := newTestHandler(t)
+	h.SetAdminUserIDs([]string{"UADMIN"})
+	ctx := context.Background()
+
+	admin := createTestUser(t, h, "UADMIN")
+	user := createTestUser(t, h, "UUSER")
+
+	steps := []struct {
+		name    string
+		user    *models.User
+		command string
+		args    string
+		want    string
+	}{
+		{
+			name:    "non-admin can't freeze",
+			user:    user,
+			command: "freeze",
+			want:    "Only admins can freeze or unfreeze Claude usage",
+		},
+		{
+			name:    "admin freezes",
+			user:    admin,
+			command: "freeze",
+			want:    "Claude usage is frozen",
+		},
+		{
+			name:    "start rejected while frozen",
+			user:    user,
+			command: "start",
+			args:    "--repo https://github.com/test/repo --from main --feat frozen-feature",
+			want:    models.ErrCodeSpendFrozen,
+		},
+		{
+			name:    "admin unfreezes",
+			user:    admin,
+			command: "unfreeze",
+			want:    "Claude usage is unfrozen",
+		},
+		{
+			name:    "start proceeds after unfreeze",
+			user:    user,
+			command: "start",
+			args:    "--repo https://github.com/test/repo --from main --feat frozen-feature",
+			want:    "Missing required credentials",
+		},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, step.user, "C123456", "", "", step.command, strings.Fields(step.args)); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			if got := fake.lastMessage(t); !strings.Contains(got, step.want) {
+				t.Errorf("reply = %q, want it to contain %q", got, step.want)
+			}
+		})
+	}
+}
+
+func TestSendMessageChunksLongText(t *testing.T) {
+	h, _, fake := newTestHandler(t)
+
+	var text strings.Builder
+	for i := 0; text.Len() < 10*1024; i++ {
+		fmt.Fprintf(&text, "Line %d of a long response\n", i)
+	}
+
+	if err := h.sendMessage("C123456", "", text.String()); err != nil {
+		t.Fatalf("sendMessage() error = %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.messages) < 3 {
+		t.Fatalf("posted %d messages, want the text in several chunks", len(fake.messages))
+	}
+	if fake.messages[0].ThreadTS != "" {
+		t.Errorf("first chunk thread_ts = %q, want it posted to the channel", fake.messages[0].ThreadTS)
+	}
+	for i, message := range fake.messages {
+		if len(message.Text) > SlackChunkSize {
+			t.Errorf("chunk %d length = %d, want at most %d", i, len(message.Text), SlackChunkSize)
+		}
+		// The fake Slack API gives every message the same timestamp
+		if i > 0 && message.ThreadTS != "1700000000.000100" {
+			t.Errorf("chunk %d thread_ts = %q, want it threaded under the first chunk", i, message.ThreadTS)
+		}
+	}
+}
+
+func TestHandleMembersCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	first := createTestUser(t, h, "UFIRST")
+	second := createTestUser(t, h, "USECOND")
+	stranger := createTestUser(t, h, "USTRANGER")
+
+	s := createTestSession(t, database, owner, "members-feature", "1234567890.123456", 0)
+	for _, member := range []*models.User{first, second} {
+		if err := h.sessionMgr.JoinSession(ctx, s, member.ID, models.SessionRoleCollaborator); err != nil {
+			t.Fatalf("JoinSession() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		user      *models.User
+		threadTS  string
+		args      []string
+		want      []string
+		wantNotIn []string
+	}{
+		{
+			name:     "session in thread",
+			user:     first,
+			threadTS: "1234567890.123456",
+			want: []string{
+				"*Members of 'members-feature':*",
+				"• *uowner* - owner, joined <!date^",
+				"• *ufirst* - collaborator, joined",
+				"• *usecond* - collaborator, joined",
+			},
+		},
+		{
+			name: "named session",
+			user: owner,
+			args: []string{"--feat", "members-feature"},
+			want: []string{"*ufirst* - collaborator", "*usecond* - collaborator"},
+		},
+		{
+			name:      "non-member rejected",
+			user:      stranger,
+			args:      []string{"--feat", "members-feature"},
+			want:      []string{"You are not a member of session 'members-feature'"},
+			wantNotIn: []string{"ufirst"},
+		},
+		{
+			name: "no session in channel",
+			user: owner,
+			want: []string{"No active session in this channel/thread"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", tt.threadTS, "", "members", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			got := fake.lastMessage(t)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("reply = %q, want it to contain %q", got, want)
+				}
+			}
+			for _, notWant := range tt.wantNotIn {
+				if strings.Contains(got, notWant) {
+					t.Errorf("reply = %q, must not contain %q", got, notWant)
+				}
+			}
+		})
+	}
+
+	// Members are listed in the order they joined
+	got := fake.messages[0].Text
+	if strings.Index(got, "uowner") > strings.Index(got, "ufirst") || strings.Index(got, "ufirst") > strings.Index(got, "usecond") {
+		t.Errorf("members = %q, want them in join order", got)
+	}
+}
+
+func TestHandleShareLinkCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	stranger := createTestUser(t, h, "USTRANGER")
+	s := createTestSession(t, database, owner, "shared-feature", "1234567890.123456", 0)
+
+	if err := h.handleCommand(ctx, owner, "C123456", "1234567890.123456", "", "share-link", nil); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	if got := fake.lastMessage(t); !strings.Contains(got, "Share links aren't enabled") {
+		t.Errorf("reply = %q, want share links reported as disabled", got)
+	}
+
+	signer := share.NewSigner("test-encryption-key-that-is-32-bytes-long")
+	h.SetShareLinks(signer, "https://bot.example.com/", time.Hour)
+
+	if err := h.handleCommand(ctx, owner, "C123456", "1234567890.123456", "", "share-link", nil); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	got := fake.lastMessage(t)
+	prefix := "https://bot.example.com/share/"
+	i := strings.Index(got, prefix)
+	if i < 0 || !strings.Contains(got, "Read-only link to session 'shared-feature' (expires <!date^") {
+		t.Fatalf("reply = %q, want a share link for shared-feature", got)
+	}
+	sessionID, err := signer.Verify(got[i+len(prefix):])
+	if err != nil {
+		t.Fatalf("Verify() of the posted token error = %v", err)
+	}
+	if sessionID != s.ID {
+		t.Errorf("token grants session %d, want %d", sessionID, s.ID)
+	}
+
+	if err := h.handleCommand(ctx, stranger, "C123456", "", "", "share-link", []string{"--feat", "shared-feature"}); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	if got := fake.lastMessage(t); !strings.Contains(got, "You are not a member of session 'shared-feature'") || strings.Contains(got, prefix) {
+		t.Errorf("reply = %q, want non-members rejected", got)
+	}
+}
+
+func TestHandleInterruptCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	stranger := createTestUser(t, h, "USTRANGER")
+	createTestSession(t, database, owner, "interrupt-feature", "1234567890.123456", 0)
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		threadTS string
+		args     []string
+		want     string
+	}{
+		{
+			name:     "nothing running",
+			user:     owner,
+			threadTS: "1234567890.123456",
+			want:     "Claude isn't working on anything in session 'interrupt-feature'",
+		},
+		{
+			name: "non-member rejected",
+			user: stranger,
+			args: []string{"--feat", "interrupt-feature"},
+			want: "You are not a member of session 'interrupt-feature'",
+		},
+		{
+			name: "no session in channel",
+			user: owner,
+			want: "No active session in this channel/thread",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := h.handleCommand(ctx, tt.user, "C123456", tt.threadTS, "", "interrupt", tt.args); err != nil {
+				t.Fatalf("handleCommand() error = %v", err)
+			}
+			if got := fake.lastMessage(t); !strings.Contains(got, tt.want) {
+				t.Errorf("reply = %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleCredentialsConnect(t *testing.T) {
+	h, _, fake := newTestHandler(t)
+	ctx := context.Background()
+	user := createTestUser(t, h, "UOWNER")
+
+	// Without GitHub OAuth configured, users are told to paste a token
+	if err := h.handleCommand(ctx, user, "D123456", "", "", "credentials", []string{"connect", "github"}); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	if got := fake.lastMessage(t); !strings.Contains(got, "isn't set up") {
+		t.Errorf("reply = %q, want connecting to be unavailable", got)
+	}
+
+	signer := oauth.NewStateSigner("test-encryption-key-that-is-32-bytes-long")
+	h.SetGitHubConnect(signer, "https://bot.example.com")
+	if err := h.handleCommand(ctx, user, "C123456", "", "", "credentials", []string{"connect", "github"}); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.ephemerals) != 1 || fake.ephemerals[0].User != "UOWNER" {
+		t.Fatalf("ephemeral messages = %v, want the connect link for UOWNER", fake.ephemerals)
+	}
+	text := fake.ephemerals[0].Text
+	const prefix = "<https://bot.example.com/oauth/github/start?state="
+	if !strings.HasPrefix(text, prefix) {
+		t.Fatalf("link message = %q, want a connect link", text)
+	}
+	state, err := url.QueryUnescape(text[len(prefix):strings.Index(text, "|")])
+	if err != nil {
+		t.Fatalf("bad state in %q: %v", text, err)
+	}
+	if userID, err := signer.Verify(state); err != nil || userID != user.ID {
+		t.Errorf("link's state is for user %d (%v), want %d", userID, err, user.ID)
+	}
+}
+
+func TestHandleWhoamiCommand(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+	user := createTestUser(t, h, "UOWNER")
+	createTestSession(t, database, user, "whoami-feature", "1234567890.000001", 1.25)
+
+	if err := h.handleCommand(ctx, user, "C123456", "", "", "whoami", nil); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	got := fake.lastMessage(t)
+	for _, want := range []string{
+		"uowner (`UOWNER`)",
+		"Workspace: `T123456`",
+		"Active sessions: 1",
+		"Total cost: $1.2500",
+		":x: Anthropic API key",
+		":x: GitHub token",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("reply = %q, want it to contain %q", got, want)
+		}
+	}
+
+	if err := h.sessionMgr.StoreCredential(ctx, user.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+	if err := h.handleCommand(ctx, user, "C123456", "", "", "whoami", nil); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	got = fake.lastMessage(t)
+	if !strings.Contains(got, ":white_check_mark: Anthropic API key") || !strings.Contains(got, ":x: GitHub token") {
+		t.Errorf("reply = %q, want the Anthropic key present and the GitHub token missing", got)
+	}
+	if strings.Contains(got, "sk-ant-test") {
+		t.Errorf("reply = %q, want the credential's value left out", got)
+	}
+}
+
+func TestErrorMessageIncludesRequestID(t *testing.T) {
+	h, _, fake := newTestHandler(t)
+	owner := createTestUser(t, h, "UOWNER")
+
+	var out bytes.Buffer
+	logging.SetOutput(&out)
+	t.Cleanup(func() { logging.SetOutput(os.Stdout) })
+
+	ctx := logging.WithRequestID(context.Background(), "req-abc123")
+	if err := h.handleCommand(ctx, owner, "C123456", "", "", "stop", nil); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+
+	if got := fake.lastMessage(t); !strings.Contains(got, "(request ID: req-abc123)") {
+		t.Errorf("reply = %q, want it to quote the request ID", got)
+	}
+	if !strings.Contains(out.String(), "request_id req-abc123") {
+		t.Errorf("log output = %q, want the request ID", out.String())
+	}
+}
+
+func TestHandleStartCommandRecordsMetrics(t *testing.T) {
+	h, _, _ := newTestHandler(t)
+	h.runAsync = func(func()) {} // setup isn't under test
+	ctx := context.Background()
+
+	m := metrics.NewMetricsWithRegisterer(prometheus.NewRegistry())
+	h.SetMetrics(m)
+	h.sessionMgr.SetMetrics(m)
+
+	owner := createTestUser(t, h, "UOWNER")
+	for credentialType, value := range map[string]string{
+		models.CredentialTypeAnthropic: "sk-ant-test",
+		models.CredentialTypeGitHub:    "ghp_test",
+	} {
+		if err := h.sessionMgr.StoreCredential(ctx, owner.ID, credentialType, value); err != nil {
+			t.Fatalf("Failed to store credential: %v", err)
+		}
+	}
+
+	args := strings.Fields("--repo https://github.com/test/repo --from main --feat metrics-feature")
+	if err := h.handleCommand(ctx, owner, "C123456", "", "1700000000.000001", "start", args); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+
+	if got := testutil.ToFloat64(m.CommandsProcessed.WithLabelValues("start", "success")); got != 1 {
+		t.Errorf(`cb_commands_processed_total{command="start"} = %v, want 1`, got)
+	}
+	if got := testutil.ToFloat64(m.SessionsCreated); got != 1 {
+		t.Errorf("cb_sessions_created_total = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.ActiveSessions); got != 1 {
+		t.Errorf("cb_active_sessions = %v, want 1", got)
+	}
+
+	// A start that fails is reported as an error
+	if err := h.handleCommand(ctx, owner, "C123456", "", "1700000000.000002", "start", args); err != nil {
+		t.Fatalf("handleCommand() error = %v", err)
+	}
+	if got := testutil.ToFloat64(m.ErrorsTotal.WithLabelValues(models.ErrCodeSessionExists, "slack")); got != 1 {
+		t.Errorf(`cb_errors_total{error_type=%q} = %v, want 1`, models.ErrCodeSessionExists, got)
+	}
+}
+
+func TestHandleMessageByRole(t *testing.T) {
+	h, database, fake := newTestHandler(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, h, "UOWNER")
+	collaborator := createTestUser(t, h, "UCOLLAB")
+	viewer := createTestUser(t, h, "UVIEWER")
+	outsider := createTestUser(t, h, "UOUTSIDER")
+	session := createTestSession(t, database, owner, "role-feature", "1234567890.123456", 0)
+	if err := h.sessionMgr.JoinSession(ctx, session, collaborator.ID, models.SessionRoleCollaborator); err != nil {
+		t.Fatalf("Failed to join as collaborator: %v", err)
+	}
+	if err := h.sessionMgr.JoinSession(ctx, session, viewer.ID, models.SessionRoleViewer); err != nil {
+		t.Fatalf("Failed to join as viewer: %v", err)
+	}
+
+	// Forwarded messages reach SendToSession, which fails here because the owner has
+	// no Anthropic key, so forwarding shows up as that failure in the thread
+	tests := []struct {
+		name          string
+		user          *models.User
+		wantForwarded bool
+		wantNotice    string
+	}{
+		{name: "owner", user: owner, wantForwarded: true},
+		{name: "collaborator", user: collaborator, wantForwarded: true},
+		{name: "viewer", user: viewer, wantNotice: "viewer access"},
+		{name: "not a member", user: outsider, wantNotice: "aren't a member"},
+		{name: "user new to the bot", user: &models.User{SlackUserID: "UNEW"}, wantNotice: "aren't a member"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.mu.Lock()
+			fake.messages, fake.ephemerals = nil, nil
+			fake.mu.Unlock()
+
+			err := h.HandleMessage(ctx, &slackevents.MessageEvent{
+				User:            tt.user.SlackUserID,
+				Channel:         "C123456",
+				Text:            "Add a test",
+				TimeStamp:       "1234567890.999999",
+				ThreadTimeStamp: "1234567890.123456",
+			}, "T123456")
+			if err != nil {
+				t.Fatalf("HandleMessage() error = %v", err)
+			}
+
+			fake.mu.Lock()
+			defer fake.mu.Unlock()
+			forwarded := false
+			for _, m := range fake.messages {
+				if strings.Contains(m.Text, "Failed to process message") {
+					forwarded = true
+				}
+			}
+			if forwarded != tt.wantForwarded {
+				t.Errorf("forwarded = %v, want %v (thread messages %v)", forwarded, tt.wantForwarded, fake.messages)
+			}
+
+			if tt.wantForwarded {
+				if len(fake.ephemerals) != 0 {
+					t.Errorf("ephemeral messages = %v, want none", fake.ephemerals)
+				}
+				return
+			}
+			if len(fake.ephemerals) != 1 || fake.ephemerals[0].User != tt.user.SlackUserID ||
+				!strings.Contains(fake.ephemerals[0].Text, tt.wantNotice) {
+				t.Errorf("ephemeral messages = %v, want %q for %s", fake.ephemerals, tt.wantNotice, tt.user.SlackUserID)
+			}
+		})
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	h, _, _ := newTestHandler(t)
+	body := []byte(`{"type":"event_callback","event":{"type":"app_mention","user":"UADMIN","text":"<@UBOT123> mcp register"}}`)
+
+	// sign returns the headers Slack would send with body, signed with secret at ts
+	sign := func(secret string, ts time.Time, body []byte) http.Header {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":"))
+		mac.Write(body)
+		header := http.Header{}
+		header.Set("X-Slack-Request-Timestamp", timestamp)
+		header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+		return header
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		wantErr bool
+	}{
+		{name: "signed by Slack", header: sign("test-signing-secret", time.Now(), body), body: body},
+		{name: "unsigned", header: http.Header{}, body: body, wantErr: true},
+		{name: "wrong secret", header: sign("another-secret", time.Now(), body), body: body, wantErr: true},
+		{name: "body changed after signing", header: sign("test-signing-secret", time.Now(), body), body: []byte(`{"type":"event_callback"}`), wantErr: true},
+		{name: "replayed", header: sign("test-signing-secret", time.Now().Add(-10*time.Minute), body), body: body, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := h.VerifyRequest(tt.header, tt.body)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyRequest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package slack
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
@@ -86,8 +91,13 @@ func (cp *CommandParser) ParseCommand(text string) (string, []string, error) {
 	command := strings.ToLower(parts[0])
 	args := parts[1:]
 
+	// cancel is an alias of interrupt
+	if command == "cancel" {
+		command = "interrupt"
+	}
+
 	// Validate command
-	validCommands := []string{"start", "stop", "status", "help", "list", "credentials"}
+	validCommands := []string{"start", "stop", "status", "help", "list", "credentials", "mcp", "limits", "cost", "logs", "restart", "join", "leave", "prompts", "diff", "history", "pr", "prompt", "freeze", "unfreeze", "members", "share-link", "interrupt", "notify", "verify", "whoami"}
 	isValid := false
 	for _, valid := range validCommands {
 		if command == valid {
@@ -97,6 +107,10 @@ func (cp *CommandParser) ParseCommand(text string) (string, []string, error) {
 	}
 
 	if !isValid {
+		if suggestion, ok := closestCommand(command, validCommands); ok {
+			return "", nil, models.NewCBError(models.ErrCodeInvalidCommand,
+				fmt.Sprintf("unknown command: %s. Did you mean `%s`? Try 'help' for available commands", command, suggestion), nil)
+		}
 		return "", nil, models.NewCBError(models.ErrCodeInvalidCommand, 
 			fmt.Sprintf("unknown command: %s. Try 'help' for available commands", command), nil)
 	}
@@ -104,13 +118,57 @@ func (cp *CommandParser) ParseCommand(text string) (string, []string, error) {
 	return command, args, nil
 }
 
+// maxSuggestionDistance is the most edits a typo may be from the command it's taken for
+const maxSuggestionDistance = 2
+
+// closestCommand returns the command nearest to an unknown one, if it's within
+// maxSuggestionDistance edits. The distance must also be less than the unknown
+// command's length, so a short word isn't taken for an unrelated command.
+func closestCommand(command string, commands []string) (string, bool) {
+	best, bestDistance := "", maxSuggestionDistance+1
+	for _, candidate := range commands {
+		if d := levenshtein(command, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	if best == "" || bestDistance >= len([]rune(command)) {
+		return "", false
+	}
+	return best, true
+}
+
+// levenshtein returns the number of single-character insertions, deletions and
+// substitutions needed to turn a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
 // ParseCredentialCommand parses credential-related commands
 // Format: credentials set <type> <value>
 // Format: credentials list
+// Format: credentials delete <type>
+// Format: credentials connect github
 func ParseCredentialCommand(args []string) (string, string, string, error) {
 	if len(args) == 0 {
 		return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand, 
-			"usage: credentials <set|list> [type] [value]", nil)
+			"usage: credentials <set|list|delete|connect> [type] [value]", nil)
 	}
 
 	action := strings.ToLower(args[0])
@@ -136,14 +194,203 @@ func ParseCredentialCommand(args []string) (string, string, string, error) {
 			return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand, 
 				"credential value cannot be empty", nil)
 		}
+		if err := validateCredentialFormat(credType, value); err != nil {
+			return "", "", "", err
+		}
 		
 		return action, credType, value, nil
+	case "delete":
+		if len(args) != 2 {
+			return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand,
+				"usage: credentials delete <type>", nil)
+		}
+		credType := strings.ToLower(args[1])
+		if credType != models.CredentialTypeAnthropic && credType != models.CredentialTypeGitHub {
+			return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand,
+				"credential type must be 'anthropic' or 'github'", nil)
+		}
+
+		return action, credType, "", nil
+	case "connect":
+		// Only GitHub has an OAuth flow
+		if len(args) > 2 || (len(args) == 2 && strings.ToLower(args[1]) != models.CredentialTypeGitHub) {
+			return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand,
+				"usage: credentials connect github", nil)
+		}
+		return action, models.CredentialTypeGitHub, "", nil
 	default:
 		return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand, 
-			"credential action must be 'set' or 'list'", nil)
+			"credential action must be 'set', 'list', 'delete' or 'connect'", nil)
+	}
+}
+
+// githubTokenRegex matches GitHub personal access, OAuth, user-to-server and
+// server-to-server tokens, fine-grained personal access tokens and 40-hex classic tokens
+var githubTokenRegex = regexp.MustCompile(`^(gh[pous]_[A-Za-z0-9]+|github_pat_[A-Za-z0-9_]+|[0-9a-fA-F]{40})$`)
+
+// validateCredentialFormat checks that value looks like a credential of credType, so
+// a token pasted into the wrong slot is caught before it's stored
+func validateCredentialFormat(credType, value string) error {
+	switch credType {
+	case models.CredentialTypeAnthropic:
+		if strings.HasPrefix(value, "sk-ant-") && len(value) > len("sk-ant-") {
+			return nil
+		}
+		if githubTokenRegex.MatchString(value) {
+			return models.NewCBError(models.ErrCodeInvalidCommand,
+				"that looks like a GitHub token; use `credentials set github <token>`", nil)
+		}
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			"that doesn't look like an Anthropic API key, which starts with `sk-ant-`", nil)
+	case models.CredentialTypeGitHub:
+		if githubTokenRegex.MatchString(value) {
+			return nil
+		}
+		if strings.HasPrefix(value, "sk-ant-") {
+			return models.NewCBError(models.ErrCodeInvalidCommand,
+				"that looks like an Anthropic API key; use `credentials set anthropic <key>`", nil)
+		}
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			"that doesn't look like a GitHub token, which starts with `ghp_`, `gho_`, `ghu_`, `ghs_` or `github_pat_`, or is 40 hex characters", nil)
+	default:
+		return models.NewCBError(models.ErrCodeInvalidCommand,
+			"credential type must be 'anthropic' or 'github'", nil)
+	}
+}
+
+// ParseMCPCommand parses MCP server commands
+// Format: mcp list
+// Format: mcp register <name> <json-config>
+func ParseMCPCommand(args []string) (string, string, string, error) {
+	if len(args) == 0 {
+		return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand,
+			"usage: mcp <list|register> [name] [config]", nil)
+	}
+
+	action := strings.ToLower(args[0])
+
+	switch action {
+	case "list":
+		return action, "", "", nil
+	case "register":
+		if len(args) < 3 {
+			return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand,
+				"usage: mcp register <name> <json-config>", nil)
+		}
+		name := args[1]
+		// Slack rewrites straight quotes as smart quotes, which breaks JSON
+		config := strings.NewReplacer("“", "\"", "”", "\"", "‘", "'", "’", "'").Replace(strings.Join(args[2:], " "))
+
+		if matched, _ := regexp.MatchString(`^[a-zA-Z0-9_-]+$`, name); !matched {
+			return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand,
+				"MCP server name may only contain letters, digits, '-' and '_'", nil)
+		}
+
+		return action, name, config, nil
+	default:
+		return "", "", "", models.NewCBError(models.ErrCodeInvalidCommand,
+			"MCP action must be 'list' or 'register'", nil)
 	}
 }
 
+// ParsePromptsCommand parses system prompt commands
+// Format: prompts [list]
+// Format: prompts import <url> [--public]
+func ParsePromptsCommand(args []string) (string, string, bool, error) {
+	if len(args) == 0 {
+		return "list", "", false, nil
+	}
+
+	action := strings.ToLower(args[0])
+
+	switch action {
+	case "list":
+		if len(args) > 1 {
+			return "", "", false, models.NewCBError(models.ErrCodeInvalidCommand, "usage: prompts [list]", nil)
+		}
+		return action, "", false, nil
+	case "import":
+		usage := models.NewCBError(models.ErrCodeInvalidCommand, "usage: prompts import <url> [--public]", nil)
+		var libraryURL string
+		var public bool
+		for _, arg := range args[1:] {
+			switch {
+			case arg == "--public":
+				public = true
+			case libraryURL == "":
+				libraryURL = unwrapSlackLink(arg)
+			default:
+				return "", "", false, usage
+			}
+		}
+		if libraryURL == "" {
+			return "", "", false, usage
+		}
+		return action, libraryURL, public, nil
+	default:
+		return "", "", false, models.NewCBError(models.ErrCodeInvalidCommand,
+			"prompts action must be 'list' or 'import'", nil)
+	}
+}
+
+// unwrapSlackLink turns Slack's <url> or <url|label> link markup back into the URL
+func unwrapSlackLink(text string) string {
+	if strings.HasPrefix(text, "<") && strings.HasSuffix(text, ">") {
+		text = strings.TrimSuffix(strings.TrimPrefix(text, "<"), ">")
+		if i := strings.Index(text, "|"); i >= 0 {
+			text = text[:i]
+		}
+	}
+	return text
+}
+
+// Default and maximum number of lines returned by the logs command
+const (
+	DefaultLogLines = 50
+	MaxLogLines     = 500
+)
+
+// ListPageSize is the number of sessions shown per page by the list command
+const ListPageSize = 10
+
+// Default and maximum number of messages shown by the history command, and how much of
+// each message is shown
+const (
+	DefaultHistoryMessages = 20
+	MaxHistoryMessages     = 100
+	HistoryContentLength   = 300
+)
+
+// ParseLogsCommand parses the logs command
+// Format: logs <feature> [lines]
+func ParseLogsCommand(args []string) (string, int, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return "", 0, models.NewCBError(models.ErrCodeInvalidCommand,
+			"usage: logs <feature> [lines]", nil)
+	}
+
+	feature := args[0]
+	if err := ValidateFeatureName(feature); err != nil {
+		return "", 0, models.NewCBError(models.ErrCodeInvalidCommand,
+			fmt.Sprintf("invalid feature name: %v", err), nil)
+	}
+
+	lines := DefaultLogLines
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n <= 0 {
+			return "", 0, models.NewCBError(models.ErrCodeInvalidCommand,
+				"number of lines must be a positive integer", nil)
+		}
+		if n > MaxLogLines {
+			n = MaxLogLines
+		}
+		lines = n
+	}
+
+	return feature, lines, nil
+}
+
 // IsDirectMention checks if the message is a direct mention of the bot
 func (cp *CommandParser) IsDirectMention(text string) bool {
 	mentionPattern := fmt.Sprintf(`<@%s>`, cp.botUserID)
@@ -264,6 +511,18 @@ func isValidBranchName(name string) bool {
 	return true
 }
 
+// FormatNotifyPreference describes a notification preference
+func FormatNotifyPreference(notify string) string {
+	switch notify {
+	case models.NotifyOff:
+		return "You won't be @-mentioned on events in your sessions"
+	case models.NotifyMentions:
+		return "You'll be @-mentioned on budget alerts and errors in your sessions"
+	default:
+		return "You'll be @-mentioned on events in your sessions: completion, budget alerts and errors"
+	}
+}
+
 // FormatHelpMessage returns a formatted help message
 func FormatHelpMessage() string {
 	return "*Claude Bot Commands:*\n\n" +
@@ -271,13 +530,40 @@ func FormatHelpMessage() string {
 		"  • `repo-url`: GitHub, GitLab, or other Git repository URL\n" +
 		"  • `branch`: Branch name (defaults to 'main')\n" +
 		"  • `--thread`: Start session in a thread (optional)\n\n" +
-		"• `stop` - End the current session in this channel/thread\n\n" +
-		"• `status` - Show current session status\n\n" +
-		"• `list` - List your active sessions\n\n" +
+		"• `stop [--message \"<commit message>\"]` - End the current session in this channel/thread, committing its changes with the given message\n\n" +
+		"• `interrupt [--feat <name>]` (or `cancel`) - Stop Claude's current turn without ending the session, to give new instructions\n\n" +
+		"• `join --feat <name> [--role collaborator|viewer]` - Join another user's session (defaults to collaborator)\n\n" +
+		"• `leave [--feat <name>]` - Leave a session; an owner's session passes to the longest-standing member, or stops if they're the last one\n\n" +
+		"• `restart [--feat <name>]` - Re-run setup for your errored or ended session in this channel/thread or a named one\n\n" +
+		"• `pr [--title \"<title>\"] [--base <branch>] [--feat <name>]` - Open a GitHub pull request for a stopped session's branch\n\n" +
+		"• `status [--feat <name>]` - Show the status of the session in this channel/thread or of any of your sessions by name\n\n" +
+		"• `list [--page N]` - List your active sessions, 10 per page\n" +
+		"• `list --all` - List every active session with its owner and cost (admins only)\n\n" +
+		"• `diff` - Show the uncommitted changes in the session in this channel/thread\n\n" +
+		"• `history [--limit N]` - Show the last N messages exchanged with Claude in this channel/thread's session (requires LOG_MESSAGES)\n\n" +
 		"• `credentials set <type> <value>` - Set API credentials\n" +
 		"  • `type`: 'anthropic' or 'github'\n" +
 		"  • `value`: Your API key/token\n\n" +
+		"• `credentials connect github` - Get a link to connect your GitHub account instead of pasting a token, if the server allows it\n\n" +
 		"• `credentials list` - List your stored credential types\n\n" +
+		"• `credentials delete <type>` - Remove a stored credential, e.g. one that has leaked\n\n" +
+		"• `members [--feat <name>]` - List the members of the session in this channel/thread or of a named session\n\n" +
+		"• `share-link [--feat <name>]` - Get an expiring read-only link to a session's status for people outside Slack\n\n" +
+		"• `cost [--feat <name>]` - Show the running cost of the session in this channel/thread or of a named session\n\n" +
+		"• `cost report [--since 30d] [--workspace]` - Total the cost of your sessions started in a period such as `7d` or `24h` (the whole workspace's for admins with `--workspace`)\n\n" +
+		"• `limits` - Show your session limits and usage\n\n" +
+		"• `whoami` - Show your account, credentials, sessions and cost\n\n" +
+		"• `notify [on|off|mentions]` - Show or set when you're @-mentioned on events in your sessions: always, never, or only for budget alerts and errors\n\n" +
+		"• `mcp list` - List registered MCP servers and their status in this session\n\n" +
+		"• `mcp register <name> <json-config>` - Register an MCP server (admins only)\n\n" +
+		"• `prompts` - List the system prompts you can use with `--pname`\n\n" +
+		"• `prompt create --name <name> [--desc \"<description>\"] [--public] <content...>` - Create a system prompt\n\n" +
+		"• `prompt show --name <name>` - Show a system prompt\n\n" +
+		"• `prompt delete --name <name>` - Delete a system prompt you created\n\n" +
+		"• `prompts import <url> [--public]` - Import a JSON/YAML list of system prompts from a URL or gist (admins only)\n\n" +
+		"• `logs <feature> [lines]` - Show the last lines of a session's log (admins only)\n\n" +
+		"• `verify [--mark]` - Check every active session's work tree and branch still exist; `--mark` marks broken ones as errored for restart (admins only)\n\n" +
+		"• `freeze` / `unfreeze` - Block or allow all new sessions and messages to Claude (admins only)\n\n" +
 		"• `help` - Show this help message\n\n" +
 		"*Examples:*\n" +
 		"• `@cb start https://github.com/user/repo`\n" +
@@ -287,12 +573,49 @@ func FormatHelpMessage() string {
 		"*Note:* Sessions cannot be started in #general channel."
 }
 
+// slackEscaper escapes the characters Slack's mrkdwn treats as control characters
+// (&, <, >) and stops formatting characters from pairing up with each other by
+// prefixing them with a zero-width space
+var slackEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"*", "\u200b*",
+	"_", "\u200b_",
+	"~", "\u200b~",
+)
+
+// slackEntityEscaper escapes only &, < and >, which Slack parses even inside code
+var slackEntityEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// slackEscape escapes dynamic text interpolated into mrkdwn so it renders literally.
+// Backticks are left alone because messages use them for inline code.
+func slackEscape(text string) string {
+	return slackEscaper.Replace(text)
+}
+
+// slackCode formats text as inline code. Formatting isn't applied inside code, so only
+// entities are escaped and backticks, which would end the span, are replaced.
+func slackCode(text string) string {
+	return "`" + strings.ReplaceAll(slackEntityEscaper.Replace(text), "`", "'") + "`"
+}
+
+// slackLink formats an http(s) URL as a Slack link; anything else is escaped as text
+func slackLink(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(rawURL, " |") {
+		return slackEscape(rawURL)
+	}
+	return "<" + slackEntityEscaper.Replace(rawURL) + ">"
+}
+
 // FormatErrorMessage formats an error for Slack display
 func FormatErrorMessage(err error) string {
-	if cbErr, ok := err.(*models.CBError); ok {
-		return fmt.Sprintf(":x: *Error (%s):* %s", cbErr.Code, cbErr.Message)
+	var cbErr *models.CBError
+	if errors.As(err, &cbErr) {
+		return fmt.Sprintf(":x: *Error (%s):* %s", cbErr.Code, slackEscape(cbErr.Message))
 	}
-	return fmt.Sprintf(":x: *Error:* %s", err.Error())
+	return fmt.Sprintf(":x: *Error:* %s", slackEscape(err.Error()))
 }
 
 // FormatSuccessMessage formats a success message for Slack display
@@ -300,12 +623,90 @@ func FormatSuccessMessage(message string) string {
 	return fmt.Sprintf(":white_check_mark: %s", message)
 }
 
+// FormatSessionMembers formats a session's members with their roles and join times.
+// users maps user IDs to the resolved users; members missing from it are shown by ID.
+func FormatSessionMembers(session *models.Session, members []*models.SessionUser, users map[int64]*models.User) string {
+	if len(members) == 0 {
+		return fmt.Sprintf("Session '%s' has no members", slackEscape(session.BranchName))
+	}
+
+	lines := []string{fmt.Sprintf("*Members of '%s':*", slackEscape(session.BranchName))}
+	for _, member := range members {
+		name := fmt.Sprintf("user #%d", member.UserID)
+		if user, ok := users[member.UserID]; ok && user.SlackUserName != "" {
+			name = slackEscape(user.SlackUserName)
+		}
+		// Slack renders the date in each reader's timezone
+		joined := fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>",
+			member.JoinedAt.Unix(), member.JoinedAt.UTC().Format("2006-01-02 15:04 UTC"))
+		lines = append(lines, fmt.Sprintf("• *%s* - %s, joined %s", name, member.Role, joined))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// FormatAllSessions formats every active session with its owner and running cost for
+// admins. owners maps session IDs to their owners; sessions missing from it show no owner.
+func FormatAllSessions(sessions []*models.Session, owners map[int64]*models.User) string {
+	if len(sessions) == 0 {
+		return "There are no active sessions"
+	}
+
+	lines := []string{fmt.Sprintf("*All Active Sessions (%d):*", len(sessions))}
+	for _, session := range sessions {
+		owner := "unknown owner"
+		if user, ok := owners[session.ID]; ok && user.SlackUserID != "" {
+			owner = fmt.Sprintf("<@%s>", user.SlackUserID)
+		}
+		lines = append(lines, fmt.Sprintf("• *%s* in <#%s> - %s, $%.4f, %s",
+			slackEscape(session.BranchName), session.SlackChannelID, owner, session.RunningCost, slackLink(session.RepoURL)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// FormatShareLink formats a read-only share link for a session and when it expires
+func FormatShareLink(session *models.Session, link string, expiresAt time.Time) string {
+	expires := fmt.Sprintf("<!date^%d^{date_short_pretty} at {time}|%s>",
+		expiresAt.Unix(), expiresAt.UTC().Format("2006-01-02 15:04 UTC"))
+	return fmt.Sprintf(":link: Read-only link to session '%s' (expires %s):\n%s",
+		slackEscape(session.BranchName), expires, link)
+}
+
+// FormatRunningCost formats the text of a session's pinned running cost message
+func FormatRunningCost(cost float64) string {
+	return fmt.Sprintf(":moneybag: Running cost: $%.4f", cost)
+}
+
+// FormatCostReport formats the total cost of the user's or, for workspace, the
+// workspace's sessions started in the last period
+func FormatCostReport(total float64, period time.Duration, workspace bool) string {
+	whose := "Your sessions"
+	if workspace {
+		whose = "This workspace's sessions"
+	}
+	return fmt.Sprintf(":bar_chart: %s started in the last %s have cost $%.4f", whose, formatPeriod(period), total)
+}
+
+// formatPeriod formats a period in whole days where it is one, as ParsePeriod takes it
+func formatPeriod(period time.Duration) string {
+	if day := 24 * time.Hour; period%day == 0 {
+		return fmt.Sprintf("%dd", period/day)
+	}
+	return period.String()
+}
+
+// FormatSessionCost formats a session's running cost for Slack display
+func FormatSessionCost(session *models.Session) string {
+	return fmt.Sprintf(":moneybag: Session '%s' has cost $%.4f so far", slackEscape(session.BranchName), session.RunningCost)
+}
+
 // FormatSessionInfo formats session information for Slack display
 func FormatSessionInfo(info map[string]interface{}) string {
 	var parts []string
 	
 	if sessionID, ok := info["session_id"].(string); ok {
-		parts = append(parts, fmt.Sprintf("*Session ID:* %s", sessionID))
+		parts = append(parts, fmt.Sprintf("*Session ID:* %s", slackEscape(sessionID)))
 	}
 	
 	if status, ok := info["status"].(string); ok {
@@ -313,27 +714,469 @@ func FormatSessionInfo(info map[string]interface{}) string {
 		switch status {
 		case models.SessionStatusActive:
 			statusEmoji = ":green_circle:"
-		case models.SessionStatusEnding:
+		case models.SessionStatusEnding, models.SessionStatusDetached:
 			statusEmoji = ":yellow_circle:"
 		case models.SessionStatusEnded:
 			statusEmoji = ":red_circle:"
 		case models.SessionStatusError:
 			statusEmoji = ":red_circle:"
 		}
-		parts = append(parts, fmt.Sprintf("*Status:* %s %s", statusEmoji, status))
+		parts = append(parts, fmt.Sprintf("*Status:* %s %s", statusEmoji, slackEscape(status)))
 	}
 	
 	if repoURL, ok := info["repo_url"].(string); ok {
-		parts = append(parts, fmt.Sprintf("*Repository:* %s", repoURL))
+		parts = append(parts, fmt.Sprintf("*Repository:* %s", slackLink(repoURL)))
 	}
 	
 	if branch, ok := info["branch"].(string); ok {
-		parts = append(parts, fmt.Sprintf("*Branch:* %s", branch))
+		parts = append(parts, fmt.Sprintf("*Branch:* %s", slackEscape(branch)))
 	}
 	
 	if claudeStatus, ok := info["claude_status"].(string); ok {
-		parts = append(parts, fmt.Sprintf("*Claude Status:* %s", claudeStatus))
+		parts = append(parts, fmt.Sprintf("*Claude Status:* %s", slackEscape(claudeStatus)))
 	}
 	
 	return strings.Join(parts, "\n")
-}
\ No newline at end of file
+}
+
+// FormatMCPServers formats registered MCP servers alongside the statuses reported by the
+// active session's Claude process. Servers reported by Claude but not registered (e.g. from
+// the repository's own configuration) are listed too.
+func FormatMCPServers(registered []*models.MCPServer, statuses []models.MCPServerStatus) string {
+	if len(registered) == 0 && len(statuses) == 0 {
+		return "No MCP servers registered"
+	}
+
+	statusByName := make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		statusByName[status.Name] = status.Status
+	}
+
+	var parts []string
+	parts = append(parts, fmt.Sprintf("*MCP Servers (%d registered):*", len(registered)))
+
+	seen := make(map[string]bool, len(registered))
+	for _, server := range registered {
+		seen[server.Name] = true
+		status, ok := statusByName[server.Name]
+		if !ok {
+			status = "not reported"
+		}
+		parts = append(parts, fmt.Sprintf("• %s - %s", slackCode(server.Name), formatMCPStatus(status)))
+	}
+
+	for _, status := range statuses {
+		if seen[status.Name] {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("• %s (unregistered) - %s", slackCode(status.Name), formatMCPStatus(status.Status)))
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// formatMCPStatus decorates an MCP server status with an emoji
+func formatMCPStatus(status string) string {
+	switch status {
+	case "connected":
+		return ":green_circle: " + status
+	case "failed":
+		return ":red_circle: " + status
+	case "not reported":
+		return ":white_circle: " + status
+	default:
+		return ":yellow_circle: " + slackEscape(status)
+	}
+}
+
+// FormatUserLimits formats a user's usage against their limits for Slack display
+func FormatUserLimits(limits *models.UserLimits) string {
+	var parts []string
+	parts = append(parts, "*Your Limits:*")
+
+	if limits.SessionCreateLimit > 0 {
+		parts = append(parts, fmt.Sprintf("• Session starts remaining: %d of %d (per %s)",
+			limits.SessionCreatesRemaining, limits.SessionCreateLimit, formatWindow(limits.SessionCreateWindow)))
+	} else {
+		parts = append(parts, "• Session starts remaining: unlimited")
+	}
+
+	if limits.MaxSessions > 0 {
+		parts = append(parts, fmt.Sprintf("• Active sessions: %d of %d", limits.ActiveSessions, limits.MaxSessions))
+	} else {
+		parts = append(parts, fmt.Sprintf("• Active sessions: %d", limits.ActiveSessions))
+	}
+
+	parts = append(parts, fmt.Sprintf("• Total cost: $%.4f", limits.TotalCostUSD))
+
+	return strings.Join(parts, "\n")
+}
+
+// FormatWhoami formats what is known about a user for Slack display: who they are, the
+// credential lines from credentials list, and their active sessions and total cost
+func FormatWhoami(user *models.User, credentialLines []string, limits *models.UserLimits) string {
+	parts := []string{
+		"*Your Account:*",
+		fmt.Sprintf("• Slack user: %s (`%s`)", slackEscape(user.SlackUserName), user.SlackUserID),
+		fmt.Sprintf("• Workspace: `%s`", user.SlackWorkspaceID),
+		fmt.Sprintf("• Active sessions: %d", limits.ActiveSessions),
+		fmt.Sprintf("• Total cost: $%.4f", limits.TotalCostUSD),
+		"*Credentials:*",
+	}
+	return strings.Join(append(parts, credentialLines...), "\n")
+}
+
+// formatWindow formats a window length in seconds using the largest whole unit
+func formatWindow(seconds int) string {
+	switch {
+	case seconds%3600 == 0:
+		return pluralize(seconds/3600, "hour")
+	case seconds%60 == 0:
+		return pluralize(seconds/60, "minute")
+	default:
+		return pluralize(seconds, "second")
+	}
+}
+
+// pluralize formats a count with a unit, omitting the count when it is one
+func pluralize(n int, unit string) string {
+	if n == 1 {
+		return unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// FormatSessionSummary formats the summary of a stopped session for Slack display
+func FormatSessionSummary(summary *models.SessionSummary) string {
+	var parts []string
+	// Only a pushed head commit is recorded, so without one the changes weren't pushed
+	switch {
+	case summary.Commits == 0 && summary.FilesChanged == 0:
+		parts = append(parts, fmt.Sprintf("🏁 *Session '%s' stopped with no changes*", slackEscape(summary.Feature)))
+	case summary.CommitSHA == "":
+		parts = append(parts, fmt.Sprintf("🏁 *Session '%s' stopped, but its changes weren't pushed*", slackEscape(summary.Feature)))
+	default:
+		parts = append(parts, fmt.Sprintf("🏁 *Session '%s' stopped and changes pushed*", slackEscape(summary.Feature)))
+	}
+	parts = append(parts, fmt.Sprintf("• Repository: %s", slackLink(summary.RepoURL)))
+	branch := slackCode(summary.Branch)
+	if summary.CommitSHA != "" {
+		branch += " at " + slackCode(summary.CommitSHA)
+	}
+	parts = append(parts, fmt.Sprintf("• Branch: %s", branch))
+	parts = append(parts, fmt.Sprintf("• Commits: %d", summary.Commits))
+	parts = append(parts, fmt.Sprintf("• Files changed: %d (+%d/-%d lines)", summary.FilesChanged, summary.Insertions, summary.Deletions))
+	parts = append(parts, fmt.Sprintf("• Total cost: $%.4f", summary.TotalCost))
+	parts = append(parts, fmt.Sprintf("• Turns: %d", summary.Turns))
+	parts = append(parts, fmt.Sprintf("• Duration: %s", time.Duration(summary.DurationSeconds)*time.Second))
+	if summary.PRURL != "" {
+		parts = append(parts, fmt.Sprintf("• Pull request: %s", slackLink(summary.PRURL)))
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// FormatPromptImport formats the outcome of a prompt library import for Slack display
+func FormatPromptImport(result *models.PromptImportResult) string {
+	var parts []string
+	parts = append(parts, fmt.Sprintf("*Prompt import:* %d created, %d skipped", len(result.Created), len(result.Skipped)))
+
+	for _, name := range result.Created {
+		parts = append(parts, fmt.Sprintf("• ✅ %s", slackCode(name)))
+	}
+	for _, skip := range result.Skipped {
+		name := skip.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		parts = append(parts, fmt.Sprintf("• ⏭️ %s - %s", slackCode(name), slackEscape(skip.Reason)))
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// FormatSystemPrompts formats the system prompts a user can use for Slack display
+func FormatSystemPrompts(systemPrompts []*models.SystemPrompt, userID int64) string {
+	if len(systemPrompts) == 0 {
+		return "No system prompts yet. Create one with `prompt create --name <name> <content>`"
+	}
+
+	parts := []string{"*System prompts:*"}
+	for _, prompt := range systemPrompts {
+		line := fmt.Sprintf("• %s", slackCode(prompt.Name))
+		if prompt.Description != "" {
+			line += " - " + slackEscape(prompt.Description)
+		}
+
+		var tags []string
+		if prompt.IsPublic {
+			tags = append(tags, "public")
+		}
+		if prompt.CreatedBy == userID {
+			tags = append(tags, "yours")
+		}
+		if len(tags) > 0 {
+			line += fmt.Sprintf(" _(%s)_", strings.Join(tags, ", "))
+		}
+		parts = append(parts, line)
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// FormatSystemPrompt formats a single system prompt, including its content, for Slack display
+func FormatSystemPrompt(prompt *models.SystemPrompt) string {
+	header := fmt.Sprintf("*%s*", slackEscape(prompt.Name))
+	if prompt.IsPublic {
+		header += " _(public)_"
+	}
+
+	parts := []string{header}
+	if prompt.Description != "" {
+		parts = append(parts, slackEscape(prompt.Description))
+	}
+	parts = append(parts, codeBlock(prompt.Content))
+
+	return strings.Join(parts, "\n")
+}
+
+// Limits for posting diffs: Slack truncates messages at around 4000 characters, and
+// only the start of a large diff is posted
+const (
+	SlackMessageLimit = 4000
+	MaxDiffBytes      = 16 * 1024
+)
+
+// FormatTruncationNotice formats the notice posted in place of a turn's output once
+// it has reached the per-turn message cap
+func FormatTruncationNotice(omitted int) string {
+	lines := "lines"
+	if omitted == 1 {
+		lines = "line"
+	}
+	return fmt.Sprintf("✂️ _(output truncated, %d more %s)_", omitted, lines)
+}
+
+// SlackChunkSize is the size long messages are split into, leaving headroom under
+// SlackMessageLimit
+const SlackChunkSize = 3900
+
+// FormatDiff formats a diffstat and the start of a unified diff as one or more Slack
+// messages, each a code block within SlackMessageLimit
+func FormatDiff(stat, diff string) []string {
+	if strings.TrimSpace(stat) == "" && strings.TrimSpace(diff) == "" {
+		return []string{"No uncommitted changes."}
+	}
+
+	var truncated bool
+	if len(diff) > MaxDiffBytes {
+		diff = diff[:MaxDiffBytes]
+		// Don't cut a line (or a multi-byte character) in half
+		if i := strings.LastIndex(diff, "\n"); i >= 0 {
+			diff = diff[:i+1]
+		}
+		truncated = true
+	}
+
+	messages := []string{"*Uncommitted changes:*\n" + codeBlock(stat)}
+	messages = append(messages, chunkCodeBlocks(diff, SlackChunkSize)...)
+	if truncated {
+		messages = append(messages, fmt.Sprintf("_Diff truncated to the first %d KB_", MaxDiffBytes/1024))
+	}
+
+	return messages
+}
+
+// codeBlock wraps text in a Slack code block
+func codeBlock(text string) string {
+	return "```\n" + escapeCode(strings.TrimRight(text, "\n")) + "\n```"
+}
+
+// escapeCode escapes text for a Slack code block
+func escapeCode(text string) string {
+	// Backticks would end the code block early
+	return strings.ReplaceAll(slackEntityEscaper.Replace(text), "```", "` ` `")
+}
+
+// chunkCodeBlocks splits text on line boundaries into code blocks of at most limit
+// characters each. Lines longer than a whole block are split.
+func chunkCodeBlocks(text string, limit int) []string {
+	const fences = len("```\n\n```")
+	size := limit - fences
+
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			chunks = append(chunks, "```\n"+strings.TrimRight(current.String(), "\n")+"\n```")
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(strings.TrimRight(text, "\n"), "\n") {
+		line = escapeCode(line)
+		for len(line) > size {
+			flush()
+			cut := size
+			// Don't split an escaped entity or a multi-byte character
+			if i := strings.LastIndex(line[:cut], "&"); i > 0 && !strings.Contains(line[i:cut], ";") {
+				cut = i
+			}
+			for cut > 1 && !utf8.RuneStart(line[cut]) {
+				cut--
+			}
+			current.WriteString(line[:cut])
+			flush()
+			line = line[cut:]
+		}
+		if current.Len()+len(line) > size {
+			flush()
+		}
+		current.WriteString(line)
+	}
+	flush()
+
+	return chunks
+}
+
+// splitForSlack splits text on line boundaries into chunks of at most SlackChunkSize
+// characters. A code block that spans chunks is closed at the end of one chunk and
+// reopened, with its language, at the start of the next, so every chunk renders
+// on its own. Lines longer than a whole chunk are split.
+func splitForSlack(text string) []string {
+	if len(text) <= SlackChunkSize {
+		return []string{text}
+	}
+
+	// Leave room to close a code block at the end of every chunk
+	const closeFence = "\n```"
+	size := SlackChunkSize - len(closeFence)
+
+	var chunks []string
+	var current strings.Builder
+	fence := ""   // opening line of the code block the current chunk ends in, if any
+	reopened := 0 // length of the fence reopened at the start of current
+	flush := func() {
+		chunk := strings.TrimSuffix(current.String(), "\n")
+		if fence != "" {
+			chunk += closeFence
+		}
+		chunks = append(chunks, chunk)
+		current.Reset()
+		reopened = 0
+		if fence != "" {
+			current.WriteString(fence + "\n")
+			reopened = current.Len()
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		pieces := []string{line}
+		if limit := size - len(fence) - 2; len(line) > limit {
+			pieces = splitLine(line, limit)
+		}
+		for _, piece := range pieces {
+			if current.Len() > reopened && current.Len()+len(piece)+1 > size {
+				flush()
+			}
+			current.WriteString(piece + "\n")
+		}
+
+		// A line starting with ``` opens or closes a code block, unless it also
+		// closes it again on the same line
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "```") && strings.Count(trimmed, "```") == 1 {
+			if fence == "" {
+				fence = trimmed
+			} else {
+				fence = ""
+			}
+		}
+	}
+	if current.Len() > reopened {
+		flush()
+	}
+
+	return chunks
+}
+
+// splitLine splits a line into pieces of at most limit bytes without splitting a
+// multi-byte character
+func splitLine(line string, limit int) []string {
+	var pieces []string
+	for len(line) > limit {
+		cut := limit
+		for cut > 1 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		pieces = append(pieces, line[:cut])
+		line = line[cut:]
+	}
+	return append(pieces, line)
+}
+
+// FormatSessionDiscrepancies formats the result of verifying checked active sessions
+func FormatSessionDiscrepancies(checked int, discrepancies []*models.SessionDiscrepancy) string {
+	if len(discrepancies) == 0 {
+		return FormatSuccessMessage(fmt.Sprintf("All %d active sessions match their work trees", checked))
+	}
+
+	parts := []string{fmt.Sprintf("*%d of %d active sessions don't match their work trees:*", len(discrepancies), checked)}
+	marked := 0
+	for _, d := range discrepancies {
+		parts = append(parts, fmt.Sprintf("• '%s': %s", slackEscape(d.Feature), slackEscape(d.Problem)))
+		if d.Marked {
+			marked++
+		}
+	}
+	if marked > 0 {
+		parts = append(parts, fmt.Sprintf("\nMarked %d sessions as errored; their owners can `restart` them", marked))
+	} else {
+		parts = append(parts, "\nRun `verify --mark` to mark them as errored so they can be restarted")
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// FormatSessionHistory formats a session's recorded messages, given newest first, as a
+// transcript in the order they were sent. Long messages are truncated.
+func FormatSessionHistory(session *models.Session, messages []*models.SessionMessage) string {
+	if len(messages) == 0 {
+		return fmt.Sprintf("No messages recorded for session '%s'", slackEscape(session.BranchName))
+	}
+
+	lines := []string{fmt.Sprintf("*Last %d messages in '%s':*", len(messages), slackEscape(session.BranchName))}
+	for i := len(messages) - 1; i >= 0; i-- {
+		message := messages[i]
+		arrow := "→ *You*"
+		if message.Direction == models.MessageDirectionClaudeToUser {
+			arrow = "← *Claude*"
+		}
+		lines = append(lines, fmt.Sprintf("%s (%s): %s",
+			arrow, message.CreatedAt.UTC().Format("15:04"), slackEscape(truncateHistoryContent(message.Content))))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// truncateHistoryContent flattens a message onto one line and cuts it to
+// HistoryContentLength bytes without splitting a multi-byte character
+func truncateHistoryContent(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	if len(content) <= HistoryContentLength {
+		return content
+	}
+	cut := HistoryContentLength
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + "…"
+}
+
+// FormatLogLines formats log lines as a Slack code block
+func FormatLogLines(feature string, lines []string) string {
+	if len(lines) == 0 {
+		return fmt.Sprintf("No log output for session '%s'", slackEscape(feature))
+	}
+	text := escapeCode(strings.Join(lines, "\n"))
+	return fmt.Sprintf("*Last %d log lines for '%s':*\n```\n%s\n```", len(lines), slackEscape(feature), text)
+}
@@ -1,8 +1,13 @@
 package slack
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
@@ -120,94 +125,932 @@ func TestParseStartCommand(t *testing.T) {
 	}
 }
 
+func TestTokenizeArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		wantErr string
+	}{
+		{name: "plain words", input: "  start  --feat   login ", want: []string{"start", "--feat", "login"}},
+		{name: "double quotes", input: `--prompt "Fix the login bug" --feat x`, want: []string{"--prompt", "Fix the login bug", "--feat", "x"}},
+		{name: "single quotes", input: `--prompt 'Fix the login bug'`, want: []string{"--prompt", "Fix the login bug"}},
+		{name: "quotes inside a word", input: `--prompt=Fix" the "bug`, want: []string{"--prompt=Fix the bug"}},
+		{name: "escaped double quote", input: `"say \"hi\""`, want: []string{`say "hi"`}},
+		{name: "escaped backslash", input: `"C:\\tmp"`, want: []string{`C:\tmp`}},
+		{name: "other backslashes kept in double quotes", input: `"a\nb"`, want: []string{`a\nb`}},
+		{name: "single quotes are literal", input: `'say \"hi'`, want: []string{`say \"hi`}},
+		{name: "double quote in single quotes", input: `'say "hi"'`, want: []string{`say "hi"`}},
+		{name: "apostrophe in double quotes", input: `"don't"`, want: []string{"don't"}},
+		{name: "escape outside quotes", input: `Fix\ the\ bug`, want: []string{"Fix the bug"}},
+		{name: "curly quotes", input: "--prompt “Fix the bug”", want: []string{"--prompt", "Fix the bug"}},
+		{name: "empty quoted argument", input: `--prompt ""`, want: []string{"--prompt", ""}},
+		{name: "unterminated double quote", input: `--prompt "Fix the bug`, wantErr: `unterminated " quote`},
+		{name: "unterminated single quote", input: `--prompt 'Fix the bug`, wantErr: "unterminated ' quote"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokenizeArgs(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("tokenizeArgs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("tokenizeArgs() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenizeArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStartCommandNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantFeature string
+		wantPrompt  string
+		wantBudget  float64
+		wantModel   string
+		wantErr     bool
+	}{
+		{
+			name:        "explicit feature name is kept",
+			input:       `@cb start --repo https://github.com/user/repo --from main --feat my-feature --prompt "Fix the login bug"`,
+			wantFeature: "my-feature",
+			wantPrompt:  "Fix the login bug",
+		},
+		{
+			name:       "feature name is optional",
+			input:      `@cb start --repo https://github.com/user/repo --from main --prompt "Fix the login bug"`,
+			wantPrompt: "Fix the login bug",
+		},
+		{
+			name:       "single-quoted prompt",
+			input:      `@cb start --repo https://github.com/user/repo --from main --prompt 'Fix the "login" bug'`,
+			wantPrompt: `Fix the "login" bug`,
+		},
+		{
+			name:       "escaped quotes in prompt",
+			input:      `@cb start --repo https://github.com/user/repo --from main --prompt "Say \"hello\" twice"`,
+			wantPrompt: `Say "hello" twice`,
+		},
+		{
+			name:       "curly quotes",
+			input:      "@cb start --repo https://github.com/user/repo --from main --prompt “Fix the login bug”",
+			wantPrompt: "Fix the login bug",
+		},
+		{
+			name:    "unterminated quote",
+			input:   `@cb start --repo https://github.com/user/repo --from main --prompt "Fix the login bug`,
+			wantErr: true,
+		},
+		{
+			name:    "repo is required",
+			input:   "@cb start --from main --feat my-feature",
+			wantErr: true,
+		},
+		{
+			name:       "budget",
+			input:      "@cb start --repo https://github.com/user/repo --from main --budget 2.50",
+			wantBudget: 2.5,
+		},
+		{
+			name:      "haiku model",
+			input:     "@cb start --repo https://github.com/user/repo --from main --model haiku",
+			wantModel: models.ModelHaiku,
+		},
+		{
+			name:      "full model ID",
+			input:     "@cb start --repo https://github.com/user/repo --from main --model Claude-3-5-Sonnet-20241022",
+			wantModel: "claude-3-5-sonnet-20241022",
+		},
+		{
+			name:    "unknown model",
+			input:   "@cb start --repo https://github.com/user/repo --from main --model gpt-4",
+			wantErr: true,
+		},
+		{
+			name:    "negative budget",
+			input:   "@cb start --repo https://github.com/user/repo --from main --budget -1",
+			wantErr: true,
+		},
+		{
+			name:    "budget that isn't a number",
+			input:   "@cb start --repo https://github.com/user/repo --from main --budget lots",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStartCommandNew(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseStartCommandNew() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.Feature != tt.wantFeature {
+				t.Errorf("ParseStartCommandNew() feature = %q, want %q", got.Feature, tt.wantFeature)
+			}
+			if got.Prompt != tt.wantPrompt {
+				t.Errorf("ParseStartCommandNew() prompt = %q, want %q", got.Prompt, tt.wantPrompt)
+			}
+			if got.Budget != tt.wantBudget {
+				t.Errorf("ParseStartCommandNew() budget = %v, want %v", got.Budget, tt.wantBudget)
+			}
+			wantModel := tt.wantModel
+			if wantModel == "" {
+				wantModel = models.ModelSonnet
+			}
+			if got.Model != wantModel {
+				t.Errorf("ParseStartCommandNew() model = %q, want %q", got.Model, wantModel)
+			}
+		})
+	}
+}
+
 func TestParseCredentialCommand(t *testing.T) {
 	tests := []struct {
 		name       string
 		input      []string
 		wantAction string
-		wantType   string
-		wantValue  string
+		wantType   string
+		wantValue  string
+		wantErr    bool
+	}{
+		{
+			name:       "set anthropic",
+			input:      []string{"set", "anthropic", "sk-ant-api-key"},
+			wantAction: "set",
+			wantType:   "anthropic",
+			wantValue:  "sk-ant-api-key",
+			wantErr:    false,
+		},
+		{
+			name:       "set github",
+			input:      []string{"set", "github", "ghp_token"},
+			wantAction: "set",
+			wantType:   "github", 
+			wantValue:  "ghp_token",
+			wantErr:    false,
+		},
+		{
+			name:       "list",
+			input:      []string{"list"},
+			wantAction: "list",
+			wantType:   "",
+			wantValue:  "",
+			wantErr:    false,
+		},
+		{
+			name:       "set with spaces in value",
+			input:      []string{"set", "anthropic", "sk-ant-api", "key"},
+			wantAction: "set",
+			wantType:   "anthropic",
+			wantValue:  "sk-ant-api key",
+			wantErr:    false,
+		},
+		{
+			name:       "delete",
+			input:      []string{"delete", "GitHub"},
+			wantAction: "delete",
+			wantType:   "github",
+		},
+		{
+			name:    "delete missing type",
+			input:   []string{"delete"},
+			wantErr: true,
+		},
+		{
+			name:    "delete invalid type",
+			input:   []string{"delete", "aws"},
+			wantErr: true,
+		},
+		{
+			name:    "delete with a value",
+			input:   []string{"delete", "github", "ghp_token"},
+			wantErr: true,
+		},
+		{
+			name:    "empty args",
+			input:   []string{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid action",
+			input:   []string{"invalid"},
+			wantErr: true,
+		},
+		{
+			name:    "set missing type",
+			input:   []string{"set"},
+			wantErr: true,
+		},
+		{
+			name:    "set missing value",
+			input:   []string{"set", "anthropic"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid credential type",
+			input:   []string{"set", "invalid", "value"},
+			wantErr: true,
+		},
+		{
+			name:    "github token in the anthropic slot",
+			input:   []string{"set", "anthropic", "ghp_token"},
+			wantErr: true,
+		},
+		{
+			name:       "connect github",
+			input:      []string{"connect", "github"},
+			wantAction: "connect",
+			wantType:   "github",
+		},
+		{
+			name:    "connect anthropic",
+			input:   []string{"connect", "anthropic"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAction, gotType, gotValue, err := ParseCredentialCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCredentialCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotAction != tt.wantAction {
+				t.Errorf("ParseCredentialCommand() action = %v, want %v", gotAction, tt.wantAction)
+			}
+			if gotType != tt.wantType {
+				t.Errorf("ParseCredentialCommand() type = %v, want %v", gotType, tt.wantType)
+			}
+			if gotValue != tt.wantValue {
+				t.Errorf("ParseCredentialCommand() value = %v, want %v", gotValue, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestParseStatusCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string
+		wantFeature string
+		wantErr     bool
+	}{
+		{name: "current session", input: []string{}, wantFeature: ""},
+		{name: "named session", input: []string{"--feat", "my-feature"}, wantFeature: "my-feature"},
+		{name: "missing feature value", input: []string{"--feat"}, wantErr: true},
+		{name: "invalid feature name", input: []string{"--feat", "bad..name"}, wantErr: true},
+		{name: "unexpected argument", input: []string{"my-feature"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStatusCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseStatusCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Feature != tt.wantFeature {
+				t.Errorf("ParseStatusCommand() feature = %v, want %v", got.Feature, tt.wantFeature)
+			}
+		})
+	}
+}
+
+func TestParseCostCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string
+		wantFeature string
+		wantErr     bool
+	}{
+		{
+			name:        "current session",
+			input:       []string{},
+			wantFeature: "",
+		},
+		{
+			name:        "named session",
+			input:       []string{"--feat", "my-feature"},
+			wantFeature: "my-feature",
+		},
+		{
+			name:    "missing feature value",
+			input:   []string{"--feat"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid feature name",
+			input:   []string{"--feat", "bad..name"},
+			wantErr: true,
+		},
+		{
+			name:    "unexpected argument",
+			input:   []string{"my-feature"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCostCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseCostCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Feature != tt.wantFeature {
+				t.Errorf("ParseCostCommand() feature = %v, want %v", got.Feature, tt.wantFeature)
+			}
+		})
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "7d", want: 7 * 24 * time.Hour},
+		{input: "30d", want: 30 * 24 * time.Hour},
+		{input: "24h", want: 24 * time.Hour},
+		{input: "90m", want: 90 * time.Minute},
+		{input: "1h30m", want: 90 * time.Minute},
+		{input: "0d", wantErr: true},
+		{input: "-2h", wantErr: true},
+		{input: "d", wantErr: true},
+		{input: "1.5d", wantErr: true},
+		{input: "week", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePeriod(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePeriod(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePeriod(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCostReportCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         []string
+		wantSince     time.Duration
+		wantWorkspace bool
+		wantErr       bool
+	}{
+		{name: "defaults", input: []string{}, wantSince: DefaultCostReportPeriod},
+		{name: "since", input: []string{"--since", "7d"}, wantSince: 7 * 24 * time.Hour},
+		{name: "workspace", input: []string{"--workspace", "--since", "24h"}, wantSince: 24 * time.Hour, wantWorkspace: true},
+		{name: "invalid since", input: []string{"--since", "soon"}, wantErr: true},
+		{name: "unexpected argument", input: []string{"all"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCostReportCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCostReportCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Since != tt.wantSince || got.Workspace != tt.wantWorkspace) {
+				t.Errorf("ParseCostReportCommand() = %+v, want since %v, workspace %v", got, tt.wantSince, tt.wantWorkspace)
+			}
+		})
+	}
+}
+
+func TestParseNotifyCommand(t *testing.T) {
+	tests := []struct {
+		name           string
+		input          []string
+		wantPreference string
+		wantErr        bool
+	}{
+		{
+			name:           "show current preference",
+			input:          []string{},
+			wantPreference: "",
+		},
+		{
+			name:           "mentions only",
+			input:          []string{"mentions"},
+			wantPreference: models.NotifyMentions,
+		},
+		{
+			name:           "case insensitive",
+			input:          []string{"OFF"},
+			wantPreference: models.NotifyOff,
+		},
+		{
+			name:    "unknown preference",
+			input:   []string{"sometimes"},
+			wantErr: true,
+		},
+		{
+			name:    "too many arguments",
+			input:   []string{"on", "off"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseNotifyCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseNotifyCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Preference != tt.wantPreference {
+				t.Errorf("ParseNotifyCommand() preference = %v, want %v", got.Preference, tt.wantPreference)
+			}
+		})
+	}
+}
+
+func TestParseStopCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string
+		wantMessage string
+		wantErr     bool
+	}{
+		{name: "default message", input: []string{}},
+		{name: "quoted message", input: strings.Fields(`--message "Fix the login bug"`), wantMessage: "Fix the login bug"},
+		{name: "curly quotes", input: strings.Fields("--message “Add tests”"), wantMessage: "Add tests"},
+		{name: "single word", input: []string{"--message", "Refactor"}, wantMessage: "Refactor"},
+		{name: "unquoted words", input: []string{"--message", "Fix", "bug"}, wantErr: true},
+		{name: "unknown flag", input: []string{"--msg", "Fix"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseStopCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseStopCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Message != tt.wantMessage {
+				t.Errorf("ParseStopCommand() message = %q, want %q", got.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestParseListCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		wantAll  bool
+		wantPage int
+		wantErr  bool
+	}{
+		{name: "own sessions", input: []string{}, wantPage: 1},
+		{name: "later page", input: []string{"--page", "3"}, wantPage: 3},
+		{name: "all sessions", input: []string{"--all"}, wantAll: true, wantPage: 1},
+		{name: "zero page", input: []string{"--page", "0"}, wantErr: true},
+		{name: "page with all", input: []string{"--all", "--page", "2"}, wantErr: true},
+		{name: "unknown flag", input: []string{"--everything"}, wantErr: true},
+		{name: "extra argument", input: []string{"--all", "feature"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseListCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseListCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && (got.All != tt.wantAll || got.Page != tt.wantPage) {
+				t.Errorf("ParseListCommand() = %+v, want all %v, page %d", got, tt.wantAll, tt.wantPage)
+			}
+		})
+	}
+}
+
+func TestParseHistoryCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     []string
+		wantLimit int
+		wantErr   bool
+	}{
+		{name: "default limit", input: []string{}, wantLimit: DefaultHistoryMessages},
+		{name: "explicit limit", input: []string{"--limit", "5"}, wantLimit: 5},
+		{name: "limit capped", input: []string{"--limit", "1000"}, wantLimit: MaxHistoryMessages},
+		{name: "zero limit", input: []string{"--limit", "0"}, wantErr: true},
+		{name: "non-numeric limit", input: []string{"--limit", "many"}, wantErr: true},
+		{name: "extra argument", input: []string{"feature"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseHistoryCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseHistoryCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && got.Limit != tt.wantLimit {
+				t.Errorf("ParseHistoryCommand() limit = %d, want %d", got.Limit, tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestParseJoinCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string
+		wantFeature string
+		wantRole    string
+		wantErr     bool
+	}{
+		{
+			name:        "default role",
+			input:       []string{"--feat", "my-feature"},
+			wantFeature: "my-feature",
+			wantRole:    models.SessionRoleCollaborator,
+		},
+		{
+			name:        "viewer",
+			input:       []string{"--feat", "my-feature", "--role", "viewer"},
+			wantFeature: "my-feature",
+			wantRole:    models.SessionRoleViewer,
+		},
+		{
+			name:    "owner role not allowed",
+			input:   []string{"--feat", "my-feature", "--role", "owner"},
+			wantErr: true,
+		},
+		{
+			name:    "missing feature",
+			input:   []string{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid feature name",
+			input:   []string{"--feat", "bad..name"},
+			wantErr: true,
+		},
+		{
+			name:    "unexpected argument",
+			input:   []string{"--feat", "my-feature", "extra"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJoinCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseJoinCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.Feature != tt.wantFeature {
+				t.Errorf("ParseJoinCommand() feature = %v, want %v", got.Feature, tt.wantFeature)
+			}
+			if got.Role != tt.wantRole {
+				t.Errorf("ParseJoinCommand() role = %v, want %v", got.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestParsePRCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    PRCommandArgs
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			input: []string{},
+			want:  PRCommandArgs{},
+		},
+		{
+			name:  "all flags",
+			input: []string{"--feat", "my-feature", "--title", "Widgets", "--base", "develop"},
+			want:  PRCommandArgs{Feature: "my-feature", Title: "Widgets", Base: "develop"},
+		},
+		{
+			name:  "quoted title",
+			input: strings.Fields(`--title "Add the widget API" --base main`),
+			want:  PRCommandArgs{Title: "Add the widget API", Base: "main"},
+		},
+		{
+			name:  "curly quoted title",
+			input: strings.Fields("--title “Add widgets”"),
+			want:  PRCommandArgs{Title: "Add widgets"},
+		},
+		{
+			name:    "unquoted multi-word title",
+			input:   []string{"--title", "Add", "widgets"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid base",
+			input:   []string{"--base", "bad..branch"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid feature name",
+			input:   []string{"--feat", "bad..name"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePRCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePRCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if *got != tt.want {
+				t.Errorf("ParsePRCommand() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePromptsCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []string
+		wantAction string
+		wantURL    string
+		wantPublic bool
+		wantErr    bool
+	}{
+		{name: "no args lists", input: []string{}, wantAction: "list"},
+		{name: "list", input: []string{"list"}, wantAction: "list"},
+		{
+			name:       "import",
+			input:      []string{"import", "<https://example.com/prompts.yaml>", "--public"},
+			wantAction: "import",
+			wantURL:    "https://example.com/prompts.yaml",
+			wantPublic: true,
+		},
+		{name: "import without url", input: []string{"import"}, wantErr: true},
+		{name: "unknown action", input: []string{"remove"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, libraryURL, public, err := ParsePromptsCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePromptsCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if action != tt.wantAction || libraryURL != tt.wantURL || public != tt.wantPublic {
+				t.Errorf("ParsePromptsCommand() = %q, %q, %v, want %q, %q, %v",
+					action, libraryURL, public, tt.wantAction, tt.wantURL, tt.wantPublic)
+			}
+		})
+	}
+}
+
+func TestParsePromptCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    PromptCommandArgs
+		wantErr bool
+	}{
+		{
+			name:  "create",
+			input: strings.Fields(`create --name reviewer --desc "Strict code reviewer" --public You are a "strict" reviewer.`),
+			want: PromptCommandArgs{
+				Action:      "create",
+				Name:        "reviewer",
+				Description: "Strict code reviewer",
+				Content:     `You are a "strict" reviewer.`,
+				Public:      true,
+			},
+		},
+		{
+			name:  "create private without description",
+			input: strings.Fields("create --name terse Answer in one sentence."),
+			want:  PromptCommandArgs{Action: "create", Name: "terse", Content: "Answer in one sentence."},
+		},
+		{
+			name:    "create without content",
+			input:   []string{"create", "--name", "empty"},
+			wantErr: true,
+		},
+		{
+			name:  "show",
+			input: []string{"show", "--name", "reviewer"},
+			want:  PromptCommandArgs{Action: "show", Name: "reviewer"},
+		},
+		{
+			name:  "delete",
+			input: []string{"delete", "--name", "reviewer"},
+			want:  PromptCommandArgs{Action: "delete", Name: "reviewer"},
+		},
+		{
+			name:    "missing name",
+			input:   []string{"show"},
+			wantErr: true,
+		},
+		{
+			name:    "name with whitespace",
+			input:   strings.Fields(`delete --name "two words"`),
+			wantErr: true,
+		},
+		{
+			name:    "public only applies to create",
+			input:   []string{"delete", "--name", "reviewer", "--public"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown action",
+			input:   []string{"rename", "--name", "reviewer"},
+			wantErr: true,
+		},
+		{
+			name:    "no action",
+			input:   []string{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePromptCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePromptCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if *got != tt.want {
+				t.Errorf("ParsePromptCommand() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLogsCommand(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       []string
+		wantFeature string
+		wantLines   int
+		wantErr     bool
+	}{
+		{"default lines", []string{"my-feature"}, "my-feature", DefaultLogLines, false},
+		{"explicit lines", []string{"my-feature", "20"}, "my-feature", 20, false},
+		{"capped lines", []string{"my-feature", "100000"}, "my-feature", MaxLogLines, false},
+		{"missing feature", []string{}, "", 0, true},
+		{"invalid lines", []string{"my-feature", "abc"}, "", 0, true},
+		{"zero lines", []string{"my-feature", "0"}, "", 0, true},
+		{"traversal", []string{"../secrets"}, "", 0, true},
+		{"too many args", []string{"my-feature", "10", "extra"}, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotFeature, gotLines, err := ParseLogsCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseLogsCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotFeature != tt.wantFeature {
+				t.Errorf("ParseLogsCommand() feature = %v, want %v", gotFeature, tt.wantFeature)
+			}
+			if gotLines != tt.wantLines {
+				t.Errorf("ParseLogsCommand() lines = %v, want %v", gotLines, tt.wantLines)
+			}
+		})
+	}
+}
+
+func TestParseMCPCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []string
+		wantAction string
+		wantName   string
+		wantConfig string
 		wantErr    bool
 	}{
-		{
-			name:       "set anthropic",
-			input:      []string{"set", "anthropic", "sk-ant-api-key"},
-			wantAction: "set",
-			wantType:   "anthropic",
-			wantValue:  "sk-ant-api-key",
-			wantErr:    false,
-		},
-		{
-			name:       "set github",
-			input:      []string{"set", "github", "ghp_token"},
-			wantAction: "set",
-			wantType:   "github", 
-			wantValue:  "ghp_token",
-			wantErr:    false,
-		},
 		{
 			name:       "list",
 			input:      []string{"list"},
 			wantAction: "list",
-			wantType:   "",
-			wantValue:  "",
-			wantErr:    false,
 		},
 		{
-			name:       "set with spaces in value",
-			input:      []string{"set", "anthropic", "sk-ant", "api", "key"},
-			wantAction: "set",
-			wantType:   "anthropic",
-			wantValue:  "sk-ant api key",
-			wantErr:    false,
+			name:       "register",
+			input:      []string{"register", "github", `{"command":`, `"github-mcp"}`},
+			wantAction: "register",
+			wantName:   "github",
+			wantConfig: `{"command": "github-mcp"}`,
 		},
 		{
-			name:    "empty args",
-			input:   []string{},
-			wantErr: true,
+			name:       "register with smart quotes",
+			input:      []string{"register", "fetch", "{“command”:“fetch-mcp”}"},
+			wantAction: "register",
+			wantName:   "fetch",
+			wantConfig: `{"command":"fetch-mcp"}`,
 		},
 		{
-			name:    "invalid action",
-			input:   []string{"invalid"},
+			name:    "empty args",
+			input:   []string{},
 			wantErr: true,
 		},
 		{
-			name:    "set missing type",
-			input:   []string{"set"},
+			name:    "register missing config",
+			input:   []string{"register", "github"},
 			wantErr: true,
 		},
 		{
-			name:    "set missing value",
-			input:   []string{"set", "anthropic"},
+			name:    "invalid name",
+			input:   []string{"register", "git hub!", "{}"},
 			wantErr: true,
 		},
 		{
-			name:    "invalid credential type",
-			input:   []string{"set", "invalid", "value"},
+			name:    "invalid action",
+			input:   []string{"remove", "github"},
 			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotAction, gotType, gotValue, err := ParseCredentialCommand(tt.input)
+			gotAction, gotName, gotConfig, err := ParseMCPCommand(tt.input)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ParseCredentialCommand() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ParseMCPCommand() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if gotAction != tt.wantAction {
-				t.Errorf("ParseCredentialCommand() action = %v, want %v", gotAction, tt.wantAction)
+				t.Errorf("ParseMCPCommand() action = %v, want %v", gotAction, tt.wantAction)
 			}
-			if gotType != tt.wantType {
-				t.Errorf("ParseCredentialCommand() type = %v, want %v", gotType, tt.wantType)
+			if gotName != tt.wantName {
+				t.Errorf("ParseMCPCommand() name = %v, want %v", gotName, tt.wantName)
 			}
-			if gotValue != tt.wantValue {
-				t.Errorf("ParseCredentialCommand() value = %v, want %v", gotValue, tt.wantValue)
+			if gotConfig != tt.wantConfig {
+				t.Errorf("ParseMCPCommand() config = %v, want %v", gotConfig, tt.wantConfig)
 			}
 		})
 	}
 }
 
+func TestFormatMCPServers(t *testing.T) {
+	registered := []*models.MCPServer{
+		{Name: "fetch"},
+		{Name: "github"},
+	}
+	statuses := []models.MCPServerStatus{
+		{Name: "github", Status: "connected"},
+		{Name: "local", Status: "failed"},
+	}
+
+	got := FormatMCPServers(registered, statuses)
+	for _, want := range []string{
+		"*MCP Servers (2 registered):*",
+		"• `fetch` - :white_circle: not reported",
+		"• `github` - :green_circle: connected",
+		"• `local` (unregistered) - :red_circle: failed",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("FormatMCPServers() = %q, missing %q", got, want)
+		}
+	}
+
+	if got := FormatMCPServers(nil, nil); got != "No MCP servers registered" {
+		t.Errorf("FormatMCPServers(nil, nil) = %q, want %q", got, "No MCP servers registered")
+	}
+}
+
 func TestIsValidRepoURL(t *testing.T) {
 	tests := []struct {
 		name string
@@ -305,6 +1148,13 @@ func TestCommandParser_ParseCommand(t *testing.T) {
 			wantArgs:    []string{},
 			wantErr:     false,
 		},
+		{
+			name:        "cancel is interrupt",
+			input:       "cancel --feat auth",
+			wantCommand: "interrupt",
+			wantArgs:    []string{"--feat", "auth"},
+			wantErr:     false,
+		},
 		{
 			name:        "credentials command",
 			input:       "credentials set anthropic sk-ant-key",
@@ -312,6 +1162,20 @@ func TestCommandParser_ParseCommand(t *testing.T) {
 			wantArgs:    []string{"set", "anthropic", "sk-ant-key"},
 			wantErr:     false,
 		},
+		{
+			name:        "cost command",
+			input:       "cost --feat my-feature",
+			wantCommand: "cost",
+			wantArgs:    []string{"--feat", "my-feature"},
+			wantErr:     false,
+		},
+		{
+			name:        "mcp command",
+			input:       "mcp list",
+			wantCommand: "mcp",
+			wantArgs:    []string{"list"},
+			wantErr:     false,
+		},
 		{
 			name:    "invalid command",
 			input:   "invalid command",
@@ -341,6 +1205,63 @@ func TestCommandParser_ParseCommand(t *testing.T) {
 	}
 }
 
+func TestCommandParser_ParseCommandSuggestion(t *testing.T) {
+	parser := NewCommandParser("UBOT123")
+
+	tests := []struct {
+		input          string
+		wantSuggestion string // empty for none
+	}{
+		{input: "statsu", wantSuggestion: "status"},
+		{input: "strat --repo x", wantSuggestion: "start"},
+		{input: "lsit", wantSuggestion: "list"},
+		{input: "histroy", wantSuggestion: "history"},
+		{input: "sharelink", wantSuggestion: "share-link"},
+		{input: "deploy"},
+		{input: "invalid command"},
+		{input: "ls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, _, err := parser.ParseCommand(tt.input)
+			var cbErr *models.CBError
+			if !errors.As(err, &cbErr) || cbErr.Code != models.ErrCodeInvalidCommand {
+				t.Fatalf("ParseCommand() error = %v, want an invalid command error", err)
+			}
+			hasSuggestion := strings.Contains(err.Error(), "Did you mean")
+			if tt.wantSuggestion == "" {
+				if hasSuggestion {
+					t.Errorf("ParseCommand() error = %q, want no suggestion", err)
+				}
+				return
+			}
+			if want := "Did you mean `" + tt.wantSuggestion + "`?"; !strings.Contains(err.Error(), want) {
+				t.Errorf("ParseCommand() error = %q, want it to contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"status", "status", 0},
+		{"statsu", "status", 2},
+		{"stat", "status", 2},
+		{"", "pr", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
 func TestExtractMentionedUsers(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -377,4 +1298,393 @@ func TestExtractMentionedUsers(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestFormatUserLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits *models.UserLimits
+		want   []string
+	}{
+		{
+			name: "near caps",
+			limits: &models.UserLimits{
+				SessionCreatesRemaining: 1,
+				SessionCreateLimit:      10,
+				SessionCreateWindow:     3600,
+				ActiveSessions:          4,
+				MaxSessions:             5,
+				TotalCostUSD:            12.5,
+			},
+			want: []string{
+				"• Session starts remaining: 1 of 10 (per hour)",
+				"• Active sessions: 4 of 5",
+				"• Total cost: $12.5000",
+			},
+		},
+		{
+			name: "no limits configured",
+			limits: &models.UserLimits{
+				SessionCreateWindow: 3600,
+				ActiveSessions:      2,
+			},
+			want: []string{
+				"• Session starts remaining: unlimited",
+				"• Active sessions: 2",
+				"• Total cost: $0.0000",
+			},
+		},
+		{
+			name: "minute window",
+			limits: &models.UserLimits{
+				SessionCreatesRemaining: 0,
+				SessionCreateLimit:      3,
+				SessionCreateWindow:     900,
+			},
+			want: []string{
+				"• Session starts remaining: 0 of 3 (per 15 minutes)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatUserLimits(tt.limits)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("FormatUserLimits() = %q, missing %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatSessionSummary(t *testing.T) {
+	summary := &models.SessionSummary{
+		Feature:         "my-feature",
+		Branch:          "my-feature",
+		RepoURL:         "https://github.com/test/repo",
+		Commits:         3,
+		FilesChanged:    7,
+		Insertions:      120,
+		Deletions:       4,
+		CommitSHA:       "abc1234",
+		TotalCost:       1.5,
+		Turns:           12,
+		DurationSeconds: 5400,
+	}
+
+	got := FormatSessionSummary(summary)
+	for _, want := range []string{
+		"Session 'my-feature' stopped and changes pushed",
+		"• Branch: `my-feature` at `abc1234`",
+		"• Commits: 3",
+		"• Files changed: 7 (+120/-4 lines)",
+		"• Total cost: $1.5000",
+		"• Turns: 12",
+		"• Duration: 1h30m0s",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("FormatSessionSummary() = %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "Pull request") {
+		t.Errorf("FormatSessionSummary() = %q, want no pull request line without a PR URL", got)
+	}
+
+	summary.PRURL = "https://github.com/test/repo/pull/1"
+	if got := FormatSessionSummary(summary); !strings.Contains(got, "• Pull request: <https://github.com/test/repo/pull/1>") {
+		t.Errorf("FormatSessionSummary() = %q, want the pull request URL", got)
+	}
+
+	summary.CommitSHA = ""
+	if got := FormatSessionSummary(summary); !strings.Contains(got, "stopped, but its changes weren't pushed") || strings.Contains(got, " at `") {
+		t.Errorf("FormatSessionSummary() = %q, want it to say the changes weren't pushed", got)
+	}
+
+	unchanged := &models.SessionSummary{Feature: "idle-feature", Branch: "idle-feature", RepoURL: "https://github.com/test/repo"}
+	if got := FormatSessionSummary(unchanged); !strings.Contains(got, "stopped with no changes") {
+		t.Errorf("FormatSessionSummary() = %q, want it to say nothing changed", got)
+	}
+}
+
+func TestSlackEscape(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "plain text", input: "my-feature", want: "my-feature"},
+		{name: "control characters", input: "a < b && c > d", want: "a &lt; b &amp;&amp; c &gt; d"},
+		{name: "mention markup", input: "<!channel>", want: "&lt;!channel&gt;"},
+		{name: "formatting", input: "*bold* _italic_ ~strike~", want: "\u200b*bold\u200b* \u200b_italic\u200b_ \u200b~strike\u200b~"},
+		{name: "inline code is kept", input: "use `stop` first", want: "use `stop` first"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slackEscape(tt.input); got != tt.want {
+				t.Errorf("slackEscape(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSessionInfoEscapesRepoURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		repoURL string
+		want    string
+	}{
+		{
+			name:    "url with query",
+			repoURL: "https://example.com/repo.git?a=1&b=<2>",
+			want:    "*Repository:* <https://example.com/repo.git?a=1&amp;b=&lt;2&gt;>",
+		},
+		{
+			name:    "not a url",
+			repoURL: "git@github.com:*org*/repo_name.git",
+			want:    "*Repository:* git@github.com:\u200b*org\u200b*/repo\u200b_name.git",
+		},
+		{
+			name:    "link markup",
+			repoURL: "<https://evil.example.com|https://github.com/test/repo>",
+			want:    "*Repository:* &lt;https://evil.example.com|https://github.com/test/repo&gt;",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FormatSessionInfo(map[string]interface{}{"repo_url": tt.repoURL})
+			if got != tt.want {
+				t.Errorf("FormatSessionInfo() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCredentialFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		credType string
+		value    string
+		wantErr  string // empty if the value is accepted
+	}{
+		{name: "anthropic key", credType: models.CredentialTypeAnthropic, value: "sk-ant-api03-abcDEF123"},
+		{name: "anthropic prefix only", credType: models.CredentialTypeAnthropic, value: "sk-ant-", wantErr: "starts with `sk-ant-`"},
+		{name: "openai key as anthropic", credType: models.CredentialTypeAnthropic, value: "sk-proj-abc123", wantErr: "starts with `sk-ant-`"},
+		{name: "github token as anthropic", credType: models.CredentialTypeAnthropic, value: "ghp_abc123", wantErr: "credentials set github"},
+		{name: "classic github token as anthropic", credType: models.CredentialTypeAnthropic, value: "0123456789abcdef0123456789abcdef01234567", wantErr: "credentials set github"},
+		{name: "github personal access token", credType: models.CredentialTypeGitHub, value: "ghp_abcDEF123"},
+		{name: "github oauth token", credType: models.CredentialTypeGitHub, value: "gho_abcDEF123"},
+		{name: "github user-to-server token", credType: models.CredentialTypeGitHub, value: "ghu_abcDEF123"},
+		{name: "github server-to-server token", credType: models.CredentialTypeGitHub, value: "ghs_abcDEF123"},
+		{name: "github fine-grained token", credType: models.CredentialTypeGitHub, value: "github_pat_11ABC_def456"},
+		{name: "github classic token", credType: models.CredentialTypeGitHub, value: "0123456789abcdef0123456789abcdef01234567"},
+		{name: "github refresh token", credType: models.CredentialTypeGitHub, value: "ghr_abcDEF123", wantErr: "doesn't look like a GitHub token"},
+		{name: "github prefix only", credType: models.CredentialTypeGitHub, value: "ghp_", wantErr: "doesn't look like a GitHub token"},
+		{name: "short hex", credType: models.CredentialTypeGitHub, value: "0123456789abcdef", wantErr: "doesn't look like a GitHub token"},
+		{name: "token with spaces", credType: models.CredentialTypeGitHub, value: "ghp_abc 123", wantErr: "doesn't look like a GitHub token"},
+		{name: "anthropic key as github", credType: models.CredentialTypeGitHub, value: "sk-ant-api03-abc", wantErr: "credentials set anthropic"},
+		{name: "unknown type", credType: "aws", value: "AKIA123", wantErr: "must be 'anthropic' or 'github'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCredentialFormat(tt.credType, tt.value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateCredentialFormat() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, models.ErrInvalidCommand) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateCredentialFormat() error = %v, want an invalid command error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormatErrorMessageEscapes(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{
+			name: "cb error",
+			err:  models.NewCBError(models.ErrCodeInvalidCommand, "invalid name '<!here>*&*'", nil),
+			want: ":x: *Error (INVALID_COMMAND):* invalid name '&lt;!here&gt;\u200b*&amp;\u200b*'",
+		},
+		{
+			name: "wrapped cb error",
+			err:  fmt.Errorf("failed to start: %w", models.NewCBError(models.ErrCodeRepoAccess, "can't clone repo", nil)),
+			want: ":x: *Error (REPO_ACCESS):* can't clone repo",
+		},
+		{
+			name: "plain error",
+			err:  fmt.Errorf("clone of <repo> failed: exit_code=128"),
+			want: ":x: *Error:* clone of &lt;repo&gt; failed: exit\u200b_code=128",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatErrorMessage(tt.err); got != tt.want {
+				t.Errorf("FormatErrorMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSessionHistory(t *testing.T) {
+	session := &models.Session{BranchName: "history-feature"}
+	sent := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+	if got := FormatSessionHistory(session, nil); !strings.Contains(got, "No messages recorded") {
+		t.Errorf("FormatSessionHistory(nil) = %q, want no messages", got)
+	}
+
+	// Newest first, as returned by the database
+	messages := []*models.SessionMessage{
+		{Direction: models.MessageDirectionClaudeToUser, Content: "a" + strings.Repeat("é", HistoryContentLength), CreatedAt: sent.Add(time.Minute)},
+		{Direction: models.MessageDirectionUserToClaude, Content: "fix the\n<tests>", CreatedAt: sent},
+	}
+	got := FormatSessionHistory(session, messages)
+	lines := strings.Split(got, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("FormatSessionHistory() = %q, want a header and 2 lines", got)
+	}
+	if lines[1] != "→ *You* (09:30): fix the &lt;tests&gt;" {
+		t.Errorf("user line = %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "← *Claude* (09:31): ") || !strings.HasSuffix(lines[2], "…") {
+		t.Errorf("Claude line = %q, want a truncated reply", lines[2])
+	}
+	if !utf8.ValidString(lines[2]) {
+		t.Errorf("Claude line = %q, cut a multi-byte character", lines[2])
+	}
+}
+
+func TestFormatDiff(t *testing.T) {
+	if got := FormatDiff("", ""); len(got) != 1 || got[0] != "No uncommitted changes." {
+		t.Errorf("FormatDiff() with no changes = %q, want %q", got, "No uncommitted changes.")
+	}
+
+	var diff strings.Builder
+	for i := 0; diff.Len() < MaxDiffBytes*2; i++ {
+		fmt.Fprintf(&diff, "+line %d with <html> & ```fences```\n", i)
+	}
+
+	got := FormatDiff(" main.go | 2 ++", diff.String())
+	if len(got) < 3 {
+		t.Fatalf("FormatDiff() returned %d messages, want the stat, several chunks and a truncation note", len(got))
+	}
+	if !strings.Contains(got[0], "main.go | 2 ++") {
+		t.Errorf("FormatDiff() first message = %q, want the stat", got[0])
+	}
+	if !strings.Contains(got[len(got)-1], "truncated") {
+		t.Errorf("FormatDiff() last message = %q, want a truncation note", got[len(got)-1])
+	}
+
+	var posted int
+	for _, message := range got[1 : len(got)-1] {
+		if len(message) > SlackMessageLimit {
+			t.Errorf("message length = %d, want at most %d", len(message), SlackMessageLimit)
+		}
+		if !strings.HasPrefix(message, "```\n") || !strings.HasSuffix(message, "\n```") {
+			t.Errorf("message = %q, want a code block", message)
+		}
+		if strings.Contains(message, "<html>") || strings.Count(message, "```") != 2 {
+			t.Errorf("message = %q, want its content escaped", message)
+		}
+		posted += strings.Count(message, "+line ")
+	}
+	if posted == 0 || posted >= strings.Count(diff.String(), "+line ") {
+		t.Errorf("posted %d diff lines, want some but not all", posted)
+	}
+}
+
+func TestSplitForSlack(t *testing.T) {
+	if got := splitForSlack("short message"); len(got) != 1 || got[0] != "short message" {
+		t.Errorf("splitForSlack() of a short message = %q, want it unchanged", got)
+	}
+
+	var plain strings.Builder
+	for i := 0; plain.Len() < 10*1024; i++ {
+		fmt.Fprintf(&plain, "Line %d of a long response from Claude\n", i)
+	}
+
+	var fenced strings.Builder
+	for i := 0; fenced.Len() < 10*1024; i++ {
+		fmt.Fprintf(&fenced, "Step %d changes the handler:\n```go\n", i)
+		for j := 0; j < 20; j++ {
+			fmt.Fprintf(&fenced, "\tfmt.Println(%d, %d)\n", i, j)
+		}
+		fenced.WriteString("```\n")
+	}
+
+	// One very long line inside a code block
+	longLine := "```\n" + strings.Repeat("é", 6000) + "\n```"
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "plain", text: plain.String()},
+		{name: "code fences", text: fenced.String()},
+		{name: "long line", text: longLine},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := splitForSlack(tt.text)
+			if len(chunks) < 2 {
+				t.Fatalf("splitForSlack() returned %d chunks, want several", len(chunks))
+			}
+
+			for i, chunk := range chunks {
+				if len(chunk) > SlackChunkSize {
+					t.Errorf("chunk %d length = %d, want at most %d", i, len(chunk), SlackChunkSize)
+				}
+				var fences int
+				for _, line := range strings.Split(chunk, "\n") {
+					if strings.HasPrefix(line, "```") {
+						fences++
+					}
+				}
+				if fences%2 != 0 {
+					t.Errorf("chunk %d has %d fences, want them balanced:\n%s", i, fences, chunk)
+				}
+			}
+
+			// Removing the fences added at the splits gives back the original lines
+			var content []string
+			for _, line := range strings.Split(strings.Join(chunks, "\n"), "\n") {
+				if !strings.HasPrefix(line, "```") {
+					content = append(content, line)
+				}
+			}
+			var want []string
+			for _, line := range strings.Split(tt.text, "\n") {
+				if !strings.HasPrefix(line, "```") {
+					want = append(want, line)
+				}
+			}
+			if got, wantText := strings.Join(content, ""), strings.Join(want, ""); got != wantText {
+				t.Errorf("splitForSlack() lost content: got %d bytes, want %d", len(got), len(wantText))
+			}
+		})
+	}
+
+	// A code block split across chunks is closed and reopened with its language
+	block := "```python\n" + strings.Repeat("print('hello, world')\n", 300) + "```"
+	chunks := splitForSlack(block)
+	if len(chunks) < 2 {
+		t.Fatalf("splitForSlack() returned %d chunks, want several", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if !strings.HasPrefix(chunk, "```python\n") || !strings.HasSuffix(chunk, "\n```") {
+			t.Errorf("chunk %d = %q..., want a complete python code block", i, chunk[:20])
+		}
+	}
+}
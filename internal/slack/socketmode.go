@@ -0,0 +1,87 @@
+package slack
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+)
+
+// socketModeAcker acknowledges Socket Mode requests; it's satisfied by *socketmode.Client
+type socketModeAcker interface {
+	Ack(req socketmode.Request, payload ...interface{})
+}
+
+// SocketModeRunner receives events over a Socket Mode WebSocket and dispatches them to
+// the same EventHandler used by the HTTP events endpoint. It lets the bot run without a
+// publicly reachable URL.
+type SocketModeRunner struct {
+	client          *socketmode.Client
+	handler         *EventHandler
+	useEnterpriseID bool
+}
+
+// NewSocketModeRunner creates a runner. The api client must have been created with
+// slack.OptionAppLevelToken, since Socket Mode connections are opened with the app token.
+func NewSocketModeRunner(api *slack.Client, handler *EventHandler, useEnterpriseID bool) *SocketModeRunner {
+	return &SocketModeRunner{
+		client:          socketmode.New(api),
+		handler:         handler,
+		useEnterpriseID: useEnterpriseID,
+	}
+}
+
+// Run connects to Slack and handles events until ctx is cancelled or the connection
+// can't be re-established
+func (r *SocketModeRunner) Run(ctx context.Context) error {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt, ok := <-r.client.Events:
+				if !ok {
+					return
+				}
+				// Handlers can run for as long as a Claude turn takes, so don't hold
+				// up the events behind them
+				go r.handleEvent(ctx, r.client, evt)
+			}
+		}
+	}()
+
+	return r.client.RunContext(ctx)
+}
+
+// handleEvent acknowledges an Events API request and dispatches it to the event handler
+func (r *SocketModeRunner) handleEvent(ctx context.Context, acker socketModeAcker, evt socketmode.Event) {
+	switch evt.Type {
+	case socketmode.EventTypeConnecting:
+		logging.Info("Connecting to Slack with Socket Mode")
+	case socketmode.EventTypeConnected:
+		logging.Info("Connected to Slack with Socket Mode")
+	case socketmode.EventTypeConnectionError:
+		logging.Warn("Socket Mode connection failed, retrying", "error", evt.Data)
+	case socketmode.EventTypeEventsAPI:
+		event, ok := evt.Data.(slackevents.EventsAPIEvent)
+		if !ok {
+			logging.Warn("Ignoring unexpected Socket Mode event data", "type", fmt.Sprintf("%T", evt.Data))
+			return
+		}
+
+		// Acknowledge before handling; Slack redelivers events that aren't
+		// acknowledged within 3 seconds
+		if evt.Request != nil {
+			acker.Ack(*evt.Request)
+		}
+
+		ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+		if err := r.handler.HandleEventsAPIEvent(ctx, event, r.useEnterpriseID); err != nil {
+			logging.ErrorCtx(ctx, "Failed to handle Socket Mode event", "error", err)
+		}
+	}
+}
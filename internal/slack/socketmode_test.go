@@ -0,0 +1,73 @@
+package slack
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+)
+
+// fakeAcker records the envelope IDs of acknowledged Socket Mode requests
+type fakeAcker struct {
+	acked []string
+}
+
+func (a *fakeAcker) Ack(req socketmode.Request, payload ...interface{}) {
+	a.acked = append(a.acked, req.EnvelopeID)
+}
+
+// socketModeEvent wraps an inner event the way the Socket Mode client delivers it
+func socketModeEvent(envelopeID string, inner interface{}) socketmode.Event {
+	return socketmode.Event{
+		Type: socketmode.EventTypeEventsAPI,
+		Data: slackevents.EventsAPIEvent{
+			Type:       slackevents.CallbackEvent,
+			TeamID:     "T123456",
+			InnerEvent: slackevents.EventsAPIInnerEvent{Data: inner},
+		},
+		Request: &socketmode.Request{Type: "events_api", EnvelopeID: envelopeID},
+	}
+}
+
+func TestSocketModeDispatch(t *testing.T) {
+	h, _, fake := newTestHandler(t)
+	createTestUser(t, h, "UALICE")
+
+	runner := &SocketModeRunner{handler: h}
+	acker := &fakeAcker{}
+	ctx := context.Background()
+
+	// An app mention runs the command
+	runner.handleEvent(ctx, acker, socketModeEvent("env-1", &slackevents.AppMentionEvent{
+		User:      "UALICE",
+		Channel:   "C123456",
+		Text:      "<@UBOT123> help",
+		TimeStamp: "1700000000.000100",
+	}))
+
+	if got := fake.lastMessage(t); !strings.Contains(got, "Claude Bot Commands") {
+		t.Errorf("app mention reply = %q, want the help message", got)
+	}
+
+	// A message goes to the session message handler, which ignores it without a session
+	runner.handleEvent(ctx, acker, socketModeEvent("env-2", &slackevents.MessageEvent{
+		User:            "UALICE",
+		Channel:         "C123456",
+		Text:            "<@UBOT123> help",
+		TimeStamp:       "1700000000.000200",
+		ThreadTimeStamp: "1700000000.000100",
+	}))
+
+	fake.mu.Lock()
+	posted := len(fake.messages)
+	fake.mu.Unlock()
+	if posted != 1 {
+		t.Errorf("posted %d messages, want only the help reply", posted)
+	}
+
+	if strings.Join(acker.acked, ",") != "env-1,env-2" {
+		t.Errorf("acked %v, want both envelopes", acker.acked)
+	}
+}
@@ -0,0 +1,242 @@
+package slack
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+
+	"github.com/pbdeuchler/claude-bot/internal/logging"
+)
+
+// DefaultStreamUpdateInterval is the minimum time between edits of a streaming message.
+// Slack allows roughly one chat.update per second per message.
+const DefaultStreamUpdateInterval = time.Second
+
+// messageEditor is the part of the Slack client a StreamingMessageUpdater needs
+type messageEditor interface {
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+}
+
+// StreamingMessageUpdater streams output into a single Slack message that is edited in
+// place as output accumulates. The first output is posted immediately; later output is
+// batched and the message edited at most once per interval. When a message would grow
+// past SlackMessageLimit it is finalized and a new one started. With a message cap set,
+// output that would start a message past the cap is held back and counted in a final
+// truncation notice instead.
+type StreamingMessageUpdater struct {
+	client    messageEditor
+	channelID string
+	threadTS  string
+	interval  time.Duration
+
+	// sendMu serializes Slack calls so edits are applied in order
+	sendMu sync.Mutex
+
+	mu        sync.Mutex
+	text      string    // text of the current message, including unsent output
+	sentText  string    // text of the current message as last sent to Slack
+	messageTS string    // timestamp of the current message, empty until it's posted
+	done      []string  // finalized messages that still have to be sent
+	lastSend  time.Time // when the last send started
+	timer     *time.Timer
+	finished  bool
+	err       error
+
+	maxMessages int      // most messages to post, not counting the truncation notice; 0 for no cap
+	started     int      // messages started so far
+	omitted     int      // lines held back once the cap was reached
+	lastOmitted string   // the last line held back, shown after the notice when finished
+	output      []string // every line appended, kept when there's a cap
+}
+
+// NewStreamingMessageUpdater creates an updater posting to channelID, in threadTS if set.
+// A non-positive interval uses DefaultStreamUpdateInterval.
+func NewStreamingMessageUpdater(client messageEditor, channelID, threadTS string, interval time.Duration) *StreamingMessageUpdater {
+	if interval <= 0 {
+		interval = DefaultStreamUpdateInterval
+	}
+	return &StreamingMessageUpdater{
+		client:    client,
+		channelID: channelID,
+		threadTS:  threadTS,
+		interval:  interval,
+	}
+}
+
+// SetMaxMessages caps the number of messages posted, not counting the truncation
+// notice, which ends with the last line of output once finished. Zero or less means no cap. Call it before appending output.
+func (u *StreamingMessageUpdater) SetMaxMessages(max int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.maxMessages = max
+}
+
+// Omitted returns the number of lines left out of the messages because the message cap
+// was reached. Call it after Finish.
+func (u *StreamingMessageUpdater) Omitted() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.omitted == 0 {
+		return 0
+	}
+	// The last line held back is shown after the notice
+	return u.omitted - 1
+}
+
+// Output returns all of the output appended, including lines held back by the message
+// cap. It's only kept when a cap is set.
+func (u *StreamingMessageUpdater) Output() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return strings.Join(u.output, "\n")
+}
+
+// Append adds a line of output. It's safe to call from the Claude output callback.
+func (u *StreamingMessageUpdater) Append(line string) {
+	line = strings.TrimRight(line, "\n")
+	if line == "" {
+		return
+	}
+
+	u.mu.Lock()
+	if u.finished {
+		u.mu.Unlock()
+		return
+	}
+
+	if u.maxMessages > 0 {
+		u.output = append(u.output, line)
+	}
+
+	if u.omitted > 0 {
+		u.omitted++
+		u.lastOmitted = line
+		u.text = FormatTruncationNotice(u.omitted)
+	} else {
+		for _, chunk := range splitForSlack(line) {
+			if u.text != "" && len(u.text)+1+len(chunk) > SlackMessageLimit {
+				u.done = append(u.done, u.text)
+				u.text = ""
+			}
+			if u.text == "" {
+				if u.maxMessages > 0 && u.started >= u.maxMessages {
+					// The truncation notice takes the place of the next message
+					u.omitted = 1
+					u.lastOmitted = line
+					u.text = FormatTruncationNotice(u.omitted)
+					break
+				}
+				u.started++
+			} else {
+				u.text += "\n"
+			}
+			u.text += chunk
+		}
+	}
+
+	// Send the first output (and overflow into a new message) right away; otherwise
+	// wait until the interval since the last send has passed. A pending timer will
+	// pick up this output, so don't flush alongside it.
+	wait := u.interval - time.Since(u.lastSend)
+	if len(u.done) > 0 || (u.timer == nil && wait <= 0) {
+		u.mu.Unlock()
+		u.flush()
+		return
+	}
+	if u.timer == nil {
+		u.timer = time.AfterFunc(wait, u.flush)
+	}
+	u.mu.Unlock()
+}
+
+// Finish sends any remaining output so the message holds the complete text, and stops
+// further updates. It returns the first error from Slack, if any.
+func (u *StreamingMessageUpdater) Finish() error {
+	u.mu.Lock()
+	u.finished = true
+	if u.omitted > 0 {
+		// End with the last line, usually Claude's result, after the notice
+		u.text = splitForSlack(u.lastOmitted)[0]
+		if u.omitted > 1 {
+			u.text = FormatTruncationNotice(u.omitted-1) + "\n" + u.text
+		}
+	}
+	if u.timer != nil {
+		u.timer.Stop()
+		u.timer = nil
+	}
+	u.mu.Unlock()
+
+	u.flush()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.err
+}
+
+// flush sends finalized messages and the current text if it changed since it was sent
+func (u *StreamingMessageUpdater) flush() {
+	u.sendMu.Lock()
+	defer u.sendMu.Unlock()
+
+	u.mu.Lock()
+	u.timer = nil
+	done := u.done
+	u.done = nil
+	messageTS := u.messageTS
+	if len(done) > 0 {
+		// The current text moved on to a new message
+		u.messageTS, u.sentText = "", ""
+	}
+	text, changed := u.text, u.text != u.sentText
+	// Output arriving while this send is in flight waits for the next interval
+	u.lastSend = time.Now()
+	u.mu.Unlock()
+
+	for _, final := range done {
+		u.send(messageTS, final)
+		messageTS = ""
+	}
+
+	if !changed || text == "" {
+		return
+	}
+
+	ts := u.send(messageTS, text)
+
+	u.mu.Lock()
+	u.messageTS = ts
+	u.sentText = text
+	u.mu.Unlock()
+}
+
+// send posts text as a new message, or edits the message at messageTS, returning the
+// message's timestamp
+func (u *StreamingMessageUpdater) send(messageTS, text string) string {
+	var err error
+	if messageTS == "" {
+		options := []slack.MsgOption{
+			slack.MsgOptionText(text, false),
+			slack.MsgOptionAsUser(true),
+		}
+		if u.threadTS != "" {
+			options = append(options, slack.MsgOptionTS(u.threadTS))
+		}
+		_, messageTS, err = u.client.PostMessage(u.channelID, options...)
+	} else {
+		_, _, _, err = u.client.UpdateMessage(u.channelID, messageTS, slack.MsgOptionText(text, false))
+	}
+
+	if err != nil {
+		logging.Error("Failed to stream message to Slack", "channel_id", u.channelID, "error", err)
+		u.mu.Lock()
+		if u.err == nil {
+			u.err = err
+		}
+		u.mu.Unlock()
+	}
+	return messageTS
+}
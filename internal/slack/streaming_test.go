@@ -0,0 +1,240 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// fakeEditor records the messages posted and edited through it
+type fakeEditor struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	posts    int
+	updates  int
+	messages map[string]string // latest text by timestamp
+	order    []string          // timestamps in posting order
+}
+
+func newFakeEditor(t *testing.T) *fakeEditor {
+	return &fakeEditor{t: t, messages: make(map[string]string)}
+}
+
+// messageText extracts the text option from a set of message options
+func messageText(t *testing.T, options []slack.MsgOption) string {
+	t.Helper()
+
+	_, values, err := slack.UnsafeApplyMsgOptions("xoxb-test", "C123456", "https://slack.com/api/", options...)
+	if err != nil {
+		t.Fatalf("Failed to apply message options: %v", err)
+	}
+	return values.Get("text")
+}
+
+func (f *fakeEditor) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
+	text := messageText(f.t, options)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.posts++
+	ts := fmt.Sprintf("1700000000.%06d", f.posts)
+	f.messages[ts] = text
+	f.order = append(f.order, ts)
+	return channelID, ts, nil
+}
+
+func (f *fakeEditor) UpdateMessage(channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	text := messageText(f.t, options)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates++
+	f.messages[timestamp] = text
+	return channelID, timestamp, text, nil
+}
+
+// texts returns the final text of each message in posting order
+func (f *fakeEditor) texts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var texts []string
+	for _, ts := range f.order {
+		texts = append(texts, f.messages[ts])
+	}
+	return texts
+}
+
+func TestStreamingMessageUpdaterThrottlesEdits(t *testing.T) {
+	fake := newFakeEditor(t)
+	interval := 20 * time.Millisecond
+	updater := NewStreamingMessageUpdater(fake, "C123456", "1234567890.123456", interval)
+
+	var want []string
+	start := time.Now()
+	// Rapid output that still fits in one message
+	for i := 0; i < 300; i++ {
+		line := fmt.Sprintf("line %d", i)
+		want = append(want, line)
+		updater.Append(line)
+		if i%30 == 0 {
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	if err := updater.Finish(); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if fake.posts != 1 {
+		t.Errorf("posted %d messages, want 1", fake.posts)
+	}
+	// One edit per interval at most, plus the final one from Finish
+	if maxUpdates := int(elapsed/interval) + 2; fake.updates > maxUpdates {
+		t.Errorf("edited %d times in %v, want at most %d", fake.updates, elapsed, maxUpdates)
+	}
+
+	texts := fake.texts()
+	if len(texts) != 1 || texts[0] != strings.Join(want, "\n") {
+		t.Errorf("final messages = %d (%d bytes), want one message with all %d lines", len(texts), len(strings.Join(texts, "")), len(want))
+	}
+}
+
+func TestStreamingMessageUpdaterSplitsLongOutput(t *testing.T) {
+	fake := newFakeEditor(t)
+	updater := NewStreamingMessageUpdater(fake, "C123456", "", time.Hour)
+
+	line := strings.Repeat("x", 1500)
+	for i := 0; i < 4; i++ {
+		updater.Append(line)
+	}
+	updater.Append(strings.Repeat("y", SlackMessageLimit+10))
+	if err := updater.Finish(); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	texts := fake.texts()
+	var total int
+	for _, text := range texts {
+		if len(text) > SlackMessageLimit {
+			t.Errorf("message length = %d, want at most %d", len(text), SlackMessageLimit)
+		}
+		total += strings.Count(text, "x") + strings.Count(text, "y")
+	}
+	if want := 4*1500 + SlackMessageLimit + 10; total != want {
+		t.Errorf("streamed %d characters, want %d", total, want)
+	}
+	if len(texts) < 3 {
+		t.Errorf("posted %d messages, want the output split across at least 3", len(texts))
+	}
+}
+
+func TestStreamingMessageUpdaterSplitsCodeBlocks(t *testing.T) {
+	fake := newFakeEditor(t)
+	updater := NewStreamingMessageUpdater(fake, "C123456", "", time.Hour)
+
+	var code []string
+	for i := 0; i < 200; i++ {
+		code = append(code, fmt.Sprintf("fmt.Println(%q)", strings.Repeat("z", 20)))
+	}
+	updater.Append("Here's the change:\n```go\n" + strings.Join(code, "\n") + "\n```\nDone.")
+	if err := updater.Finish(); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	// Each message closes the code block it opens, so every one renders as code
+	texts := fake.texts()
+	if len(texts) < 2 {
+		t.Fatalf("posted %d messages, want the code block split across messages", len(texts))
+	}
+	for i, text := range texts {
+		if len(text) > SlackMessageLimit {
+			t.Errorf("message %d length = %d, want at most %d", i, len(text), SlackMessageLimit)
+		}
+		if n := strings.Count(text, "```"); n%2 != 0 {
+			t.Errorf("message %d has %d code fences, want them balanced:\n%s", i, n, text)
+		}
+	}
+	if !strings.HasPrefix(texts[1], "```go\n") {
+		t.Errorf("message 1 starts %q, want the code block reopened", texts[1][:min(len(texts[1]), 20)])
+	}
+}
+
+func TestStreamingMessageUpdaterNoOutput(t *testing.T) {
+	fake := newFakeEditor(t)
+	updater := NewStreamingMessageUpdater(fake, "C123456", "", time.Millisecond)
+
+	updater.Append("")
+	if err := updater.Finish(); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	updater.Append("too late")
+
+	if fake.posts != 0 || fake.updates != 0 {
+		t.Errorf("posted %d and edited %d times, want no calls", fake.posts, fake.updates)
+	}
+}
+
+func TestStreamingMessageUpdaterCapsMessages(t *testing.T) {
+	fake := newFakeEditor(t)
+	updater := NewStreamingMessageUpdater(fake, "C123456", "", time.Millisecond)
+	updater.SetMaxMessages(2)
+
+	// Each line fills most of a message, so every line would start a new one
+	line := strings.Repeat("x", SlackChunkSize-100)
+	var want []string
+	for i := 0; i < 50; i++ {
+		want = append(want, fmt.Sprintf("%d %s", i, line))
+		updater.Append(want[i])
+	}
+	updater.Append("✅ done")
+	want = append(want, "✅ done")
+	if err := updater.Finish(); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	// Two messages of output, then the notice ending with the last line
+	texts := fake.texts()
+	if len(texts) != 3 {
+		t.Fatalf("posted %d messages, want 3", len(texts))
+	}
+	for i, text := range texts[:2] {
+		if text != want[i] {
+			t.Errorf("message %d = %.20q..., want line %d", i, text, i)
+		}
+	}
+	if wantNotice := FormatTruncationNotice(48) + "\n✅ done"; texts[2] != wantNotice {
+		t.Errorf("final message = %q, want %q", texts[2], wantNotice)
+	}
+
+	if got := updater.Omitted(); got != 48 {
+		t.Errorf("Omitted() = %d, want 48", got)
+	}
+	if got := updater.Output(); got != strings.Join(want, "\n") {
+		t.Errorf("Output() has %d bytes, want all %d bytes of output", len(got), len(strings.Join(want, "\n")))
+	}
+}
+
+func TestStreamingMessageUpdaterUnderCap(t *testing.T) {
+	fake := newFakeEditor(t)
+	updater := NewStreamingMessageUpdater(fake, "C123456", "", time.Millisecond)
+	updater.SetMaxMessages(2)
+
+	updater.Append("one")
+	updater.Append("two")
+	if err := updater.Finish(); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+
+	if texts := fake.texts(); len(texts) != 1 || texts[0] != "one\ntwo" {
+		t.Errorf("messages = %q, want the output in one message", texts)
+	}
+	if got := updater.Omitted(); got != 0 {
+		t.Errorf("Omitted() = %d, want 0", got)
+	}
+}
@@ -0,0 +1,24 @@
+package slack
+
+import (
+	"github.com/slack-go/slack/slackevents"
+)
+
+// ResolveWorkspaceID determines the key used to scope users and sessions for an event.
+//
+// On Enterprise Grid installs a single bot spans several workspaces (teams) that share
+// one organization. When useEnterpriseID is set, events carrying an enterprise ID are
+// keyed on the organization so that the same user resolves to the same records no matter
+// which workspace they are talking from. Otherwise, and for non-Grid events, the team ID
+// is used.
+func ResolveWorkspaceID(teamID, enterpriseID string, useEnterpriseID bool) string {
+	if useEnterpriseID && enterpriseID != "" {
+		return enterpriseID
+	}
+	return teamID
+}
+
+// WorkspaceIDFromEvent resolves the workspace key from an Events API envelope
+func WorkspaceIDFromEvent(event slackevents.EventsAPIEvent, useEnterpriseID bool) string {
+	return ResolveWorkspaceID(event.TeamID, event.EnterpriseID, useEnterpriseID)
+}
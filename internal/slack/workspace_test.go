@@ -0,0 +1,82 @@
+package slack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/slack-go/slack/slackevents"
+)
+
+func TestResolveWorkspaceID(t *testing.T) {
+	tests := []struct {
+		name            string
+		teamID          string
+		enterpriseID    string
+		useEnterpriseID bool
+		want            string
+	}{
+		{"non-grid event", "T123", "", false, "T123"},
+		{"non-grid event with enterprise keying", "T123", "", true, "T123"},
+		{"grid event without enterprise keying", "T123", "E999", false, "T123"},
+		{"grid event with enterprise keying", "T123", "E999", true, "E999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveWorkspaceID(tt.teamID, tt.enterpriseID, tt.useEnterpriseID); got != tt.want {
+				t.Errorf("ResolveWorkspaceID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkspaceIDFromEvent_GridConsistency(t *testing.T) {
+	// The same org spanning two workspaces
+	eventA := slackevents.EventsAPIEvent{TeamID: "T111", EnterpriseID: "E999"}
+	eventB := slackevents.EventsAPIEvent{TeamID: "T222", EnterpriseID: "E999"}
+
+	keyA := WorkspaceIDFromEvent(eventA, true)
+	keyB := WorkspaceIDFromEvent(eventB, true)
+	if keyA != keyB {
+		t.Errorf("expected grid events to resolve to the same key, got %s and %s", keyA, keyB)
+	}
+	if keyA != "E999" {
+		t.Errorf("expected enterprise key E999, got %s", keyA)
+	}
+
+	// Without enterprise keying the workspaces stay distinct
+	if WorkspaceIDFromEvent(eventA, false) == WorkspaceIDFromEvent(eventB, false) {
+		t.Error("expected team-keyed events from different workspaces to differ")
+	}
+}
+
+func TestHandleEventsAPIEventMovesTeamRecords(t *testing.T) {
+	h, database, _ := newTestHandler(t)
+	alice := createTestUser(t, h, "UALICE")
+	ctx := context.Background()
+
+	event := callbackEvent("Ev123", &slackevents.AppMentionEvent{
+		User:      "UALICE",
+		Channel:   "C123456",
+		Text:      "<@UBOT123> help",
+		TimeStamp: "1700000000.000100",
+	})
+	event.EnterpriseID = "E999"
+
+	// Without enterprise keying the team's records stay where they are
+	if err := h.HandleEventsAPIEvent(ctx, event, false); err != nil {
+		t.Fatalf("HandleEventsAPIEvent() error = %v", err)
+	}
+	if _, err := database.GetUserBySlackID(ctx, "E999", "UALICE"); err == nil {
+		t.Fatal("user was moved to the enterprise ID without USE_ENTERPRISE_ID")
+	}
+
+	event.Data = &slackevents.EventsAPICallbackEvent{EventID: "Ev456"}
+	if err := h.HandleEventsAPIEvent(ctx, event, true); err != nil {
+		t.Fatalf("HandleEventsAPIEvent() error = %v", err)
+	}
+	moved, err := database.GetUserBySlackID(ctx, "E999", "UALICE")
+	if err != nil || moved.ID != alice.ID {
+		t.Errorf("GetUserBySlackID(E999) = %v, %v, want the user created under the team", moved, err)
+	}
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ModelInfo describes a Claude model sessions can run with
+type ModelInfo struct {
+	Name               string  // model name passed to the claude CLI's --model flag
+	InputPricePerMTok  float64 // USD per million input tokens
+	OutputPricePerMTok float64 // USD per million output tokens
+}
+
+// ModelRegistry maps the model names users may give, such as "haiku" or a full model
+// ID, to the model they select. Lookups ignore case.
+type ModelRegistry map[string]ModelInfo
+
+// Models is the registry of models sessions can be started with
+var Models = ModelRegistry{
+	ModelSonnet: {Name: ModelSonnet, InputPricePerMTok: 3, OutputPricePerMTok: 15},
+	ModelOpus:   {Name: ModelOpus, InputPricePerMTok: 15, OutputPricePerMTok: 75},
+	ModelHaiku:  {Name: ModelHaiku, InputPricePerMTok: 0.8, OutputPricePerMTok: 4},
+
+	"claude-opus-4-20250514":     {Name: "claude-opus-4-20250514", InputPricePerMTok: 15, OutputPricePerMTok: 75},
+	"claude-sonnet-4-20250514":   {Name: "claude-sonnet-4-20250514", InputPricePerMTok: 3, OutputPricePerMTok: 15},
+	"claude-3-7-sonnet-20250219": {Name: "claude-3-7-sonnet-20250219", InputPricePerMTok: 3, OutputPricePerMTok: 15},
+	"claude-3-5-sonnet-20241022": {Name: "claude-3-5-sonnet-20241022", InputPricePerMTok: 3, OutputPricePerMTok: 15},
+	"claude-3-5-haiku-20241022":  {Name: "claude-3-5-haiku-20241022", InputPricePerMTok: 0.8, OutputPricePerMTok: 4},
+}
+
+// Cost returns the cost in USD of the given token counts at the model's prices
+func (m ModelInfo) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*m.InputPricePerMTok + float64(outputTokens)*m.OutputPricePerMTok) / 1e6
+}
+
+// Resolve returns the model registered under name. Unknown names are an
+// ErrCodeInvalidCommand error listing the registered ones.
+func (r ModelRegistry) Resolve(name string) (ModelInfo, error) {
+	if info, ok := r[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return info, nil
+	}
+	return ModelInfo{}, NewCBError(ErrCodeInvalidCommand,
+		fmt.Sprintf("unknown model '%s', must be one of: %s", name, strings.Join(r.Aliases(), ", ")), nil)
+}
+
+// Aliases returns the registered model names, sorted
+func (r ModelRegistry) Aliases() []string {
+	aliases := make([]string, 0, len(r))
+	for alias := range r {
+		aliases = append(aliases, alias)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestModelRegistryResolve(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantName string
+		wantErr  bool
+	}{
+		{name: "sonnet alias", input: "sonnet", wantName: ModelSonnet},
+		{name: "opus alias", input: "opus", wantName: ModelOpus},
+		{name: "haiku alias", input: "haiku", wantName: ModelHaiku},
+		{name: "case and spaces ignored", input: " Haiku ", wantName: ModelHaiku},
+		{name: "full model ID", input: "claude-3-5-sonnet-20241022", wantName: "claude-3-5-sonnet-20241022"},
+		{name: "unknown model", input: "gpt-4", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Models.Resolve(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCommand) || !strings.Contains(err.Error(), "haiku") {
+					t.Errorf("Resolve(%q) error = %v, want an invalid command error listing the models", tt.input, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) error = %v", tt.input, err)
+			}
+			if got.Name != tt.wantName {
+				t.Errorf("Resolve(%q) name = %q, want %q", tt.input, got.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestModelsAreResolvableByName(t *testing.T) {
+	// Sessions store a model's name, which must resolve to itself when validated again
+	for alias, info := range Models {
+		got, err := Models.Resolve(info.Name)
+		if err != nil || got != info {
+			t.Errorf("model %s: Resolve(%q) = %+v, %v, want %+v", alias, info.Name, got, err, info)
+		}
+		if info.InputPricePerMTok <= 0 || info.OutputPricePerMTok <= 0 {
+			t.Errorf("model %s has no price", alias)
+		}
+	}
+}
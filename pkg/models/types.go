@@ -1,11 +1,15 @@
 package models
 
 import (
+	"errors"
 	"fmt"
 	"time"
 )
 
-// User represents a user in the system
+// User represents a user in the system.
+//
+// SlackWorkspaceID holds the resolved workspace key: the enterprise (org) ID for
+// Enterprise Grid installs when USE_ENTERPRISE_ID is enabled, otherwise the team ID.
 type User struct {
 	ID               int64     `json:"id" db:"id"`
 	SlackWorkspaceID string    `json:"slack_workspace_id" db:"slack_workspace_id"`
@@ -25,7 +29,8 @@ type Credential struct {
 	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
 }
 
-// Session represents an active Claude Code session
+// Session represents an active Claude Code session.
+// SlackWorkspaceID follows the same workspace key semantics as User.
 type Session struct {
 	ID               int64      `json:"id" db:"id"`
 	SessionID        string     `json:"session_id" db:"session_id"` // This is the Claude session ID
@@ -41,6 +46,10 @@ type Session struct {
 	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
 	EndedAt          *time.Time `json:"ended_at" db:"ended_at"`
+	IdempotencyKey   string     `json:"idempotency_key,omitempty" db:"idempotency_key"`
+	// MaxCost is the session's own cost budget in USD, 0 for none. It is stored on
+	// creation; read it back with GetSessionMaxCost.
+	MaxCost float64 `json:"max_cost,omitempty" db:"max_cost"`
 }
 
 // SystemPrompt represents a reusable system prompt template
@@ -82,6 +91,95 @@ type SessionMessage struct {
 	CreatedAt      time.Time `json:"created_at" db:"created_at"`
 }
 
+// MCPServer represents a registered MCP server definition. Config holds the JSON
+// server definition as understood by the claude CLI (command, args, env, ...).
+type MCPServer struct {
+	ID        int64     `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	Config    string    `json:"config" db:"config"`
+	CreatedBy int64     `json:"created_by" db:"created_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// MCPServerStatus represents an MCP server status as reported by Claude's system/init message
+type MCPServerStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// UserLimits reports a user's usage against the configured limits. A zero limit
+// (SessionCreateLimit, MaxSessions) means no limit is configured.
+type UserLimits struct {
+	SessionCreatesRemaining int     `json:"session_creates_remaining"`
+	SessionCreateLimit      int     `json:"session_create_limit"`
+	SessionCreateWindow     int     `json:"session_create_window"` // seconds
+	ActiveSessions          int     `json:"active_sessions"`
+	MaxSessions             int     `json:"max_sessions"`
+	TotalCostUSD            float64 `json:"total_cost_usd"`
+}
+
+// SessionSummary is the record of a session compiled when it is stopped
+type SessionSummary struct {
+	ID              int64     `json:"id" db:"id"`
+	SessionID       int64     `json:"session_id" db:"session_id"`
+	Feature         string    `json:"feature" db:"feature"`
+	Branch          string    `json:"branch" db:"branch"`
+	RepoURL         string    `json:"repo_url" db:"repo_url"`
+	Commits         int       `json:"commits" db:"commits"`
+	FilesChanged    int       `json:"files_changed" db:"files_changed"`
+	Insertions      int       `json:"insertions" db:"insertions"`
+	Deletions       int       `json:"deletions" db:"deletions"`
+	CommitSHA       string    `json:"commit_sha" db:"commit_sha"` // branch head pushed when the session stopped; empty if the push failed
+	TotalCost       float64   `json:"total_cost" db:"total_cost"`
+	Turns           int       `json:"turns" db:"turns"`
+	DurationSeconds int64     `json:"duration_seconds" db:"duration_seconds"`
+	PRURL           string    `json:"pr_url" db:"pr_url"` // empty if no pull request was opened
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
+
+// LeaveResult describes what happened when a user left a session
+type LeaveResult struct {
+	Outcome    string `json:"outcome"`      // one of the LeaveOutcome constants
+	NewOwnerID int64  `json:"new_owner_id"` // set when ownership was transferred
+}
+
+// Leave outcome constants
+const (
+	LeaveOutcomeLeft        = "left"        // a non-owner left
+	LeaveOutcomeTransferred = "transferred" // the owner left and another member became owner
+	LeaveOutcomeEnded       = "ended"       // the owner was the last member, so the session was ended
+)
+
+// SessionDiscrepancy is a difference between an active session's record and its actual
+// work tree, found when verifying sessions
+type SessionDiscrepancy struct {
+	SessionID int64  `json:"session_id"`
+	Feature   string `json:"feature"`
+	Problem   string `json:"problem"`
+	Marked    bool   `json:"marked"` // the session was marked as errored
+}
+
+// PromptImportResult reports which prompts of an imported library were created and
+// which were skipped
+type PromptImportResult struct {
+	Created []string           `json:"created"`
+	Skipped []PromptImportSkip `json:"skipped"`
+}
+
+// PromptImportSkip is a prompt that wasn't imported and why
+type PromptImportSkip struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// UserPrefs holds a user's preferences
+type UserPrefs struct {
+	UserID    int64     `json:"user_id" db:"user_id"`
+	Notify    string    `json:"notify" db:"notify"` // one of the Notify constants
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
 // Request/Response types for service operations
 
 // CreateSessionRequest represents a request to create a new session
@@ -96,6 +194,11 @@ type CreateSessionRequest struct {
 	ModelName         string `json:"model_name"`
 	PromptText        string `json:"prompt_text,omitempty"`
 	PromptName        string `json:"prompt_name,omitempty"`
+	// IdempotencyKey makes creation safe to retry: a repeated create with the same key
+	// returns the session created by the first request
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// MaxCostUSD stops the session once its cost reaches it; 0 for no budget of its own
+	MaxCostUSD float64 `json:"max_cost_usd,omitempty"`
 }
 
 // CreateUserRequest represents a request to create a new user
@@ -172,6 +275,12 @@ const (
 	ErrCodeSessionNotFound   = "SESSION_NOT_FOUND"
 	ErrCodeUnauthorized      = "UNAUTHORIZED"
 	ErrCodeInvalidChannel    = "INVALID_CHANNEL"
+	ErrCodeRateLimited       = "RATE_LIMITED"
+	ErrCodeQuotaExceeded     = "QUOTA_EXCEEDED"
+	ErrCodeSpendFrozen       = "SPEND_FROZEN"
+	ErrCodeTurnInterrupted   = "TURN_INTERRUPTED"
+	ErrCodeCommandTimeout    = "COMMAND_TIMEOUT"
+	ErrCodeRequestReplayed   = "REQUEST_REPLAYED"
 )
 
 // NewCBError creates a new structured error
@@ -194,12 +303,48 @@ func (e *CBError) Unwrap() error {
 	return e.Err
 }
 
+// Is reports whether target is a CBError with the same code, so errors.Is can
+// match a wrapped CBError against the sentinels below
+func (e *CBError) Is(target error) bool {
+	t, ok := target.(*CBError)
+	return ok && t.Code == e.Code
+}
+
+// Sentinel errors for matching CBErrors by code with errors.Is
+var (
+	ErrInvalidCommand    = &CBError{Code: ErrCodeInvalidCommand}
+	ErrSessionExists     = &CBError{Code: ErrCodeSessionExists}
+	ErrNoCredentials     = &CBError{Code: ErrCodeNoCredentials}
+	ErrClaudeUnavailable = &CBError{Code: ErrCodeClaudeUnavailable}
+	ErrRepoAccess        = &CBError{Code: ErrCodeRepoAccess}
+	ErrDatabase          = &CBError{Code: ErrCodeDatabaseError}
+	ErrEncryption        = &CBError{Code: ErrCodeEncryptionError}
+	ErrSessionNotFound   = &CBError{Code: ErrCodeSessionNotFound}
+	ErrUnauthorized      = &CBError{Code: ErrCodeUnauthorized}
+	ErrInvalidChannel    = &CBError{Code: ErrCodeInvalidChannel}
+	ErrRateLimited       = &CBError{Code: ErrCodeRateLimited}
+	ErrQuotaExceeded     = &CBError{Code: ErrCodeQuotaExceeded}
+	ErrSpendFrozen       = &CBError{Code: ErrCodeSpendFrozen}
+	ErrTurnInterrupted   = &CBError{Code: ErrCodeTurnInterrupted}
+	ErrCommandTimeout    = &CBError{Code: ErrCodeCommandTimeout}
+	ErrRequestReplayed   = &CBError{Code: ErrCodeRequestReplayed}
+)
+
+// Lookups that find nothing return these rather than a nil result, so
+// callers can tell them apart from failures with errors.Is
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrNoActiveSession = errors.New("no active session in this channel/thread")
+)
+
 // Session status constants
 const (
-	SessionStatusActive = "active"
-	SessionStatusEnding = "ending"
-	SessionStatusEnded  = "ended"
-	SessionStatusError  = "error"
+	SessionStatusStarting = "starting" // Setup in progress
+	SessionStatusActive   = "active"
+	SessionStatusEnding   = "ending"
+	SessionStatusEnded    = "ended"
+	SessionStatusError    = "error"
+	SessionStatusDetached = "detached" // Stopped by a shutdown in detach mode; resumed on the next start
 )
 
 // Credential type constants
@@ -221,8 +366,17 @@ const (
 	SessionRoleViewer       = "viewer"
 )
 
-// Claude model constants
+// Notification preference constants, controlling when the bot @-mentions a session's
+// owner on session events
+const (
+	NotifyOn       = "on"       // mention on every session event
+	NotifyOff      = "off"      // never mention
+	NotifyMentions = "mentions" // mention only on alerts: budget alerts and errors
+)
+
+// Claude model constants; see Models for every model name that's accepted
 const (
 	ModelSonnet = "sonnet"
 	ModelOpus   = "opus"
+	ModelHaiku  = "haiku"
 )
\ No newline at end of file
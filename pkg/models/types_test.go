@@ -0,0 +1,34 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCBErrorIs(t *testing.T) {
+	notFound := NewCBError(ErrCodeSessionNotFound, "session not found", errors.New("sql: no rows in result set"))
+
+	tests := []struct {
+		name   string
+		err    error
+		target error
+		want   bool
+	}{
+		{name: "same code", err: notFound, target: ErrSessionNotFound, want: true},
+		{name: "wrapped", err: fmt.Errorf("failed to end session: %w", notFound), target: ErrSessionNotFound, want: true},
+		{name: "wrapped twice", err: fmt.Errorf("outer: %w", fmt.Errorf("inner: %w", notFound)), target: ErrSessionNotFound, want: true},
+		{name: "different code", err: notFound, target: ErrUnauthorized, want: false},
+		{name: "cause still matches", err: NewCBError(ErrCodeDatabaseError, "lookup failed", ErrUserNotFound), target: ErrUserNotFound, want: true},
+		{name: "plain error", err: errors.New("session not found"), target: ErrSessionNotFound, want: false},
+		{name: "nil", err: nil, target: ErrSessionNotFound, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Is(tt.err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+			}
+		})
+	}
+}
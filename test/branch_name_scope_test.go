@@ -0,0 +1,207 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestFeatureNameScopedToWorkspaceRepo(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	newUser := func(workspaceID string) *models.User {
+		user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+			SlackWorkspaceID: workspaceID,
+			SlackUserID:      "U123456",
+			SlackUserName:    "testuser",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	newRequest := func(user *models.User, repoURL, feature string) *models.CreateSessionRequest {
+		return &models.CreateSessionRequest{
+			WorkspaceID:     user.SlackWorkspaceID,
+			CreatedByUserID: user.ID,
+			ChannelID:       "C123456",
+			ThreadTS:        "ts-" + user.SlackWorkspaceID + "-" + repoURL + "-" + feature,
+			RepoURL:         repoURL,
+			FromCommitish:   "main",
+			FeatureName:     feature,
+			ModelName:       models.ModelSonnet,
+		}
+	}
+
+	first := newUser("T123456")
+	second := newUser("T654321")
+	const repoURL = "https://github.com/test/repo"
+
+	if _, err := sessionMgr.CreateSession(ctx, newRequest(first, repoURL, "shared-name")); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	t.Run("same workspace and repo", func(t *testing.T) {
+		_, err := sessionMgr.CreateSession(ctx, newRequest(first, repoURL, "shared-name"))
+		cbErr, ok := err.(*models.CBError)
+		if !ok || cbErr.Code != models.ErrCodeSessionExists {
+			t.Fatalf("CreateSession() error = %v, want %s", err, models.ErrCodeSessionExists)
+		}
+	})
+
+	t.Run("same repo by another URL", func(t *testing.T) {
+		for _, otherURL := range []string{"git@github.com:test/repo.git", "https://github.com/Test/repo.git/"} {
+			_, err := sessionMgr.CreateSession(ctx, newRequest(first, otherURL, "shared-name"))
+			cbErr, ok := err.(*models.CBError)
+			if !ok || cbErr.Code != models.ErrCodeSessionExists {
+				t.Errorf("CreateSession(%s) error = %v, want %s", otherURL, err, models.ErrCodeSessionExists)
+			}
+		}
+	})
+
+	t.Run("another workspace", func(t *testing.T) {
+		session, err := sessionMgr.CreateSession(ctx, newRequest(second, repoURL, "shared-name"))
+		if err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+
+		found, err := database.GetSessionByBranchName(ctx, "T654321", "", "shared-name")
+		if err != nil {
+			t.Fatalf("GetSessionByBranchName() error = %v", err)
+		}
+		if found.ID != session.ID {
+			t.Errorf("GetSessionByBranchName() = session %d, want %d", found.ID, session.ID)
+		}
+	})
+
+	t.Run("another repo in the same workspace", func(t *testing.T) {
+		const otherRepoURL = "https://github.com/test/other-repo"
+		session, err := sessionMgr.CreateSession(ctx, newRequest(first, otherRepoURL, "shared-name"))
+		if err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+
+		// With the repo the lookup finds that repo's session
+		found, err := database.GetSessionByBranchName(ctx, "T123456", otherRepoURL, "shared-name")
+		if err != nil {
+			t.Fatalf("GetSessionByBranchName() error = %v", err)
+		}
+		if found.ID != session.ID {
+			t.Errorf("GetSessionByBranchName() = session %d, want %d", found.ID, session.ID)
+		}
+		found, err = database.GetSessionByBranchName(ctx, "T123456", repoURL, "shared-name")
+		if err != nil {
+			t.Fatalf("GetSessionByBranchName() error = %v", err)
+		}
+		if found.RepoURL != repoURL {
+			t.Errorf("GetSessionByBranchName() = session of %s, want %s", found.RepoURL, repoURL)
+		}
+
+		// Without it the name is ambiguous rather than resolved to either session
+		_, err = database.GetSessionByBranchName(ctx, "T123456", "", "shared-name")
+		cbErr, ok := err.(*models.CBError)
+		if !ok || cbErr.Code != models.ErrCodeInvalidCommand {
+			t.Fatalf("GetSessionByBranchName() without a repo error = %v, want %s", err, models.ErrCodeInvalidCommand)
+		}
+	})
+
+	t.Run("ended session's name is reused", func(t *testing.T) {
+		ended := createOwnedSession(t, database, first.ID, "reused-name", models.SessionStatusEnded)
+
+		exists, err := database.CheckBranchNameExists(ctx, "T123456", repoURL, "reused-name")
+		if err != nil {
+			t.Fatalf("CheckBranchNameExists() error = %v", err)
+		}
+		if exists {
+			t.Error("CheckBranchNameExists() = true for an ended session's name")
+		}
+
+		session, err := sessionMgr.CreateSession(ctx, newRequest(first, repoURL, "reused-name"))
+		if err != nil {
+			t.Fatalf("CreateSession() error = %v", err)
+		}
+
+		// The live session is found rather than the ended one
+		found, err := database.GetSessionByBranchName(ctx, "T123456", "", "reused-name")
+		if err != nil {
+			t.Fatalf("GetSessionByBranchName() error = %v", err)
+		}
+		if found.ID != session.ID || found.ID == ended.ID {
+			t.Errorf("GetSessionByBranchName() = session %d, want the new session %d", found.ID, session.ID)
+		}
+	})
+}
+
+func TestConcurrentCreatesClaimFeatureNameOnce(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	const creates = 2
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make([]error, creates)
+	for i := 0; i < creates; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = sessionMgr.CreateSession(ctx, &models.CreateSessionRequest{
+				WorkspaceID:     "T123456",
+				CreatedByUserID: owner.ID,
+				ChannelID:       "C123456",
+				ThreadTS:        fmt.Sprintf("ts-race-%d", i),
+				RepoURL:         "https://github.com/test/repo",
+				FromCommitish:   "main",
+				FeatureName:     "race-feature",
+				ModelName:       models.ModelSonnet,
+			})
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		cbErr, ok := err.(*models.CBError)
+		if !ok || cbErr.Code != models.ErrCodeSessionExists {
+			t.Errorf("CreateSession() error = %v, want %s", err, models.ErrCodeSessionExists)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("%d of %d creates succeeded, want exactly 1", succeeded, creates)
+	}
+
+	// The winning session has its owner
+	session, err := database.GetSessionByBranchName(ctx, "T123456", "", "race-feature")
+	if err != nil {
+		t.Fatalf("GetSessionByBranchName() error = %v", err)
+	}
+	ownerID, err := database.GetSessionOwner(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionOwner() error = %v", err)
+	}
+	if ownerID != owner.ID {
+		t.Errorf("session owner = %d, want %d", ownerID, owner.ID)
+	}
+}
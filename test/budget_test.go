@@ -0,0 +1,214 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestBudgetAlertCrossPostedToAlertChannel(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Budget.WarnThresholdUSD = 1.0
+		cfg.Budget.AlertChannelID = "CALERTS"
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	session := &models.Session{
+		SessionID:        "claude-session-budget",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "budget-feature",
+		WorkTreePath:     "/tmp/budget-feature",
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	var threadMessages, alertMessages []string
+	sessionMgr.SetAlertCallback(func(message string) {
+		alertMessages = append(alertMessages, message)
+	})
+	threadCallback := func(message string) {
+		threadMessages = append(threadMessages, message)
+	}
+
+	// Below the threshold nothing is posted
+	if err := sessionMgr.RecordSessionCost(ctx, session, 0.5, threadCallback); err != nil {
+		t.Fatalf("Failed to record cost: %v", err)
+	}
+	if len(threadMessages) != 0 || len(alertMessages) != 0 {
+		t.Fatalf("Expected no alerts below threshold, got thread=%v alert=%v", threadMessages, alertMessages)
+	}
+
+	// Crossing the threshold posts to both the thread and the alert channel
+	if err := sessionMgr.RecordSessionCost(ctx, session, 0.75, threadCallback); err != nil {
+		t.Fatalf("Failed to record cost: %v", err)
+	}
+	if len(threadMessages) != 1 {
+		t.Fatalf("Expected 1 thread alert, got %d", len(threadMessages))
+	}
+	if len(alertMessages) != 1 {
+		t.Fatalf("Expected 1 alert channel post, got %d", len(alertMessages))
+	}
+	if !strings.Contains(alertMessages[0], "budget-feature") {
+		t.Errorf("Expected alert to name the session, got %q", alertMessages[0])
+	}
+
+	// Further updates above the threshold don't repeat the alert
+	if err := sessionMgr.RecordSessionCost(ctx, session, 0.25, threadCallback); err != nil {
+		t.Fatalf("Failed to record cost: %v", err)
+	}
+	if len(threadMessages) != 1 || len(alertMessages) != 1 {
+		t.Errorf("Expected alert to fire once, got thread=%d alert=%d", len(threadMessages), len(alertMessages))
+	}
+
+	// The cost is persisted
+	stored, err := database.GetSession(ctx, session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if stored.RunningCost != 1.5 {
+		t.Errorf("Expected stored cost 1.5, got %f", stored.RunningCost)
+	}
+}
+
+func TestSessionStoppedOverBudget(t *testing.T) {
+	// Each case ends up with an effective budget of $2
+	tests := []struct {
+		name    string
+		maxCost float64 // MAX_SESSION_COST_USD
+		budget  float64 // the session's --budget
+	}{
+		{name: "configured maximum", maxCost: 2.0},
+		{name: "session budget", budget: 2.0},
+		{name: "session budget below the maximum", maxCost: 5.0, budget: 2.0},
+		{name: "maximum below the session budget", maxCost: 2.0, budget: 5.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+				cfg.Budget.MaxSessionCostUSD = tt.maxCost
+			})
+			defer cleanup()
+
+			ctx := context.Background()
+
+			session := &models.Session{
+				SessionID:        "claude-session-capped",
+				SlackWorkspaceID: "T123456",
+				SlackChannelID:   "C123456",
+				SlackThreadTS:    "1234567890.123456",
+				RepoURL:          "https://github.com/test/repo",
+				BranchName:       "capped-feature",
+				WorkTreePath:     "/tmp/capped-feature",
+				ModelName:        models.ModelSonnet,
+				Status:           models.SessionStatusActive,
+				MaxCost:          tt.budget,
+			}
+			if err := database.CreateSession(ctx, session); err != nil {
+				t.Fatalf("Failed to create session: %v", err)
+			}
+
+			var threadMessages []string
+			threadCallback := func(message string) {
+				threadMessages = append(threadMessages, message)
+			}
+
+			// Under the budget the session keeps running
+			if err := sessionMgr.RecordSessionCost(ctx, session, 1.5, threadCallback); err != nil {
+				t.Fatalf("Failed to record cost: %v", err)
+			}
+			stored, err := database.GetSession(ctx, session.SessionID)
+			if err != nil {
+				t.Fatalf("Failed to get session: %v", err)
+			}
+			if stored.Status != models.SessionStatusActive || len(threadMessages) != 0 {
+				t.Fatalf("Under budget: status = %s, messages = %v, want active and none", stored.Status, threadMessages)
+			}
+
+			// Past it the session is ended with a warning in the thread
+			if err := sessionMgr.RecordSessionCost(ctx, session, 1.0, threadCallback); err != nil {
+				t.Fatalf("Failed to record cost: %v", err)
+			}
+			stored, err = database.GetSession(ctx, session.SessionID)
+			if err != nil {
+				t.Fatalf("Failed to get session: %v", err)
+			}
+			if stored.Status != models.SessionStatusEnded {
+				t.Errorf("Over budget: status = %s, want %s", stored.Status, models.SessionStatusEnded)
+			}
+			if len(threadMessages) != 1 || !strings.Contains(threadMessages[0], "$2.00 budget") {
+				t.Errorf("Over budget: messages = %v, want a warning about the $2.00 budget", threadMessages)
+			}
+		})
+	}
+}
+
+func TestStaleSessionCopiesCountTowardsBudget(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Budget.MaxSessionCostUSD = 2.0
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	session := &models.Session{
+		SessionID:        "claude-session-stale",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "stale-feature",
+		WorkTreePath:     "/tmp/stale-feature",
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// Two turns each load the session before either has recorded its cost
+	first, err := database.GetSession(ctx, session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	second, err := database.GetSession(ctx, session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+
+	var threadMessages []string
+	threadCallback := func(message string) {
+		threadMessages = append(threadMessages, message)
+	}
+	if err := sessionMgr.RecordSessionCost(ctx, first, 1.25, threadCallback); err != nil {
+		t.Fatalf("Failed to record cost: %v", err)
+	}
+	if err := sessionMgr.RecordSessionCost(ctx, second, 1.25, threadCallback); err != nil {
+		t.Fatalf("Failed to record cost: %v", err)
+	}
+
+	stored, err := database.GetSession(ctx, session.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if stored.RunningCost != 2.5 {
+		t.Errorf("stored cost = %f, want 2.5", stored.RunningCost)
+	}
+	if stored.Status != models.SessionStatusEnded {
+		t.Errorf("status = %s, want %s once both turns' costs pass the budget", stored.Status, models.SessionStatusEnded)
+	}
+	if len(threadMessages) != 1 || !strings.Contains(threadMessages[0], "$2.00 budget") {
+		t.Errorf("messages = %v, want a warning about the $2.00 budget", threadMessages)
+	}
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/session"
+)
+
+func TestClaudeMessageFormatContent(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want string
+	}{
+		{
+			name: "assistant text",
+			line: `{"type":"assistant","session_id":"abc","message":{"id":"msg_1","type":"message","role":"assistant","model":"claude-sonnet-4","content":[{"type":"text","text":"I'll look at the handler first."}],"stop_reason":null}}`,
+			want: "🤖 I'll look at the handler first.",
+		},
+		{
+			name: "text blocks joined",
+			line: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"The tests pass. "},{"type":"text","text":"Ready for review."}]}}`,
+			want: "🤖 The tests pass. Ready for review.",
+		},
+		{
+			name: "text and tool use",
+			line: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Running the tests."},{"type":"tool_use","id":"toolu_1","name":"Bash","input":{"command":"go test ./...","description":"Run tests"}}]}}`,
+			want: "🤖 Running the tests.\n🖥️ Bash(go test ./...)",
+		},
+		{
+			name: "file tool shows its path",
+			line: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_2","name":"Write","input":{"file_path":"main.go","content":"package main\n\nfunc main() {\n\tprintln(\"this is a rather long file body that goes on and on\")\n}\n"}}]}}`,
+			want: "🔧 Write(path=main.go)",
+		},
+		{
+			name: "tool calls between prose on separate lines",
+			line: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Fixing the handler."},{"type":"tool_use","id":"toolu_3","name":"Edit","input":{"file_path":"internal/slack/handler.go","old_string":"a","new_string":"b"}},{"type":"tool_use","id":"toolu_4","name":"Grep","input":{"pattern":"func handle","path":"internal"}},{"type":"text","text":"Done."}]}}`,
+			want: "🤖 Fixing the handler.\n🔧 Edit(path=internal/slack/handler.go)\n🔧 Grep(pattern=func handle)\n🤖 Done.",
+		},
+		{
+			name: "multi-line command flattened",
+			line: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_5","name":"Bash","input":{"command":"cd internal &&\n  go vet ./..."}}]}}`,
+			want: "🖥️ Bash(cd internal && go vet ./...)",
+		},
+		{
+			name: "other tools show all inputs",
+			line: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_6","name":"mcp__fetch__fetch","input":{"url":"https://example.com/a/rather/long/path/that/keeps/going/and/going/until/it/is/cut/off/somewhere","max_length":5000}}]}}`,
+			want: "🔧 mcp__fetch__fetch(max_length: 5000, url: \"https://example.com/a/rather/long/path/that/keeps/going/and/going/until/it/is/cut/off/somewhere\")",
+		},
+		{
+			name: "thinking hidden",
+			line: `{"type":"assistant","message":{"role":"assistant","content":[{"type":"thinking","thinking":"Let me consider..."}]}}`,
+			want: "",
+		},
+		{
+			name: "tool result",
+			line: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"ok  \tgithub.com/pbdeuchler/claude-bot/internal/slack\t0.2s\nok  \tgithub.com/pbdeuchler/claude-bot/test\t0.6s"}]}}`,
+			want: "↳ ok  \tgithub.com/pbdeuchler/claude-bot/internal/slack\t0.2s (+1 lines)",
+		},
+		{
+			name: "tool result blocks with error",
+			line: `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","is_error":true,"content":[{"type":"text","text":"exit status 1"}]}]}}`,
+			want: "⚠️ Tool error: exit status 1",
+		},
+		{
+			name: "user string content",
+			line: `{"type":"user","message":{"role":"user","content":"Please add tests"}}`,
+			want: "👤 Please add tests",
+		},
+		{
+			name: "unexpected shape shown as JSON",
+			line: `{"type":"assistant","message":{"role":"assistant","content":42}}`,
+			want: `🤖 {"role":"assistant","content":42}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg session.ClaudeMessage
+			if err := json.Unmarshal([]byte(tt.line), &msg); err != nil {
+				t.Fatalf("Failed to parse stream message: %v", err)
+			}
+			if got := msg.FormatContent(); got != tt.want {
+				t.Errorf("FormatContent() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaudeMessageCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		model string
+		want  float64
+	}{
+		{
+			name:  "reported cost",
+			line:  `{"type":"result","subtype":"success","cost_usd":0.25,"usage":{"input_tokens":1000000,"output_tokens":0}}`,
+			model: "sonnet",
+			want:  0.25,
+		},
+		{
+			name:  "usage only",
+			line:  `{"type":"result","subtype":"success","usage":{"input_tokens":1000000,"output_tokens":500000}}`,
+			model: "sonnet",
+			want:  3 + 7.5,
+		},
+		{
+			name:  "usage priced for the model",
+			line:  `{"type":"result","subtype":"success","usage":{"input_tokens":1000000,"output_tokens":500000}}`,
+			model: "opus",
+			want:  15 + 37.5,
+		},
+		{
+			name:  "usage for an unknown model",
+			line:  `{"type":"result","subtype":"success","usage":{"input_tokens":1000,"output_tokens":1000}}`,
+			model: "gpt-4",
+			want:  0,
+		},
+		{
+			name:  "neither",
+			line:  `{"type":"result","subtype":"success"}`,
+			model: "sonnet",
+			want:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg session.ClaudeMessage
+			if err := json.Unmarshal([]byte(tt.line), &msg); err != nil {
+				t.Fatalf("Failed to parse stream message: %v", err)
+			}
+			if got := msg.Cost(tt.model); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cost(%s) = %v, want %v", tt.model, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+//go:build unix
+
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// stubbornClaudeScript stands in for a headless claude that ignores the exit command,
+// with a tool it started in the background. The tool's PID is written to $TOOL_PID_FILE.
+const stubbornClaudeScript = `#!/bin/sh
+sleep 60 &
+echo $! > "$TOOL_PID_FILE"
+sleep 60
+`
+
+// processAlive reports whether pid is running; zombies that haven't been reaped count as dead
+func processAlive(t *testing.T, pid string) bool {
+	t.Helper()
+
+	stat, err := os.ReadFile(filepath.Join("/proc", pid, "stat"))
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+// processKilled reports whether pid dies within a couple of seconds, since a killed
+// process may take a moment to exit
+func processKilled(t *testing.T, pid string) bool {
+	t.Helper()
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if !processAlive(t, pid) {
+			return true
+		}
+	}
+	return false
+}
+
+// waitForToolPID waits for a stub claude to write its tool's PID to pidPath
+func waitForToolPID(t *testing.T, pidPath string) string {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		data, _ := os.ReadFile(pidPath)
+		if pid := strings.TrimSpace(string(data)); pid != "" {
+			return pid
+		}
+	}
+	t.Fatalf("tool PID wasn't written to %s", pidPath)
+	return ""
+}
+
+func TestClaudeProcessStopKillsProcessGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("/proc not available")
+	}
+
+	claudePath := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(claudePath, []byte(stubbornClaudeScript), 0755); err != nil {
+		t.Fatalf("Failed to write fake claude: %v", err)
+	}
+	pidPath := filepath.Join(t.TempDir(), "tool.pid")
+	t.Setenv("TOOL_PID_FILE", pidPath)
+
+	ctx := context.Background()
+	claudeMgr := session.NewClaudeManager(claudePath)
+	if _, err := claudeMgr.StartSession(ctx, "stubborn-session", t.TempDir(), "sk-ant-test"); err != nil {
+		t.Fatalf("StartSession() error = %v", err)
+	}
+
+	pid := waitForToolPID(t, pidPath)
+	if !processAlive(t, pid) {
+		t.Fatalf("tool process %q wasn't started", pid)
+	}
+
+	// Claude ignores the exit command, so it's force killed along with its tool
+	if err := claudeMgr.StopSession(ctx, "stubborn-session"); err != nil {
+		t.Fatalf("StopSession() error = %v", err)
+	}
+	if !processKilled(t, pid) {
+		t.Errorf("tool process %s is still running", pid)
+	}
+}
+
+func TestSendToSessionTimeoutKillsProcessGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("/proc not available")
+	}
+	installClaudeScript(t, stubbornClaudeScript)
+	pidPath := filepath.Join(t.TempDir(), "tool.pid")
+	t.Setenv("TOOL_PID_FILE", pidPath)
+
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.CommandTimeout = 1
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "stubborn-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "stubborn-feature",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	// The tool holds Claude's output open, so the turn only ends once it's killed too
+	start := time.Now()
+	err = sessionMgr.SendToSession(ctx, session.SessionID, "carry on", func(string) {}, func(float64) {})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("SendToSession() returned after %v, want about a second", elapsed)
+	}
+	if !errors.Is(err, models.ErrCommandTimeout) {
+		t.Fatalf("SendToSession() error = %v, want a command timeout", err)
+	}
+	if pid := waitForToolPID(t, pidPath); !processKilled(t, pid) {
+		t.Errorf("tool process %s is still running", pid)
+	}
+}
@@ -0,0 +1,229 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// fakeClaudeScript stands in for the claude CLI. Resuming a session fails the way
+// Claude does once the session has expired, unless it's $FAKE_CLAUDE_RESUMABLE;
+// starting fresh succeeds. Every invocation's arguments are appended to
+// $FAKE_CLAUDE_LOG, one per line, followed by its API key and working directory.
+const fakeClaudeScript = `#!/bin/sh
+for arg in "$@"; do
+	printf '%s\n' "$arg" >> "$FAKE_CLAUDE_LOG"
+done
+printf 'key=%s\ndir=%s\n' "$ANTHROPIC_API_KEY" "$(pwd)" >> "$FAKE_CLAUDE_LOG"
+printf -- '---\n' >> "$FAKE_CLAUDE_LOG"
+
+if [ "$2" = "-r" ]; then
+	if [ -n "$FAKE_CLAUDE_RESUMABLE" ] && [ "$3" = "$FAKE_CLAUDE_RESUMABLE" ]; then
+		echo '{"type":"result","subtype":"success","result":"resumed","cost_usd":0.01,"session_id":"'"$3"'"}'
+		exit 0
+	fi
+	echo "Error: No conversation found with session ID: $3" >&2
+	exit 1
+fi
+
+echo '{"type":"system","subtype":"init","session_id":"fresh-session"}'
+echo '{"type":"result","subtype":"success","result":"done","cost_usd":0.01,"session_id":"fresh-session"}'
+`
+
+// installFakeClaude puts a fake claude binary first on PATH and returns the path
+// of the file its invocations are logged to
+func installFakeClaude(t *testing.T) string {
+	t.Helper()
+	return installClaudeScript(t, fakeClaudeScript)
+}
+
+// installClaudeScript puts script first on PATH as the claude binary and returns the
+// path of the file it's expected to log to, passed as $FAKE_CLAUDE_LOG
+func installClaudeScript(t *testing.T, script string) string {
+	t.Helper()
+
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "claude"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake claude: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	logPath := filepath.Join(t.TempDir(), "invocations.log")
+	t.Setenv("FAKE_CLAUDE_LOG", logPath)
+	return logPath
+}
+
+func TestSendToSessionRetriesStaleResume(t *testing.T) {
+	logPath := installFakeClaude(t)
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "expired-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "stale-resume",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	var messages []string
+	err = sessionMgr.SendToSession(ctx, session.SessionID, "fix the tests",
+		func(message string) { messages = append(messages, message) },
+		func(float64) {})
+	if err != nil {
+		t.Fatalf("SendToSession() error = %v", err)
+	}
+
+	output := strings.Join(messages, "\n")
+	for _, want := range []string{"No conversation found", "context was reset", "✅ done"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("messages = %q, want them to contain %q", output, want)
+		}
+	}
+
+	// The first invocation resumes, the retry starts fresh with the system prompt re-applied
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read invocation log: %v", err)
+	}
+	invocations := strings.Split(strings.TrimSuffix(string(data), "---\n"), "---\n")
+	if len(invocations) != 2 {
+		t.Fatalf("claude invoked %d times, want 2", len(invocations))
+	}
+	if !strings.Contains(invocations[0], "-r\nexpired-session\n") {
+		t.Errorf("first invocation = %q, want it to resume expired-session", invocations[0])
+	}
+	if strings.Contains(invocations[1], "-r\n") {
+		t.Errorf("retry = %q, want it to start a fresh session", invocations[1])
+	}
+	if !strings.Contains(invocations[1], "You are Claude Bot") || !strings.Contains(invocations[1], "fix the tests") {
+		t.Errorf("retry = %q, want the system prompt followed by the message", invocations[1])
+	}
+
+	// The fresh Claude session replaces the expired one
+	updated, err := database.GetSessionByBranchName(ctx, "T123456", "", "stale-resume")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if updated.SessionID != "fresh-session" {
+		t.Errorf("SessionID = %q, want %q", updated.SessionID, "fresh-session")
+	}
+	if updated.RunningCost != 0.01 {
+		t.Errorf("RunningCost = %v, want %v", updated.RunningCost, 0.01)
+	}
+}
+
+func TestSendToSessionResumesStoredClaudeSession(t *testing.T) {
+	logPath := installFakeClaude(t)
+	t.Setenv("FAKE_CLAUDE_RESUMABLE", "stored-session")
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	// A session set up by an earlier process, which recorded Claude's session ID
+	workTree := t.TempDir()
+	session := &models.Session{
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "stored-resume",
+		WorkTreePath:     workTree,
+		ModelName:        models.ModelOpus,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+	if err := database.UpdateSessionByID(ctx, session.ID, "stored-session"); err != nil {
+		t.Fatalf("Failed to store Claude session ID: %v", err)
+	}
+
+	var messages []string
+	err = sessionMgr.SendToSession(ctx, "stored-session", "carry on",
+		func(message string) { messages = append(messages, message) },
+		func(float64) {})
+	if err != nil {
+		t.Fatalf("SendToSession() error = %v", err)
+	}
+	if output := strings.Join(messages, "\n"); !strings.Contains(output, "✅ resumed") {
+		t.Errorf("messages = %q, want the resumed reply", output)
+	}
+
+	// The one invocation resumes the stored conversation instead of starting over
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read invocation log: %v", err)
+	}
+	invocations := strings.Split(strings.TrimSuffix(string(data), "---\n"), "---\n")
+	if len(invocations) != 1 {
+		t.Fatalf("claude invoked %d times, want 1", len(invocations))
+	}
+	if !strings.Contains(invocations[0], "-r\nstored-session\n") {
+		t.Errorf("invocation = %q, want it to resume stored-session", invocations[0])
+	}
+
+	// It runs in the session's work tree with its model and the owner's API key
+	for _, want := range []string{"--model\n" + models.ModelOpus + "\n", "key=sk-ant-test\n", "dir=" + workTree + "\n"} {
+		if !strings.Contains(invocations[0], want) {
+			t.Errorf("invocation = %q, want it to contain %q", invocations[0], want)
+		}
+	}
+
+	updated, err := database.GetSessionByBranchName(ctx, "T123456", "", "stored-resume")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if updated.SessionID != "stored-session" {
+		t.Errorf("SessionID = %q, want %q", updated.SessionID, "stored-session")
+	}
+	if updated.RunningCost != 0.01 {
+		t.Errorf("RunningCost = %v, want %v", updated.RunningCost, 0.01)
+	}
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// stuckClaudeScript stands in for a claude CLI that never finishes its turn
+const stuckClaudeScript = `#!/bin/sh
+echo '{"type":"system","subtype":"init","session_id":"stuck-session"}'
+exec sleep 60
+`
+
+func TestSendToSessionCommandTimeout(t *testing.T) {
+	installClaudeScript(t, stuckClaudeScript)
+
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.CommandTimeout = 1
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "stuck-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "stuck-feature",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	start := time.Now()
+	err = sessionMgr.SendToSession(ctx, session.SessionID, "carry on", func(string) {}, func(float64) {})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("SendToSession() returned after %v, want about a second", elapsed)
+	}
+	if !errors.Is(err, models.ErrCommandTimeout) {
+		t.Fatalf("SendToSession() error = %v, want a command timeout", err)
+	}
+	if !strings.Contains(err.Error(), "didn't finish within 1s") {
+		t.Errorf("SendToSession() error = %q, want it to give the timeout", err)
+	}
+}
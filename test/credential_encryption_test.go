@@ -0,0 +1,308 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
+	"github.com/pbdeuchler/claude-bot/internal/db"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// openTestDB opens a database at dbPath with the test encryption key
+func openTestDB(t *testing.T, dbPath string) *db.DB {
+	t.Helper()
+
+	encryptor, err := crypto.NewEncryptor(testEncryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	database, err := db.NewDB(dbPath, encryptor)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	return database
+}
+
+func TestCredentialsEncryptedAtRest(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "encrypted.db")
+	database := openTestDB(t, dbPath)
+
+	ctx := context.Background()
+
+	user, err := database.CreateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	secrets := map[string]string{
+		models.CredentialTypeAnthropic: "sk-ant-REDACTED",
+		models.CredentialTypeGitHub:    "ghp_super_secret_github_token_67890",
+	}
+	for credType, secret := range secrets {
+		if err := database.StoreCredential(ctx, user.ID, credType, secret); err != nil {
+			t.Fatalf("Failed to store %s credential: %v", credType, err)
+		}
+	}
+
+	// Overwriting goes through the update path
+	secrets[models.CredentialTypeAnthropic] = "sk-ant-REDACTED"
+	if err := database.StoreCredential(ctx, user.ID, models.CredentialTypeAnthropic, secrets[models.CredentialTypeAnthropic]); err != nil {
+		t.Fatalf("Failed to update credential: %v", err)
+	}
+
+	for credType, secret := range secrets {
+		got, err := database.GetCredential(ctx, user.ID, credType)
+		if err != nil {
+			t.Fatalf("Failed to get %s credential: %v", credType, err)
+		}
+		if got != secret {
+			t.Errorf("GetCredential(%s) = %q, want %q", credType, got, secret)
+		}
+	}
+
+	database.Close()
+
+	contents, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to read database file: %v", err)
+	}
+	for credType, secret := range secrets {
+		if bytes.Contains(contents, []byte(secret)) {
+			t.Errorf("Database file contains the raw %s credential", credType)
+		}
+	}
+}
+
+func TestPlaintextCredentialMigration(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+	database := openTestDB(t, dbPath)
+	defer database.Close()
+
+	ctx := context.Background()
+
+	user, err := database.CreateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Simulate a row written before credentials were encrypted
+	const legacySecret = "sk-ant-REDACTED"
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open raw connection: %v", err)
+	}
+	defer raw.Close()
+	_, err = raw.ExecContext(ctx,
+		"INSERT INTO credentials (user_id, credential_type, credential_value) VALUES (?, ?, ?)",
+		user.ID, models.CredentialTypeAnthropic, legacySecret)
+	if err != nil {
+		t.Fatalf("Failed to insert plaintext credential: %v", err)
+	}
+
+	got, err := database.GetCredential(ctx, user.ID, models.CredentialTypeAnthropic)
+	if err != nil {
+		t.Fatalf("Failed to get legacy credential: %v", err)
+	}
+	if got != legacySecret {
+		t.Errorf("GetCredential() = %q, want %q", got, legacySecret)
+	}
+
+	// Reading the legacy row encrypts it in place
+	var stored string
+	err = raw.QueryRowContext(ctx,
+		"SELECT credential_value FROM credentials WHERE user_id = ? AND credential_type = ?",
+		user.ID, models.CredentialTypeAnthropic).Scan(&stored)
+	if err != nil {
+		t.Fatalf("Failed to read stored credential: %v", err)
+	}
+	if stored == legacySecret {
+		t.Error("Expected legacy credential to be re-encrypted after read")
+	}
+
+	got, err = database.GetCredential(ctx, user.ID, models.CredentialTypeAnthropic)
+	if err != nil {
+		t.Fatalf("Failed to get re-encrypted credential: %v", err)
+	}
+	if got != legacySecret {
+		t.Errorf("GetCredential() after re-encryption = %q, want %q", got, legacySecret)
+	}
+}
+
+func TestCredentialWithWrongKeyIsKept(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "rotated.db")
+	database := openTestDB(t, dbPath)
+
+	ctx := context.Background()
+
+	user, err := database.CreateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	const secret = "sk-ant-REDACTED"
+	if err := database.StoreCredential(ctx, user.ID, models.CredentialTypeAnthropic, secret); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+	database.Close()
+
+	readStored := func() string {
+		t.Helper()
+		raw, err := sql.Open("sqlite3", dbPath)
+		if err != nil {
+			t.Fatalf("Failed to open raw connection: %v", err)
+		}
+		defer raw.Close()
+		var stored string
+		err = raw.QueryRowContext(ctx,
+			"SELECT credential_value FROM credentials WHERE user_id = ? AND credential_type = ?",
+			user.ID, models.CredentialTypeAnthropic).Scan(&stored)
+		if err != nil {
+			t.Fatalf("Failed to read stored credential: %v", err)
+		}
+		return stored
+	}
+	before := readStored()
+
+	// Reopen with a different key, as after a misconfigured rotation
+	encryptor, err := crypto.NewEncryptor("a-different-encryption-key-of-32-bytes")
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	rotated, err := db.NewDB(dbPath, encryptor)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer rotated.Close()
+
+	got, err := rotated.GetCredential(ctx, user.ID, models.CredentialTypeAnthropic)
+	if !errors.Is(err, models.ErrEncryption) {
+		t.Errorf("GetCredential() = %q, %v, want an encryption error", got, err)
+	}
+	if after := readStored(); after != before {
+		t.Error("Stored credential was rewritten after failing to decrypt")
+	}
+}
+
+func TestRotateCredentials(t *testing.T) {
+	const newKey = "a-new-encryption-key-of-at-least-32-bytes"
+	dbPath := filepath.Join(t.TempDir(), "rotate.db")
+	database := openTestDB(t, dbPath)
+
+	ctx := context.Background()
+
+	createUser := func(slackUserID string) *models.User {
+		t.Helper()
+		user, err := database.CreateUser(ctx, &models.CreateUserRequest{
+			SlackWorkspaceID: "T123456",
+			SlackUserID:      slackUserID,
+			SlackUserName:    slackUserID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	user := createUser("U123456")
+	other := createUser("U654321")
+
+	secrets := map[string]string{
+		models.CredentialTypeAnthropic: "sk-ant-secret-to-rotate",
+		models.CredentialTypeGitHub:    "ghp_secret_to_rotate",
+	}
+	for credType, secret := range secrets {
+		if err := database.StoreCredential(ctx, user.ID, credType, secret); err != nil {
+			t.Fatalf("Failed to store %s credential: %v", credType, err)
+		}
+	}
+
+	// A credential encrypted with some other key can't be rotated
+	stray, err := crypto.NewEncryptor("yet-another-encryption-key-of-32-bytes")
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	strayValue, err := stray.EncryptCredential("sk-ant-stray-secret")
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open raw connection: %v", err)
+	}
+	defer raw.Close()
+	_, err = raw.ExecContext(ctx,
+		"INSERT INTO credentials (user_id, credential_type, credential_value) VALUES (?, ?, ?)",
+		other.ID, models.CredentialTypeAnthropic, strayValue)
+	if err != nil {
+		t.Fatalf("Failed to insert credential: %v", err)
+	}
+
+	result, err := database.RotateCredentials(ctx, testEncryptionKey, newKey)
+	if err != nil {
+		t.Fatalf("RotateCredentials() error = %v", err)
+	}
+	if result.Rotated != len(secrets) {
+		t.Errorf("Rotated = %d, want %d", result.Rotated, len(secrets))
+	}
+	if len(result.Failed) != 1 || result.Failed[0].UserID != other.ID {
+		t.Errorf("Failed = %+v, want only the other user's credential", result.Failed)
+	}
+
+	// The database now uses the new key
+	for credType, secret := range secrets {
+		if got, err := database.GetCredential(ctx, user.ID, credType); err != nil || got != secret {
+			t.Errorf("GetCredential(%s) = %q, %v, want %q", credType, got, err, secret)
+		}
+	}
+	database.Close()
+
+	newEncryptor, err := crypto.NewEncryptor(newKey)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	oldEncryptor, err := crypto.NewEncryptor(testEncryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+	for credType, secret := range secrets {
+		var stored string
+		err := raw.QueryRowContext(ctx,
+			"SELECT credential_value FROM credentials WHERE user_id = ? AND credential_type = ?",
+			user.ID, credType).Scan(&stored)
+		if err != nil {
+			t.Fatalf("Failed to read stored credential: %v", err)
+		}
+		if got, err := newEncryptor.DecryptCredential(stored); err != nil || got != secret {
+			t.Errorf("%s credential decrypted with the new key = %q, %v, want %q", credType, got, err, secret)
+		}
+		if _, err := oldEncryptor.DecryptCredential(stored); err == nil {
+			t.Errorf("%s credential still decrypts with the old key", credType)
+		}
+	}
+
+	var stored string
+	err = raw.QueryRowContext(ctx,
+		"SELECT credential_value FROM credentials WHERE user_id = ?", other.ID).Scan(&stored)
+	if err != nil {
+		t.Fatalf("Failed to read stored credential: %v", err)
+	}
+	if stored != strayValue {
+		t.Error("Credential that failed to decrypt was rewritten")
+	}
+}
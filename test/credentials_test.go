@@ -0,0 +1,288 @@
+package test
+
+import (
+	"context"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// serveGitRepos serves two empty repositories over HTTPS and returns their URLs:
+// public.git can be read by anyone, private.git only with the user "bot" and password
+// "secret". Git is set up to trust the server's certificate.
+func serveGitRepos(t *testing.T) (publicURL, privateURL string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("Git not available, skipping")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"public.git", "private.git"} {
+		repoPath := filepath.Join(dir, name)
+		if output, err := exec.Command("git", "init", "--bare", repoPath).CombinedOutput(); err != nil {
+			t.Fatalf("Failed to create bare repo: %v, output: %s", err, output)
+		}
+		// Lets git read the repository as static files
+		if output, err := exec.Command("git", "-C", repoPath, "update-server-info").CombinedOutput(); err != nil {
+			t.Fatalf("Failed to update server info: %v, output: %s", err, output)
+		}
+	}
+
+	files := http.FileServer(http.Dir(dir))
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); strings.HasPrefix(r.URL.Path, "/private.git/") && (user != "bot" || password != "secret") {
+			w.Header().Set("WWW-Authenticate", `Basic realm="git"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		files.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	certPath := filepath.Join(t.TempDir(), "cert.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(certPath, cert, 0644); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	t.Setenv("GIT_SSL_CAINFO", certPath)
+
+	return server.URL + "/public.git", server.URL + "/private.git"
+}
+
+func TestMissingCredentialsPublicVsPrivateRepo(t *testing.T) {
+	_, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	publicRepoURL, privateRepoURL := serveGitRepos(t)
+
+	// The bot's own git setup can read the private repository, which mustn't make it
+	// count as public
+	home := t.TempDir()
+	gitConfig := "[credential]\n\thelper = \"!f() { echo username=bot; echo password=secret; }; f\"\n"
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(gitConfig), 0644); err != nil {
+		t.Fatalf("Failed to write git config: %v", err)
+	}
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	if output, err := exec.Command("git", "ls-remote", privateRepoURL).CombinedOutput(); err != nil {
+		t.Fatalf("git can't read the private repository with its credential helper: %v, output: %s", err, output)
+	}
+
+	// Nothing stored yet: Anthropic is always required
+	missing, err := sessionMgr.MissingCredentials(ctx, user.ID, publicRepoURL)
+	if err != nil {
+		t.Fatalf("Failed to check credentials: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []string{models.CredentialTypeAnthropic}) {
+		t.Errorf("Expected only anthropic missing for public repo, got %v", missing)
+	}
+
+	if err := sessionMgr.StoreCredential(ctx, user.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	// A public repo session can start with only an Anthropic key
+	ok, err := sessionMgr.HasRequiredCredentials(ctx, user.ID, publicRepoURL)
+	if err != nil {
+		t.Fatalf("Failed to check credentials: %v", err)
+	}
+	if !ok {
+		t.Error("Expected public repo to require only an Anthropic key")
+	}
+
+	// A private repo demands git credentials
+	missing, err = sessionMgr.MissingCredentials(ctx, user.ID, privateRepoURL)
+	if err != nil {
+		t.Fatalf("Failed to check credentials: %v", err)
+	}
+	if !reflect.DeepEqual(missing, []string{models.CredentialTypeGitHub}) {
+		t.Errorf("Expected github missing for private repo, got %v", missing)
+	}
+
+	// SSH URLs, URLs with credentials and local repositories always need credentials
+	for _, repoURL := range []string{
+		"git@github.com:user/repo.git",
+		strings.Replace(privateRepoURL, "https://", "https://bot:secret@", 1),
+		"file://" + filepath.Join(t.TempDir(), "local.git"),
+	} {
+		missing, err = sessionMgr.MissingCredentials(ctx, user.ID, repoURL)
+		if err != nil {
+			t.Fatalf("Failed to check credentials: %v", err)
+		}
+		if !reflect.DeepEqual(missing, []string{models.CredentialTypeGitHub}) {
+			t.Errorf("Expected github missing for %s, got %v", repoURL, missing)
+		}
+	}
+
+	if err := sessionMgr.StoreCredential(ctx, user.ID, models.CredentialTypeGitHub, "ghp_test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	ok, err = sessionMgr.HasRequiredCredentials(ctx, user.ID, privateRepoURL)
+	if err != nil {
+		t.Fatalf("Failed to check credentials: %v", err)
+	}
+	if !ok {
+		t.Error("Expected private repo to be allowed once a GitHub token is stored")
+	}
+}
+
+func TestDeleteCredential(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	for _, credType := range []string{models.CredentialTypeAnthropic, models.CredentialTypeGitHub} {
+		if err := database.StoreCredential(ctx, user.ID, credType, "secret-"+credType); err != nil {
+			t.Fatalf("Failed to store credential: %v", err)
+		}
+	}
+
+	if err := database.DeleteCredential(ctx, user.ID, models.CredentialTypeGitHub); err != nil {
+		t.Fatalf("DeleteCredential() error = %v", err)
+	}
+
+	// Only the deleted type is gone
+	if has, err := database.HasCredential(ctx, user.ID, models.CredentialTypeGitHub); err != nil || has {
+		t.Errorf("HasCredential(github) = %v, %v, want false after delete", has, err)
+	}
+	if has, err := database.HasCredential(ctx, user.ID, models.CredentialTypeAnthropic); err != nil || !has {
+		t.Errorf("HasCredential(anthropic) = %v, %v, want true", has, err)
+	}
+
+	// Deleting again finds nothing
+	if err := database.DeleteCredential(ctx, user.ID, models.CredentialTypeGitHub); !errors.Is(err, models.ErrNoCredentials) {
+		t.Errorf("second DeleteCredential() error = %v, want %v", err, models.ErrNoCredentials)
+	}
+}
+
+func TestStoreCredentialVerification(t *testing.T) {
+	// The fake provider accepts credentials containing "good", rejects those containing
+	// "bad" and drops the connection for anything else
+	var calls atomic.Int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		credential := r.Header.Get("x-api-key") + r.Header.Get("Authorization")
+		switch {
+		case strings.Contains(credential, "good"):
+			w.Write([]byte(`{}`))
+		case strings.Contains(credential, "bad"):
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "Bad credentials"}`))
+		default:
+			panic(http.ErrAbortHandler)
+		}
+	}))
+	defer provider.Close()
+
+	for _, verify := range []bool{true, false} {
+		t.Run(fmt.Sprintf("verify %v", verify), func(t *testing.T) {
+			database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+				cfg.Credentials.VerifyOnSet = verify
+				cfg.Anthropic.APIURL = provider.URL
+				cfg.GitHub.APIURL = provider.URL
+			})
+			defer cleanup()
+
+			ctx := context.Background()
+			user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+				SlackWorkspaceID: "T123456",
+				SlackUserID:      "U123456",
+				SlackUserName:    "testuser",
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+
+			tests := []struct {
+				name       string
+				credType   string
+				value      string
+				wantErr    error // when verifying
+				wantStored bool  // when verifying
+			}{
+				{name: "accepted anthropic key", credType: models.CredentialTypeAnthropic, value: "sk-ant-good", wantStored: true},
+				{name: "rejected anthropic key", credType: models.CredentialTypeAnthropic, value: "sk-ant-bad", wantErr: models.ErrInvalidCommand},
+				{name: "accepted github token", credType: models.CredentialTypeGitHub, value: "ghp_good", wantStored: true},
+				{name: "rejected github token", credType: models.CredentialTypeGitHub, value: "ghp_bad", wantErr: models.ErrInvalidCommand},
+				{name: "network error", credType: models.CredentialTypeGitHub, value: "ghp_unreachable"},
+			}
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					if err := database.DeleteCredential(ctx, user.ID, tt.credType); err != nil && !errors.Is(err, models.ErrNoCredentials) {
+						t.Fatalf("Failed to clear credential: %v", err)
+					}
+					calls.Store(0)
+
+					err := sessionMgr.StoreCredential(ctx, user.ID, tt.credType, tt.value)
+					has, hasErr := database.HasCredential(ctx, user.ID, tt.credType)
+					if hasErr != nil {
+						t.Fatalf("Failed to check credential: %v", hasErr)
+					}
+
+					if !verify {
+						if err != nil || !has || calls.Load() != 0 {
+							t.Errorf("StoreCredential() error = %v, stored %v after %d provider calls, want stored unverified", err, has, calls.Load())
+						}
+						return
+					}
+					// The HTTP client may retry a dropped request
+					if calls.Load() == 0 {
+						t.Error("provider wasn't called")
+					}
+					if has != tt.wantStored {
+						t.Errorf("stored = %v, want %v", has, tt.wantStored)
+					}
+					switch {
+					case tt.wantStored:
+						if err != nil {
+							t.Errorf("StoreCredential() error = %v", err)
+						}
+					case tt.wantErr != nil:
+						if !errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), "rejected") {
+							t.Errorf("StoreCredential() error = %v, want a rejection", err)
+						}
+					default:
+						if err == nil || !strings.Contains(err.Error(), "couldn't verify") {
+							t.Errorf("StoreCredential() error = %v, want a verification failure", err)
+						}
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestFeatureSlug(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Fix the flaky login test", want: "fix-the-flaky-login-test"},
+		{text: "Add OAuth2 support to the API client, then update docs", want: "add-oauth2-support-to-the"},
+		{text: "  Refactor: parser/lexer!! ", want: "refactor-parser-lexer"},
+		{text: "Supercalifragilisticexpialidocious internationalization", want: "supercalifragilisticexpialidocious-inter"},
+		{text: "🚀 ✨", want: ""},
+		{text: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := session.FeatureSlug(tt.text)
+			if got != tt.want {
+				t.Errorf("FeatureSlug(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+			if got != "" {
+				if err := session.ValidateFeatureName(got); err != nil {
+					t.Errorf("FeatureSlug(%q) = %q, not a valid feature name: %v", tt.text, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateFeatureName(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	now := time.Date(2024, 3, 9, 14, 5, 0, 0, time.UTC)
+
+	// From the prompt when there is one
+	name, err := sessionMgr.GenerateFeatureName(ctx, "T123456", "https://github.com/test/repo", "Fix the flaky login test", "main", now)
+	if err != nil {
+		t.Fatalf("GenerateFeatureName() error = %v", err)
+	}
+	if name != "fix-the-flaky-login-test" {
+		t.Errorf("GenerateFeatureName() = %q, want %q", name, "fix-the-flaky-login-test")
+	}
+
+	// From the time otherwise
+	name, err = sessionMgr.GenerateFeatureName(ctx, "T123456", "https://github.com/test/repo", "", "main", now)
+	if err != nil {
+		t.Fatalf("GenerateFeatureName() error = %v", err)
+	}
+	if name != "session-20240309-1405" {
+		t.Errorf("GenerateFeatureName() = %q, want %q", name, "session-20240309-1405")
+	}
+
+	// Names used by a live session get a numeric suffix; ended sessions' names are free
+	createOwnedSession(t, database, owner.ID, "session-20240309-1405", models.SessionStatusActive)
+	createOwnedSession(t, database, owner.ID, "session-20240309-1405-2", models.SessionStatusActive)
+	createOwnedSession(t, database, owner.ID, "session-20240309-1405-3", models.SessionStatusEnded)
+	name, err = sessionMgr.GenerateFeatureName(ctx, "T123456", "https://github.com/test/repo", "", "main", now)
+	if err != nil {
+		t.Fatalf("GenerateFeatureName() error = %v", err)
+	}
+	if name != "session-20240309-1405-3" {
+		t.Errorf("GenerateFeatureName() with collisions = %q, want %q", name, "session-20240309-1405-3")
+	}
+
+	// A prompt that slugs to a protected branch is suffixed too
+	name, err = sessionMgr.GenerateFeatureName(ctx, "T123456", "https://github.com/test/repo", "main", "main", now)
+	if err != nil {
+		t.Fatalf("GenerateFeatureName() error = %v", err)
+	}
+	if name != "main-2" {
+		t.Errorf("GenerateFeatureName() for a protected name = %q, want %q", name, "main-2")
+	}
+}
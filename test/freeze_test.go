@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// isSpendFrozenError reports whether err is the error returned while spend is frozen
+func isSpendFrozenError(err error) bool {
+	cbErr, ok := err.(*models.CBError)
+	return ok && cbErr.Code == models.ErrCodeSpendFrozen
+}
+
+func TestFreezeBlocksNewSpend(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	active := createOwnedSession(t, database, user.ID, "freeze-active", models.SessionStatusActive)
+
+	newRequest := func(feature string) *models.CreateSessionRequest {
+		return &models.CreateSessionRequest{
+			WorkspaceID:     user.SlackWorkspaceID,
+			CreatedByUserID: user.ID,
+			ChannelID:       "C123456",
+			ThreadTS:        "ts-" + feature,
+			RepoURL:         "https://github.com/test/repo",
+			FromCommitish:   "main",
+			FeatureName:     feature,
+			ModelName:       models.ModelSonnet,
+		}
+	}
+
+	sessionMgr.SetFrozen(true)
+	if !sessionMgr.IsFrozen() {
+		t.Fatal("IsFrozen() = false after SetFrozen(true)")
+	}
+
+	if _, err := sessionMgr.CreateSession(ctx, newRequest("freeze-new")); !isSpendFrozenError(err) {
+		t.Errorf("CreateSession() while frozen error = %v, want %s", err, models.ErrCodeSpendFrozen)
+	}
+	exists, err := database.CheckBranchNameExists(ctx, "T123456", "https://github.com/test/repo", "freeze-new")
+	if err != nil {
+		t.Fatalf("Failed to check branch name: %v", err)
+	}
+	if exists {
+		t.Error("Expected session created while frozen not to be stored")
+	}
+
+	var messages []string
+	err = sessionMgr.SendToSession(ctx, active.SessionID, "hello", func(m string) { messages = append(messages, m) }, func(float64) {})
+	if !isSpendFrozenError(err) {
+		t.Errorf("SendToSession() while frozen error = %v, want %s", err, models.ErrCodeSpendFrozen)
+	}
+	if len(messages) != 0 {
+		t.Errorf("SendToSession() while frozen produced output %v, want none", messages)
+	}
+
+	if _, err := sessionMgr.PrepareRestart(ctx, active); !isSpendFrozenError(err) {
+		t.Errorf("PrepareRestart() while frozen error = %v, want %s", err, models.ErrCodeSpendFrozen)
+	}
+
+	// Unfreezing lets sessions be created again
+	sessionMgr.SetFrozen(false)
+	if _, err := sessionMgr.CreateSession(ctx, newRequest("freeze-new")); err != nil {
+		t.Errorf("CreateSession() after unfreeze error = %v", err)
+	}
+}
+
+func TestFreezeFromConfig(t *testing.T) {
+	_, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Budget.Frozen = true
+	})
+	defer cleanup()
+
+	if !sessionMgr.IsFrozen() {
+		t.Error("IsFrozen() = false, want true when SPEND_FROZEN is set")
+	}
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestCreateSessionIdempotencyKey(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	newRequest := func(feature, key string) *models.CreateSessionRequest {
+		return &models.CreateSessionRequest{
+			WorkspaceID:     user.SlackWorkspaceID,
+			CreatedByUserID: user.ID,
+			ChannelID:       "C123456",
+			ThreadTS:        "1234567890.000" + feature[len(feature)-1:],
+			RepoURL:         "https://github.com/test/repo",
+			FromCommitish:   "main",
+			FeatureName:     feature,
+			ModelName:       models.ModelSonnet,
+			IdempotencyKey:  key,
+		}
+	}
+
+	first, err := sessionMgr.CreateSession(ctx, newRequest("idem-feature-1", "request-1"))
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// Retrying with the same key returns the original session, marked as a replay so
+	// the caller doesn't set it up again
+	retry, err := sessionMgr.CreateSession(ctx, newRequest("idem-feature-1", "request-1"))
+	if !errors.Is(err, models.ErrRequestReplayed) {
+		t.Fatalf("Retried create error = %v, want %s", err, models.ErrCodeRequestReplayed)
+	}
+	if retry == nil || retry.ID != first.ID {
+		t.Fatalf("Expected retried create to return session %d, got %v", first.ID, retry)
+	}
+
+	// The same key wins even if the retried request differs
+	retry, err = sessionMgr.CreateSession(ctx, newRequest("idem-feature-2", "request-1"))
+	if !errors.Is(err, models.ErrRequestReplayed) {
+		t.Fatalf("Retried create error = %v, want %s", err, models.ErrCodeRequestReplayed)
+	}
+	if retry.ID != first.ID {
+		t.Errorf("Expected retried create to return session %d, got %d", first.ID, retry.ID)
+	}
+
+	// Without a key the usual duplicate checks apply
+	if _, err := sessionMgr.CreateSession(ctx, newRequest("idem-feature-1", "")); err == nil {
+		t.Error("Expected error creating a duplicate session without an idempotency key")
+	}
+
+	// The retry with a different feature name must not have created a second session
+	exists, err := database.CheckBranchNameExists(ctx, "T123456", "https://github.com/test/repo", "idem-feature-2")
+	if err != nil {
+		t.Fatalf("Failed to check branch name: %v", err)
+	}
+	if exists {
+		t.Error("Expected no session to be created for a retried idempotency key")
+	}
+
+	// The key is enforced by the database as well
+	duplicate := &models.Session{
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C999999",
+		SlackThreadTS:    "1234567890.999999",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "idem-feature-5",
+		WorkTreePath:     "/tmp/idem-feature-5",
+		ModelName:        models.ModelSonnet,
+		Status:           "starting",
+		IdempotencyKey:   "request-1",
+	}
+	if err := database.CreateSession(ctx, duplicate); err == nil {
+		t.Error("Expected unique constraint violation for duplicate idempotency key")
+	}
+
+	// A key that created nothing is reported as not found rather than a nil session
+	if _, err := database.GetSessionByIdempotencyKey(ctx, "request-unknown"); !errors.Is(err, models.ErrSessionNotFound) {
+		t.Errorf("GetSessionByIdempotencyKey() of an unused key error = %v, want %s", err, models.ErrCodeSessionNotFound)
+	}
+}
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestIdleSessionMonitorUsesConfiguredInterval(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.IdleCheck = 42
+		cfg.Session.IdleWorkers = 1
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	session := createOwnedSession(t, database, owner.ID, "monitored", models.SessionStatusActive)
+
+	intervals := make(chan time.Duration, 1)
+	ticks := make(chan time.Time)
+	stopped := make(chan struct{})
+	sessionMgr.SetTickerFactory(func(d time.Duration) (<-chan time.Time, func()) {
+		intervals <- d
+		return ticks, func() { close(stopped) }
+	})
+	sessionMgr.SetClock(func() time.Time { return time.Now().Add(2 * time.Hour) })
+
+	done := make(chan struct{})
+	go func() {
+		sessionMgr.StartIdleSessionMonitor(ctx)
+		close(done)
+	}()
+
+	if got := <-intervals; got != 42*time.Second {
+		t.Errorf("ticker interval = %v, want 42s", got)
+	}
+
+	// Each tick runs a cleanup; the second is only received once the first has finished
+	ticks <- time.Now()
+	ticks <- time.Now()
+	stored, err := database.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if stored.Status != models.SessionStatusEnded {
+		t.Errorf("session status = %s, want ended after a tick", stored.Status)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("monitor didn't exit after its context was cancelled")
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("monitor didn't stop its ticker")
+	}
+}
+
+// fakeGitScript stands in for git, recording how many git commands run at once
+const fakeGitScript = `#!/bin/sh
+touch "$FAKE_GIT_RUNNING/$$"
+ls "$FAKE_GIT_RUNNING" | wc -l >> "$FAKE_GIT_LOG"
+sleep 0.2
+rm "$FAKE_GIT_RUNNING/$$"
+exit 1
+`
+
+func TestCleanupEndsIdleSessionsWithinWorkerBound(t *testing.T) {
+	binDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(binDir, "git"), []byte(fakeGitScript), 0755); err != nil {
+		t.Fatalf("Failed to write fake git: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_GIT_RUNNING", t.TempDir())
+	logPath := filepath.Join(t.TempDir(), "concurrency.log")
+	t.Setenv("FAKE_GIT_LOG", logPath)
+
+	const workers = 2
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.IdleWorkers = workers
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Ending a session runs git to remove its work tree, which must be a git worktree
+	const idleSessions = 6
+	for i := 0; i < idleSessions; i++ {
+		session := createOwnedSession(t, database, owner.ID, "idle-"+strconv.Itoa(i), models.SessionStatusActive)
+		workTree := t.TempDir()
+		if err := os.WriteFile(filepath.Join(workTree, ".git"), []byte("gitdir: "+filepath.Join(workTree, "missing")+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write .git file: %v", err)
+		}
+		if err := database.UpdateSessionWorkTreePath(ctx, session.ID, workTree); err != nil {
+			t.Fatalf("Failed to set work tree: %v", err)
+		}
+	}
+	sessionMgr.SetClock(func() time.Time { return time.Now().Add(2 * time.Hour) })
+
+	ended, err := sessionMgr.CleanupIdleSessions(ctx)
+	if err != nil {
+		t.Fatalf("CleanupIdleSessions() error = %v", err)
+	}
+	if ended != idleSessions {
+		t.Errorf("CleanupIdleSessions() ended %d sessions, want %d", ended, idleSessions)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read fake git log: %v", err)
+	}
+	maxRunning := 0
+	for _, line := range strings.Fields(string(data)) {
+		running, err := strconv.Atoi(line)
+		if err != nil {
+			t.Fatalf("Unexpected fake git log line %q", line)
+		}
+		if running > maxRunning {
+			maxRunning = running
+		}
+	}
+	if maxRunning != workers {
+		t.Errorf("at most %d git commands ran at once, want %d", maxRunning, workers)
+	}
+}
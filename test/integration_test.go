@@ -2,18 +2,29 @@ package test
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/internal/crypto"
 	"github.com/pbdeuchler/claude-bot/internal/db"
 	"github.com/pbdeuchler/claude-bot/internal/session"
 	"github.com/pbdeuchler/claude-bot/pkg/models"
 )
 
+// testEncryptionKey is the credential encryption key used by test databases
+const testEncryptionKey = "test-encryption-key-that-is-32-bytes-long"
+
 func setupTestEnvironment(t *testing.T) (*db.DB, *session.Manager, func()) {
+	return setupTestEnvironmentWithConfig(t, nil)
+}
+
+// setupTestEnvironmentWithConfig is like setupTestEnvironment but lets the caller
+// adjust the configuration before the session manager is created
+func setupTestEnvironmentWithConfig(t *testing.T, configure func(*config.Config)) (*db.DB, *session.Manager, func()) {
 	// Create temporary directory for test database
 	tmpDir, err := os.MkdirTemp("", "cb-test-*")
 	if err != nil {
@@ -22,25 +33,28 @@ func setupTestEnvironment(t *testing.T) (*db.DB, *session.Manager, func()) {
 
 	dbPath := filepath.Join(tmpDir, "test.db")
 
+	encryptor, err := crypto.NewEncryptor(testEncryptionKey)
+	if err != nil {
+		t.Fatalf("Failed to create encryptor: %v", err)
+	}
+
 	// Initialize test database
-	database, err := db.NewDB(dbPath)
+	database, err := db.NewDB(dbPath, encryptor)
 	if err != nil {
 		t.Fatalf("Failed to initialize test database: %v", err)
 	}
 
 	// Create test configuration
-	cfg := &config.Config{
-		Session: struct {
-			WorkDir        string `env:"WORK_DIR" envDefault:"./sessions"`
-			MaxPerUser     int    `env:"MAX_SESSIONS_PER_USER" envDefault:"5"`
-			IdleTimeout    int    `env:"SESSION_IDLE_TIMEOUT" envDefault:"3600"`
-			ClaudeCodePath string `env:"CLAUDE_CODE_PATH" envDefault:"claude-code"`
-		}{
-			WorkDir:        filepath.Join(tmpDir, "sessions"),
-			MaxPerUser:     5,
-			IdleTimeout:    3600,
-			ClaudeCodePath: "echo", // Use echo command for testing instead of claude-code
-		},
+	cfg := &config.Config{}
+	cfg.Database.Path = dbPath
+	cfg.Database.EncryptionKey = testEncryptionKey
+	cfg.Session.WorkDir = filepath.Join(tmpDir, "sessions")
+	cfg.Session.MaxPerUser = 5
+	cfg.Session.IdleTimeout = 3600
+	cfg.Session.ClaudeCodePath = "echo" // Use echo command for testing instead of claude-code
+
+	if configure != nil {
+		configure(cfg)
 	}
 
 	// Create session manager
@@ -93,13 +107,14 @@ func TestUserCreationAndCredentials(t *testing.T) {
 		t.Errorf("Expected credential 'test-api-key', got %s", credential)
 	}
 
-	// Test required credentials check
-	hasRequired, err := sessionMgr.HasRequiredCredentials(ctx, user.ID)
+	// Test required credentials check against a repository that can't be read anonymously
+	privateRepoURL := "file://" + filepath.Join(os.TempDir(), "cb-test-missing-repo")
+	hasRequired, err := sessionMgr.HasRequiredCredentials(ctx, user.ID, privateRepoURL)
 	if err != nil {
 		t.Fatalf("Failed to check required credentials: %v", err)
 	}
 
-	// Should be false because we only have anthropic, need github too
+	// Should be false because we only have anthropic, need github too for private repos
 	if hasRequired {
 		t.Error("Expected false for required credentials check with only anthropic credential")
 	}
@@ -111,7 +126,7 @@ func TestUserCreationAndCredentials(t *testing.T) {
 	}
 
 	// Check again
-	hasRequired, err = sessionMgr.HasRequiredCredentials(ctx, user.ID)
+	hasRequired, err = sessionMgr.HasRequiredCredentials(ctx, user.ID, privateRepoURL)
 	if err != nil {
 		t.Fatalf("Failed to check required credentials: %v", err)
 	}
@@ -202,13 +217,13 @@ func TestSessionLifecycle(t *testing.T) {
 	}
 
 	// Test getting active session for channel (should be none)
-	activeSession, err := sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, "C123456", "")
-	if err != nil {
-		t.Fatalf("Failed to get active session for channel: %v", err)
+	if _, err := sessionMgr.GetActiveSessionForChannel(ctx, user.SlackWorkspaceID, "C123456", ""); !errors.Is(err, models.ErrNoActiveSession) {
+		t.Errorf("GetActiveSessionForChannel() error = %v, want %v", err, models.ErrNoActiveSession)
 	}
 
-	if activeSession != nil {
-		t.Error("Expected no active session for channel")
+	// Test getting a user who hasn't used the bot
+	if _, err := sessionMgr.GetUserBySlackID(ctx, user.SlackWorkspaceID, "UUNKNOWN"); !errors.Is(err, models.ErrUserNotFound) {
+		t.Errorf("GetUserBySlackID() error = %v, want %v", err, models.ErrUserNotFound)
 	}
 }
 
@@ -0,0 +1,275 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// hangingClaudeScript stands in for the claude CLI. Given the message "hang" it starts
+// a turn that never finishes; any other message gets an immediate reply. The message
+// of every invocation, and whether it resumed, is appended to $FAKE_CLAUDE_LOG.
+const hangingClaudeScript = `#!/bin/sh
+for last; do :; done
+printf '%s %s\n' "$2" "$last" >> "$FAKE_CLAUDE_LOG"
+
+echo '{"type":"system","subtype":"init","session_id":"live-session"}'
+if [ "$last" = "hang" ]; then
+	exec sleep 30
+fi
+echo '{"type":"result","subtype":"success","result":"done","cost_usd":0.01,"session_id":"live-session"}'
+`
+
+func TestInterruptSession(t *testing.T) {
+	logPath := installClaudeScript(t, hangingClaudeScript)
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "live-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "interrupt-feature",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	if sessionMgr.InterruptSession(session.ID) {
+		t.Error("InterruptSession() = true with no turn running")
+	}
+
+	// Start a turn that only ends when interrupted
+	started := make(chan struct{})
+	var once sync.Once
+	done := make(chan error, 1)
+	go func() {
+		done <- sessionMgr.SendToSession(ctx, session.SessionID, "hang", func(message string) {
+			if strings.Contains(message, "Claude session initialized") {
+				once.Do(func() { close(started) })
+			}
+		}, func(float64) {})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Claude turn didn't start")
+	}
+
+	if !sessionMgr.InterruptSession(session.ID) {
+		t.Error("InterruptSession() = false with a turn running")
+	}
+
+	select {
+	case err := <-done:
+		var cbErr *models.CBError
+		if !errors.As(err, &cbErr) || cbErr.Code != models.ErrCodeTurnInterrupted {
+			t.Errorf("SendToSession() error = %v, want %s", err, models.ErrCodeTurnInterrupted)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("interrupted turn didn't end; the claude process is still running")
+	}
+
+	// The session is still active and the next message resumes its conversation
+	updated, err := database.GetSessionByBranchName(ctx, "T123456", "", "interrupt-feature")
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if updated.Status != models.SessionStatusActive || updated.SessionID != "live-session" {
+		t.Errorf("session status = %s, Claude session = %s, want active live-session", updated.Status, updated.SessionID)
+	}
+
+	var messages []string
+	err = sessionMgr.SendToSession(ctx, session.SessionID, "try another way",
+		func(message string) { messages = append(messages, message) },
+		func(float64) {})
+	if err != nil {
+		t.Fatalf("SendToSession() after interrupt error = %v", err)
+	}
+	if output := strings.Join(messages, "\n"); !strings.Contains(output, "✅ done") {
+		t.Errorf("messages = %q, want the new turn's reply", output)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read invocation log: %v", err)
+	}
+	if got, want := string(data), "-r hang\n-r try another way\n"; got != want {
+		t.Errorf("invocations = %q, want %q", got, want)
+	}
+}
+
+func TestEndSessionInterruptsTurn(t *testing.T) {
+	installClaudeScript(t, hangingClaudeScript)
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "live-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "stopped-mid-turn",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	started := make(chan struct{})
+	var once sync.Once
+	done := make(chan error, 1)
+	go func() {
+		done <- sessionMgr.SendToSession(ctx, session.SessionID, "hang", func(message string) {
+			if strings.Contains(message, "Claude session initialized") {
+				once.Do(func() { close(started) })
+			}
+		}, func(float64) {})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Claude turn didn't start")
+	}
+
+	// Stopping the session ends the turn before committing, rather than committing
+	// while Claude keeps changing the work tree
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- sessionMgr.EndSession(ctx, session.SessionID, "")
+	}()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("EndSession() error = %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("EndSession() didn't return; the turn wasn't interrupted")
+	}
+
+	select {
+	case err := <-done:
+		var cbErr *models.CBError
+		if !errors.As(err, &cbErr) || cbErr.Code != models.ErrCodeTurnInterrupted {
+			t.Errorf("SendToSession() error = %v, want %s", err, models.ErrCodeTurnInterrupted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("EndSession() returned while the turn was still running")
+	}
+}
+
+func TestBudgetStopDuringTurn(t *testing.T) {
+	installClaudeScript(t, `#!/bin/sh
+echo '{"type":"system","subtype":"init","session_id":"live-session"}'
+echo '{"type":"result","subtype":"success","result":"done","cost_usd":5,"session_id":"live-session"}'
+`)
+
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Budget.MaxSessionCostUSD = 1.0
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "live-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "expensive-turn",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	// The turn's own cost ends the session, which mustn't wait for the turn to end
+	done := make(chan error, 1)
+	go func() {
+		done <- sessionMgr.SendToSession(ctx, session.SessionID, "spend", func(string) {}, func(float64) {})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("SendToSession() didn't return after its cost ended the session")
+	}
+
+	stored, err := database.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if stored.Status != models.SessionStatusEnded {
+		t.Errorf("status = %s, want %s", stored.Status, models.SessionStatusEnded)
+	}
+}
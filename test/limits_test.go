@@ -0,0 +1,126 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestUserLimitsNearCaps(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.MaxPerUser = 3
+		cfg.Session.CreateLimit = 2
+		cfg.Session.CreateWindow = 3600
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Two existing sessions with accumulated cost, one of them ended
+	for i, status := range []string{models.SessionStatusActive, models.SessionStatusEnded} {
+		session := &models.Session{
+			SessionID:        fmt.Sprintf("claude-session-%d", i),
+			SlackWorkspaceID: user.SlackWorkspaceID,
+			SlackChannelID:   "C123456",
+			SlackThreadTS:    fmt.Sprintf("1234567890.00000%d", i),
+			RepoURL:          "https://github.com/test/repo",
+			BranchName:       fmt.Sprintf("limits-feature-%d", i),
+			WorkTreePath:     fmt.Sprintf("/tmp/limits-feature-%d", i),
+			ModelName:        models.ModelSonnet,
+			RunningCost:      1.25,
+			Status:           status,
+		}
+		if err := database.CreateSession(ctx, session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if err := database.AddUserToSession(ctx, session.ID, user.ID, models.SessionRoleOwner); err != nil {
+			t.Fatalf("Failed to add owner: %v", err)
+		}
+	}
+
+	// Creating a session through the manager consumes a token
+	_, err = sessionMgr.CreateSession(ctx, &models.CreateSessionRequest{
+		WorkspaceID:     user.SlackWorkspaceID,
+		CreatedByUserID: user.ID,
+		ChannelID:       "C123456",
+		ThreadTS:        "1234567890.123456",
+		RepoURL:         "https://github.com/test/repo",
+		FromCommitish:   "main",
+		FeatureName:     "limits-feature-new",
+		ModelName:       models.ModelSonnet,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	limits, err := sessionMgr.GetUserLimits(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get limits: %v", err)
+	}
+
+	want := models.UserLimits{
+		SessionCreatesRemaining: 1,
+		SessionCreateLimit:      2,
+		SessionCreateWindow:     3600,
+		ActiveSessions:          2, // the active session and the one starting
+		MaxSessions:             3,
+		TotalCostUSD:            2.5,
+	}
+	if *limits != want {
+		t.Errorf("GetUserLimits() = %+v, want %+v", *limits, want)
+	}
+}
+
+func TestSessionCreateRateLimit(t *testing.T) {
+	_, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.CreateLimit = 1
+		cfg.Session.CreateWindow = 3600
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	newRequest := func(feature string) *models.CreateSessionRequest {
+		return &models.CreateSessionRequest{
+			WorkspaceID:     user.SlackWorkspaceID,
+			CreatedByUserID: user.ID,
+			ChannelID:       "C123456",
+			ThreadTS:        "1234567890." + feature,
+			RepoURL:         "https://github.com/test/repo",
+			FromCommitish:   "main",
+			FeatureName:     feature,
+			ModelName:       models.ModelSonnet,
+		}
+	}
+
+	if _, err := sessionMgr.CreateSession(ctx, newRequest("rate-feature-1")); err != nil {
+		t.Fatalf("Failed to create first session: %v", err)
+	}
+
+	_, err = sessionMgr.CreateSession(ctx, newRequest("rate-feature-2"))
+	cbErr, ok := err.(*models.CBError)
+	if !ok || cbErr.Code != models.ErrCodeRateLimited {
+		t.Errorf("Expected %s error, got %v", models.ErrCodeRateLimited, err)
+	}
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestMCPServerRegistry(t *testing.T) {
+	_, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	admin, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "UADMIN",
+		SlackUserName:    "admin",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Invalid JSON is rejected
+	if _, err := sessionMgr.RegisterMCPServer(ctx, admin.ID, "broken", "{not json"); err == nil {
+		t.Error("Expected error registering MCP server with invalid config")
+	}
+
+	_, err = sessionMgr.RegisterMCPServer(ctx, admin.ID, "github", `{"command":"github-mcp","args":["stdio"]}`)
+	if err != nil {
+		t.Fatalf("Failed to register MCP server: %v", err)
+	}
+	_, err = sessionMgr.RegisterMCPServer(ctx, admin.ID, "fetch", `{"command":"fetch-mcp"}`)
+	if err != nil {
+		t.Fatalf("Failed to register MCP server: %v", err)
+	}
+
+	// Re-registering replaces the existing config
+	updated, err := sessionMgr.RegisterMCPServer(ctx, admin.ID, "github", `{"command":"github-mcp-v2"}`)
+	if err != nil {
+		t.Fatalf("Failed to re-register MCP server: %v", err)
+	}
+	if updated.Config != `{"command":"github-mcp-v2"}` {
+		t.Errorf("Expected updated config, got %s", updated.Config)
+	}
+
+	servers, err := sessionMgr.GetMCPServers(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get MCP servers: %v", err)
+	}
+	var names []string
+	for _, server := range servers {
+		names = append(names, server.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"fetch", "github"}) {
+		t.Errorf("Expected servers [fetch github], got %v", names)
+	}
+}
+
+func TestClaudeInitMessageMCPServers(t *testing.T) {
+	line := `{"type":"system","subtype":"init","session_id":"abc","tools":["Bash"],"mcp_servers":[{"name":"github","status":"connected"},{"name":"fetch","status":"failed"}]}`
+
+	var msg session.ClaudeMessage
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		t.Fatalf("Failed to parse init message: %v", err)
+	}
+
+	want := []models.MCPServerStatus{
+		{Name: "github", Status: "connected"},
+		{Name: "fetch", Status: "failed"},
+	}
+	if !reflect.DeepEqual(msg.MCPServers, want) {
+		t.Errorf("MCPServers = %v, want %v", msg.MCPServers, want)
+	}
+
+	// Sessions without any reported statuses have nothing to show
+	_, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	if statuses := sessionMgr.GetMCPServerStatuses(1); len(statuses) != 0 {
+		t.Errorf("Expected no statuses for unknown session, got %v", statuses)
+	}
+}
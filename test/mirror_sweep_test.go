@@ -0,0 +1,120 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestSweepMirrorsRemovesOnlyStaleUnusedMirrors(t *testing.T) {
+	// Mirrors live under $WORK_DIR/repos
+	workDir := t.TempDir()
+	reposDir := filepath.Join(workDir, "repos")
+
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.WorkDir = workDir
+		cfg.Session.MirrorTTL = 3600
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Mirrors are kept by host, owner and repository
+	const (
+		stale      = "github.com/test/stale-repo"
+		active     = "github.com/test/active-repo"
+		otherOwner = "github.com/other/active-repo"
+		fresh      = "github.com/test/fresh-repo"
+		worktreed  = "github.com/test/worktree-repo"
+	)
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{stale, active, otherOwner, fresh, worktreed} {
+		path := filepath.Join(reposDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Join(path, ".git"), 0755); err != nil {
+			t.Fatalf("Failed to create mirror %s: %v", name, err)
+		}
+		if name != fresh {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatalf("Failed to age mirror %s: %v", name, err)
+			}
+		}
+	}
+
+	// A worktree is still registered with worktree-repo, though no live session uses it
+	worktreeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(worktreeDir, ".git"), []byte("gitdir: elsewhere\n"), 0644); err != nil {
+		t.Fatalf("Failed to create worktree: %v", err)
+	}
+	registration := filepath.Join(reposDir, filepath.FromSlash(worktreed), ".git", "worktrees", "leftover")
+	if err := os.MkdirAll(registration, 0755); err != nil {
+		t.Fatalf("Failed to register worktree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(registration, "gitdir"), []byte(filepath.Join(worktreeDir, ".git")+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to register worktree: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(reposDir, filepath.FromSlash(worktreed)), old, old); err != nil {
+		t.Fatalf("Failed to age mirror: %v", err)
+	}
+
+	// A live session has a worktree from active-repo
+	session := &models.Session{
+		SessionID:        "claude-session-mirror",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/active-repo.git",
+		BranchName:       "mirror-feature",
+		WorkTreePath:     filepath.Join(workDir, "worktrees", "mirror-feature"),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	// An ended session doesn't keep its mirror alive
+	ended := &models.Session{
+		SessionID:        "claude-session-ended",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.654321",
+		RepoURL:          "https://github.com/test/stale-repo",
+		BranchName:       "ended-feature",
+		WorkTreePath:     filepath.Join(workDir, "worktrees", "ended-feature"),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusEnded,
+	}
+	if err := database.CreateSession(ctx, ended); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	removed, err := sessionMgr.SweepMirrors(ctx)
+	if err != nil {
+		t.Fatalf("SweepMirrors() error = %v", err)
+	}
+	// The other owner's same-named repository isn't kept alive by the live session
+	sort.Strings(removed)
+	if want := []string{otherOwner, stale}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("SweepMirrors() removed = %v, want %v", removed, want)
+	}
+
+	for name, wantExists := range map[string]bool{
+		stale:      false,
+		active:     true,
+		otherOwner: false,
+		fresh:      true,
+		worktreed:  true,
+	} {
+		_, err := os.Stat(filepath.Join(reposDir, filepath.FromSlash(name)))
+		if exists := err == nil; exists != wantExists {
+			t.Errorf("Mirror %s exists = %v, want %v", name, exists, wantExists)
+		}
+	}
+}
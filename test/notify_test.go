@@ -0,0 +1,96 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestNotifyPreference(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Budget.WarnThresholdUSD = 1.0
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "UOWNER",
+		SlackUserName:    "owner",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	prefs, err := sessionMgr.GetUserPrefs(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("Failed to get preferences: %v", err)
+	}
+	if prefs.Notify != models.NotifyOn {
+		t.Errorf("default notify = %q, want %q", prefs.Notify, models.NotifyOn)
+	}
+	if err := sessionMgr.SetNotifyPreference(ctx, owner.ID, "sometimes"); err == nil {
+		t.Error("SetNotifyPreference() accepted an invalid preference")
+	}
+
+	tests := []struct {
+		notify          string
+		wantAlert       bool
+		wantCompletion  bool
+		wantBudgetAlert bool
+	}{
+		{notify: models.NotifyOn, wantAlert: true, wantCompletion: true, wantBudgetAlert: true},
+		{notify: models.NotifyMentions, wantAlert: true, wantCompletion: false, wantBudgetAlert: true},
+		{notify: models.NotifyOff, wantAlert: false, wantCompletion: false, wantBudgetAlert: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.notify, func(t *testing.T) {
+			session := &models.Session{
+				SessionID:        "notify-" + tt.notify,
+				SlackWorkspaceID: "T123456",
+				SlackChannelID:   "C123456",
+				SlackThreadTS:    "1234567890." + tt.notify,
+				RepoURL:          "https://github.com/test/repo",
+				BranchName:       "notify-" + tt.notify,
+				WorkTreePath:     t.TempDir(),
+				ModelName:        models.ModelSonnet,
+				Status:           models.SessionStatusActive,
+			}
+			if err := database.CreateSession(ctx, session); err != nil {
+				t.Fatalf("Failed to create session: %v", err)
+			}
+			if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+				t.Fatalf("Failed to add owner: %v", err)
+			}
+			if err := sessionMgr.SetNotifyPreference(ctx, owner.ID, tt.notify); err != nil {
+				t.Fatalf("Failed to set preference: %v", err)
+			}
+
+			const mention = "<@UOWNER> "
+			if got := sessionMgr.OwnerMention(ctx, session.ID, true); (got == mention) != tt.wantAlert {
+				t.Errorf("OwnerMention(alert) = %q, want mention %v", got, tt.wantAlert)
+			}
+			if got := sessionMgr.OwnerMention(ctx, session.ID, false); (got == mention) != tt.wantCompletion {
+				t.Errorf("OwnerMention(completion) = %q, want mention %v", got, tt.wantCompletion)
+			}
+
+			var threadMessages []string
+			if err := sessionMgr.RecordSessionCost(ctx, session, 1.5, func(message string) {
+				threadMessages = append(threadMessages, message)
+			}); err != nil {
+				t.Fatalf("Failed to record cost: %v", err)
+			}
+			if len(threadMessages) != 1 {
+				t.Fatalf("Expected 1 budget alert, got %v", threadMessages)
+			}
+			if got := strings.Contains(threadMessages[0], "<@UOWNER>"); got != tt.wantBudgetAlert {
+				t.Errorf("budget alert %q, want mention %v", threadMessages[0], tt.wantBudgetAlert)
+			}
+		})
+	}
+}
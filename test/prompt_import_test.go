@@ -0,0 +1,97 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/prompts"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestImportSystemPrompts(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	admin, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "UADMIN",
+		SlackUserName:    "admin",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// A prompt the admin can already see is not imported again
+	_, err = database.CreateSystemPrompt(ctx, &models.CreateSystemPromptRequest{
+		Name:      "go-expert",
+		Content:   "An existing prompt",
+		CreatedBy: admin.ID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create system prompt: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join("..", "internal", "prompts", "testdata", "library.yaml"))
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	library, err := prompts.ParseLibrary(data)
+	if err != nil {
+		t.Fatalf("ParseLibrary() error = %v", err)
+	}
+
+	result, err := sessionMgr.ImportSystemPrompts(ctx, admin.ID, library, true)
+	if err != nil {
+		t.Fatalf("ImportSystemPrompts() error = %v", err)
+	}
+
+	created := append([]string(nil), result.Created...)
+	sort.Strings(created)
+	if got, want := strings.Join(created, ","), "docs-writer,reviewer"; got != want {
+		t.Errorf("created = %v, want %v", got, want)
+	}
+
+	skipped := make(map[string]string)
+	for _, skip := range result.Skipped {
+		skipped[skip.Name] = skip.Reason
+	}
+	wantSkipped := map[string]string{
+		"go-expert": "already exists",
+		"reviewer":  "duplicate in library",
+	}
+	if len(result.Skipped) != len(wantSkipped) {
+		t.Errorf("skipped %d prompts, want %d", len(result.Skipped), len(wantSkipped))
+	}
+	for name, reason := range wantSkipped {
+		if skipped[name] != reason {
+			t.Errorf("skip reason for %s = %q, want %q", name, skipped[name], reason)
+		}
+	}
+
+	// Imported prompts are public and keep the first definition of a repeated name
+	reviewer, err := database.GetSystemPromptByName(ctx, admin.ID, "reviewer")
+	if err != nil {
+		t.Fatalf("GetSystemPromptByName() error = %v", err)
+	}
+	if !reviewer.IsPublic {
+		t.Error("imported prompt IsPublic = false, want true")
+	}
+	if !strings.Contains(reviewer.Content, "meticulous") {
+		t.Errorf("imported prompt content = %q, want the first definition", reviewer.Content)
+	}
+
+	// Importing the same library again creates nothing
+	result, err = sessionMgr.ImportSystemPrompts(ctx, admin.ID, library, true)
+	if err != nil {
+		t.Fatalf("ImportSystemPrompts() second run error = %v", err)
+	}
+	if len(result.Created) != 0 || len(result.Skipped) != len(library) {
+		t.Errorf("second run created %d, skipped %d, want 0 and %d", len(result.Created), len(result.Skipped), len(library))
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestCreateSessionRejectsProtectedBranch(t *testing.T) {
+	_, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.ProtectedBranches = []string{"main", "release"}
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		feature string
+		from    string
+		wantErr bool
+	}{
+		{name: "default branch", feature: "main", from: "main", wantErr: true},
+		{name: "configured protected branch", feature: "release", from: "main", wantErr: true},
+		{name: "protected branch in another case", feature: "Main", from: "main", wantErr: true},
+		{name: "branch the session starts from", feature: "develop", from: "origin/develop", wantErr: true},
+		{name: "feature branch", feature: "add-widgets", from: "main"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := sessionMgr.CreateSession(ctx, &models.CreateSessionRequest{
+				WorkspaceID:     user.SlackWorkspaceID,
+				CreatedByUserID: user.ID,
+				ChannelID:       "C123456",
+				ThreadTS:        "1234567890.00000" + string(rune('0'+i)),
+				RepoURL:         "https://github.com/test/repo",
+				FromCommitish:   tt.from,
+				FeatureName:     tt.feature,
+				ModelName:       models.ModelSonnet,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateSession() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "protected branch") {
+				t.Errorf("CreateSession() error = %v, want a protected branch error", err)
+			}
+		})
+	}
+}
+
+func TestSetupSessionRejectsProtectedBranch(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// A restarted session is set up again without going through CreateSession
+	session := createOwnedSession(t, database, user.ID, "develop", models.SessionStatusStarting)
+
+	var messages []string
+	sessionMgr.SetupSessionAsync(ctx, session, &models.CreateSessionRequest{
+		WorkspaceID:     user.SlackWorkspaceID,
+		CreatedByUserID: user.ID,
+		ChannelID:       "C123456",
+		RepoURL:         "https://github.com/test/repo",
+		FromCommitish:   "main",
+		FeatureName:     "develop",
+		ModelName:       models.ModelSonnet,
+	}, func(message string) {
+		messages = append(messages, message)
+	})
+
+	if len(messages) != 1 || !strings.Contains(messages[0], "protected branch") {
+		t.Errorf("setup messages = %q, want a protected branch error", messages)
+	}
+	stored, err := database.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if stored.Status != models.SessionStatusError {
+		t.Errorf("session status = %s, want %s", stored.Status, models.SessionStatusError)
+	}
+}
@@ -0,0 +1,163 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/internal/repo"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestEndSessionPushRejectedKeepsSession(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	installFakeClaude(t)
+	t.Setenv("HOME", t.TempDir())
+
+	workDir := t.TempDir()
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.WorkDir = workDir
+		cfg.Session.CleanupOrphans = true
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// A bare origin with main, so that the session and others can push to it
+	root := t.TempDir()
+	source := filepath.Join(root, "source")
+	originDir := filepath.Join(root, "origin.git")
+	runGit(t, root, "init", "--initial-branch=main", source)
+	if err := os.WriteFile(filepath.Join(source, "README.md"), []byte("# rejected\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, source, "add", ".")
+	runGit(t, source, "commit", "-m", "Initial commit")
+	runGit(t, root, "clone", "--bare", source, originDir)
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	const branch = "rejected-feature"
+	session := &models.Session{
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          originDir,
+		BranchName:       branch,
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusStarting,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+	var messages []string
+	sessionMgr.SetupSessionAsync(ctx, session, &models.CreateSessionRequest{
+		WorkspaceID:     "T123456",
+		CreatedByUserID: owner.ID,
+		ChannelID:       "C123456",
+		RepoURL:         originDir,
+		FromCommitish:   "main",
+		FeatureName:     branch,
+		ModelName:       models.ModelSonnet,
+	}, func(message string) {
+		messages = append(messages, message)
+	})
+	session, err = database.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if session.Status != models.SessionStatusActive {
+		t.Fatalf("session status = %s, want active; setup said:\n%s", session.Status, strings.Join(messages, "\n"))
+	}
+
+	// Someone else pushes the branch before the session is stopped
+	other := filepath.Join(root, "other")
+	runGit(t, root, "clone", originDir, other)
+	runGit(t, other, "checkout", "-b", branch)
+	runGit(t, other, "commit", "--allow-empty", "-m", "Other change")
+	runGit(t, other, "push", "origin", branch)
+
+	if err := os.WriteFile(filepath.Join(session.WorkTreePath, "feature.go"), []byte("package feature\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	err = sessionMgr.EndSession(ctx, session.SessionID, "Add feature")
+	if !errors.Is(err, repo.ErrPushRejected) || !errors.Is(err, models.ErrRepoAccess) {
+		t.Fatalf("EndSession() error = %v, want a rejected push", err)
+	}
+
+	// The session stays active with the commit on its work tree
+	stored, err := database.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if stored.Status != models.SessionStatusActive {
+		t.Errorf("session status = %s, want active", stored.Status)
+	}
+	headSubject := func() string {
+		t.Helper()
+		output, err := exec.Command("git", "-C", session.WorkTreePath, "log", "-1", "--format=%s").Output()
+		if err != nil {
+			t.Fatalf("git log failed: %v", err)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	if got := headSubject(); got != "Add feature" {
+		t.Errorf("work tree head = %q, want the rejected commit", got)
+	}
+
+	// Neither the orphan cleanup nor a new session on the branch touches it
+	removed, err := sessionMgr.ReconcileWorktrees(ctx)
+	if err != nil {
+		t.Fatalf("ReconcileWorktrees() error = %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("ReconcileWorktrees() removed %v, want nothing", removed)
+	}
+	if got := headSubject(); got != "Add feature" {
+		t.Errorf("work tree head after reconcile = %q, want the rejected commit", got)
+	}
+	exists, err := sessionMgr.CheckBranchNameExists(ctx, "T123456", originDir, branch)
+	if err != nil || !exists {
+		t.Errorf("CheckBranchNameExists() = %v, %v, want the branch taken", exists, err)
+	}
+
+	// Once the remote branch is merged, stopping again pushes the commit
+	runGit(t, session.WorkTreePath, "pull", "--no-rebase", "--no-edit", "origin", branch)
+	if err := sessionMgr.EndSession(ctx, session.SessionID, ""); err != nil {
+		t.Fatalf("EndSession() after merging error = %v", err)
+	}
+	output, err := exec.Command("git", "-C", originDir, "log", "--format=%s", branch).Output()
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	if !strings.Contains(string(output), "Add feature") {
+		t.Errorf("origin history = %q, want the session's commit", output)
+	}
+	summary, err := sessionMgr.GetSessionSummary(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionSummary() error = %v", err)
+	}
+	if summary.CommitSHA == "" {
+		t.Error("summary has no commit, want the pushed head")
+	}
+}
@@ -0,0 +1,77 @@
+package test
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// usageClaudeScript stands in for a claude CLI that reports token usage but no cost:
+// 1000 input and 2000 output tokens per invocation
+const usageClaudeScript = `#!/bin/sh
+echo '{"type":"result","subtype":"success","result":"done","usage":{"input_tokens":1000,"output_tokens":2000},"session_id":"usage-session"}'
+`
+
+func TestSendToSessionCostFromUsage(t *testing.T) {
+	installClaudeScript(t, usageClaudeScript)
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "usage-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "usage-feature",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	// At Sonnet's $3/$15 per million tokens each turn costs $0.003 + $0.03
+	const turnCost = 0.033
+	for turn := 1; turn <= 2; turn++ {
+		var reported []float64
+		err := sessionMgr.SendToSession(ctx, session.SessionID, "carry on", func(string) {},
+			func(cost float64) { reported = append(reported, cost) })
+		if err != nil {
+			t.Fatalf("SendToSession() error = %v", err)
+		}
+		if len(reported) != 1 || math.Abs(reported[0]-turnCost) > 1e-9 {
+			t.Errorf("turn %d reported costs %v, want [%v]", turn, reported, turnCost)
+		}
+
+		// Each turn's cost is added to the running cost
+		stored, err := database.GetSessionByID(ctx, session.ID)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if want := float64(turn) * turnCost; math.Abs(stored.RunningCost-want) > 1e-9 {
+			t.Errorf("after turn %d RunningCost = %v, want %v", turn, stored.RunningCost, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestDetachAllActiveSessions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	originDir, workDir := createFixtureWorktree(t, "detach-feature")
+	session := &models.Session{
+		SessionID:        "claude-detach",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.detach",
+		RepoURL:          originDir,
+		BranchName:       "detach-feature",
+		WorkTreePath:     workDir,
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	if err := sessionMgr.DetachAllActiveSessions(ctx); err != nil {
+		t.Fatalf("DetachAllActiveSessions() error = %v", err)
+	}
+
+	t.Run("work is pushed", func(t *testing.T) {
+		if err := exec.Command("git", "--git-dir", originDir, "rev-parse", "--verify", "detach-feature").Run(); err != nil {
+			t.Errorf("the session's changes weren't pushed: %v", err)
+		}
+	})
+
+	t.Run("session is detached, not ended", func(t *testing.T) {
+		got, err := database.GetSession(ctx, session.SessionID)
+		if err != nil {
+			t.Fatalf("GetSession() error = %v", err)
+		}
+		if got.Status != models.SessionStatusDetached {
+			t.Errorf("status = %q, want %q", got.Status, models.SessionStatusDetached)
+		}
+		if got.EndedAt != nil {
+			t.Errorf("ended_at = %v, want unset", got.EndedAt)
+		}
+		if _, err := os.Stat(workDir); err != nil {
+			t.Errorf("work tree was removed: %v", err)
+		}
+	})
+
+	t.Run("next start resumes it", func(t *testing.T) {
+		resumed, err := sessionMgr.ResumeDetachedSessions(ctx)
+		if err != nil {
+			t.Fatalf("ResumeDetachedSessions() error = %v", err)
+		}
+		if resumed != 1 {
+			t.Errorf("ResumeDetachedSessions() = %d, want 1", resumed)
+		}
+		got, err := database.GetSession(ctx, session.SessionID)
+		if err != nil {
+			t.Fatalf("GetSession() error = %v", err)
+		}
+		if got.Status != models.SessionStatusActive || got.SessionID != "claude-detach" {
+			t.Errorf("session = %q with Claude session %q, want active with claude-detach", got.Status, got.SessionID)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestCleanupWarnsIdleSessions(t *testing.T) {
+	type step struct {
+		after        time.Duration // since the session's last activity when it was created
+		activity     bool          // the session is active at this point instead of being cleaned up
+		wantWarnings int           // in total so far
+		wantStatus   string
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "warn then close",
+			steps: []step{
+				{after: 45 * time.Minute, wantStatus: models.SessionStatusActive},
+				{after: 55 * time.Minute, wantWarnings: 1, wantStatus: models.SessionStatusActive},
+				{after: 58 * time.Minute, wantWarnings: 1, wantStatus: models.SessionStatusActive},
+				// Past the idle timeout, but the warning gave ten minutes
+				{after: 61 * time.Minute, wantWarnings: 1, wantStatus: models.SessionStatusActive},
+				{after: 65 * time.Minute, wantWarnings: 1, wantStatus: models.SessionStatusEnded},
+			},
+		},
+		{
+			name: "warn then reprieve",
+			steps: []step{
+				{after: 55 * time.Minute, wantWarnings: 1, wantStatus: models.SessionStatusActive},
+				{after: 56 * time.Minute, activity: true},
+				{after: 70 * time.Minute, wantWarnings: 1, wantStatus: models.SessionStatusActive},
+				// Idle again, so warned again before closing
+				{after: 107 * time.Minute, wantWarnings: 2, wantStatus: models.SessionStatusActive},
+				{after: 118 * time.Minute, wantWarnings: 2, wantStatus: models.SessionStatusEnded},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dbPath string
+			database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+				cfg.Session.IdleTimeout = int(time.Hour.Seconds())
+				cfg.Session.IdleWarning = int((10 * time.Minute).Seconds())
+				dbPath = cfg.Database.Path
+			})
+			defer cleanup()
+
+			ctx := context.Background()
+
+			owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+				SlackWorkspaceID: "T123456",
+				SlackUserID:      "U123456",
+				SlackUserName:    "testuser",
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+			session := createOwnedSession(t, database, owner.ID, "idle-feature", models.SessionStatusActive)
+			stored, err := database.GetSessionByID(ctx, session.ID)
+			if err != nil {
+				t.Fatalf("Failed to get session: %v", err)
+			}
+			start := stored.UpdatedAt
+
+			raw, err := sql.Open("sqlite3", dbPath)
+			if err != nil {
+				t.Fatalf("Failed to open raw connection: %v", err)
+			}
+			defer raw.Close()
+
+			var warnings []string
+			sessionMgr.SetThreadCallback(func(channelID, threadTS, message string) {
+				warnings = append(warnings, message)
+			})
+
+			for _, s := range tt.steps {
+				now := start.Add(s.after)
+				if s.activity {
+					if _, err := raw.ExecContext(ctx, "UPDATE sessions SET updated_at = ? WHERE id = ?",
+						now.UTC().Format("2006-01-02 15:04:05"), session.ID); err != nil {
+						t.Fatalf("Failed to record activity: %v", err)
+					}
+					continue
+				}
+
+				sessionMgr.SetClock(func() time.Time { return now })
+				if _, err := sessionMgr.CleanupIdleSessions(ctx); err != nil {
+					t.Fatalf("CleanupIdleSessions() error = %v", err)
+				}
+
+				if len(warnings) != s.wantWarnings {
+					t.Fatalf("after %v: warnings = %q, want %d", s.after, warnings, s.wantWarnings)
+				}
+				for _, warning := range warnings {
+					if !strings.Contains(warning, "closed in 10 minutes due to inactivity") {
+						t.Errorf("warning = %q, want the inactivity notice", warning)
+					}
+				}
+				stored, err := database.GetSessionByID(ctx, session.ID)
+				if err != nil {
+					t.Fatalf("Failed to get session: %v", err)
+				}
+				if stored.Status != s.wantStatus {
+					t.Fatalf("after %v: status = %s, want %s", s.after, stored.Status, s.wantStatus)
+				}
+			}
+		})
+	}
+}
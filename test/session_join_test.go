@@ -0,0 +1,76 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestJoinSession(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	newUser := func(slackUserID string) *models.User {
+		user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+			SlackWorkspaceID: "T123456",
+			SlackUserID:      slackUserID,
+			SlackUserName:    slackUserID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	owner := newUser("UOWNER")
+	collaborator := newUser("UCOLLAB")
+	viewer := newUser("UVIEWER")
+
+	session := createOwnedSession(t, database, owner.ID, "join-feature", models.SessionStatusActive)
+
+	if err := sessionMgr.JoinSession(ctx, session, collaborator.ID, models.SessionRoleCollaborator); err != nil {
+		t.Fatalf("JoinSession() collaborator error = %v", err)
+	}
+	if err := sessionMgr.JoinSession(ctx, session, viewer.ID, models.SessionRoleViewer); err != nil {
+		t.Fatalf("JoinSession() viewer error = %v", err)
+	}
+
+	users, err := sessionMgr.GetSessionUsers(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionUsers() error = %v", err)
+	}
+
+	roles := make(map[int64]string)
+	for _, u := range users {
+		roles[u.UserID] = u.Role
+	}
+	want := map[int64]string{
+		owner.ID:        models.SessionRoleOwner,
+		collaborator.ID: models.SessionRoleCollaborator,
+		viewer.ID:       models.SessionRoleViewer,
+	}
+	if len(roles) != len(want) {
+		t.Errorf("GetSessionUsers() returned %d users, want %d", len(roles), len(want))
+	}
+	for userID, role := range want {
+		if roles[userID] != role {
+			t.Errorf("role for user %d = %q, want %q", userID, roles[userID], role)
+		}
+	}
+
+	// The owner can't demote themselves by joining
+	if err := sessionMgr.JoinSession(ctx, session, owner.ID, models.SessionRoleViewer); err == nil {
+		t.Error("JoinSession() by owner error = nil, want error")
+	}
+	if ownerID, err := sessionMgr.GetSessionOwner(ctx, session.ID); err != nil || ownerID != owner.ID {
+		t.Errorf("GetSessionOwner() = %v, %v, want %v", ownerID, err, owner.ID)
+	}
+
+	// Ended sessions can't be joined
+	ended := createOwnedSession(t, database, owner.ID, "join-ended", models.SessionStatusEnded)
+	if err := sessionMgr.JoinSession(ctx, ended, collaborator.ID, models.SessionRoleCollaborator); err == nil {
+		t.Error("JoinSession() on ended session error = nil, want error")
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/db"
+	"github.com/pbdeuchler/claude-bot/internal/session"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// createLeaveTestUsers creates an owner, two collaborators and a viewer
+func createLeaveTestUsers(t *testing.T, sessionMgr *session.Manager) (owner, first, second, viewer *models.User) {
+	t.Helper()
+
+	newUser := func(slackUserID string) *models.User {
+		user, err := sessionMgr.CreateOrUpdateUser(context.Background(), &models.CreateUserRequest{
+			SlackWorkspaceID: "T123456",
+			SlackUserID:      slackUserID,
+			SlackUserName:    slackUserID,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		return user
+	}
+	return newUser("UOWNER"), newUser("UFIRST"), newUser("USECOND"), newUser("UVIEWER")
+}
+
+// sessionRoles returns the role of each member of a session by user ID
+func sessionRoles(t *testing.T, database *db.DB, sessionID int64) map[int64]string {
+	t.Helper()
+
+	users, err := database.GetSessionUsers(context.Background(), sessionID)
+	if err != nil {
+		t.Fatalf("GetSessionUsers() error = %v", err)
+	}
+	roles := make(map[int64]string, len(users))
+	for _, u := range users {
+		roles[u.UserID] = u.Role
+	}
+	return roles
+}
+
+func TestLeaveSessionOwnerWithCollaborators(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	owner, first, second, viewer := createLeaveTestUsers(t, sessionMgr)
+
+	s := createOwnedSession(t, database, owner.ID, "leave-shared", models.SessionStatusActive)
+	// The viewer joined before either collaborator but collaborators are preferred
+	for _, member := range []struct {
+		user *models.User
+		role string
+	}{
+		{viewer, models.SessionRoleViewer},
+		{first, models.SessionRoleCollaborator},
+		{second, models.SessionRoleCollaborator},
+	} {
+		if err := sessionMgr.JoinSession(ctx, s, member.user.ID, member.role); err != nil {
+			t.Fatalf("JoinSession() error = %v", err)
+		}
+	}
+
+	result, err := sessionMgr.LeaveSession(ctx, s, owner.ID)
+	if err != nil {
+		t.Fatalf("LeaveSession() error = %v", err)
+	}
+	if result.Outcome != models.LeaveOutcomeTransferred || result.NewOwnerID != first.ID {
+		t.Errorf("LeaveSession() = %+v, want ownership transferred to user %d", result, first.ID)
+	}
+
+	roles := sessionRoles(t, database, s.ID)
+	want := map[int64]string{
+		first.ID:  models.SessionRoleOwner,
+		second.ID: models.SessionRoleCollaborator,
+		viewer.ID: models.SessionRoleViewer,
+	}
+	if len(roles) != len(want) {
+		t.Errorf("session has %d members, want %d", len(roles), len(want))
+	}
+	for userID, role := range want {
+		if roles[userID] != role {
+			t.Errorf("role for user %d = %q, want %q", userID, roles[userID], role)
+		}
+	}
+
+	updated, err := database.GetSessionByBranchName(ctx, "T123456", "", "leave-shared")
+	if err != nil {
+		t.Fatalf("GetSessionByBranchName() error = %v", err)
+	}
+	if updated.Status != models.SessionStatusActive {
+		t.Errorf("status = %q, want %q", updated.Status, models.SessionStatusActive)
+	}
+}
+
+func TestLeaveSessionOwnerAlone(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	owner, _, _, _ := createLeaveTestUsers(t, sessionMgr)
+
+	s := createOwnedSession(t, database, owner.ID, "leave-alone", models.SessionStatusActive)
+
+	result, err := sessionMgr.LeaveSession(ctx, s, owner.ID)
+	if err != nil {
+		t.Fatalf("LeaveSession() error = %v", err)
+	}
+	if result.Outcome != models.LeaveOutcomeEnded {
+		t.Errorf("LeaveSession() outcome = %q, want %q", result.Outcome, models.LeaveOutcomeEnded)
+	}
+
+	updated, err := database.GetSessionByBranchName(ctx, "T123456", "", "leave-alone")
+	if err != nil {
+		t.Fatalf("GetSessionByBranchName() error = %v", err)
+	}
+	if updated.Status != models.SessionStatusEnded {
+		t.Errorf("status = %q, want %q", updated.Status, models.SessionStatusEnded)
+	}
+
+	// The ended session stays attributed to its owner
+	if ownerID, err := database.GetSessionOwner(ctx, s.ID); err != nil || ownerID != owner.ID {
+		t.Errorf("GetSessionOwner() = %v, %v, want %v", ownerID, err, owner.ID)
+	}
+}
+
+func TestLeaveSessionNonOwner(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	owner, first, second, _ := createLeaveTestUsers(t, sessionMgr)
+
+	s := createOwnedSession(t, database, owner.ID, "leave-member", models.SessionStatusActive)
+	if err := sessionMgr.JoinSession(ctx, s, first.ID, models.SessionRoleCollaborator); err != nil {
+		t.Fatalf("JoinSession() error = %v", err)
+	}
+
+	result, err := sessionMgr.LeaveSession(ctx, s, first.ID)
+	if err != nil {
+		t.Fatalf("LeaveSession() error = %v", err)
+	}
+	if result.Outcome != models.LeaveOutcomeLeft {
+		t.Errorf("LeaveSession() outcome = %q, want %q", result.Outcome, models.LeaveOutcomeLeft)
+	}
+
+	roles := sessionRoles(t, database, s.ID)
+	if len(roles) != 1 || roles[owner.ID] != models.SessionRoleOwner {
+		t.Errorf("session members = %v, want only the owner", roles)
+	}
+
+	// Someone who isn't a member can't leave
+	if _, err := sessionMgr.LeaveSession(ctx, s, second.ID); err == nil {
+		t.Error("LeaveSession() by non-member error = nil, want error")
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestCleanupEndsSessionsPastMaxLifetime(t *testing.T) {
+	var dbPath string
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.MaxLifetime = int((24 * time.Hour).Seconds())
+		dbPath = cfg.Database.Path
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	oldSession := createOwnedSession(t, database, owner.ID, "long-lived", models.SessionStatusActive)
+	newSession := createOwnedSession(t, database, owner.ID, "short-lived", models.SessionStatusActive)
+
+	// The first session started two days ago but was active just now
+	raw, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open raw connection: %v", err)
+	}
+	defer raw.Close()
+	if _, err := raw.ExecContext(ctx, "UPDATE sessions SET created_at = datetime('now', '-2 days') WHERE id = ?", oldSession.ID); err != nil {
+		t.Fatalf("Failed to backdate session: %v", err)
+	}
+	if err := database.UpdateSessionCost(ctx, oldSession.SessionID, 0.5); err != nil {
+		t.Fatalf("Failed to record activity: %v", err)
+	}
+
+	var posted []string
+	sessionMgr.SetThreadCallback(func(channelID, threadTS, message string) {
+		if channelID != oldSession.SlackChannelID || threadTS != oldSession.SlackThreadTS {
+			t.Errorf("posted to %s/%s, want the long-lived session's thread", channelID, threadTS)
+		}
+		posted = append(posted, message)
+	})
+
+	ended, err := sessionMgr.CleanupIdleSessions(ctx)
+	if err != nil {
+		t.Fatalf("CleanupIdleSessions() error = %v", err)
+	}
+	if ended != 1 {
+		t.Errorf("CleanupIdleSessions() ended %d sessions, want 1", ended)
+	}
+
+	for _, tt := range []struct {
+		session    *models.Session
+		wantStatus string
+	}{
+		{session: oldSession, wantStatus: models.SessionStatusEnded},
+		{session: newSession, wantStatus: models.SessionStatusActive},
+	} {
+		stored, err := database.GetSessionByID(ctx, tt.session.ID)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if stored.Status != tt.wantStatus {
+			t.Errorf("session %s status = %s, want %s", tt.session.BranchName, stored.Status, tt.wantStatus)
+		}
+	}
+
+	if len(posted) != 1 || !strings.Contains(posted[0], "maximum lifetime") || !strings.Contains(posted[0], "<@U123456>") {
+		t.Errorf("thread messages = %q, want one maximum lifetime notice mentioning the owner", posted)
+	}
+}
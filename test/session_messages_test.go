@@ -0,0 +1,85 @@
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestSendToSessionRecordsMessages(t *testing.T) {
+	installFakeClaude(t)
+	t.Setenv("FAKE_CLAUDE_RESUMABLE", "logged-session")
+
+	for _, logMessages := range []bool{true, false} {
+		name := "logging off"
+		if logMessages {
+			name = "logging on"
+		}
+		t.Run(name, func(t *testing.T) {
+			database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+				cfg.Session.LogMessages = logMessages
+			})
+			defer cleanup()
+
+			ctx := context.Background()
+
+			owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+				SlackWorkspaceID: "T123456",
+				SlackUserID:      "U123456",
+				SlackUserName:    "testuser",
+			})
+			if err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+			if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+				t.Fatalf("Failed to store credential: %v", err)
+			}
+			session := &models.Session{
+				SessionID:        "logged-session",
+				SlackWorkspaceID: "T123456",
+				SlackChannelID:   "C123456",
+				SlackThreadTS:    "1234567890.123456",
+				RepoURL:          "https://github.com/test/repo",
+				BranchName:       "logged-feature",
+				WorkTreePath:     t.TempDir(),
+				ModelName:        models.ModelSonnet,
+				Status:           models.SessionStatusActive,
+			}
+			if err := database.CreateSession(ctx, session); err != nil {
+				t.Fatalf("Failed to create session: %v", err)
+			}
+			if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+				t.Fatalf("Failed to add owner: %v", err)
+			}
+
+			if err := sessionMgr.SendToSession(ctx, "logged-session", "carry on", func(string) {}, func(float64) {}); err != nil {
+				t.Fatalf("SendToSession() error = %v", err)
+			}
+
+			messages, err := sessionMgr.GetSessionMessages(ctx, session.ID, 10)
+			if err != nil {
+				t.Fatalf("GetSessionMessages() error = %v", err)
+			}
+			if !logMessages {
+				if len(messages) != 0 {
+					t.Errorf("recorded %d messages with LOG_MESSAGES off, want none", len(messages))
+				}
+				return
+			}
+
+			// Newest first: Claude's reply follows the user's message
+			if len(messages) != 2 {
+				t.Fatalf("recorded %d messages, want 2", len(messages))
+			}
+			if messages[1].Direction != models.MessageDirectionUserToClaude || messages[1].Content != "carry on" {
+				t.Errorf("first message = %s %q, want the user's message", messages[1].Direction, messages[1].Content)
+			}
+			if messages[0].Direction != models.MessageDirectionClaudeToUser || !strings.Contains(messages[0].Content, "resumed") {
+				t.Errorf("second message = %s %q, want Claude's reply", messages[0].Direction, messages[0].Content)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/pbdeuchler/claude-bot/internal/metrics"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestEndSessionRecordsDuration(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	m := metrics.NewMetricsWithRegisterer(prometheus.NewRegistry())
+	sessionMgr.SetMetrics(m)
+
+	session := &models.Session{
+		SessionID:        "claude-timed-feature",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "timed-feature",
+		WorkTreePath:     "/tmp/timed-feature",
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	start := time.Now()
+	if err := sessionMgr.EndSession(ctx, session.SessionID, ""); err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+
+	var histogram dto.Metric
+	if err := m.SessionDuration.(prometheus.Metric).Write(&histogram); err != nil {
+		t.Fatalf("Failed to read session durations: %v", err)
+	}
+	if got := histogram.GetHistogram().GetSampleCount(); got != 1 {
+		t.Fatalf("cb_session_duration_seconds count = %d, want 1", got)
+	}
+
+	// created_at has second precision, so the session may appear up to a second older
+	duration := time.Duration(histogram.GetHistogram().GetSampleSum() * float64(time.Second))
+	if max := time.Since(start) + 2*time.Second; duration <= 0 || duration > max {
+		t.Errorf("session duration = %v, want between 0 and %v", duration, max)
+	}
+}
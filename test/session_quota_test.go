@@ -0,0 +1,219 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/internal/db"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// createOwnedSession inserts a session with the given status owned by userID
+func createOwnedSession(t *testing.T, database *db.DB, userID int64, name, status string) *models.Session {
+	t.Helper()
+
+	ctx := context.Background()
+	session := &models.Session{
+		SessionID:        "claude-" + name,
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "ts-" + name,
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       name,
+		WorkTreePath:     "/tmp/" + name,
+		ModelName:        models.ModelSonnet,
+		Status:           status,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session %s: %v", name, err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, userID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner to session %s: %v", name, err)
+	}
+	return session
+}
+
+func TestCountActiveSessionsByUser(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "UOWNER",
+		SlackUserName:    "owner",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	other, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "UOTHER",
+		SlackUserName:    "other",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	statuses := []string{
+		"starting",
+		models.SessionStatusActive,
+		models.SessionStatusEnding,
+		models.SessionStatusEnded,
+		models.SessionStatusError,
+	}
+	for i, status := range statuses {
+		createOwnedSession(t, database, owner.ID, fmt.Sprintf("count-%d", i), status)
+	}
+
+	// Collaborating on someone else's session doesn't count against the quota
+	shared := createOwnedSession(t, database, other.ID, "count-shared", models.SessionStatusActive)
+	if err := database.AddUserToSession(ctx, shared.ID, owner.ID, models.SessionRoleCollaborator); err != nil {
+		t.Fatalf("Failed to add collaborator: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int64
+		want   int
+	}{
+		{"only starting and active sessions", owner.ID, 2},
+		{"owned shared session", other.ID, 1},
+		{"unknown user", 9999, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := database.CountActiveSessionsByUser(ctx, tt.userID)
+			if err != nil {
+				t.Fatalf("CountActiveSessionsByUser() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CountActiveSessionsByUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSessionEnforcesMaxPerUser(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.MaxPerUser = 5
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Ended sessions don't count
+	createOwnedSession(t, database, user.ID, "quota-ended", models.SessionStatusEnded)
+
+	newRequest := func(feature string) *models.CreateSessionRequest {
+		return &models.CreateSessionRequest{
+			WorkspaceID:     user.SlackWorkspaceID,
+			CreatedByUserID: user.ID,
+			ChannelID:       "C123456",
+			ThreadTS:        "ts-" + feature,
+			RepoURL:         "https://github.com/test/repo",
+			FromCommitish:   "main",
+			FeatureName:     feature,
+			ModelName:       models.ModelSonnet,
+		}
+	}
+
+	for i := 1; i <= 4; i++ {
+		createOwnedSession(t, database, user.ID, fmt.Sprintf("quota-%d", i), models.SessionStatusActive)
+	}
+
+	// The 5th session is still within the limit
+	if _, err := sessionMgr.CreateSession(ctx, newRequest("quota-5")); err != nil {
+		t.Fatalf("Expected 5th session to be created: %v", err)
+	}
+
+	// The 6th is rejected
+	_, err = sessionMgr.CreateSession(ctx, newRequest("quota-6"))
+	cbErr, ok := err.(*models.CBError)
+	if !ok || cbErr.Code != models.ErrCodeQuotaExceeded {
+		t.Fatalf("Expected %s error for 6th session, got %v", models.ErrCodeQuotaExceeded, err)
+	}
+
+	exists, err := database.CheckBranchNameExists(ctx, "T123456", "https://github.com/test/repo", "quota-6")
+	if err != nil {
+		t.Fatalf("Failed to check branch name: %v", err)
+	}
+	if exists {
+		t.Error("Expected rejected session not to be stored")
+	}
+}
+
+func TestGetActiveSessionsByUserPages(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Created in order, so newest first is the reverse
+	var features []string
+	for i := 1; i <= 5; i++ {
+		name := fmt.Sprintf("page-feature-%d", i)
+		createOwnedSession(t, database, owner.ID, name, models.SessionStatusActive)
+		features = append([]string{name}, features...)
+	}
+	createOwnedSession(t, database, owner.ID, "ended-feature", models.SessionStatusEnded)
+
+	count, err := database.GetSessionCountByUser(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("GetSessionCountByUser() error = %v", err)
+	}
+	if count != len(features) {
+		t.Errorf("GetSessionCountByUser() = %d, want %d", count, len(features))
+	}
+
+	tests := []struct {
+		name          string
+		limit, offset int
+		want          []string
+	}{
+		{name: "first page", limit: 2, offset: 0, want: features[0:2]},
+		{name: "middle page", limit: 2, offset: 2, want: features[2:4]},
+		{name: "partial last page", limit: 2, offset: 4, want: features[4:]},
+		{name: "past the end", limit: 2, offset: 6, want: nil},
+		{name: "no limit", limit: 0, offset: 1, want: features[1:]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, err := database.GetActiveSessionsByUser(ctx, owner.ID, tt.limit, tt.offset)
+			if err != nil {
+				t.Fatalf("GetActiveSessionsByUser() error = %v", err)
+			}
+			var got []string
+			for _, s := range sessions {
+				got = append(got, s.BranchName)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("GetActiveSessionsByUser(%d, %d) = %v, want %v", tt.limit, tt.offset, got, tt.want)
+			}
+		})
+	}
+}
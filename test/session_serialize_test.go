@@ -0,0 +1,229 @@
+package test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// slowClaudeScript stands in for the claude CLI, logging to $FAKE_CLAUDE_LOG when each
+// invocation starts and ends. Messages starting with "slow" take a second.
+const slowClaudeScript = `#!/bin/sh
+for last; do :; done
+echo "start $last" >> "$FAKE_CLAUDE_LOG"
+echo '{"type":"system","subtype":"init","session_id":"'"$3"'"}'
+case "$last" in
+slow*) sleep 1 ;;
+esac
+echo "end $last" >> "$FAKE_CLAUDE_LOG"
+echo '{"type":"result","subtype":"success","result":"done","cost_usd":0.01,"session_id":"'"$3"'"}'
+`
+
+func TestSendToSessionSerializesMessages(t *testing.T) {
+	logPath := installClaudeScript(t, slowClaudeScript)
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	for _, name := range []string{"first", "other"} {
+		session := &models.Session{
+			SessionID:        "claude-" + name,
+			SlackWorkspaceID: "T123456",
+			SlackChannelID:   "C123456",
+			SlackThreadTS:    "ts-" + name,
+			RepoURL:          "https://github.com/test/repo",
+			BranchName:       name,
+			WorkTreePath:     t.TempDir(),
+			ModelName:        models.ModelSonnet,
+			Status:           models.SessionStatusActive,
+		}
+		if err := database.CreateSession(ctx, session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+			t.Fatalf("Failed to add owner: %v", err)
+		}
+	}
+
+	waitForLog := func(line string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			data, _ := os.ReadFile(logPath)
+			if strings.Contains(string(data), line+"\n") {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("invocation log never contained %q", line)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var queuedNotices int
+	send := func(sessionID, message string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := sessionMgr.SendToSession(ctx, sessionID, message, func(message string) {
+				if strings.Contains(message, "still working on the previous message") {
+					mu.Lock()
+					queuedNotices++
+					mu.Unlock()
+				}
+			}, func(float64) {})
+			if err != nil {
+				t.Errorf("SendToSession(%s) error = %v", message, err)
+			}
+		}()
+	}
+
+	send("claude-first", "slow one")
+	waitForLog("start slow one")
+	send("claude-first", "quick two")
+	// Another session's message isn't held up
+	send("claude-other", "quick other")
+	waitForLog("end quick other")
+	wg.Wait()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read invocation log: %v", err)
+	}
+	var order []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.HasSuffix(line, "other") {
+			order = append(order, line)
+		}
+	}
+	if got, want := strings.Join(order, ", "), "start slow one, end slow one, start quick two, end quick two"; got != want {
+		t.Errorf("invocations = %q, want %q", got, want)
+	}
+	if log := string(data); strings.Index(log, "end quick other") > strings.Index(log, "end slow one") {
+		t.Errorf("the other session's message waited for the first session's; invocations:\n%s", log)
+	}
+	if queuedNotices != 1 {
+		t.Errorf("queued notices = %d, want 1", queuedNotices)
+	}
+}
+
+// resetClaudeScript stands in for the claude CLI, failing to resume expired-session as
+// Claude does once a session has expired and continuing as fresh-session otherwise. It
+// logs to $FAKE_CLAUDE_LOG when each message starts and ends; messages starting with
+// "slow" take a second.
+const resetClaudeScript = `#!/bin/sh
+for last; do :; done
+message=$(printf '%s\n' "$last" | tail -n 1)
+if [ "$2" = "-r" ] && [ "$3" = "expired-session" ]; then
+	echo "Error: No conversation found with session ID: $3" >&2
+	exit 1
+fi
+echo "start $message" >> "$FAKE_CLAUDE_LOG"
+echo '{"type":"system","subtype":"init","session_id":"fresh-session"}'
+case "$message" in
+slow*) sleep 1 ;;
+esac
+echo "end $message" >> "$FAKE_CLAUDE_LOG"
+echo '{"type":"result","subtype":"success","result":"done","cost_usd":0.01,"session_id":"fresh-session"}'
+`
+
+func TestSendToSessionSerializesAcrossReset(t *testing.T) {
+	logPath := installClaudeScript(t, resetClaudeScript)
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SessionID:        "expired-session",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "reset-feature",
+		WorkTreePath:     t.TempDir(),
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	waitForLog := func(line string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			data, _ := os.ReadFile(logPath)
+			if strings.Contains(string(data), line+"\n") {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("invocation log never contained %q", line)
+	}
+
+	var wg sync.WaitGroup
+	send := func(sessionID, message string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sessionMgr.SendToSession(ctx, sessionID, message, func(string) {}, func(float64) {}); err != nil {
+				t.Errorf("SendToSession(%s) error = %v", message, err)
+			}
+		}()
+	}
+
+	// The first message resets the Claude session; the second was queued under the
+	// expired Claude session ID
+	send("expired-session", "slow one")
+	waitForLog("start slow one")
+	send("expired-session", "slow two")
+	waitForLog("start slow two")
+	// A message sent under the new Claude session ID waits for the one in flight
+	send("fresh-session", "quick three")
+	wg.Wait()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read invocation log: %v", err)
+	}
+	got := strings.Join(strings.Split(strings.TrimSpace(string(data)), "\n"), ", ")
+	if want := "start slow one, end slow one, start slow two, end slow two, start quick three, end quick three"; got != want {
+		t.Errorf("invocations = %q, want %q", got, want)
+	}
+}
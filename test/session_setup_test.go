@@ -0,0 +1,114 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/internal/config"
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestSetupSessionUsesConfiguredWorkDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	installFakeClaude(t)
+
+	// Nothing may be written to the home directory
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	workDir := t.TempDir()
+	database, sessionMgr, cleanup := setupTestEnvironmentWithConfig(t, func(cfg *config.Config) {
+		cfg.Session.WorkDir = workDir
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+
+	originDir := filepath.Join(t.TempDir(), "setup-repo")
+	runGit(t, filepath.Dir(originDir), "init", "--initial-branch=main", originDir)
+	if err := os.WriteFile(filepath.Join(originDir, "README.md"), []byte("# setup\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, originDir, "add", ".")
+	runGit(t, originDir, "commit", "-m", "Initial commit")
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := sessionMgr.StoreCredential(ctx, owner.ID, models.CredentialTypeAnthropic, "sk-ant-test"); err != nil {
+		t.Fatalf("Failed to store credential: %v", err)
+	}
+
+	session := &models.Session{
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          originDir,
+		BranchName:       "setup-feature",
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusStarting,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	var messages []string
+	sessionMgr.SetupSessionAsync(ctx, session, &models.CreateSessionRequest{
+		WorkspaceID:     "T123456",
+		CreatedByUserID: owner.ID,
+		ChannelID:       "C123456",
+		RepoURL:         originDir,
+		FromCommitish:   "main",
+		FeatureName:     "setup-feature",
+		ModelName:       models.ModelSonnet,
+	}, func(message string) {
+		messages = append(messages, message)
+	})
+
+	stored, err := database.GetSessionByID(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("Failed to get session: %v", err)
+	}
+	if stored.Status != models.SessionStatusActive {
+		t.Fatalf("session status = %s, want active; setup said:\n%s", stored.Status, strings.Join(messages, "\n"))
+	}
+
+	wantWorkTree := filepath.Join(workDir, "worktrees", strings.ToLower(originDir), fmt.Sprintf("setup-feature-%d", session.ID))
+	if stored.WorkTreePath != wantWorkTree {
+		t.Errorf("work tree path = %q, want %q", stored.WorkTreePath, wantWorkTree)
+	}
+
+	// Ending the session looks it up by its Claude session ID
+	byClaudeID, err := database.GetSession(ctx, stored.SessionID)
+	if err != nil {
+		t.Fatalf("Failed to get session by Claude session ID: %v", err)
+	}
+	if byClaudeID.WorkTreePath != wantWorkTree {
+		t.Errorf("work tree path by Claude session ID = %q, want %q", byClaudeID.WorkTreePath, wantWorkTree)
+	}
+	if _, err := os.Stat(filepath.Join(wantWorkTree, "README.md")); err != nil {
+		t.Errorf("work tree wasn't checked out: %v", err)
+	}
+	// A local repository's mirror is kept by its (lowercased) path
+	if _, err := os.Stat(filepath.Join(workDir, "repos", strings.ToLower(originDir))); err != nil {
+		t.Errorf("mirror wasn't cloned under the work dir: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".claude-bot")); !os.IsNotExist(err) {
+		t.Errorf("setup wrote to the home directory: %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestEndSessionCommitMessage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{name: "default", message: "", want: "CB Session claude-default-message changes"},
+		{name: "custom", message: "Fix the login redirect", want: "Fix the login redirect"},
+		{name: "multi-line", message: "Fix the login\nredirect\r\n\tfor SSO", want: "Fix the login redirect for SSO"},
+		{name: "too long", message: strings.Repeat("a", 250), want: strings.Repeat("a", 200)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			feature := strings.ReplaceAll(tt.name, " ", "-") + "-message"
+			originDir, workDir := createFixtureWorktree(t, feature)
+			session := &models.Session{
+				SessionID:        "claude-" + feature,
+				SlackWorkspaceID: "T123456",
+				SlackChannelID:   "C123456",
+				SlackThreadTS:    "1234567890." + feature,
+				RepoURL:          originDir,
+				BranchName:       feature,
+				WorkTreePath:     workDir,
+				ModelName:        models.ModelSonnet,
+				Status:           models.SessionStatusActive,
+			}
+			if err := database.CreateSession(ctx, session); err != nil {
+				t.Fatalf("Failed to create session: %v", err)
+			}
+			if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+				t.Fatalf("Failed to add owner: %v", err)
+			}
+
+			if err := sessionMgr.EndSession(ctx, session.SessionID, tt.message); err != nil {
+				t.Fatalf("EndSession() error = %v", err)
+			}
+
+			output, err := exec.Command("git", "--git-dir", originDir, "log", "-1", "--format=%B", feature).Output()
+			if err != nil {
+				t.Fatalf("the session's changes weren't pushed: %v", err)
+			}
+			if got := strings.TrimSpace(string(output)); got != tt.want {
+				t.Errorf("pushed commit message = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+// runGit runs a git command in dir, failing the test on error
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+}
+
+// createFixtureWorktree creates a clone of a local origin checked out on branch, with
+// one commit and one uncommitted file on top of main
+func createFixtureWorktree(t *testing.T, branch string) (originDir, workDir string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	root := t.TempDir()
+	originDir = filepath.Join(root, "origin.git")
+	workDir = filepath.Join(root, "work")
+
+	runGit(t, root, "init", "--bare", "--initial-branch=main", originDir)
+	runGit(t, root, "init", "--initial-branch=main", workDir)
+	runGit(t, workDir, "remote", "add", "origin", originDir)
+
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	writeFile("README.md", "# fixture\n")
+	runGit(t, workDir, "add", ".")
+	runGit(t, workDir, "commit", "-m", "Initial commit")
+	runGit(t, workDir, "push", "origin", "main")
+
+	runGit(t, workDir, "checkout", "-b", branch)
+	writeFile("feature.go", "package feature\n")
+	runGit(t, workDir, "add", ".")
+	runGit(t, workDir, "commit", "-m", "Add feature")
+
+	// Left for EndSession to commit
+	writeFile("feature_test.go", "package feature\n")
+
+	return originDir, workDir
+}
+
+func TestEndSessionRecordsSummary(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	owner, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+		SlackWorkspaceID: "T123456",
+		SlackUserID:      "U123456",
+		SlackUserName:    "testuser",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	originDir, workDir := createFixtureWorktree(t, "summary-feature")
+
+	session := &models.Session{
+		SessionID:        "claude-summary-feature",
+		SlackWorkspaceID: "T123456",
+		SlackChannelID:   "C123456",
+		SlackThreadTS:    "1234567890.123456",
+		RepoURL:          originDir,
+		BranchName:       "summary-feature",
+		WorkTreePath:     workDir,
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, session); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if err := database.AddUserToSession(ctx, session.ID, owner.ID, models.SessionRoleOwner); err != nil {
+		t.Fatalf("Failed to add owner: %v", err)
+	}
+
+	setupRequest, err := json.Marshal(&models.CreateSessionRequest{
+		RepoURL:       originDir,
+		FromCommitish: "main",
+		FeatureName:   "summary-feature",
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode setup request: %v", err)
+	}
+	if err := database.SaveSessionSetupRequest(ctx, session.ID, string(setupRequest)); err != nil {
+		t.Fatalf("Failed to save setup request: %v", err)
+	}
+	if _, err := database.AddSessionCostByID(ctx, session.ID, 0.75); err != nil {
+		t.Fatalf("Failed to set cost: %v", err)
+	}
+	for _, turns := range []int{2, 3} {
+		if err := database.AddSessionTurns(ctx, session.ID, turns); err != nil {
+			t.Fatalf("Failed to add turns: %v", err)
+		}
+	}
+
+	if err := sessionMgr.EndSession(ctx, session.SessionID, ""); err != nil {
+		t.Fatalf("EndSession() error = %v", err)
+	}
+
+	summary, err := sessionMgr.GetSessionSummary(ctx, session.ID)
+	if err != nil {
+		t.Fatalf("GetSessionSummary() error = %v", err)
+	}
+
+	if summary.Feature != "summary-feature" {
+		t.Errorf("Feature = %q, want %q", summary.Feature, "summary-feature")
+	}
+	if summary.Branch != "summary-feature" {
+		t.Errorf("Branch = %q, want %q", summary.Branch, "summary-feature")
+	}
+	if summary.RepoURL != originDir {
+		t.Errorf("RepoURL = %q, want %q", summary.RepoURL, originDir)
+	}
+	// The fixture's own commit plus the one EndSession makes for the uncommitted file
+	if summary.Commits != 2 {
+		t.Errorf("Commits = %d, want 2", summary.Commits)
+	}
+	if summary.FilesChanged != 2 {
+		t.Errorf("FilesChanged = %d, want 2", summary.FilesChanged)
+	}
+	// feature.go and feature_test.go, one line each
+	if summary.Insertions != 2 || summary.Deletions != 0 {
+		t.Errorf("lines changed = +%d/-%d, want +2/-0", summary.Insertions, summary.Deletions)
+	}
+	if summary.TotalCost != 0.75 {
+		t.Errorf("TotalCost = %v, want 0.75", summary.TotalCost)
+	}
+	if summary.Turns != 5 {
+		t.Errorf("Turns = %d, want 5", summary.Turns)
+	}
+	if summary.DurationSeconds < 0 {
+		t.Errorf("DurationSeconds = %d, want >= 0", summary.DurationSeconds)
+	}
+	if summary.PRURL != "" {
+		t.Errorf("PRURL = %q, want empty", summary.PRURL)
+	}
+
+	// The branch was pushed at the recorded commit and the work tree cleaned up
+	cmd := exec.Command("git", "rev-parse", "--verify", "refs/heads/summary-feature")
+	cmd.Dir = originDir
+	output, err := cmd.Output()
+	if err != nil {
+		t.Errorf("branch not pushed to origin: %v", err)
+	}
+	if summary.CommitSHA == "" || !strings.HasPrefix(string(output), summary.CommitSHA) {
+		t.Errorf("CommitSHA = %q, want the pushed head %s", summary.CommitSHA, output)
+	}
+	if _, err := os.Stat(workDir); !os.IsNotExist(err) {
+		t.Errorf("work tree still exists after EndSession")
+	}
+}
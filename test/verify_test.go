@@ -0,0 +1,127 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestVerifySessions(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	_, healthyDir := createFixtureWorktree(t, "healthy-feature")
+	_, otherBranchDir := createFixtureWorktree(t, "other-branch")
+
+	fixtures := []struct {
+		feature      string
+		workTreePath string
+		wantProblem  string // empty for a healthy session
+	}{
+		{feature: "healthy-feature", workTreePath: healthyDir},
+		{feature: "missing-feature", workTreePath: filepath.Join(t.TempDir(), "gone"), wantProblem: "doesn't exist"},
+		{feature: "plain-feature", workTreePath: t.TempDir(), wantProblem: "isn't a git repository"},
+		{feature: "deleted-feature", workTreePath: otherBranchDir, wantProblem: "branch deleted-feature doesn't exist"},
+	}
+
+	sessions := make(map[string]*models.Session)
+	for _, f := range fixtures {
+		session := &models.Session{
+			SessionID:        "claude-" + f.feature,
+			SlackWorkspaceID: "T123456",
+			SlackChannelID:   "C123456",
+			SlackThreadTS:    "1234567890." + f.feature,
+			RepoURL:          "https://github.com/test/repo",
+			BranchName:       f.feature,
+			WorkTreePath:     f.workTreePath,
+			ModelName:        models.ModelSonnet,
+			Status:           models.SessionStatusActive,
+		}
+		if err := database.CreateSession(ctx, session); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+		sessions[f.feature] = session
+	}
+
+	checkReport := func(t *testing.T, discrepancies []*models.SessionDiscrepancy, wantMarked bool) {
+		t.Helper()
+
+		byFeature := make(map[string]*models.SessionDiscrepancy)
+		for _, d := range discrepancies {
+			byFeature[d.Feature] = d
+		}
+		for _, f := range fixtures {
+			d := byFeature[f.feature]
+			if f.wantProblem == "" {
+				if d != nil {
+					t.Errorf("healthy session %s reported: %s", f.feature, d.Problem)
+				}
+				continue
+			}
+			if d == nil {
+				t.Errorf("session %s not reported, want %q", f.feature, f.wantProblem)
+				continue
+			}
+			if !strings.Contains(d.Problem, f.wantProblem) {
+				t.Errorf("session %s problem = %q, want it to contain %q", f.feature, d.Problem, f.wantProblem)
+			}
+			if d.Marked != wantMarked {
+				t.Errorf("session %s marked = %v, want %v", f.feature, d.Marked, wantMarked)
+			}
+		}
+	}
+
+	checkStatuses := func(t *testing.T, brokenStatus string) {
+		t.Helper()
+
+		for _, f := range fixtures {
+			stored, err := database.GetSessionByID(ctx, sessions[f.feature].ID)
+			if err != nil {
+				t.Fatalf("Failed to get session: %v", err)
+			}
+			want := brokenStatus
+			if f.wantProblem == "" {
+				want = models.SessionStatusActive
+			}
+			if stored.Status != want {
+				t.Errorf("session %s status = %s, want %s", f.feature, stored.Status, want)
+			}
+		}
+	}
+
+	t.Run("report only", func(t *testing.T) {
+		checked, discrepancies, err := sessionMgr.VerifySessions(ctx, false)
+		if err != nil {
+			t.Fatalf("VerifySessions() error = %v", err)
+		}
+		if checked != len(fixtures) {
+			t.Errorf("checked = %d, want %d", checked, len(fixtures))
+		}
+		checkReport(t, discrepancies, false)
+		checkStatuses(t, models.SessionStatusActive)
+	})
+
+	t.Run("mark broken sessions", func(t *testing.T) {
+		_, discrepancies, err := sessionMgr.VerifySessions(ctx, true)
+		if err != nil {
+			t.Fatalf("VerifySessions() error = %v", err)
+		}
+		checkReport(t, discrepancies, true)
+		checkStatuses(t, models.SessionStatusError)
+	})
+
+	t.Run("only healthy sessions remain active", func(t *testing.T) {
+		checked, discrepancies, err := sessionMgr.VerifySessions(ctx, false)
+		if err != nil {
+			t.Fatalf("VerifySessions() error = %v", err)
+		}
+		if checked != 1 || len(discrepancies) != 0 {
+			t.Errorf("VerifySessions() = %d, %v, want 1 healthy session", checked, discrepancies)
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pbdeuchler/claude-bot/pkg/models"
+)
+
+func TestSessionsIsolatedAcrossWorkspaces(t *testing.T) {
+	database, sessionMgr, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Channel and thread IDs are only unique within a workspace
+	const channelID = "C123456"
+	const threadTS = "1234567890.123456"
+
+	sessionsByWorkspace := make(map[string]*models.Session)
+	for _, workspaceID := range []string{"T111111", "T222222"} {
+		user, err := sessionMgr.CreateOrUpdateUser(ctx, &models.CreateUserRequest{
+			SlackWorkspaceID: workspaceID,
+			SlackUserID:      "U123456",
+			SlackUserName:    "testuser",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create user in %s: %v", workspaceID, err)
+		}
+
+		session := &models.Session{
+			SessionID:        "claude-session-" + workspaceID,
+			SlackWorkspaceID: workspaceID,
+			SlackChannelID:   channelID,
+			SlackThreadTS:    threadTS,
+			RepoURL:          "https://github.com/test/repo",
+			BranchName:       "feature-" + workspaceID,
+			WorkTreePath:     "/tmp/feature-" + workspaceID,
+			ModelName:        models.ModelSonnet,
+			Status:           models.SessionStatusActive,
+		}
+		if err := database.CreateSession(ctx, session); err != nil {
+			t.Fatalf("Failed to create session in %s: %v", workspaceID, err)
+		}
+		if err := database.AddUserToSession(ctx, session.ID, user.ID, models.SessionRoleOwner); err != nil {
+			t.Fatalf("Failed to add owner in %s: %v", workspaceID, err)
+		}
+		sessionsByWorkspace[workspaceID] = session
+	}
+
+	for workspaceID, want := range sessionsByWorkspace {
+		got, err := sessionMgr.GetActiveSessionForChannel(ctx, workspaceID, channelID, threadTS)
+		if err != nil {
+			t.Fatalf("Failed to get active session in %s: %v", workspaceID, err)
+		}
+		if got.ID != want.ID {
+			t.Errorf("Workspace %s resolved session %d, want %d", workspaceID, got.ID, want.ID)
+		}
+	}
+
+	// Ending one workspace's session leaves the other untouched
+	if err := database.UpdateSessionStatusByID(ctx, sessionsByWorkspace["T111111"].ID, models.SessionStatusEnded); err != nil {
+		t.Fatalf("Failed to end session: %v", err)
+	}
+	if _, err := sessionMgr.GetActiveSessionForChannel(ctx, "T111111", channelID, threadTS); !errors.Is(err, models.ErrNoActiveSession) {
+		t.Errorf("Expected no active session in T111111, got error %v", err)
+	}
+	if _, err := sessionMgr.GetActiveSessionForChannel(ctx, "T222222", channelID, threadTS); err != nil {
+		t.Errorf("Expected T222222 session to remain active, got error %v", err)
+	}
+
+	// Within a workspace the channel/thread is still unique
+	duplicate := &models.Session{
+		SlackWorkspaceID: "T222222",
+		SlackChannelID:   channelID,
+		SlackThreadTS:    threadTS,
+		RepoURL:          "https://github.com/test/repo",
+		BranchName:       "feature-duplicate",
+		WorkTreePath:     "/tmp/feature-duplicate",
+		ModelName:        models.ModelSonnet,
+		Status:           models.SessionStatusActive,
+	}
+	if err := database.CreateSession(ctx, duplicate); err == nil {
+		t.Error("Expected error creating a second session in the same workspace thread")
+	}
+}